@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"strconv"
@@ -18,8 +19,10 @@ import (
 	"github.com/noteduco342/OMMessenger-backend/internal/httpx"
 	"github.com/noteduco342/OMMessenger-backend/internal/middleware"
 	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"github.com/noteduco342/OMMessenger-backend/internal/scanner"
 	"github.com/noteduco342/OMMessenger-backend/internal/service"
 	"github.com/noteduco342/OMMessenger-backend/internal/storage"
+	"github.com/noteduco342/OMMessenger-backend/internal/unfurl"
 )
 
 func main() {
@@ -36,8 +39,8 @@ func main() {
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
 		AppName: "OM Messenger Backend",
-		// Support avatar uploads up to 5MB + overhead.
-		BodyLimit: 8 * 1024 * 1024, // 8MB
+		// Support attachment uploads up to 20MB (ATTACHMENT_MAX_BYTES) + overhead.
+		BodyLimit: 24 * 1024 * 1024, // 24MB
 	})
 
 	// Middleware
@@ -79,6 +82,7 @@ func main() {
 
 	messageCache := cache.NewMessageCache(redisCache)
 	userCache := cache.NewUserCache(redisCache)
+	groupCache := cache.NewGroupCache(redisCache)
 
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db)
@@ -86,39 +90,79 @@ func main() {
 	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
 	groupRepo := repository.NewGroupRepository(db)
 	groupInviteRepo := repository.NewGroupInviteRepository(db)
+	groupAuditRepo := repository.NewGroupAuditRepository(db)
 	groupReadStateRepo := repository.NewGroupReadStateRepository(db)
 	pendingMessageRepo := repository.NewPendingMessageRepository(db)
 	versionRepo := repository.NewVersionRepository(db)
+	mediaReferenceRepo := repository.NewMediaReferenceRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
+	storageRepo := repository.NewStorageRepository(db)
+	scheduledMessageRepo := repository.NewScheduledMessageRepository(db)
+	directChatSettingsRepo := repository.NewDirectChatSettingsRepository(db)
 
 	// Initialize services
 	authService := service.NewAuthService(userRepo, refreshTokenRepo, groupRepo)
 	userService := service.NewUserService(userRepo, groupRepo)
 	messageService := service.NewMessageService(messageRepo)
 	groupService := service.NewGroupService(groupRepo, groupReadStateRepo, userRepo, groupInviteRepo)
+	groupService.EnableMemberCache(groupCache)
+	groupService.SetMemberLimits(service.LoadMemberLimitsFromEnv())
+	groupService.EnableAuditLog(groupAuditRepo)
+	groupService.EnableRateLimits(groupCache, service.LoadFloodLimitFromEnv())
 	versionService := service.NewVersionService(versionRepo)
 
-	// Initialize S3/MinIO storage (best-effort; feature endpoints return 503 if missing)
-	var s3Store *storage.S3Storage
-	if cfg, err := storage.LoadS3ConfigFromEnv(); err != nil {
-		log.Printf("WARNING: S3 storage not configured: %v", err)
-	} else if st, err := storage.NewS3Storage(cfg); err != nil {
-		log.Printf("WARNING: Failed to initialize S3 storage: %v", err)
+	// Initialize blob storage (best-effort; feature endpoints return 503 if missing).
+	// STORAGE_BACKEND selects s3 (MinIO), fs or memory.
+	var blobStore storage.BlobStore
+	if st, backend, err := storage.NewBlobStoreFromEnv(); err != nil {
+		log.Printf("WARNING: Blob storage not configured (backend=%q): %v", backend, err)
 	} else {
-		s3Store = st
-		log.Printf("S3 storage initialized successfully (bucket=%s)", cfg.Bucket)
+		blobStore = st
+		log.Printf("Blob storage initialized successfully (backend=%s)", backend)
 	}
 
-	avatarService := service.NewAvatarService(userRepo, s3Store)
+	storageService := service.NewStorageService(storageRepo)
+	avatarService := service.NewAvatarService(userRepo, groupRepo, blobStore, storageService)
+	// Malware scanning is enabled by CLAMD_ADDR; without it uploads are served unscanned.
+	fileScanner := scanner.NewScannerFromEnv()
+	if fileScanner == nil {
+		log.Printf("WARNING: Malware scanning disabled (CLAMD_ADDR not set)")
+	}
+	scanService := service.NewScanService(attachmentRepo, blobStore, fileScanner)
+	go scanService.Start(context.Background())
+	attachmentService := service.NewAttachmentService(attachmentRepo, blobStore, storageService, scanService)
+	groupService.EnableAttachmentCleanup(attachmentService)
+	expiryService := service.NewMessageExpiryService(messageRepo, groupRepo, directChatSettingsRepo, userRepo, attachmentService, service.LoadMessageExpiryConfigFromEnv())
+	messageService.EnableExpiry(expiryService)
+	messageService.EnableMentions(groupService)
+	linkPreviewConfig := service.LoadLinkPreviewConfigFromEnv()
+	linkPreviewService := service.NewLinkPreviewService(messageRepo, unfurl.NewHTTPFetcher(linkPreviewConfig.Timeout), blobStore, cache.NewLinkPreviewCache(redisCache), linkPreviewConfig)
+	messageService.EnableLinkPreviews(linkPreviewService)
+	mediaGCService := service.NewMediaGCService(blobStore, mediaReferenceRepo, service.LoadMediaGCConfigFromEnv())
+	go mediaGCService.Start(context.Background())
 
 	// Initialize handlers
-	wsHandler := handlers.NewWebSocketHandler(messageService, userService, groupService, pendingMessageRepo, userCache, messageCache)
+	wsHandler := handlers.NewWebSocketHandler(messageService, userService, groupService, attachmentService, pendingMessageRepo, userCache, messageCache)
 	authHandler := handlers.NewAuthHandler(authService)
 	userHandler := handlers.NewUserHandler(userService)
 	avatarHandler := handlers.NewAvatarHandler(avatarService)
-	mediaHandler := handlers.NewMediaHandler(s3Store)
-	messageHandler := handlers.NewMessageHandler(messageService, groupService, messageCache, wsHandler.GetHub())
-	groupHandler := handlers.NewGroupHandler(groupService)
+	mediaHandler := handlers.NewMediaHandler(blobStore, attachmentService)
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentService)
+	messageHandler := handlers.NewMessageHandler(messageService, groupService, attachmentService, messageCache, wsHandler.GetHub(), wsHandler.GetDelivery())
+	groupHandler := handlers.NewGroupHandler(groupService, avatarService, wsHandler.GetHub())
+	groupService.EnableSystemMessages(messageRepo, wsHandler.GetDelivery())
+	scheduledService := service.NewScheduledMessageService(scheduledMessageRepo, messageService, groupService, attachmentService, userRepo, service.LoadSchedulerConfigFromEnv())
+	scheduledService.EnableDelivery(wsHandler.GetDelivery())
+	go scheduledService.Start(context.Background())
+	scheduledMessageHandler := handlers.NewScheduledMessageHandler(scheduledService)
+	expiryService.EnableDelivery(wsHandler.GetDelivery())
+	go expiryService.Start(context.Background())
+	linkPreviewService.EnableDelivery(wsHandler.GetDelivery())
+	go linkPreviewService.Start(context.Background())
+	chatSettingsHandler := handlers.NewChatSettingsHandler(expiryService, wsHandler.GetHub())
 	versionHandler := handlers.NewVersionHandler(versionService)
+	adminHandler := handlers.NewAdminHandler(mediaGCService, storageService)
+	storageHandler := handlers.NewStorageHandler(storageService)
 
 	// Public routes
 	api := app.Group("/api", middleware.OriginAllowed())
@@ -157,15 +201,26 @@ func main() {
 		avatarHandler.UploadMyAvatar,
 	)
 	protected.Delete("/users/me/avatar", avatarHandler.DeleteMyAvatar)
+	protected.Get("/users/me/storage", storageHandler.GetMyStorage)
 	protected.Get("/media/avatars/*", mediaHandler.GetAvatar)
+	protected.Get("/media/previews/*", mediaHandler.GetLinkPreviewImage)
+	protected.Post("/media/attachments", attachmentHandler.UploadAttachment)
+	protected.Get("/media/attachments/:id", mediaHandler.GetAttachment)
+	protected.Delete("/media/attachments/:id", attachmentHandler.DeleteAttachment)
 	protected.Get("/users/search", userHandler.SearchUsers)
 	protected.Get("/users/:identifier", userHandler.GetUser)
 	protected.Get("/conversations", messageHandler.GetConversations)
 	protected.Get("/conversations/peers", messageHandler.GetRecentPeers)
 	protected.Post("/conversations/:peer_id/read", messageHandler.MarkConversationRead)
+	protected.Get("/conversations/:peer_id/settings", chatSettingsHandler.GetSettings)
+	protected.Put("/conversations/:peer_id/settings", chatSettingsHandler.UpdateSettings)
 	protected.Get("/messages", messageHandler.GetMessages)
 	protected.Post("/messages", messageHandler.SendMessage)
 	protected.Post("/messages/sync", messageHandler.SyncMessages)
+	protected.Get("/scheduled-messages", scheduledMessageHandler.ListScheduled)
+	protected.Post("/scheduled-messages", scheduledMessageHandler.ScheduleMessage)
+	protected.Put("/scheduled-messages/:id", scheduledMessageHandler.UpdateScheduled)
+	protected.Delete("/scheduled-messages/:id", scheduledMessageHandler.CancelScheduled)
 
 	// Group routes
 	protected.Post("/groups", groupHandler.CreateGroup)
@@ -176,12 +231,44 @@ func main() {
 	protected.Post("/groups/:id/join", groupHandler.JoinGroup)
 	protected.Post("/groups/:id/leave", groupHandler.LeaveGroup)
 	protected.Get("/groups/:id/members", groupHandler.GetGroupMembers)
+	protected.Put("/groups/:id", groupHandler.UpdateGroup)
+	protected.Delete("/groups/:id", groupHandler.DeleteGroup)
+	protected.Post("/groups/:id/owner", groupHandler.TransferOwnership)
+	protected.Post("/groups/:id/icon", groupHandler.UploadGroupIcon)
+	protected.Delete("/groups/:id/icon", groupHandler.DeleteGroupIcon)
+	protected.Put("/groups/:id/permissions", groupHandler.UpdatePermissions)
+	protected.Put("/groups/:id/members/:userId/role", groupHandler.SetMemberRole)
+	protected.Delete("/groups/:id/members/:userId", groupHandler.RemoveMember)
+	protected.Get("/groups/:id/bans", groupHandler.ListBans)
+	protected.Post("/groups/:id/bans", groupHandler.BanMember)
+	protected.Delete("/groups/:id/bans/:userId", groupHandler.UnbanMember)
+	protected.Get("/groups/:id/audit-log", groupHandler.GetAuditLog)
+	protected.Get("/groups/:id/topics", groupHandler.ListTopics)
+	protected.Post("/groups/:id/topics", groupHandler.CreateTopic)
+	protected.Put("/groups/:id/topics/:topicId", groupHandler.UpdateTopic)
+	protected.Get("/groups/:id/join-requests", groupHandler.ListJoinRequests)
+	protected.Post("/groups/:id/join-requests/:requestId/approve", groupHandler.ApproveJoinRequest)
+	protected.Post("/groups/:id/join-requests/:requestId/decline", groupHandler.DeclineJoinRequest)
+	protected.Get("/groups/:id/invite-links", groupHandler.ListInviteLinks)
 	protected.Post("/groups/:id/invite-links", groupHandler.CreateInviteLink)
+	protected.Put("/groups/:id/invite-links/:linkId", groupHandler.UpdateInviteLink)
+	protected.Delete("/groups/:id/invite-links/:linkId", groupHandler.RevokeInviteLink)
+	protected.Get("/groups/:id/invite-links/:linkId/uses", groupHandler.ListInviteLinkUses)
 	protected.Post("/join/:token", groupHandler.JoinByInviteLink)
 	protected.Get("/groups/:id/messages", messageHandler.GetGroupMessages)
 	protected.Post("/groups/:id/messages", messageHandler.SendGroupMessage)
 	protected.Post("/groups/:id/read", messageHandler.MarkGroupRead)
 	protected.Get("/groups/:id/read-state", messageHandler.GetGroupReadState)
+	protected.Get("/groups/:id/mentions/next", messageHandler.GetNextMention)
+
+	// Admin routes
+	admin := protected.Group("/admin", middleware.RequireRole("admin"))
+	admin.Post("/media/gc", adminHandler.RunMediaGC)
+	admin.Get("/storage/plans", adminHandler.ListStoragePlans)
+	admin.Post("/storage/plans", adminHandler.CreateStoragePlan)
+	admin.Put("/storage/plans/:id", adminHandler.UpdateStoragePlan)
+	admin.Get("/users/:id/storage", adminHandler.GetUserStorage)
+	admin.Put("/users/:id/storage-plan", adminHandler.AssignStoragePlan)
 
 	// WebSocket route (websocket upgrade needs special handling)
 	app.Use(
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// GroupMembersTTL bounds how long a missed invalidation can go unnoticed.
+	GroupMembersTTL = 10 * time.Minute
+)
+
+// GroupCache handles group-related caching
+type GroupCache struct {
+	redis *RedisCache
+}
+
+// NewGroupCache creates a new group cache
+func NewGroupCache(redis *RedisCache) *GroupCache {
+	return &GroupCache{redis: redis}
+}
+
+func groupMembersKey(groupID uint) string {
+	return fmt.Sprintf("group_members:%d", groupID)
+}
+
+// GetMemberIDs retrieves the cached member IDs of a group
+func (gc *GroupCache) GetMemberIDs(groupID uint) ([]uint, bool) {
+	if gc == nil || gc.redis == nil {
+		return nil, false
+	}
+	data, err := gc.redis.Get(groupMembersKey(groupID))
+	if err != nil || data == nil {
+		return nil, false
+	}
+
+	var ids []uint
+	if err := msgpack.Unmarshal(data, &ids); err != nil {
+		return nil, false
+	}
+	return ids, true
+}
+
+// SetMemberIDs caches the member IDs of a group
+func (gc *GroupCache) SetMemberIDs(groupID uint, ids []uint) error {
+	if gc == nil || gc.redis == nil {
+		return nil
+	}
+	data, err := msgpack.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	return gc.redis.Set(groupMembersKey(groupID), data, GroupMembersTTL)
+}
+
+// InvalidateMemberIDs removes the cached member IDs of a group
+func (gc *GroupCache) InvalidateMemberIDs(groupID uint) error {
+	if gc == nil || gc.redis == nil {
+		return nil
+	}
+	return gc.redis.Delete(groupMembersKey(groupID))
+}
+
+// TakeSlowModeSlot claims the user's next message slot in a slow-mode group.
+// It returns how long the user still has to wait, or 0 if the slot was free.
+func (gc *GroupCache) TakeSlowModeSlot(groupID, userID uint, interval time.Duration) (time.Duration, error) {
+	if gc == nil || gc.redis == nil {
+		return 0, nil
+	}
+	key := fmt.Sprintf("slowmode:%d:%d", groupID, userID)
+	ok, err := gc.redis.SetNX(key, []byte("1"), interval)
+	if err != nil || ok {
+		return 0, err
+	}
+	return gc.redis.TTL(key)
+}
+
+// CountGroupMessage counts a message towards the user's flood window in the
+// group, returning the count so far and the time left in the window.
+func (gc *GroupCache) CountGroupMessage(groupID, userID uint, window time.Duration) (int64, time.Duration, error) {
+	if gc == nil || gc.redis == nil {
+		return 0, 0, nil
+	}
+	return gc.redis.IncrWindow(fmt.Sprintf("flood:%d:%d", groupID, userID), window)
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// LinkPreviewCache keeps unfurled link previews, so a link shared in many
+// conversations is fetched once.
+type LinkPreviewCache struct {
+	redis *RedisCache
+}
+
+// NewLinkPreviewCache creates a new link preview cache
+func NewLinkPreviewCache(redis *RedisCache) *LinkPreviewCache {
+	return &LinkPreviewCache{redis: redis}
+}
+
+// linkPreviewEntry wraps a preview so that pages without one are cached too.
+type linkPreviewEntry struct {
+	Preview *models.LinkPreview
+}
+
+func linkPreviewKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return "link_preview:" + hex.EncodeToString(sum[:])
+}
+
+// GetLinkPreview returns the cached preview of url. found is true with a nil
+// preview when the page is known to have none.
+func (lc *LinkPreviewCache) GetLinkPreview(url string) (*models.LinkPreview, bool) {
+	if lc == nil || lc.redis == nil {
+		return nil, false
+	}
+	data, err := lc.redis.Get(linkPreviewKey(url))
+	if err != nil || data == nil {
+		return nil, false
+	}
+	var entry linkPreviewEntry
+	if err := msgpack.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	return entry.Preview, true
+}
+
+// SetLinkPreview caches the preview of url, or its absence when preview is nil.
+func (lc *LinkPreviewCache) SetLinkPreview(url string, preview *models.LinkPreview, ttl time.Duration) error {
+	if lc == nil || lc.redis == nil {
+		return nil
+	}
+	data, err := msgpack.Marshal(linkPreviewEntry{Preview: preview})
+	if err != nil {
+		return err
+	}
+	return lc.redis.Set(linkPreviewKey(url), data, ttl)
+}
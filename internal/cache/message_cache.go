@@ -82,12 +82,38 @@ func (mc *MessageCache) SetConversation(userID1, userID2 uint, messages []models
 		return nil
 	}
 	key := conversationKey(userID1, userID2)
+	ttl := pageTTL(messages, time.Now())
+	if ttl <= 0 {
+		return mc.redis.Delete(key)
+	}
 	data, err := msgpack.Marshal(messages)
 	if err != nil {
 		return err
 	}
 
-	return mc.redis.Set(key, data, ConversationTTL)
+	return mc.redis.Set(key, data, ttl)
+}
+
+// pageTTL caps how long a page of messages is cached at the earliest moment
+// one of its disappearing messages can expire. A timer that starts on first
+// read may start right after caching, so such messages count from now.
+func pageTTL(messages []models.Message, now time.Time) time.Duration {
+	ttl := ConversationTTL
+	for _, m := range messages {
+		var left time.Duration
+		switch {
+		case m.ExpiresAt != nil:
+			left = m.ExpiresAt.Sub(now)
+		case m.TTLSeconds > 0:
+			left = time.Duration(m.TTLSeconds) * time.Second
+		default:
+			continue
+		}
+		if left < ttl {
+			ttl = left
+		}
+	}
+	return ttl
 }
 
 // SetGroupConversation caches group messages
@@ -96,12 +122,16 @@ func (mc *MessageCache) SetGroupConversation(groupID uint, messages []models.Mes
 		return nil
 	}
 	key := groupConversationKey(groupID)
+	ttl := pageTTL(messages, time.Now())
+	if ttl <= 0 {
+		return mc.redis.Delete(key)
+	}
 	data, err := msgpack.Marshal(messages)
 	if err != nil {
 		return err
 	}
 
-	return mc.redis.Set(key, data, ConversationTTL)
+	return mc.redis.Set(key, data, ttl)
 }
 
 // InvalidateConversation removes conversation from cache
@@ -197,6 +227,19 @@ func (mc *MessageCache) InvalidateConversationList(userID uint) error {
 	return mc.redis.Delete(key)
 }
 
+// InvalidateConversationLists removes the conversation lists of many users
+// at once, e.g. everyone in a group that just got a message
+func (mc *MessageCache) InvalidateConversationLists(userIDs []uint) error {
+	if mc == nil || mc.redis == nil || len(userIDs) == 0 {
+		return nil
+	}
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = fmt.Sprintf("convlist:%d", id)
+	}
+	return mc.redis.DeleteMany(keys...)
+}
+
 // GetUnreadCount retrieves cached unread count
 func (mc *MessageCache) GetUnreadCount(userID uint, otherUserID uint) (int, bool) {
 	if mc == nil || mc.redis == nil {
@@ -44,6 +44,14 @@ func (c *RedisCache) Delete(key string) error {
 	return c.client.Del(c.ctx, key).Err()
 }
 
+// DeleteMany removes several keys in one round trip
+func (c *RedisCache) DeleteMany(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.client.Del(c.ctx, keys...).Err()
+}
+
 // DeletePattern removes all keys matching a pattern
 func (c *RedisCache) DeletePattern(pattern string) error {
 	iter := c.client.Scan(c.ctx, 0, pattern, 0).Iterator()
@@ -61,6 +69,33 @@ func (c *RedisCache) Exists(key string) bool {
 	return count > 0
 }
 
+// SetNX stores a value only if the key doesn't exist yet, reporting whether it did
+func (c *RedisCache) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	return c.client.SetNX(c.ctx, key, value, ttl).Result()
+}
+
+// TTL returns the remaining time to live of a key
+func (c *RedisCache) TTL(key string) (time.Duration, error) {
+	return c.client.PTTL(c.ctx, key).Result()
+}
+
+// IncrWindow increments a counter that expires window after its first
+// increment, returning the new count and the time left in the window
+func (c *RedisCache) IncrWindow(key string, window time.Duration) (int64, time.Duration, error) {
+	var incr *redis.IntCmd
+	var ttl *redis.DurationCmd
+	_, err := c.client.TxPipelined(c.ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(c.ctx, key)
+		pipe.ExpireNX(c.ctx, key, window)
+		ttl = pipe.PTTL(c.ctx, key)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return incr.Val(), ttl.Val(), nil
+}
+
 // SetAdd adds members to a Redis set
 func (c *RedisCache) SetAdd(key string, members ...interface{}) error {
 	return c.client.SAdd(c.ctx, key, members...).Err()
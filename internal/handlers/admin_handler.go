@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/noteduco342/OMMessenger-backend/internal/httpx"
+	"github.com/noteduco342/OMMessenger-backend/internal/service"
+)
+
+type AdminHandler struct {
+	mediaGC        *service.MediaGCService
+	storageService *service.StorageService
+}
+
+func NewAdminHandler(mediaGC *service.MediaGCService, storageService *service.StorageService) *AdminHandler {
+	return &AdminHandler{mediaGC: mediaGC, storageService: storageService}
+}
+
+type AssignStoragePlanRequest struct {
+	// PlanID nil reverts the user to the default plan.
+	PlanID *uint `json:"plan_id"`
+}
+
+// RunMediaGC runs the orphaned media collector once and returns its report.
+// Dry-run is the default; pass ?dry_run=false to actually delete.
+// POST /api/admin/media/gc
+func (h *AdminHandler) RunMediaGC(c *fiber.Ctx) error {
+	dryRun := c.QueryBool("dry_run", true)
+
+	report, err := h.mediaGC.Run(c.Context(), dryRun)
+	if err != nil {
+		if errors.Is(err, service.ErrStorageNotConfigured) {
+			return httpx.Error(c, fiber.StatusServiceUnavailable, "storage_not_configured", "Storage not configured")
+		}
+		if errors.Is(err, service.ErrMediaGCRunning) {
+			return httpx.Error(c, fiber.StatusConflict, "media_gc_running", "Media GC is already running")
+		}
+		return httpx.Internal(c, "media_gc_failed")
+	}
+
+	return c.JSON(report)
+}
+
+// ListStoragePlans returns every storage plan.
+// GET /api/admin/storage/plans
+func (h *AdminHandler) ListStoragePlans(c *fiber.Ctx) error {
+	plans, err := h.storageService.ListPlans()
+	if err != nil {
+		return httpx.Internal(c, "list_storage_plans_failed")
+	}
+	return c.JSON(fiber.Map{"plans": plans})
+}
+
+// CreateStoragePlan adds a plan.
+// POST /api/admin/storage/plans
+func (h *AdminHandler) CreateStoragePlan(c *fiber.Ctx) error {
+	var input service.StoragePlanInput
+	if err := c.BodyParser(&input); err != nil {
+		return httpx.BadRequest(c, "invalid_request_body", "Invalid request body")
+	}
+
+	plan, err := h.storageService.CreatePlan(input)
+	if err != nil {
+		return storagePlanError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(plan)
+}
+
+// UpdateStoragePlan replaces a plan's limits. Lowering a quota does not delete
+// anything; users over the new limit just can't upload until they free space.
+// PUT /api/admin/storage/plans/:id
+func (h *AdminHandler) UpdateStoragePlan(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || id == 0 {
+		return httpx.BadRequest(c, "invalid_plan_id", "Invalid plan id")
+	}
+
+	var input service.StoragePlanInput
+	if err := c.BodyParser(&input); err != nil {
+		return httpx.BadRequest(c, "invalid_request_body", "Invalid request body")
+	}
+
+	plan, err := h.storageService.UpdatePlan(uint(id), input)
+	if err != nil {
+		return storagePlanError(c, err)
+	}
+	return c.JSON(plan)
+}
+
+// AssignStoragePlan moves a user onto a plan.
+// PUT /api/admin/users/:id/storage-plan
+func (h *AdminHandler) AssignStoragePlan(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || userID == 0 {
+		return httpx.BadRequest(c, "invalid_user_id", "Invalid user id")
+	}
+
+	var input AssignStoragePlanRequest
+	if err := c.BodyParser(&input); err != nil {
+		return httpx.BadRequest(c, "invalid_request_body", "Invalid request body")
+	}
+
+	if err := h.storageService.AssignPlan(uint(userID), input.PlanID); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return httpx.Error(c, fiber.StatusNotFound, "user_not_found", "User not found")
+		}
+		return storagePlanError(c, err)
+	}
+
+	usage, err := h.storageService.Usage(uint(userID))
+	if err != nil {
+		return httpx.Internal(c, "get_storage_usage_failed")
+	}
+	return c.JSON(usage)
+}
+
+// GetUserStorage returns any user's storage usage.
+// GET /api/admin/users/:id/storage
+func (h *AdminHandler) GetUserStorage(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || userID == 0 {
+		return httpx.BadRequest(c, "invalid_user_id", "Invalid user id")
+	}
+
+	usage, err := h.storageService.Usage(uint(userID))
+	if err != nil {
+		return httpx.Internal(c, "get_storage_usage_failed")
+	}
+	return c.JSON(usage)
+}
+
+func storagePlanError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrInvalidStoragePlan) {
+		return httpx.BadRequest(c, "invalid_storage_plan", "Name and a positive quota_bytes are required")
+	}
+	if errors.Is(err, service.ErrStoragePlanNameTaken) {
+		return httpx.Error(c, fiber.StatusConflict, "storage_plan_name_taken", "Plan name already taken")
+	}
+	if errors.Is(err, service.ErrStoragePlanNotFound) {
+		return httpx.Error(c, fiber.StatusNotFound, "storage_plan_not_found", "Storage plan not found")
+	}
+	return httpx.Internal(c, "storage_plan_failed")
+}
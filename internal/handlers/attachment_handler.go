@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/noteduco342/OMMessenger-backend/internal/httpx"
+	"github.com/noteduco342/OMMessenger-backend/internal/service"
+)
+
+type AttachmentHandler struct {
+	attachmentService *service.AttachmentService
+}
+
+func NewAttachmentHandler(attachmentService *service.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{attachmentService: attachmentService}
+}
+
+// UploadAttachment stores a file the user can then reference via attachment_id
+// when sending a message.
+// POST /api/media/attachments (multipart field "file")
+func (h *AttachmentHandler) UploadAttachment(c *fiber.Ctx) error {
+	userID, err := httpx.LocalUint(c, "userID")
+	if err != nil {
+		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return httpx.BadRequest(c, "missing_file", "file is required")
+	}
+	if err := h.attachmentService.CheckUpload(userID, fileHeader.Size); err != nil {
+		return attachmentUploadError(c, err)
+	}
+
+	f, err := fileHeader.Open()
+	if err != nil {
+		return httpx.BadRequest(c, "invalid_file", "Invalid file upload")
+	}
+	defer f.Close()
+
+	att, err := h.attachmentService.Upload(c.Context(), userID, fileHeader.Filename, f)
+	if err != nil {
+		return attachmentUploadError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(att.ToResponse())
+}
+
+func attachmentUploadError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrStorageNotConfigured) {
+		return httpx.Error(c, fiber.StatusServiceUnavailable, "storage_not_configured", "Storage not configured")
+	}
+	if errors.Is(err, service.ErrAttachmentTooLarge) {
+		return httpx.Error(c, fiber.StatusRequestEntityTooLarge, "attachment_too_large", "Attachment is too large")
+	}
+	if errors.Is(err, service.ErrStorageQuotaExceeded) {
+		return httpx.Error(c, fiber.StatusRequestEntityTooLarge, "storage_quota_exceeded", "Storage quota exceeded")
+	}
+	if errors.Is(err, service.ErrAttachmentEmpty) {
+		return httpx.BadRequest(c, "attachment_empty", "File is empty")
+	}
+	if errors.Is(err, service.ErrAttachmentInfected) {
+		return httpx.Error(c, fiber.StatusUnprocessableEntity, "attachment_infected", "File failed malware scan")
+	}
+	return httpx.Internal(c, "attachment_upload_failed")
+}
+
+// DeleteAttachment removes one of the user's uploads.
+// DELETE /api/media/attachments/:id
+func (h *AttachmentHandler) DeleteAttachment(c *fiber.Ctx) error {
+	userID, err := httpx.LocalUint(c, "userID")
+	if err != nil {
+		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || id == 0 {
+		return httpx.BadRequest(c, "invalid_attachment_id", "Invalid attachment id")
+	}
+
+	if err := h.attachmentService.Delete(c.Context(), userID, uint(id)); err != nil {
+		if errors.Is(err, service.ErrStorageNotConfigured) {
+			return httpx.Error(c, fiber.StatusServiceUnavailable, "storage_not_configured", "Storage not configured")
+		}
+		if errors.Is(err, service.ErrAttachmentNotFound) {
+			return httpx.Error(c, fiber.StatusNotFound, "attachment_not_found", "Attachment not found")
+		}
+		if errors.Is(err, service.ErrAttachmentForbidden) {
+			return httpx.Forbidden(c, "not_attachment_owner", "Not your attachment")
+		}
+		return httpx.Internal(c, "attachment_delete_failed")
+	}
+
+	return c.JSON(fiber.Map{"message": "Attachment deleted"})
+}
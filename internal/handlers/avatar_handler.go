@@ -58,6 +58,9 @@ func (h *AvatarHandler) UploadMyAvatar(c *fiber.Ctx) error {
 		if errors.Is(err, storage.ErrInvalidImage) {
 			return httpx.BadRequest(c, "avatar_invalid", "Invalid image")
 		}
+		if errors.Is(err, service.ErrStorageQuotaExceeded) {
+			return httpx.Error(c, fiber.StatusRequestEntityTooLarge, "storage_quota_exceeded", "Storage quota exceeded")
+		}
 		return httpx.Internal(c, "avatar_upload_failed")
 	}
 
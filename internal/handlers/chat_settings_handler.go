@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/noteduco342/OMMessenger-backend/internal/handlers/ws"
+	"github.com/noteduco342/OMMessenger-backend/internal/httpx"
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/service"
+)
+
+// ChatSettingsHandler serves the settings shared by both participants of a
+// direct conversation.
+type ChatSettingsHandler struct {
+	expiryService *service.MessageExpiryService
+	hub           *ws.Hub
+}
+
+func NewChatSettingsHandler(expiryService *service.MessageExpiryService, hub *ws.Hub) *ChatSettingsHandler {
+	return &ChatSettingsHandler{expiryService: expiryService, hub: hub}
+}
+
+type UpdateChatSettingsRequest struct {
+	MessageTTLSeconds int                   `json:"message_ttl_seconds"`
+	MessageTTLMode    models.MessageTTLMode `json:"message_ttl_mode"`
+}
+
+func peerIDParam(c *fiber.Ctx) (uint, error) {
+	id, err := strconv.ParseUint(c.Params("peer_id"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, errors.New("invalid peer_id")
+	}
+	return uint(id), nil
+}
+
+// GetSettings returns the conversation's disappearing message timer.
+// GET /api/conversations/:peer_id/settings
+func (h *ChatSettingsHandler) GetSettings(c *fiber.Ctx) error {
+	userID, err := httpx.LocalUint(c, "userID")
+	if err != nil {
+		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
+	}
+	peerID, err := peerIDParam(c)
+	if err != nil {
+		return httpx.BadRequest(c, "invalid_peer_id", "Invalid peer_id")
+	}
+
+	settings, err := h.expiryService.GetDirectSettings(userID, peerID)
+	if err != nil {
+		return httpx.Internal(c, "get_chat_settings_failed")
+	}
+	return c.JSON(settings)
+}
+
+// UpdateSettings sets the conversation's disappearing message timer for
+// messages sent from now on. Either participant may change it; both are
+// notified.
+// PUT /api/conversations/:peer_id/settings
+func (h *ChatSettingsHandler) UpdateSettings(c *fiber.Ctx) error {
+	userID, err := httpx.LocalUint(c, "userID")
+	if err != nil {
+		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
+	}
+	peerID, err := peerIDParam(c)
+	if err != nil {
+		return httpx.BadRequest(c, "invalid_peer_id", "Invalid peer_id")
+	}
+
+	var req UpdateChatSettingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httpx.BadRequest(c, "invalid_request_body", "Invalid request body")
+	}
+
+	settings, changed, err := h.expiryService.SetDirectTTL(userID, peerID, req.MessageTTLSeconds, req.MessageTTLMode)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidMessageTTL):
+			return httpx.BadRequest(c, "invalid_message_ttl", "Invalid message_ttl_seconds or message_ttl_mode")
+		case errors.Is(err, service.ErrSelfConversation):
+			return httpx.BadRequest(c, "invalid_peer_id", "Invalid peer_id")
+		case errors.Is(err, service.ErrUserNotFound):
+			return httpx.Error(c, fiber.StatusNotFound, "user_not_found", "User not found")
+		}
+		return httpx.Internal(c, "update_chat_settings_failed")
+	}
+
+	if changed && h.hub != nil {
+		for _, pair := range [][2]uint{{userID, peerID}, {peerID, userID}} {
+			h.hub.SendToUser(pair[0], fiber.Map{
+				"type":            "chat_settings_updated",
+				"conversation_id": "user_" + strconv.FormatUint(uint64(pair[1]), 10),
+				"actor_id":        userID,
+				"settings":        settings,
+			})
+		}
+	}
+	return c.JSON(settings)
+}
@@ -1,22 +1,42 @@
 package handlers
 
 import (
+	"errors"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/noteduco342/OMMessenger-backend/internal/handlers/ws"
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
 	"github.com/noteduco342/OMMessenger-backend/internal/service"
+	"github.com/noteduco342/OMMessenger-backend/internal/storage"
 	"github.com/noteduco342/OMMessenger-backend/internal/validation"
+	"gorm.io/gorm"
 )
 
 type GroupHandler struct {
-	groupService *service.GroupService
+	groupService  *service.GroupService
+	avatarService *service.AvatarService
+	hub           *ws.Hub
 }
 
-func NewGroupHandler(groupService *service.GroupService) *GroupHandler {
-	return &GroupHandler{groupService: groupService}
+func NewGroupHandler(groupService *service.GroupService, avatarService *service.AvatarService, hub *ws.Hub) *GroupHandler {
+	return &GroupHandler{groupService: groupService, avatarService: avatarService, hub: hub}
+}
+
+// notifyMembers sends event to the group's current members and to extra
+// users (e.g. someone who was just removed).
+func (h *GroupHandler) notifyMembers(groupID uint, event map[string]interface{}, extra ...uint) {
+	if h.hub == nil {
+		return
+	}
+	memberIDs, err := h.groupService.GetMemberIDs(groupID)
+	if err != nil {
+		return
+	}
+	h.hub.BroadcastToUsers(append(memberIDs, extra...), event)
 }
 
 type CreateGroupRequest struct {
@@ -24,6 +44,8 @@ type CreateGroupRequest struct {
 	Description string `json:"description"`
 	IsPublic    bool   `json:"is_public"`
 	Handle      string `json:"handle"`
+	// Type is "group" (default) or "channel".
+	Type models.GroupType `json:"type"`
 }
 
 func (h *GroupHandler) CreateGroup(c *fiber.Ctx) error {
@@ -44,8 +66,11 @@ func (h *GroupHandler) CreateGroup(c *fiber.Ctx) error {
 	}
 
 	userID := c.Locals("userID").(uint)
-	group, err := h.groupService.CreateGroupWithVisibility(req.Name, req.Description, userID, req.IsPublic, req.Handle)
+	group, err := h.groupService.CreateGroupOfType(req.Type, req.Name, req.Description, userID, req.IsPublic, req.Handle)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidGroupType) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
 		msg := err.Error()
 		if strings.Contains(msg, "handle") || strings.Contains(msg, "public") || strings.Contains(msg, "taken") {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
@@ -73,8 +98,12 @@ func (h *GroupHandler) JoinGroup(c *fiber.Ctx) error {
 	}
 
 	userID := c.Locals("userID").(uint)
-	if err := h.groupService.JoinGroup(uint(groupID), userID); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	req, err := h.groupService.JoinGroup(uint(groupID), userID)
+	if err != nil {
+		return joinError(c, err)
+	}
+	if req != nil {
+		return h.joinRequested(c, req)
 	}
 
 	return c.JSON(fiber.Map{"message": "Joined group successfully"})
@@ -94,34 +123,208 @@ func (h *GroupHandler) LeaveGroup(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Left group successfully"})
 }
 
+// GetGroupMembers lists members a page at a time, online members first.
+// GET /api/groups/:id/members?q=&role=admin,moderator&cursor=&limit=
 func (h *GroupHandler) GetGroupMembers(c *fiber.Ctx) error {
 	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
 	}
 
-	group, err := h.groupService.GetGroup(uint(groupID))
+	userID := c.Locals("userID").(uint)
+	opts := service.MemberListOptions{
+		Search: c.Query("q"),
+		Cursor: c.Query("cursor"),
+		Limit:  c.QueryInt("limit"),
+	}
+	for _, role := range strings.Split(c.Query("role"), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			opts.Roles = append(opts.Roles, models.GroupRole(role))
+		}
+	}
+	page, err := h.groupService.ListMembers(uint(groupID), userID, opts)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
+		if errors.Is(err, service.ErrMemberListHidden) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		return groupError(c, err, "Failed to fetch members")
+	}
+
+	return c.JSON(page)
+}
+
+// UpdateGroup edits name, description, visibility and handle.
+// PUT /api/groups/:id
+func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	var req service.UpdateGroupInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
 	userID := c.Locals("userID").(uint)
-	if !group.IsPublic {
-		isMember, err := h.groupService.IsMember(uint(groupID), userID)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check membership"})
-		}
-		if !isMember {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
-		}
+	group, changed, err := h.groupService.UpdateGroup(uint(groupID), userID, req)
+	if err != nil {
+		return groupError(c, err, "Failed to update group")
+	}
+	if len(changed) > 0 {
+		h.notifyGroupUpdated(group, userID, changed)
+	}
+	h.groupService.HideMembersFrom(group, userID)
+	return c.JSON(group)
+}
+
+// UploadGroupIcon sets the group's icon from a multipart "icon" image.
+// POST /api/groups/:id/icon
+func (h *GroupHandler) UploadGroupIcon(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	if err := h.groupService.Authorize(uint(groupID), userID, models.PermChangeInfo); err != nil {
+		return groupError(c, err, "Failed to update icon")
+	}
+
+	fileHeader, err := c.FormFile("icon")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "icon file is required"})
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid icon upload"})
+	}
+	defer f.Close()
+
+	group, err := h.avatarService.UploadGroupIcon(c.Context(), uint(groupID), f, publicAPIBaseURL(c))
+	if err != nil {
+		return groupError(c, err, "Failed to update icon")
+	}
+	h.groupService.RecordGroupUpdated(group.ID, userID, "icon")
+	h.notifyGroupUpdated(group, userID, []string{"icon"})
+	h.groupService.HideMembersFrom(group, userID)
+	return c.JSON(group)
+}
+
+// DeleteGroupIcon removes the group's icon.
+// DELETE /api/groups/:id/icon
+func (h *GroupHandler) DeleteGroupIcon(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	if err := h.groupService.Authorize(uint(groupID), userID, models.PermChangeInfo); err != nil {
+		return groupError(c, err, "Failed to remove icon")
+	}
+
+	group, err := h.avatarService.DeleteGroupIcon(c.Context(), uint(groupID))
+	if err != nil {
+		return groupError(c, err, "Failed to remove icon")
+	}
+	h.groupService.RecordGroupUpdated(group.ID, userID, "icon")
+	h.notifyGroupUpdated(group, userID, []string{"icon"})
+	h.groupService.HideMembersFrom(group, userID)
+	return c.JSON(group)
+}
+
+func (h *GroupHandler) notifyGroupUpdated(group *models.Group, actorID uint, changed []string) {
+	h.notifyMembers(group.ID, map[string]interface{}{
+		"type":     "group_updated",
+		"group_id": group.ID,
+		"actor_id": actorID,
+		"changes":  changed,
+		"group":    groupSummary(group),
+	})
+}
+
+// groupSummary is the public-facing subset of a group (no members or creator).
+func groupSummary(group *models.Group) fiber.Map {
+	return fiber.Map{
+		"id":          group.ID,
+		"name":        group.Name,
+		"description": group.Description,
+		"icon":        group.Icon,
+		"is_public":   group.IsPublic,
+		"handle":      group.Handle,
+		"type":        group.Type,
+		"is_forum":    group.IsForum,
+
+		"message_ttl_seconds": group.MessageTTLSeconds,
+		"message_ttl_mode":    group.MessageTTLMode,
+		// Only set where the service counted members, e.g. invite previews.
+		"member_count": group.MemberCount,
+	}
+}
+
+type UpdateGroupPermissionsRequest struct {
+	MemberPermissions    models.GroupPermission `json:"member_permissions"`
+	ModeratorPermissions models.GroupPermission `json:"moderator_permissions"`
+}
+
+// UpdatePermissions sets the permission bitmaps for members and moderators.
+// PUT /api/groups/:id/permissions
+func (h *GroupHandler) UpdatePermissions(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	var req UpdateGroupPermissionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	members, err := h.groupService.GetGroupMembers(uint(groupID))
+	userID := c.Locals("userID").(uint)
+	group, err := h.groupService.UpdatePermissions(uint(groupID), userID, req.MemberPermissions, req.ModeratorPermissions)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch members"})
+		return groupError(c, err, "Failed to update permissions")
 	}
+	return c.JSON(group)
+}
 
-	return c.JSON(members)
+// groupError maps GroupService sentinel errors to responses; anything else is
+// a 500 with fallback as the message.
+func groupError(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrNotGroupMember), errors.Is(err, service.ErrGroupPermissionDenied):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	case errors.Is(err, service.ErrCannotManageMember), errors.Is(err, service.ErrGroupBanned),
+		errors.Is(err, service.ErrNotGroupOwner):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidGroupPermission), errors.Is(err, service.ErrInvalidGroupRole),
+		errors.Is(err, service.ErrInvalidBanExpiry), errors.Is(err, service.ErrInvalidGroupName),
+		errors.Is(err, service.ErrInvalidGroupHandle), errors.Is(err, service.ErrGroupHandleRequired),
+		errors.Is(err, service.ErrInvalidInviteLimit), errors.Is(err, service.ErrInvalidSlowMode),
+		errors.Is(err, service.ErrInvalidMemberCursor), errors.Is(err, service.ErrInvalidAuditAction),
+		errors.Is(err, service.ErrInvalidGroupType), errors.Is(err, service.ErrInvalidTopicTitle),
+		errors.Is(err, service.ErrNotForum), errors.Is(err, service.ErrInvalidMessageTTL):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrGroupHandleTaken), errors.Is(err, service.ErrJoinRequestDecided),
+		errors.Is(err, service.ErrGroupFull):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrStorageNotConfigured):
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Storage not configured"})
+	case errors.Is(err, storage.ErrTooLarge):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Image is too large"})
+	case errors.Is(err, storage.ErrUnsupported):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported image type"})
+	case errors.Is(err, storage.ErrInvalidImage):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid image"})
+	case errors.Is(err, service.ErrGroupMemberNotFound), errors.Is(err, service.ErrUserNotFound),
+		errors.Is(err, service.ErrInviteLinkNotFound), errors.Is(err, service.ErrJoinRequestNotFound),
+		errors.Is(err, service.ErrTopicNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
 }
 
 func (h *GroupHandler) SearchPublicGroups(c *fiber.Ctx) error {
@@ -167,9 +370,12 @@ func (h *GroupHandler) JoinPublicGroupByHandle(c *fiber.Ctx) error {
 	}
 
 	userID := c.Locals("userID").(uint)
-	group, err := h.groupService.JoinGroupByHandle(handle, userID)
+	group, req, err := h.groupService.JoinGroupByHandle(handle, userID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return joinError(c, err)
+	}
+	if req != nil {
+		return h.joinRequested(c, req)
 	}
 	return c.JSON(group)
 }
@@ -177,6 +383,7 @@ func (h *GroupHandler) JoinPublicGroupByHandle(c *fiber.Ctx) error {
 type CreateInviteLinkRequest struct {
 	SingleUse        bool `json:"single_use"`
 	ExpiresInSeconds *int `json:"expires_in_seconds"`
+	RequiresApproval bool `json:"requires_approval"`
 }
 
 func (h *GroupHandler) CreateInviteLink(c *fiber.Ctx) error {
@@ -197,7 +404,7 @@ func (h *GroupHandler) CreateInviteLink(c *fiber.Ctx) error {
 	}
 
 	userID := c.Locals("userID").(uint)
-	link, err := h.groupService.CreateInviteLink(uint(groupID), userID, req.SingleUse, expiresAt)
+	link, err := h.groupService.CreateInviteLink(uint(groupID), userID, req.SingleUse, req.RequiresApproval, expiresAt)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -214,19 +421,118 @@ func (h *GroupHandler) CreateInviteLink(c *fiber.Ctx) error {
 		"join_url":   joinURL,
 		"expires_at": link.ExpiresAt,
 		"max_uses":   link.MaxUses,
+
+		"requires_approval": link.RequiresApproval,
 	})
 }
 
+// ListInviteLinks returns the group's invite links with usage counts.
+// GET /api/groups/:id/invite-links
+func (h *GroupHandler) ListInviteLinks(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	links, err := h.groupService.ListInviteLinks(uint(groupID), userID)
+	if err != nil {
+		return groupError(c, err, "Failed to fetch invite links")
+	}
+	now := time.Now()
+	out := make([]models.GroupInviteLinkResponse, len(links))
+	for i := range links {
+		out[i] = links[i].ToResponse(now)
+	}
+	return c.JSON(fiber.Map{"invite_links": out})
+}
+
+// UpdateInviteLink changes a link's expiry and max uses.
+// PUT /api/groups/:id/invite-links/:linkId
+func (h *GroupHandler) UpdateInviteLink(c *fiber.Ctx) error {
+	groupID, linkID, ok := parseInviteLinkParams(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group or link ID"})
+	}
+	var req service.UpdateInviteLinkInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	link, err := h.groupService.UpdateInviteLink(groupID, userID, linkID, req)
+	if err != nil {
+		return groupError(c, err, "Failed to update invite link")
+	}
+	return c.JSON(link.ToResponse(time.Now()))
+}
+
+// RevokeInviteLink disables a link.
+// DELETE /api/groups/:id/invite-links/:linkId
+func (h *GroupHandler) RevokeInviteLink(c *fiber.Ctx) error {
+	groupID, linkID, ok := parseInviteLinkParams(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group or link ID"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	link, err := h.groupService.RevokeInviteLink(groupID, userID, linkID)
+	if err != nil {
+		return groupError(c, err, "Failed to revoke invite link")
+	}
+	return c.JSON(link.ToResponse(time.Now()))
+}
+
+// ListInviteLinkUses returns the users who joined through a link.
+// GET /api/groups/:id/invite-links/:linkId/uses
+func (h *GroupHandler) ListInviteLinkUses(c *fiber.Ctx) error {
+	groupID, linkID, ok := parseInviteLinkParams(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group or link ID"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	uses, err := h.groupService.ListInviteLinkUses(groupID, userID, linkID)
+	if err != nil {
+		return groupError(c, err, "Failed to fetch invite link uses")
+	}
+	out := make([]fiber.Map, len(uses))
+	for i := range uses {
+		out[i] = fiber.Map{
+			"user":      uses[i].User.ToResponse(),
+			"joined_at": uses[i].JoinedAt,
+		}
+	}
+	return c.JSON(fiber.Map{"uses": out})
+}
+
+// parseInviteLinkParams reads the :id and :linkId route params.
+func parseInviteLinkParams(c *fiber.Ctx) (groupID, linkID uint, ok bool) {
+	g, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || g == 0 {
+		return 0, 0, false
+	}
+	l, err := strconv.ParseUint(c.Params("linkId"), 10, 32)
+	if err != nil || l == 0 {
+		return 0, 0, false
+	}
+	return uint(g), uint(l), true
+}
+
 func (h *GroupHandler) JoinByInviteLink(c *fiber.Ctx) error {
 	token := strings.TrimSpace(c.Params("token"))
 	if token == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid token"})
 	}
 	userID := c.Locals("userID").(uint)
-	group, err := h.groupService.JoinGroupByInvite(token, userID)
+	group, req, err := h.groupService.JoinGroupByInvite(token, userID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return joinError(c, err)
 	}
+	if req != nil {
+		return h.joinRequested(c, req)
+	}
+	h.groupService.HideMembersFrom(group, userID)
 	return c.JSON(group)
 }
 
@@ -243,17 +549,418 @@ func (h *GroupHandler) GetInvitePreview(c *fiber.Ctx) error {
 
 	// Minimal preview response (no members, no creator details)
 	return c.JSON(fiber.Map{
-		"group": fiber.Map{
-			"id":          group.ID,
-			"name":        group.Name,
-			"description": group.Description,
-			"icon":        group.Icon,
-			"is_public":   group.IsPublic,
-			"handle":      group.Handle,
-		},
+		"group":         groupSummary(group),
 		"expires_at":    link.ExpiresAt,
 		"max_uses":      link.MaxUses,
 		"used_count":    link.UsedCount,
 		"requires_auth": true,
 	})
 }
+
+func joinError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrGroupBanned) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, service.ErrGroupFull) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+}
+
+// parseGroupMemberParams reads the :id and :userId route params.
+func parseGroupMemberParams(c *fiber.Ctx) (groupID, targetID uint, ok bool) {
+	g, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || g == 0 {
+		return 0, 0, false
+	}
+	u, err := strconv.ParseUint(c.Params("userId"), 10, 32)
+	if err != nil || u == 0 {
+		return 0, 0, false
+	}
+	return uint(g), uint(u), true
+}
+
+type SetMemberRoleRequest struct {
+	Role models.GroupRole `json:"role"`
+}
+
+// SetMemberRole promotes or demotes a member.
+// PUT /api/groups/:id/members/:userId/role
+func (h *GroupHandler) SetMemberRole(c *fiber.Ctx) error {
+	groupID, targetID, ok := parseGroupMemberParams(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group or user ID"})
+	}
+	var req SetMemberRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	if err := h.groupService.SetMemberRole(groupID, userID, targetID, req.Role); err != nil {
+		return groupError(c, err, "Failed to update role")
+	}
+
+	h.notifyMembers(groupID, map[string]interface{}{
+		"type":     "group_member_role_changed",
+		"group_id": groupID,
+		"user_id":  targetID,
+		"role":     req.Role,
+		"actor_id": userID,
+	})
+	return c.JSON(fiber.Map{"message": "Role updated", "role": req.Role})
+}
+
+// RemoveMember kicks a member from the group.
+// DELETE /api/groups/:id/members/:userId
+func (h *GroupHandler) RemoveMember(c *fiber.Ctx) error {
+	groupID, targetID, ok := parseGroupMemberParams(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group or user ID"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	if err := h.groupService.RemoveMember(groupID, userID, targetID); err != nil {
+		return groupError(c, err, "Failed to remove member")
+	}
+
+	h.notifyMembers(groupID, map[string]interface{}{
+		"type":     "group_member_removed",
+		"group_id": groupID,
+		"user_id":  targetID,
+		"actor_id": userID,
+	}, targetID)
+	return c.JSON(fiber.Map{"message": "Member removed"})
+}
+
+type BanMemberRequest struct {
+	UserID          uint   `json:"user_id"`
+	Reason          string `json:"reason"`
+	DurationSeconds *int   `json:"duration_seconds"` // omitted or 0 = permanent
+}
+
+// BanMember bans a user from the group, removing them if they're a member.
+// POST /api/groups/:id/bans
+func (h *GroupHandler) BanMember(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+	var req BanMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.UserID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user_id is required"})
+	}
+
+	var expiresAt *time.Time
+	if req.DurationSeconds != nil && *req.DurationSeconds > 0 {
+		t := time.Now().Add(time.Duration(*req.DurationSeconds) * time.Second)
+		expiresAt = &t
+	}
+
+	userID := c.Locals("userID").(uint)
+	ban, wasMember, err := h.groupService.BanMember(uint(groupID), userID, req.UserID, req.Reason, expiresAt)
+	if err != nil {
+		return groupError(c, err, "Failed to ban user")
+	}
+
+	h.notifyMembers(uint(groupID), map[string]interface{}{
+		"type":       "group_member_banned",
+		"group_id":   groupID,
+		"user_id":    req.UserID,
+		"actor_id":   userID,
+		"reason":     ban.Reason,
+		"expires_at": ban.ExpiresAt,
+		"was_member": wasMember,
+	}, req.UserID)
+	return c.Status(fiber.StatusCreated).JSON(ban)
+}
+
+// UnbanMember lifts a ban.
+// DELETE /api/groups/:id/bans/:userId
+func (h *GroupHandler) UnbanMember(c *fiber.Ctx) error {
+	groupID, targetID, ok := parseGroupMemberParams(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group or user ID"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	if err := h.groupService.UnbanMember(groupID, userID, targetID); err != nil {
+		return groupError(c, err, "Failed to unban user")
+	}
+
+	h.notifyMembers(groupID, map[string]interface{}{
+		"type":     "group_member_unbanned",
+		"group_id": groupID,
+		"user_id":  targetID,
+		"actor_id": userID,
+	}, targetID)
+	return c.JSON(fiber.Map{"message": "User unbanned"})
+}
+
+// ListBans returns the group's active bans.
+// GET /api/groups/:id/bans
+func (h *GroupHandler) ListBans(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	bans, err := h.groupService.ListBans(uint(groupID), userID)
+	if err != nil {
+		return groupError(c, err, "Failed to fetch bans")
+	}
+	return c.JSON(fiber.Map{"bans": bans})
+}
+
+type TransferOwnershipRequest struct {
+	UserID uint `json:"user_id"`
+}
+
+// TransferOwnership hands the group to another member.
+// POST /api/groups/:id/owner
+func (h *GroupHandler) TransferOwnership(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+	var req TransferOwnershipRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.UserID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user_id is required"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	if err := h.groupService.TransferOwnership(uint(groupID), userID, req.UserID); err != nil {
+		return groupError(c, err, "Failed to transfer ownership")
+	}
+
+	h.notifyMembers(uint(groupID), map[string]interface{}{
+		"type":              "group_owner_changed",
+		"group_id":          groupID,
+		"owner_id":          req.UserID,
+		"previous_owner_id": userID,
+	})
+	return c.JSON(fiber.Map{"message": "Ownership transferred", "owner_id": req.UserID})
+}
+
+// DeleteGroup deletes the group for everyone; owner only.
+// DELETE /api/groups/:id
+func (h *GroupHandler) DeleteGroup(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	memberIDs, err := h.groupService.DeleteGroup(uint(groupID), userID)
+	if err != nil {
+		return groupError(c, err, "Failed to delete group")
+	}
+
+	// Members are gone from the group by now, so address them directly.
+	if h.hub != nil {
+		h.hub.BroadcastToUsers(memberIDs, map[string]interface{}{
+			"type":     "group_deleted",
+			"group_id": groupID,
+			"actor_id": userID,
+		})
+	}
+	return c.JSON(fiber.Map{"message": "Group deleted"})
+}
+
+// joinRequested answers a join that needs approval and alerts the reviewers
+// to a new request; asking again doesn't alert them again.
+func (h *GroupHandler) joinRequested(c *fiber.Ctx, req *models.GroupJoinRequest) error {
+	if h.hub != nil && req.Filed {
+		if reviewers, err := h.groupService.JoinRequestReviewers(req.GroupID); err == nil {
+			h.hub.BroadcastToUsers(reviewers, map[string]interface{}{
+				"type":         "group_join_request",
+				"group_id":     req.GroupID,
+				"join_request": req,
+			})
+		}
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":      "Join request sent",
+		"join_request": req,
+	})
+}
+
+// ListJoinRequests returns the group's pending join requests.
+// GET /api/groups/:id/join-requests
+func (h *GroupHandler) ListJoinRequests(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	reqs, err := h.groupService.ListJoinRequests(uint(groupID), userID)
+	if err != nil {
+		return groupError(c, err, "Failed to fetch join requests")
+	}
+	return c.JSON(fiber.Map{"join_requests": reqs})
+}
+
+type DecideJoinRequestRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ApproveJoinRequest admits the requester.
+// POST /api/groups/:id/join-requests/:requestId/approve
+func (h *GroupHandler) ApproveJoinRequest(c *fiber.Ctx) error {
+	return h.decideJoinRequest(c, true)
+}
+
+// DeclineJoinRequest turns the request down, optionally with a reason.
+// POST /api/groups/:id/join-requests/:requestId/decline
+func (h *GroupHandler) DeclineJoinRequest(c *fiber.Ctx) error {
+	return h.decideJoinRequest(c, false)
+}
+
+func (h *GroupHandler) decideJoinRequest(c *fiber.Ctx, approve bool) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+	requestID, err := strconv.ParseUint(c.Params("requestId"), 10, 32)
+	if err != nil || requestID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request ID"})
+	}
+	var body DecideJoinRequestRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	userID := c.Locals("userID").(uint)
+	req, err := h.groupService.DecideJoinRequest(uint(groupID), userID, uint(requestID), approve, body.Reason)
+	if err != nil {
+		return groupError(c, err, "Failed to decide join request")
+	}
+
+	if h.hub != nil {
+		event := map[string]interface{}{
+			"type":       "group_join_request_decided",
+			"group_id":   req.GroupID,
+			"request_id": req.ID,
+			"status":     req.Status,
+			"reason":     req.Reason,
+		}
+		if approve {
+			if group, err := h.groupService.GetGroup(req.GroupID); err == nil {
+				event["group"] = groupSummary(group)
+			}
+		}
+		_ = h.hub.SendToUser(req.UserID, event)
+	}
+	return c.JSON(req)
+}
+
+// GetAuditLog returns the group's audit log, newest first; admins only.
+// GET /api/groups/:id/audit-log?actor_id=&action=member_banned,member_removed&cursor=&limit=
+func (h *GroupHandler) GetAuditLog(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	filter := service.AuditLogFilter{Limit: c.QueryInt("limit")}
+	if v := c.Query("actor_id"); v != "" {
+		actorID, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid actor_id"})
+		}
+		filter.ActorID = uint(actorID)
+	}
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+		}
+		filter.Cursor = uint(cursor)
+	}
+	for _, action := range strings.Split(c.Query("action"), ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			filter.Actions = append(filter.Actions, models.GroupAuditAction(action))
+		}
+	}
+
+	userID := c.Locals("userID").(uint)
+	page, err := h.groupService.ListAuditLog(uint(groupID), userID, filter)
+	if err != nil {
+		return groupError(c, err, "Failed to fetch audit log")
+	}
+	return c.JSON(page)
+}
+
+type CreateTopicRequest struct {
+	Title string `json:"title"`
+}
+
+// ListTopics returns the topics of a forum group.
+// GET /api/groups/:id/topics
+func (h *GroupHandler) ListTopics(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	topics, err := h.groupService.ListTopics(uint(groupID), userID)
+	if err != nil {
+		return groupError(c, err, "Failed to fetch topics")
+	}
+	return c.JSON(fiber.Map{"topics": topics})
+}
+
+// CreateTopic opens a topic in a forum group.
+// POST /api/groups/:id/topics
+func (h *GroupHandler) CreateTopic(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+	var req CreateTopicRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	topic, err := h.groupService.CreateTopic(uint(groupID), userID, req.Title)
+	if err != nil {
+		return groupError(c, err, "Failed to create topic")
+	}
+	return c.Status(fiber.StatusCreated).JSON(topic)
+}
+
+// UpdateTopic renames, closes or reopens a topic.
+// PUT /api/groups/:id/topics/:topicId
+func (h *GroupHandler) UpdateTopic(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+	topicID, err := strconv.ParseUint(c.Params("topicId"), 10, 32)
+	if err != nil || topicID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid topic ID"})
+	}
+	var req service.UpdateTopicInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	userID := c.Locals("userID").(uint)
+	topic, _, err := h.groupService.UpdateTopic(uint(groupID), uint(topicID), userID, req)
+	if err != nil {
+		return groupError(c, err, "Failed to update topic")
+	}
+	return c.JSON(topic)
+}
@@ -2,36 +2,38 @@ package handlers
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/minio/minio-go/v7"
+	"github.com/google/uuid"
 	"github.com/noteduco342/OMMessenger-backend/internal/httpx"
+	"github.com/noteduco342/OMMessenger-backend/internal/service"
 	"github.com/noteduco342/OMMessenger-backend/internal/storage"
 )
 
-type MediaHandler struct {
-	s3 *storage.S3Storage
-}
+// maxRangesPerRequest bounds multi-range requests; beyond it the whole
+// representation is sent instead (RFC 7233 allows ignoring Range).
+const maxRangesPerRequest = 16
 
-func NewMediaHandler(s3 *storage.S3Storage) *MediaHandler {
-	return &MediaHandler{s3: s3}
+type MediaHandler struct {
+	store       storage.BlobStore
+	attachments *service.AttachmentService
 }
 
-func normalizeETag(v string) string {
-	v = strings.TrimSpace(v)
-	v = strings.TrimPrefix(v, "W/")
-	v = strings.Trim(v, "\"")
-	return v
+func NewMediaHandler(store storage.BlobStore, attachments *service.AttachmentService) *MediaHandler {
+	return &MediaHandler{store: store, attachments: attachments}
 }
 
 func (h *MediaHandler) GetAvatar(c *fiber.Ctx) error {
-	if h.s3 == nil {
+	if h.store == nil {
 		return httpx.Error(c, fiber.StatusServiceUnavailable, "storage_not_configured", "Storage not configured")
 	}
 
@@ -43,44 +45,239 @@ func (h *MediaHandler) GetAvatar(c *fiber.Ctx) error {
 
 	log.Printf("[media] avatar get start keyParam=%q key=%q", keyParam, key)
 
-	obj, st, err := h.s3.GetObject(c.Context(), key)
+	st, err := h.store.Stat(c.Context(), key)
 	if err != nil {
-		log.Printf("[media] avatar get error key=%q err=%v", key, err)
+		log.Printf("[media] avatar stat error key=%q err=%v", key, err)
 		// Hide details.
-		var resp minio.ErrorResponse
-		if errors.As(err, &resp) {
-			if resp.StatusCode == 404 || resp.Code == "NoSuchKey" || resp.Code == "NoSuchObject" {
-				return httpx.Error(c, fiber.StatusNotFound, "not_found", "Not found")
-			}
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return httpx.Error(c, fiber.StatusNotFound, "not_found", "Not found")
 		}
 		return httpx.Internal(c, "media_fetch_failed")
 	}
 
 	log.Printf("[media] avatar stat key=%q size=%d etag=%q contentType=%q lastModified=%s", key, st.Size, st.ETag, st.ContentType, st.LastModified.UTC().Format(time.RFC3339Nano))
 
-	etag := st.ETag
-	if etag != "" {
-		c.Set("ETag", "\""+etag+"\"")
-		if inm := normalizeETag(c.Get("If-None-Match")); inm != "" && inm == normalizeETag(etag) {
-			_ = obj.Close()
-			log.Printf("[media] avatar 304 key=%q", key)
-			return c.SendStatus(fiber.StatusNotModified)
+	if st.ContentType == "" {
+		st.ContentType = "image/jpeg"
+	}
+	return h.serveObject(c, "avatar", st, "private, max-age=31536000, immutable")
+}
+
+// GetLinkPreviewImage serves the stored image of a link preview. Preview
+// images are copies of public pages' images, so any signed-in user may fetch
+// them.
+// GET /api/media/previews/*
+func (h *MediaHandler) GetLinkPreviewImage(c *fiber.Ctx) error {
+	if h.store == nil {
+		return httpx.Error(c, fiber.StatusServiceUnavailable, "storage_not_configured", "Storage not configured")
+	}
+	key, err := storage.SafeJoinAvatarPath("previews", strings.TrimSpace(c.Params("*")))
+	if err != nil {
+		return httpx.Error(c, fiber.StatusNotFound, "not_found", "Not found")
+	}
+
+	st, err := h.store.Stat(c.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return httpx.Error(c, fiber.StatusNotFound, "not_found", "Not found")
+		}
+		log.Printf("[media] preview stat error key=%q err=%v", key, err)
+		return httpx.Internal(c, "media_fetch_failed")
+	}
+	if st.ContentType == "" {
+		st.ContentType = "image/jpeg"
+	}
+	return h.serveObject(c, "preview", st, "private, max-age=31536000, immutable")
+}
+
+// GetAttachment streams an uploaded file to a user who can see it.
+// GET /api/media/attachments/:id
+func (h *MediaHandler) GetAttachment(c *fiber.Ctx) error {
+	userID, err := httpx.LocalUint(c, "userID")
+	if err != nil {
+		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
+	}
+	if h.store == nil {
+		return httpx.Error(c, fiber.StatusServiceUnavailable, "storage_not_configured", "Storage not configured")
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || id == 0 {
+		return httpx.Error(c, fiber.StatusNotFound, "not_found", "Not found")
+	}
+
+	att, err := h.attachments.GetForUser(userID, uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrAttachmentNotFound) {
+			return httpx.Error(c, fiber.StatusNotFound, "not_found", "Not found")
 		}
+		if errors.Is(err, service.ErrAttachmentQuarantined) {
+			c.Set(fiber.HeaderRetryAfter, "30")
+			return httpx.Error(c, fiber.StatusConflict, "attachment_quarantined", "File is being scanned, try again shortly")
+		}
+		if errors.Is(err, service.ErrAttachmentInfected) {
+			log.Printf("[media] blocked infected attachment id=%d user=%d", id, userID)
+			return httpx.Error(c, fiber.StatusForbidden, "attachment_infected", "File blocked: malware detected")
+		}
+		log.Printf("[media] attachment get error id=%d err=%v", id, err)
+		return httpx.Internal(c, "media_fetch_failed")
+	}
+
+	st, err := h.store.Stat(c.Context(), att.Blob.Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return httpx.Error(c, fiber.StatusNotFound, "not_found", "Not found")
+		}
+		log.Printf("[media] attachment stat error key=%q err=%v", att.Blob.Key, err)
+		return httpx.Internal(c, "media_fetch_failed")
+	}
+
+	// The blob key carries no extension, so the stored row is authoritative.
+	st.ContentType = att.ContentType
+	c.Set("X-Content-Type-Options", "nosniff")
+	disposition := "attachment"
+	if isInlineMedia(att.ContentType) {
+		disposition = "inline"
+	}
+	if att.FileName != "" {
+		disposition += "; filename*=UTF-8''" + strings.ReplaceAll(url.QueryEscape(att.FileName), "+", "%20")
+	}
+	c.Set("Content-Disposition", disposition)
+
+	// Content-addressed: the bytes behind an attachment never change.
+	return h.serveObject(c, "attachment", st, "private, max-age=31536000, immutable")
+}
+
+func isInlineMedia(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/") ||
+		strings.HasPrefix(contentType, "audio/") ||
+		strings.HasPrefix(contentType, "video/")
+}
+
+// serveObject answers a GET/HEAD for the object described by st, handling
+// conditional requests and byte ranges (single and multipart/byteranges).
+func (h *MediaHandler) serveObject(c *fiber.Ctx, kind string, st storage.ObjectStat, cacheControl string) error {
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderCacheControl, cacheControl)
+	if st.ETag != "" {
+		c.Set(fiber.HeaderETag, "\""+st.ETag+"\"")
 	}
 	if !st.LastModified.IsZero() {
-		c.Set("Last-Modified", st.LastModified.UTC().Format(time.RFC1123))
+		c.Set(fiber.HeaderLastModified, st.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	switch httpx.CheckPreconditions(c, st.ETag, st.LastModified) {
+	case fiber.StatusNotModified:
+		log.Printf("[media] %s 304 key=%q", kind, st.Key)
+		return c.SendStatus(fiber.StatusNotModified)
+	case fiber.StatusPreconditionFailed:
+		return httpx.Error(c, fiber.StatusPreconditionFailed, "precondition_failed", "Precondition failed")
+	}
+
+	var ranges []httpx.ByteRange
+	if httpx.IfRangeMatches(c, st.ETag, st.LastModified) {
+		var err error
+		ranges, err = httpx.ParseRange(c.Get(fiber.HeaderRange), st.Size)
+		if errors.Is(err, httpx.ErrRangeNotSatisfiable) {
+			c.Set(fiber.HeaderContentRange, "bytes */"+strconv.FormatInt(st.Size, 10))
+			return httpx.Error(c, fiber.StatusRequestedRangeNotSatisfiable, "range_not_satisfiable", "Range not satisfiable")
+		}
+		// Many or overlapping ranges cost more than the full body; send it whole.
+		if len(ranges) > maxRangesPerRequest || (len(ranges) > 1 && httpx.TotalLength(ranges) >= st.Size) {
+			ranges = nil
+		}
+	}
+
+	ctx := c.Context()
+	switch len(ranges) {
+	case 0:
+		obj, _, err := h.store.Get(ctx, st.Key)
+		if err != nil {
+			return mediaFetchError(c, kind, st.Key, err)
+		}
+		c.Set(fiber.HeaderContentType, st.ContentType)
+		streamBody(c, kind, st.Key, obj, st.Size)
+		return nil
+
+	case 1:
+		r := ranges[0]
+		obj, _, err := h.store.GetRange(ctx, st.Key, r.Start, r.Length)
+		if err != nil {
+			return mediaFetchError(c, kind, st.Key, err)
+		}
+		c.Status(fiber.StatusPartialContent)
+		c.Set(fiber.HeaderContentType, st.ContentType)
+		c.Set(fiber.HeaderContentRange, r.ContentRange(st.Size))
+		streamBody(c, kind, st.Key, obj, r.Length)
+		return nil
 	}
 
-	c.Set("Cache-Control", "private, max-age=31536000, immutable")
-	if st.ContentType != "" {
-		c.Type(st.ContentType)
-	} else {
-		c.Type("image/jpeg")
+	boundary := strings.ReplaceAll(uuid.NewString(), "-", "")
+	partHeaders := make([]string, len(ranges))
+	length := int64(len("\r\n--" + boundary + "--\r\n"))
+	for i, r := range ranges {
+		partHeaders[i] = "\r\n--" + boundary + "\r\n" +
+			"Content-Type: " + st.ContentType + "\r\n" +
+			"Content-Range: " + r.ContentRange(st.Size) + "\r\n\r\n"
+		length += int64(len(partHeaders[i])) + r.Length
 	}
-	if st.Size > 0 {
-		c.Set("Content-Length", strconv.FormatInt(st.Size, 10))
+
+	c.Status(fiber.StatusPartialContent)
+	c.Set(fiber.HeaderContentType, "multipart/byteranges; boundary="+boundary)
+	if c.Method() == fiber.MethodHead {
+		c.Context().Response.Header.SetContentLength(int(length))
+		return nil
 	}
 
+	// Parts are fetched lazily so a long range list doesn't hold many open
+	// storage connections at once.
+	store := h.store
+	key := st.Key
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var copied int64
+		for i, r := range ranges {
+			if _, err := w.WriteString(partHeaders[i]); err != nil {
+				return
+			}
+			obj, _, err := store.GetRange(context.Background(), key, r.Start, r.Length)
+			if err != nil {
+				log.Printf("[media] %s range fetch error key=%q range=%d-%d err=%v", kind, key, r.Start, r.Start+r.Length-1, err)
+				return
+			}
+			n, err := io.Copy(w, obj)
+			_ = obj.Close()
+			copied += n
+			if err != nil {
+				log.Printf("[media] %s stream error key=%q copied=%d err=%v", kind, key, copied, err)
+				return
+			}
+		}
+		_, _ = w.WriteString("\r\n--" + boundary + "--\r\n")
+		if err := w.Flush(); err != nil {
+			log.Printf("[media] %s stream flush error key=%q copied=%d err=%v", kind, key, copied, err)
+			return
+		}
+		log.Printf("[media] %s multirange stream ok key=%q parts=%d bytes=%d", kind, key, len(ranges), copied)
+	})
+	// SetBodyStreamWriter resets the length to chunked; the size is known.
+	c.Context().Response.Header.SetContentLength(int(length))
+	return nil
+}
+
+func mediaFetchError(c *fiber.Ctx, kind, key string, err error) error {
+	log.Printf("[media] %s get error key=%q err=%v", kind, key, err)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return httpx.Error(c, fiber.StatusNotFound, "not_found", "Not found")
+	}
+	return httpx.Internal(c, "media_fetch_failed")
+}
+
+// streamBody streams size bytes of obj as the response body and closes it.
+func streamBody(c *fiber.Ctx, kind, key string, obj io.ReadCloser, size int64) {
+	if c.Method() == fiber.MethodHead {
+		_ = obj.Close()
+		c.Context().Response.Header.SetContentLength(int(size))
+		return
+	}
 	// Stream object while capturing any mid-stream errors.
 	// (Fiber versions vary; use underlying fasthttp stream writer.)
 	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
@@ -92,14 +289,14 @@ func (h *MediaHandler) GetAvatar(c *fiber.Ctx) error {
 		flushErr := w.Flush()
 
 		if copyErr != nil {
-			log.Printf("[media] avatar stream error key=%q copied=%d err=%v", key, n, copyErr)
+			log.Printf("[media] %s stream error key=%q copied=%d err=%v", kind, key, n, copyErr)
 			return
 		}
 		if flushErr != nil {
-			log.Printf("[media] avatar stream flush error key=%q copied=%d err=%v", key, n, flushErr)
+			log.Printf("[media] %s stream flush error key=%q copied=%d err=%v", kind, key, n, flushErr)
 			return
 		}
-		log.Printf("[media] avatar stream ok key=%q bytes=%d", key, n)
+		log.Printf("[media] %s stream ok key=%q bytes=%d", kind, key, n)
 	})
-	return nil
+	c.Context().Response.Header.SetContentLength(int(size))
 }
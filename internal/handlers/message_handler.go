@@ -11,34 +11,44 @@ import (
 	"github.com/noteduco342/OMMessenger-backend/internal/handlers/ws"
 	"github.com/noteduco342/OMMessenger-backend/internal/httpx"
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/richtext"
 	"github.com/noteduco342/OMMessenger-backend/internal/service"
 	"github.com/noteduco342/OMMessenger-backend/internal/validation"
 	"gorm.io/gorm"
 )
 
 type MessageHandler struct {
-	messageService *service.MessageService
-	groupService   *service.GroupService
-	messageCache   *cache.MessageCache
-	hub            *ws.Hub
+	messageService    *service.MessageService
+	groupService      *service.GroupService
+	attachmentService *service.AttachmentService
+	messageCache      *cache.MessageCache
+	hub               *ws.Hub
+	delivery          *ws.GroupDelivery
 }
 
-func NewMessageHandler(messageService *service.MessageService, groupService *service.GroupService, messageCache *cache.MessageCache, hub *ws.Hub) *MessageHandler {
+func NewMessageHandler(messageService *service.MessageService, groupService *service.GroupService, attachmentService *service.AttachmentService, messageCache *cache.MessageCache, hub *ws.Hub, delivery *ws.GroupDelivery) *MessageHandler {
 	return &MessageHandler{
-		messageService: messageService,
-		groupService:   groupService,
-		messageCache:   messageCache,
-		hub:            hub,
+		messageService:    messageService,
+		groupService:      groupService,
+		attachmentService: attachmentService,
+		messageCache:      messageCache,
+		hub:               hub,
+		delivery:          delivery,
 	}
 }
 
 type SendGroupMessageRequest struct {
-	ClientID    string `json:"client_id"`
-	Content     string `json:"content"`
-	MessageType string `json:"message_type"`
+	ClientID     string                 `json:"client_id"`
+	Content      string                 `json:"content"`
+	Entities     []models.MessageEntity `json:"entities"`
+	ParseMode    richtext.ParseMode     `json:"parse_mode"`
+	MessageType  string                 `json:"message_type"`
+	AttachmentID *uint                  `json:"attachment_id"`
+	TopicID      *uint                  `json:"topic_id"`
 }
 
 type MarkGroupReadRequest struct {
+	TopicID           uint `json:"topic_id"`
 	LastReadMessageID uint `json:"last_read_message_id"`
 }
 
@@ -65,27 +75,108 @@ func parseMessageType(input string) models.MessageType {
 	}
 }
 
+// groupAccessError maps GroupService.Authorize failures to responses.
+func groupAccessError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrNotGroupMember) {
+		return httpx.Forbidden(c, "not_group_member", "Not a group member")
+	}
+	if errors.Is(err, service.ErrChannelAdminOnly) {
+		return httpx.Forbidden(c, "channel_admin_only", "Only admins can post in this channel")
+	}
+	if errors.Is(err, service.ErrGroupPermissionDenied) {
+		return httpx.Forbidden(c, "missing_permission", "Not allowed in this group")
+	}
+	if errors.Is(err, service.ErrTopicNotFound) {
+		return httpx.Error(c, fiber.StatusNotFound, "topic_not_found", "Topic not found")
+	}
+	if errors.Is(err, service.ErrTopicClosed) {
+		return httpx.Forbidden(c, "topic_closed", "This topic is closed")
+	}
+	if errors.Is(err, service.ErrNotForum) {
+		return httpx.BadRequest(c, "not_forum", "This group has no topics")
+	}
+	return httpx.Internal(c, "check_membership_failed")
+}
+
+// queryTopicID parses the optional topic_id query parameter; absent or 0
+// means the group's General stream.
+func queryTopicID(c *fiber.Ctx) (uint, error) {
+	s := c.Query("topic_id")
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(v), nil
+}
+
+// formatMessage applies the parse mode and length limit to a message's text
+// and entities. When it returns false the error response has already been
+// written.
+func formatMessage(c *fiber.Ctx, content *string, entities *[]models.MessageEntity, mode richtext.ParseMode) (bool, error) {
+	text, formatted, err := richtext.Format(*content, *entities, mode, validation.MaxMessageLength())
+	if err != nil {
+		code, _ := service.EntityErrorCode(err)
+		return false, httpx.BadRequest(c, code, "Invalid message formatting")
+	}
+	*content, *entities = text, formatted
+	return true, nil
+}
+
+// checkAttachment reports whether the user may attach the upload to a message.
+// When it returns false the error response has already been written.
+func (h *MessageHandler) checkAttachment(c *fiber.Ctx, userID, attachmentID uint) (bool, error) {
+	if h.attachmentService == nil {
+		return false, httpx.Error(c, fiber.StatusServiceUnavailable, "storage_not_configured", "Storage not configured")
+	}
+	if _, err := h.attachmentService.CheckAttachable(userID, attachmentID); err != nil {
+		if errors.Is(err, service.ErrAttachmentNotFound) || errors.Is(err, service.ErrAttachmentForbidden) {
+			return false, httpx.BadRequest(c, "invalid_attachment", "Invalid attachment_id")
+		}
+		if errors.Is(err, service.ErrAttachmentInfected) {
+			return false, httpx.BadRequest(c, "attachment_infected", "Attachment failed malware scan")
+		}
+		return false, httpx.Internal(c, "check_attachment_failed")
+	}
+	return true, nil
+}
+
 func (h *MessageHandler) SendMessage(c *fiber.Ctx) error {
 	userID, err := httpx.LocalUint(c, "userID")
 	if err != nil {
 		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
 	}
 
-	var input service.SendMessageInput
+	var input struct {
+		service.SendMessageInput
+		ParseMode richtext.ParseMode `json:"parse_mode"`
+	}
 	if err := c.BodyParser(&input); err != nil {
 		return httpx.BadRequest(c, "invalid_request_body", "Invalid request body")
 	}
 
-	input.Content = validation.TrimAndLimit(input.Content, validation.MaxMessageLength())
-	if input.Content == "" {
+	if ok, err := formatMessage(c, &input.Content, &input.Entities, input.ParseMode); !ok {
+		return err
+	}
+	if input.Content == "" && input.AttachmentID == nil {
 		return httpx.BadRequest(c, "missing_content", "Content is required")
 	}
 	if input.RecipientID == nil || *input.RecipientID == 0 {
 		return httpx.BadRequest(c, "missing_recipient", "recipient_id is required")
 	}
+	if input.AttachmentID != nil {
+		if ok, err := h.checkAttachment(c, userID, *input.AttachmentID); !ok {
+			return err
+		}
+	}
 
-	message, err := h.messageService.SendMessage(userID, input)
+	message, err := h.messageService.SendMessage(userID, input.SendMessageInput)
 	if err != nil {
+		if code, ok := service.EntityErrorCode(err); ok {
+			return httpx.BadRequest(c, code, "Invalid message formatting")
+		}
 		return httpx.Internal(c, "send_message_failed")
 	}
 
@@ -179,13 +270,17 @@ func (h *MessageHandler) GetGroupMessages(c *fiber.Ctx) error {
 	}
 	groupID := uint(groupID64)
 
+	topicID, err := queryTopicID(c)
+	if err != nil {
+		return httpx.BadRequest(c, "invalid_topic_id", "Invalid topic_id")
+	}
+
 	if h.groupService != nil {
-		isMember, err := h.groupService.IsMember(groupID, userID)
-		if err != nil {
-			return httpx.Internal(c, "check_membership_failed")
+		if err := h.groupService.Authorize(groupID, userID, 0); err != nil {
+			return groupAccessError(c, err)
 		}
-		if !isMember {
-			return httpx.Forbidden(c, "not_group_member", "Not a group member")
+		if err := h.groupService.CheckTopic(groupID, topicID); err != nil {
+			return groupAccessError(c, err)
 		}
 	}
 
@@ -197,12 +292,17 @@ func (h *MessageHandler) GetGroupMessages(c *fiber.Ctx) error {
 	}
 
 	var messages []models.Message
-	if cursorStr := c.Query("cursor"); cursorStr != "" {
-		cursor, err := strconv.ParseUint(cursorStr, 10, 32)
-		if err != nil {
-			return httpx.BadRequest(c, "invalid_cursor", "Invalid cursor")
+	cursorStr := c.Query("cursor")
+	// Only the first page of the General stream is cached.
+	if cursorStr != "" || topicID != 0 {
+		var cursor uint64
+		if cursorStr != "" {
+			cursor, err = strconv.ParseUint(cursorStr, 10, 32)
+			if err != nil {
+				return httpx.BadRequest(c, "invalid_cursor", "Invalid cursor")
+			}
 		}
-		messages, err = h.messageService.GetGroupMessages(groupID, uint(cursor), limit)
+		messages, err = h.messageService.GetGroupMessages(groupID, topicID, uint(cursor), limit)
 		if err != nil {
 			return httpx.Internal(c, "fetch_messages_failed")
 		}
@@ -213,7 +313,7 @@ func (h *MessageHandler) GetGroupMessages(c *fiber.Ctx) error {
 				messages = messages[:limit]
 			}
 		} else {
-			messages, err = h.messageService.GetGroupMessages(groupID, 0, limit)
+			messages, err = h.messageService.GetGroupMessages(groupID, 0, 0, limit)
 			if err != nil {
 				return httpx.Internal(c, "fetch_messages_failed")
 			}
@@ -304,29 +404,44 @@ func (h *MessageHandler) SendGroupMessage(c *fiber.Ctx) error {
 	}
 	groupID := uint(groupID64)
 
-	if h.groupService != nil {
-		isMember, err := h.groupService.IsMember(groupID, userID)
-		if err != nil {
-			return httpx.Internal(c, "check_membership_failed")
-		}
-		if !isMember {
-			return httpx.Forbidden(c, "not_group_member", "Not a group member")
-		}
-	}
-
 	var input SendGroupMessageRequest
 	if err := c.BodyParser(&input); err != nil {
 		return httpx.BadRequest(c, "invalid_request_body", "Invalid request body")
 	}
 
 	input.ClientID = strings.TrimSpace(input.ClientID)
-	input.Content = validation.TrimAndLimit(input.Content, validation.MaxMessageLength())
+	if ok, err := formatMessage(c, &input.Content, &input.Entities, input.ParseMode); !ok {
+		return err
+	}
 	if input.ClientID == "" {
 		return httpx.BadRequest(c, "missing_client_id", "client_id is required")
 	}
-	if input.Content == "" {
+	if input.Content == "" && input.AttachmentID == nil {
 		return httpx.BadRequest(c, "missing_content", "Content is required")
 	}
+	if input.TopicID != nil && *input.TopicID == 0 {
+		input.TopicID = nil
+	}
+
+	if h.groupService != nil {
+		perm := models.PermSendMessages
+		if input.AttachmentID != nil {
+			perm |= models.PermSendMedia
+		}
+		if err := h.groupService.Authorize(groupID, userID, perm); err != nil {
+			return groupAccessError(c, err)
+		}
+		if input.TopicID != nil {
+			if err := h.groupService.CheckTopicPost(groupID, *input.TopicID, userID); err != nil {
+				return groupAccessError(c, err)
+			}
+		}
+	}
+	if input.AttachmentID != nil {
+		if ok, err := h.checkAttachment(c, userID, *input.AttachmentID); !ok {
+			return err
+		}
+	}
 
 	// Idempotent send by client_id
 	if existing, err := h.messageService.GetByClientID(input.ClientID, userID); err == nil && existing != nil {
@@ -337,39 +452,28 @@ func (h *MessageHandler) SendGroupMessage(c *fiber.Ctx) error {
 	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return httpx.Internal(c, "get_message_failed")
 	}
+	if h.groupService != nil {
+		if err := h.groupService.CheckSendRate(groupID, userID); err != nil {
+			var slow *service.SlowModeError
+			if errors.As(err, &slow) {
+				return httpx.TooManyRequests(c, "slow_mode", "Slow mode is on; wait before sending again", slow.RetrySeconds())
+			}
+			return groupAccessError(c, err)
+		}
+	}
 
 	msgType := parseMessageType(input.MessageType)
-	message, err := h.messageService.CreateWithClientIDAndType(userID, input.ClientID, nil, &groupID, input.Content, msgType)
+	message, err := h.messageService.CreateWithAttachment(userID, input.ClientID, nil, &groupID, input.TopicID, input.Content, input.Entities, msgType, input.AttachmentID)
 	if err != nil {
-		return httpx.Internal(c, "send_message_failed")
-	}
-
-	// Invalidate group message cache and conversation list cache for members
-	if h.messageCache != nil {
-		_ = h.messageCache.InvalidateGroupConversation(groupID)
-	}
-
-	// Broadcast to group members (also queues for offline users)
-	if h.hub != nil && h.groupService != nil {
-		members, err := h.groupService.GetGroupMembers(groupID)
-		if err == nil {
-			for _, member := range members {
-				if member.ID == userID {
-					continue
-				}
-				_ = h.hub.SendToUserWithID(member.ID, message.ID, map[string]interface{}{
-					"type":    "message",
-					"message": message.ToResponse(),
-				})
-				if h.messageCache != nil {
-					_ = h.messageCache.InvalidateConversationList(member.ID)
-				}
-			}
+		if code, ok := service.EntityErrorCode(err); ok {
+			return httpx.BadRequest(c, code, "Invalid message formatting")
 		}
+		return httpx.Internal(c, "send_message_failed")
 	}
 
-	if h.messageCache != nil {
-		_ = h.messageCache.InvalidateConversationList(userID)
+	// Fan out to the other members; this also invalidates the group's caches
+	if h.delivery != nil {
+		h.delivery.DeliverGroupMessage(message, userID)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(message.ToResponse())
@@ -428,7 +532,9 @@ func (h *MessageHandler) GetConversations(c *fiber.Ctx) error {
 	conversations := make([]interface{}, 0, len(rows))
 	for _, r := range rows {
 		var conversationID string
-		if r.ConversationType == "group" && r.GroupID.Valid {
+		if r.ConversationType == "topic" && r.TopicID.Valid {
+			conversationID = "topic_" + strconv.FormatInt(r.TopicID.Int64, 10)
+		} else if r.ConversationType == "group" && r.GroupID.Valid {
 			conversationID = "group_" + strconv.FormatInt(r.GroupID.Int64, 10)
 		} else if r.PeerID.Valid {
 			conversationID = "user_" + strconv.FormatInt(r.PeerID.Int64, 10)
@@ -457,6 +563,15 @@ func (h *MessageHandler) GetConversations(c *fiber.Ctx) error {
 			}
 		}
 
+		topic := interface{}(nil)
+		if r.TopicID.Valid {
+			topic = fiber.Map{
+				"id":        uint(r.TopicID.Int64),
+				"title":     r.TopicTitle.String,
+				"is_closed": r.TopicIsClosed.Bool,
+			}
+		}
+
 		var recipientID interface{} = nil
 		if r.MessageRecipientID.Valid {
 			recipientID = uint(r.MessageRecipientID.Int64)
@@ -465,6 +580,10 @@ func (h *MessageHandler) GetConversations(c *fiber.Ctx) error {
 		if r.MessageGroupID.Valid {
 			groupID = uint(r.MessageGroupID.Int64)
 		}
+		var topicID interface{} = nil
+		if r.TopicID.Valid {
+			topicID = uint(r.TopicID.Int64)
+		}
 
 		var lastMessage interface{} = nil
 		if r.MessageID != 0 {
@@ -483,6 +602,7 @@ func (h *MessageHandler) GetConversations(c *fiber.Ctx) error {
 				},
 				"recipient_id":    recipientID,
 				"group_id":        groupID,
+				"topic_id":        topicID,
 				"content":         r.MessageContent,
 				"message_type":    r.MessageType,
 				"status":          r.MessageStatus,
@@ -494,12 +614,14 @@ func (h *MessageHandler) GetConversations(c *fiber.Ctx) error {
 		}
 
 		conversations = append(conversations, fiber.Map{
-			"conversation_id": conversationID,
-			"peer":            peer,
-			"group":           group,
-			"unread_count":    r.UnreadCount,
-			"last_activity":   r.LastActivity,
-			"last_message":    lastMessage,
+			"conversation_id":      conversationID,
+			"peer":                 peer,
+			"group":                group,
+			"topic":                topic,
+			"unread_count":         r.UnreadCount,
+			"unread_mention_count": r.UnreadMentionCount,
+			"last_activity":        r.LastActivity,
+			"last_message":         lastMessage,
 		})
 	}
 
@@ -602,6 +724,10 @@ func (h *MessageHandler) MarkConversationRead(c *fiber.Ctx) error {
 	}
 	if h.messageCache != nil {
 		_ = h.messageCache.InvalidateConversationList(userID)
+		if cleared > 0 {
+			// Reading may have started disappearing message timers.
+			_ = h.messageCache.InvalidateConversation(userID, uint(peerID64))
+		}
 	}
 
 	return c.JSON(fiber.Map{
@@ -623,12 +749,8 @@ func (h *MessageHandler) MarkGroupRead(c *fiber.Ctx) error {
 	groupID := uint(groupID64)
 
 	if h.groupService != nil {
-		isMember, err := h.groupService.IsMember(groupID, userID)
-		if err != nil {
-			return httpx.Internal(c, "check_membership_failed")
-		}
-		if !isMember {
-			return httpx.Forbidden(c, "not_group_member", "Not a group member")
+		if err := h.groupService.Authorize(groupID, userID, 0); err != nil {
+			return groupAccessError(c, err)
 		}
 	}
 
@@ -636,9 +758,14 @@ func (h *MessageHandler) MarkGroupRead(c *fiber.Ctx) error {
 	if err := c.BodyParser(&input); err != nil {
 		return httpx.BadRequest(c, "invalid_request_body", "Invalid request body")
 	}
+	if h.groupService != nil {
+		if err := h.groupService.CheckTopic(groupID, input.TopicID); err != nil {
+			return groupAccessError(c, err)
+		}
+	}
 
 	if input.LastReadMessageID > 0 {
-		belongs, err := h.messageService.IsMessageInGroup(input.LastReadMessageID, groupID)
+		belongs, err := h.messageService.IsMessageInGroup(input.LastReadMessageID, groupID, input.TopicID)
 		if err != nil {
 			return httpx.Internal(c, "validate_message_failed")
 		}
@@ -647,7 +774,7 @@ func (h *MessageHandler) MarkGroupRead(c *fiber.Ctx) error {
 		}
 	}
 
-	latestID, err := h.messageService.GetLatestGroupMessageID(groupID)
+	latestID, err := h.messageService.GetLatestGroupMessageID(groupID, input.TopicID)
 	if err != nil {
 		return httpx.Internal(c, "latest_message_failed")
 	}
@@ -657,7 +784,7 @@ func (h *MessageHandler) MarkGroupRead(c *fiber.Ctx) error {
 	}
 
 	if h.groupService != nil {
-		if err := h.groupService.UpsertReadStateMonotonic(groupID, userID, lastRead); err != nil {
+		if err := h.groupService.UpsertReadStateMonotonic(groupID, input.TopicID, userID, lastRead); err != nil {
 			return httpx.Internal(c, "mark_group_read_failed")
 		}
 	}
@@ -667,6 +794,7 @@ func (h *MessageHandler) MarkGroupRead(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{
 		"ok":                      true,
+		"topic_id":                input.TopicID,
 		"last_read_message_id":    lastRead,
 		"latest_group_message_id": latestID,
 	})
@@ -684,22 +812,31 @@ func (h *MessageHandler) GetGroupReadState(c *fiber.Ctx) error {
 	}
 	groupID := uint(groupID64)
 
+	topicID, err := queryTopicID(c)
+	if err != nil {
+		return httpx.BadRequest(c, "invalid_topic_id", "Invalid topic_id")
+	}
+
 	if h.groupService != nil {
-		isMember, err := h.groupService.IsMember(groupID, userID)
-		if err != nil {
-			return httpx.Internal(c, "check_membership_failed")
+		if err := h.groupService.Authorize(groupID, userID, 0); err != nil {
+			return groupAccessError(c, err)
 		}
-		if !isMember {
-			return httpx.Forbidden(c, "not_group_member", "Not a group member")
+		if err := h.groupService.CheckTopic(groupID, topicID); err != nil {
+			return groupAccessError(c, err)
 		}
 	}
 
-	myState, err := h.groupService.GetReadState(groupID, userID)
+	myState, err := h.groupService.GetReadState(groupID, topicID, userID)
+	if err != nil {
+		return httpx.Internal(c, "get_read_state_failed")
+	}
+
+	states, err := h.groupService.ListReadStates(groupID, topicID, userID)
 	if err != nil {
 		return httpx.Internal(c, "get_read_state_failed")
 	}
 
-	states, err := h.groupService.ListReadStates(groupID)
+	mentions, _, err := h.groupService.UnreadMentions(groupID, topicID, userID, 0)
 	if err != nil {
 		return httpx.Internal(c, "get_read_state_failed")
 	}
@@ -713,7 +850,60 @@ func (h *MessageHandler) GetGroupReadState(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
+		"topic_id":                topicID,
 		"my_last_read_message_id": myState.LastReadMessageID,
+		"unread_mention_count":    mentions,
 		"members":                 members,
 	})
 }
+
+// GetNextMention returns the user's oldest unread mention in a group topic
+// after the after message ID, so clients can jump through their mentions.
+// message_id is null when there are no more.
+// GET /api/groups/:id/mentions/next?topic_id=&after=
+func (h *MessageHandler) GetNextMention(c *fiber.Ctx) error {
+	userID, err := httpx.LocalUint(c, "userID")
+	if err != nil {
+		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
+	}
+
+	groupID64, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || groupID64 == 0 {
+		return httpx.BadRequest(c, "invalid_group_id", "Invalid group id")
+	}
+	groupID := uint(groupID64)
+
+	topicID, err := queryTopicID(c)
+	if err != nil {
+		return httpx.BadRequest(c, "invalid_topic_id", "Invalid topic_id")
+	}
+	var after uint
+	if s := c.Query("after"); s != "" {
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return httpx.BadRequest(c, "invalid_after", "Invalid after")
+		}
+		after = uint(v)
+	}
+
+	if err := h.groupService.Authorize(groupID, userID, 0); err != nil {
+		return groupAccessError(c, err)
+	}
+	if err := h.groupService.CheckTopic(groupID, topicID); err != nil {
+		return groupAccessError(c, err)
+	}
+
+	count, next, err := h.groupService.UnreadMentions(groupID, topicID, userID, after)
+	if err != nil {
+		return httpx.Internal(c, "get_mentions_failed")
+	}
+	var messageID *uint
+	if next != 0 {
+		messageID = &next
+	}
+	return c.JSON(fiber.Map{
+		"topic_id":             topicID,
+		"message_id":           messageID,
+		"unread_mention_count": count,
+	})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/noteduco342/OMMessenger-backend/internal/httpx"
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/richtext"
+	"github.com/noteduco342/OMMessenger-backend/internal/service"
+)
+
+type ScheduledMessageHandler struct {
+	scheduledService *service.ScheduledMessageService
+}
+
+func NewScheduledMessageHandler(scheduledService *service.ScheduledMessageService) *ScheduledMessageHandler {
+	return &ScheduledMessageHandler{scheduledService: scheduledService}
+}
+
+// scheduledError maps ScheduledMessageService errors to responses. Access
+// errors use the same codes as a live send.
+func scheduledError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrScheduledNotFound):
+		return httpx.Error(c, fiber.StatusNotFound, "scheduled_message_not_found", "Scheduled message not found")
+	case errors.Is(err, service.ErrScheduledNotEditable):
+		return httpx.Error(c, fiber.StatusConflict, "scheduled_message_not_editable", "Scheduled message is already being sent")
+	case errors.Is(err, service.ErrInvalidSendAt):
+		return httpx.BadRequest(c, "invalid_send_at", "send_at must be in the future")
+	case errors.Is(err, service.ErrInvalidScheduleTarget):
+		return httpx.BadRequest(c, "invalid_target", "Exactly one of recipient_id or group_id is required")
+	case errors.Is(err, service.ErrEmptyScheduledMessage):
+		return httpx.BadRequest(c, "missing_content", "Content is required")
+	case errors.Is(err, service.ErrTooManyScheduled):
+		return httpx.Error(c, fiber.StatusConflict, "too_many_scheduled_messages", "Too many scheduled messages")
+	case errors.Is(err, service.ErrClientIDTaken):
+		return httpx.Error(c, fiber.StatusConflict, "client_id_taken", "client_id was already used for a message")
+	}
+	if code, ok := service.ScheduledFailureCode(err); ok {
+		switch code {
+		case "topic_not_found", "recipient_not_found":
+			return httpx.Error(c, fiber.StatusNotFound, code, "Target not found")
+		case "storage_not_configured":
+			return httpx.Error(c, fiber.StatusServiceUnavailable, code, "Storage not configured")
+		case "invalid_attachment", "attachment_infected", "not_forum",
+			"invalid_entities", "too_many_entities", "invalid_parse_mode", "too_many_mentions":
+			return httpx.BadRequest(c, code, "Message can't be scheduled")
+		}
+		return httpx.Forbidden(c, code, "Not allowed to send this message")
+	}
+	return httpx.Internal(c, "scheduled_message_failed")
+}
+
+func scheduledID(c *fiber.Ctx) (uint, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, errors.New("invalid id")
+	}
+	return uint(id), nil
+}
+
+// ListScheduled returns the user's unsent scheduled messages, soonest first.
+// GET /api/scheduled-messages
+func (h *ScheduledMessageHandler) ListScheduled(c *fiber.Ctx) error {
+	userID, err := httpx.LocalUint(c, "userID")
+	if err != nil {
+		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
+	}
+	messages, err := h.scheduledService.List(userID)
+	if err != nil {
+		return httpx.Internal(c, "list_scheduled_failed")
+	}
+	if messages == nil {
+		messages = []models.ScheduledMessage{}
+	}
+	return c.JSON(fiber.Map{"scheduled_messages": messages})
+}
+
+// ScheduleMessage stores a direct or group message to be sent at send_at.
+// POST /api/scheduled-messages
+func (h *ScheduledMessageHandler) ScheduleMessage(c *fiber.Ctx) error {
+	userID, err := httpx.LocalUint(c, "userID")
+	if err != nil {
+		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
+	}
+
+	var input struct {
+		service.ScheduleMessageInput
+		ParseMode richtext.ParseMode `json:"parse_mode"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return httpx.BadRequest(c, "invalid_request_body", "Invalid request body")
+	}
+	if ok, err := formatMessage(c, &input.Content, &input.Entities, input.ParseMode); !ok {
+		return err
+	}
+	input.MessageType = parseMessageType(string(input.MessageType))
+
+	scheduled, err := h.scheduledService.Schedule(userID, input.ScheduleMessageInput)
+	if err != nil {
+		return scheduledError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(scheduled)
+}
+
+// UpdateScheduled changes a pending message's content or send_at.
+// PUT /api/scheduled-messages/:id
+func (h *ScheduledMessageHandler) UpdateScheduled(c *fiber.Ctx) error {
+	userID, err := httpx.LocalUint(c, "userID")
+	if err != nil {
+		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
+	}
+	id, err := scheduledID(c)
+	if err != nil {
+		return httpx.BadRequest(c, "invalid_scheduled_id", "Invalid scheduled message id")
+	}
+
+	var input struct {
+		service.UpdateScheduledInput
+		ParseMode richtext.ParseMode `json:"parse_mode"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return httpx.BadRequest(c, "invalid_request_body", "Invalid request body")
+	}
+	if input.Content != nil {
+		if ok, err := formatMessage(c, input.Content, &input.Entities, input.ParseMode); !ok {
+			return err
+		}
+	}
+
+	scheduled, err := h.scheduledService.Update(userID, id, input.UpdateScheduledInput)
+	if err != nil {
+		return scheduledError(c, err)
+	}
+	return c.JSON(scheduled)
+}
+
+// CancelScheduled deletes a pending or failed scheduled message.
+// DELETE /api/scheduled-messages/:id
+func (h *ScheduledMessageHandler) CancelScheduled(c *fiber.Ctx) error {
+	userID, err := httpx.LocalUint(c, "userID")
+	if err != nil {
+		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
+	}
+	id, err := scheduledID(c)
+	if err != nil {
+		return httpx.BadRequest(c, "invalid_scheduled_id", "Invalid scheduled message id")
+	}
+
+	if err := h.scheduledService.Cancel(userID, id); err != nil {
+		return scheduledError(c, err)
+	}
+	return c.JSON(fiber.Map{"message": "Scheduled message cancelled"})
+}
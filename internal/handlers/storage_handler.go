@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/noteduco342/OMMessenger-backend/internal/httpx"
+	"github.com/noteduco342/OMMessenger-backend/internal/service"
+)
+
+type StorageHandler struct {
+	storageService *service.StorageService
+}
+
+func NewStorageHandler(storageService *service.StorageService) *StorageHandler {
+	return &StorageHandler{storageService: storageService}
+}
+
+// GetMyStorage returns the caller's storage usage and plan limits.
+// GET /api/users/me/storage
+func (h *StorageHandler) GetMyStorage(c *fiber.Ctx) error {
+	userID, err := httpx.LocalUint(c, "userID")
+	if err != nil {
+		return httpx.Unauthorized(c, "unauthorized", "Unauthorized")
+	}
+
+	usage, err := h.storageService.Usage(userID)
+	if err != nil {
+		return httpx.Internal(c, "get_storage_usage_failed")
+	}
+	return c.JSON(usage)
+}
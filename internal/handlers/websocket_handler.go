@@ -12,22 +12,27 @@ import (
 )
 
 type WebSocketHandler struct {
-	messageService *service.MessageService
-	userService    *service.UserService
-	groupService   *service.GroupService
-	hub            *ws.Hub
-	userCache      *cache.UserCache
-	messageCache   *cache.MessageCache
+	messageService    *service.MessageService
+	userService       *service.UserService
+	groupService      *service.GroupService
+	attachmentService *service.AttachmentService
+	hub               *ws.Hub
+	delivery          *ws.GroupDelivery
+	userCache         *cache.UserCache
+	messageCache      *cache.MessageCache
 }
 
-func NewWebSocketHandler(messageService *service.MessageService, userService *service.UserService, groupService *service.GroupService, pendingRepo repository.PendingMessageRepositoryInterface, userCache *cache.UserCache, messageCache *cache.MessageCache) *WebSocketHandler {
+func NewWebSocketHandler(messageService *service.MessageService, userService *service.UserService, groupService *service.GroupService, attachmentService *service.AttachmentService, pendingRepo repository.PendingMessageRepositoryInterface, userCache *cache.UserCache, messageCache *cache.MessageCache) *WebSocketHandler {
+	hub := ws.NewHub(pendingRepo)
 	return &WebSocketHandler{
-		messageService: messageService,
-		userService:    userService,
-		groupService:   groupService,
-		hub:            ws.NewHub(pendingRepo),
-		userCache:      userCache,
-		messageCache:   messageCache,
+		messageService:    messageService,
+		userService:       userService,
+		groupService:      groupService,
+		attachmentService: attachmentService,
+		hub:               hub,
+		delivery:          ws.NewGroupDelivery(hub, groupService, messageCache),
+		userCache:         userCache,
+		messageCache:      messageCache,
 	}
 }
 
@@ -36,6 +41,11 @@ func (h *WebSocketHandler) GetHub() *ws.Hub {
 	return h.hub
 }
 
+// GetDelivery returns the group fan-out shared by every sender of group messages
+func (h *WebSocketHandler) GetDelivery() *ws.GroupDelivery {
+	return h.delivery
+}
+
 func (h *WebSocketHandler) HandleWebSocket(c *websocket.Conn) {
 	userID := c.Locals("userID").(uint)
 	wsDebug := os.Getenv("WS_DEBUG") == "true"
@@ -44,7 +54,7 @@ func (h *WebSocketHandler) HandleWebSocket(c *websocket.Conn) {
 	supportsGzip := c.Query("gzip") == "1" || c.Headers("X-Supports-Gzip") == "1"
 
 	// Register client in hub
-	h.hub.Register(userID, c, supportsGzip)
+	client := h.hub.Register(userID, c, supportsGzip)
 
 	// Update user status to online
 	go func() {
@@ -63,6 +73,9 @@ func (h *WebSocketHandler) HandleWebSocket(c *websocket.Conn) {
 		if err := h.hub.FlushPendingMessages(userID); err != nil {
 			log.Printf("Failed to flush pending messages for user %d: %v", userID, err)
 		}
+		if err := h.delivery.SendGroupCatchUp(userID); err != nil {
+			log.Printf("Failed to send group catch-up to user %d: %v", userID, err)
+		}
 	}()
 
 	defer func() {
@@ -85,13 +98,16 @@ func (h *WebSocketHandler) HandleWebSocket(c *websocket.Conn) {
 	// Create message context
 	ctx := &ws.MessageContext{
 		UserID:         userID,
-		Conn:           c,
+		Conn:           client,
 		Hub:            h.hub,
 		MessageService: h.messageService,
 		UserService:    h.userService,
 		GroupService:   h.groupService,
 		MessageCache:   h.messageCache,
 		UserCache:      h.userCache,
+
+		AttachmentService: h.attachmentService,
+		Delivery:          h.delivery,
 	}
 
 	// Handle incoming messages
@@ -111,7 +127,7 @@ func (h *WebSocketHandler) HandleWebSocket(c *websocket.Conn) {
 			decompressed, err := ws.DecompressMessage(messageBytes)
 			if err != nil {
 				log.Printf("Error decompressing message from user %d: %v", userID, err)
-				ws.SendError(c, "decompression_failed", "Failed to decompress message", err.Error())
+				ws.SendError(client, "decompression_failed", "Failed to decompress message", err.Error())
 				continue
 			}
 			messageBytes = decompressed
@@ -121,14 +137,14 @@ func (h *WebSocketHandler) HandleWebSocket(c *websocket.Conn) {
 		msg, err := ws.Deserialize(messageBytes)
 		if err != nil {
 			log.Printf("Error deserializing message from user %d: %v", userID, err)
-			ws.SendError(c, "invalid_message", "Invalid message format", err.Error())
+			ws.SendError(client, "invalid_message", "Invalid message format", err.Error())
 			continue
 		}
 
 		// Process message
 		if err := msg.Process(ctx); err != nil {
 			log.Printf("Error processing message %s from user %d: %v", msg.GetType(), userID, err)
-			ws.SendError(c, "processing_failed", "Failed to process message", err.Error())
+			ws.SendError(client, "processing_failed", "Failed to process message", err.Error())
 		}
 	}
 
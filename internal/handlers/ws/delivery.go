@@ -0,0 +1,419 @@
+package ws
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/cache"
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/service"
+)
+
+const (
+	fanoutWorkers   = 8
+	fanoutQueueSize = 256
+
+	// readReceiptMaxMembers is the largest group whose members are told about
+	// each other's read marks; beyond it per-reader receipts are noise.
+	readReceiptMaxMembers = 200
+)
+
+// fanoutJob is one worker's share of a group message's online recipients.
+type fanoutJob struct {
+	userIDs []uint
+	msg     *PreparedMessage
+}
+
+// GroupDelivery fans stored group messages out to members through the hub.
+// It implements service.MessageDelivery for messages the server creates
+// itself, such as system messages, service.ScheduledDelivery for scheduled
+// messages, which have no live connection to send them through,
+// service.ExpiryDelivery for disappearing messages and
+// service.LinkPreviewDelivery for link previews attached after sending.
+//
+// Only online members are written to; nothing is queued per member. Offline
+// members catch up from their group read state and the message log when they
+// reconnect (see SendGroupCatchUp).
+type GroupDelivery struct {
+	hub          *Hub
+	groupService *service.GroupService
+	messageCache *cache.MessageCache
+	workers      []chan fanoutJob
+}
+
+func NewGroupDelivery(hub *Hub, groupService *service.GroupService, messageCache *cache.MessageCache) *GroupDelivery {
+	d := &GroupDelivery{
+		hub:          hub,
+		groupService: groupService,
+		messageCache: messageCache,
+		workers:      make([]chan fanoutJob, fanoutWorkers),
+	}
+	for i := range d.workers {
+		d.workers[i] = make(chan fanoutJob, fanoutQueueSize)
+		go d.fanoutWorker(d.workers[i])
+	}
+	return d
+}
+
+// fanoutWorker writes prepared messages to its share of recipients. Each user
+// always lands on the same worker, so their messages keep their order.
+func (d *GroupDelivery) fanoutWorker(jobs <-chan fanoutJob) {
+	for job := range jobs {
+		for _, userID := range job.userIDs {
+			d.hub.SendPrepared(userID, job.msg)
+		}
+	}
+}
+
+// DeliverGroupMessage sends the message to every online member except
+// skipUserID (0 to include everyone) and invalidates the affected caches.
+// The payload is encoded once and the writes happen on the worker pool, so
+// the caller doesn't wait on slow connections.
+func (d *GroupDelivery) DeliverGroupMessage(message *models.Message, skipUserID uint) {
+	if message.GroupID == nil {
+		return
+	}
+	groupID := *message.GroupID
+	if d.messageCache != nil {
+		_ = d.messageCache.InvalidateGroupConversation(groupID)
+	}
+
+	memberIDs, err := d.groupService.GetMemberIDs(groupID)
+	if err != nil {
+		log.Printf("group %d: failed to load members for message %d: %v", groupID, message.ID, err)
+		return
+	}
+	if d.messageCache != nil {
+		_ = d.messageCache.InvalidateConversationLists(memberIDs)
+	}
+
+	msg, err := d.hub.PrepareMessage(map[string]interface{}{
+		"type":    "message",
+		"message": message.ToResponse(),
+	})
+	if err != nil {
+		log.Printf("group %d: failed to encode message %d: %v", groupID, message.ID, err)
+		return
+	}
+	d.fanout(memberIDs, skipUserID, msg)
+	d.deliverMentions(message, memberIDs)
+}
+
+// deliverMentions sends a mention event to the online users the message
+// mentions, or to every member but the sender for @all.
+func (d *GroupDelivery) deliverMentions(message *models.Message, memberIDs []uint) {
+	mentioned, all := service.MentionedUserIDs(message)
+	if all {
+		mentioned = memberIDs
+	}
+	if len(mentioned) == 0 {
+		return
+	}
+	var topicID uint
+	conversationID := fmt.Sprintf("group_%d", *message.GroupID)
+	if message.TopicID != nil {
+		topicID = *message.TopicID
+		conversationID = fmt.Sprintf("topic_%d", topicID)
+	}
+	msg, err := d.hub.PrepareMessage(map[string]interface{}{
+		"type":            "mention",
+		"conversation_id": conversationID,
+		"group_id":        *message.GroupID,
+		"topic_id":        topicID,
+		"message_id":      message.ID,
+		"sender_id":       message.SenderID,
+	})
+	if err != nil {
+		log.Printf("group %d: failed to encode mention of message %d: %v", *message.GroupID, message.ID, err)
+		return
+	}
+	d.fanout(mentioned, message.SenderID, msg)
+}
+
+// fanout queues msg for the online members except skipUserID. It never
+// blocks: when a worker's queue is full its share is dropped, and those
+// members miss the live event and see the message when they next sync.
+func (d *GroupDelivery) fanout(memberIDs []uint, skipUserID uint, msg *PreparedMessage) {
+	shares := make([][]uint, len(d.workers))
+	for _, id := range d.hub.OnlineAmong(memberIDs) {
+		if id == skipUserID {
+			continue
+		}
+		w := id % uint(len(d.workers))
+		shares[w] = append(shares[w], id)
+	}
+	for w, userIDs := range shares {
+		if len(userIDs) == 0 {
+			continue
+		}
+		select {
+		case d.workers[w] <- fanoutJob{userIDs: userIDs, msg: msg}:
+		default:
+			log.Printf("fan-out worker %d is backed up; dropped a message for %d users", w, len(userIDs))
+		}
+	}
+}
+
+// DeliverReadUpdate tells the other online members of a group that the reader
+// has read up to lastRead. Channels keep read marks to the reader, as they
+// would reveal the subscribers, and large groups skip the receipts.
+func (d *GroupDelivery) DeliverReadUpdate(groupID, topicID, readerID, lastRead uint) {
+	group, err := d.groupService.GetGroupInfo(groupID)
+	if err != nil || group.IsChannel() {
+		return
+	}
+	memberIDs, err := d.groupService.GetMemberIDs(groupID)
+	if err != nil || len(memberIDs) > readReceiptMaxMembers {
+		return
+	}
+	msg, err := d.hub.PrepareMessage(map[string]interface{}{
+		"type":                 "group_read_update",
+		"group_id":             groupID,
+		"topic_id":             topicID,
+		"user_id":              readerID,
+		"last_read_message_id": lastRead,
+	})
+	if err != nil {
+		log.Printf("group %d: failed to encode read update: %v", groupID, err)
+		return
+	}
+	d.fanout(memberIDs, readerID, msg)
+}
+
+// conversationKey identifies a group topic or a direct conversation, whose
+// user IDs are stored lower first.
+type conversationKey struct {
+	groupID, topicID uint
+	userIDs          [2]uint
+}
+
+// deletedBatch is the expired messages of one conversation.
+type deletedBatch struct {
+	conversationKey
+	messageIDs []uint
+}
+
+// DeliverMessagesDeleted tells the participants of each affected conversation
+// which expired messages were deleted and drops the cached copies. Direct
+// conversations go to both users, group ones to online members.
+func (d *GroupDelivery) DeliverMessagesDeleted(messages []models.Message) {
+	var batches []*deletedBatch
+	index := make(map[conversationKey]*deletedBatch)
+	for _, m := range messages {
+		var key conversationKey
+		switch {
+		case m.GroupID != nil:
+			key.groupID = *m.GroupID
+			if m.TopicID != nil {
+				key.topicID = *m.TopicID
+			}
+		case m.RecipientID != nil:
+			key.userIDs = [2]uint{m.SenderID, *m.RecipientID}
+			if key.userIDs[0] > key.userIDs[1] {
+				key.userIDs[0], key.userIDs[1] = key.userIDs[1], key.userIDs[0]
+			}
+		default:
+			continue
+		}
+		batch, ok := index[key]
+		if !ok {
+			batch = &deletedBatch{conversationKey: key}
+			index[key] = batch
+			batches = append(batches, batch)
+		}
+		batch.messageIDs = append(batch.messageIDs, m.ID)
+	}
+
+	for _, batch := range batches {
+		if batch.groupID != 0 {
+			d.deliverGroupDeleted(batch)
+		} else {
+			d.deliverDirectDeleted(batch)
+		}
+	}
+}
+
+func (d *GroupDelivery) deliverDirectDeleted(batch *deletedBatch) {
+	a, b := batch.userIDs[0], batch.userIDs[1]
+	if d.messageCache != nil {
+		_ = d.messageCache.InvalidateConversation(a, b)
+		_ = d.messageCache.InvalidateConversationLists([]uint{a, b})
+		_ = d.messageCache.InvalidateUnreadCount(a, b)
+		_ = d.messageCache.InvalidateUnreadCount(b, a)
+	}
+	for _, pair := range [][2]uint{{a, b}, {b, a}} {
+		if !d.hub.IsOnline(pair[0]) {
+			continue
+		}
+		_ = d.hub.SendToUser(pair[0], map[string]interface{}{
+			"type":            "message_deleted",
+			"conversation_id": fmt.Sprintf("user_%d", pair[1]),
+			"message_ids":     batch.messageIDs,
+			"reason":          "expired",
+		})
+	}
+}
+
+func (d *GroupDelivery) deliverGroupDeleted(batch *deletedBatch) {
+	if d.messageCache != nil {
+		_ = d.messageCache.InvalidateGroupConversation(batch.groupID)
+	}
+	memberIDs, err := d.groupService.GetMemberIDs(batch.groupID)
+	if err != nil {
+		log.Printf("group %d: failed to load members for deleted messages: %v", batch.groupID, err)
+		return
+	}
+	if d.messageCache != nil {
+		_ = d.messageCache.InvalidateConversationLists(memberIDs)
+	}
+
+	conversationID := fmt.Sprintf("group_%d", batch.groupID)
+	if batch.topicID != 0 {
+		conversationID = fmt.Sprintf("topic_%d", batch.topicID)
+	}
+	msg, err := d.hub.PrepareMessage(map[string]interface{}{
+		"type":            "message_deleted",
+		"conversation_id": conversationID,
+		"group_id":        batch.groupID,
+		"topic_id":        batch.topicID,
+		"message_ids":     batch.messageIDs,
+		"reason":          "expired",
+	})
+	if err != nil {
+		log.Printf("group %d: failed to encode deleted messages: %v", batch.groupID, err)
+		return
+	}
+	d.fanout(memberIDs, 0, msg)
+}
+
+// DeliverDirectMessage sends a stored direct message to both participants,
+// as a live send does for the recipient, and invalidates their caches.
+func (d *GroupDelivery) DeliverDirectMessage(message *models.Message) {
+	if message.RecipientID == nil {
+		return
+	}
+	recipientID := *message.RecipientID
+	if d.messageCache != nil {
+		_ = d.messageCache.InvalidateConversation(message.SenderID, recipientID)
+		_ = d.messageCache.InvalidateConversationList(message.SenderID)
+		_ = d.messageCache.InvalidateConversationList(recipientID)
+		_ = d.messageCache.InvalidateUnreadCount(recipientID, message.SenderID)
+	}
+
+	event := map[string]interface{}{
+		"type":    "message",
+		"message": message.ToResponse(),
+	}
+	if err := d.hub.SendToUserWithID(recipientID, message.ID, event); err != nil {
+		log.Printf("message %d: failed to deliver to %d: %v", message.ID, recipientID, err)
+	}
+	if recipientID != message.SenderID && d.hub.IsOnline(message.SenderID) {
+		_ = d.hub.SendToUser(message.SenderID, event)
+	}
+}
+
+// DeliverMessageUpdated sends a message_updated event with the stored message
+// to the participants of its conversation and drops the cached copies. Direct
+// messages go to both users, group ones to online members.
+func (d *GroupDelivery) DeliverMessageUpdated(message *models.Message) {
+	switch {
+	case message.GroupID != nil:
+		d.deliverGroupUpdated(message)
+	case message.RecipientID != nil:
+		d.deliverDirectUpdated(message)
+	}
+}
+
+func (d *GroupDelivery) deliverDirectUpdated(message *models.Message) {
+	a, b := message.SenderID, *message.RecipientID
+	if d.messageCache != nil {
+		_ = d.messageCache.InvalidateConversation(a, b)
+		_ = d.messageCache.InvalidateConversationLists([]uint{a, b})
+	}
+	resp := message.ToResponse()
+	for _, pair := range [][2]uint{{a, b}, {b, a}} {
+		if !d.hub.IsOnline(pair[0]) {
+			continue
+		}
+		_ = d.hub.SendToUser(pair[0], map[string]interface{}{
+			"type":            "message_updated",
+			"conversation_id": fmt.Sprintf("user_%d", pair[1]),
+			"message":         resp,
+		})
+	}
+}
+
+func (d *GroupDelivery) deliverGroupUpdated(message *models.Message) {
+	groupID := *message.GroupID
+	if d.messageCache != nil {
+		_ = d.messageCache.InvalidateGroupConversation(groupID)
+	}
+	memberIDs, err := d.groupService.GetMemberIDs(groupID)
+	if err != nil {
+		log.Printf("group %d: failed to load members for updated message %d: %v", groupID, message.ID, err)
+		return
+	}
+	if d.messageCache != nil {
+		_ = d.messageCache.InvalidateConversationLists(memberIDs)
+	}
+
+	var topicID uint
+	conversationID := fmt.Sprintf("group_%d", groupID)
+	if message.TopicID != nil {
+		topicID = *message.TopicID
+		conversationID = fmt.Sprintf("topic_%d", topicID)
+	}
+	msg, err := d.hub.PrepareMessage(map[string]interface{}{
+		"type":            "message_updated",
+		"conversation_id": conversationID,
+		"group_id":        groupID,
+		"topic_id":        topicID,
+		"message":         message.ToResponse(),
+	})
+	if err != nil {
+		log.Printf("group %d: failed to encode updated message %d: %v", groupID, message.ID, err)
+		return
+	}
+	d.fanout(memberIDs, 0, msg)
+}
+
+// NotifyUser sends an event to the user's connection, if they are online.
+func (d *GroupDelivery) NotifyUser(userID uint, event map[string]interface{}) {
+	if d.hub.IsOnline(userID) {
+		_ = d.hub.SendToUser(userID, event)
+	}
+}
+
+// SendGroupCatchUp tells a reconnecting user which groups and forum topics
+// have messages past their read mark, so the client can sync them from the
+// message log.
+func (d *GroupDelivery) SendGroupCatchUp(userID uint) error {
+	rows, err := d.groupService.ListGroupsBehind(userID)
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+	groups := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		conversationID := fmt.Sprintf("group_%d", row.GroupID)
+		if row.TopicID != 0 {
+			conversationID = fmt.Sprintf("topic_%d", row.TopicID)
+		}
+		groups[i] = map[string]interface{}{
+			"conversation_id":      conversationID,
+			"group_id":             row.GroupID,
+			"topic_id":             row.TopicID,
+			"last_read_message_id": row.LastReadMessageID,
+			"latest_message_id":    row.LatestMessageID,
+			"unread_count":         row.UnreadCount,
+		}
+	}
+	msg, err := d.hub.PrepareMessage(map[string]interface{}{
+		"type":   "group_catchup",
+		"groups": groups,
+	})
+	if err != nil {
+		return err
+	}
+	d.hub.SendPrepared(userID, msg)
+	return nil
+}
@@ -0,0 +1,157 @@
+package ws
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// connectUsers serves the hub over a local listener and opens a client
+// connection for each user, returning once all of them are registered.
+func connectUsers(t *testing.T, hub *Hub, userIDs ...uint) map[uint]*fws.Conn {
+	t.Helper()
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/ws", websocket.New(func(c *websocket.Conn) {
+		id, _ := strconv.ParseUint(c.Query("user"), 10, 32)
+		hub.Register(uint(id), c, false)
+		defer hub.Unregister(uint(id))
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	conns := make(map[uint]*fws.Conn, len(userIDs))
+	for _, id := range userIDs {
+		conn, _, err := fws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/ws?user="+strconv.Itoa(int(id)), nil)
+		if err != nil {
+			t.Fatalf("dial user %d: %v", id, err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		conns[id] = conn
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(hub.OnlineAmong(userIDs)) < len(userIDs) {
+		if time.Now().After(deadline) {
+			t.Fatal("users not registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return conns
+}
+
+// readEvent reads the next event from conn, or returns nil on timeout.
+func readEvent(t *testing.T, conn *fws.Conn, timeout time.Duration) map[string]interface{} {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return nil
+		}
+		t.Fatalf("read: %v", err)
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("decode %q: %v", data, err)
+	}
+	return event
+}
+
+func TestFanoutDeliversThroughWorkers(t *testing.T) {
+	hub := NewHub(nil)
+	d := NewGroupDelivery(hub, nil, nil)
+	conns := connectUsers(t, hub, 1, 2, 3)
+
+	// User 4 is offline and user 2 is skipped; every other member gets the
+	// messages in order.
+	const count = 20
+	for i := 0; i < count; i++ {
+		msg, err := hub.PrepareMessage(map[string]interface{}{"type": "message", "n": i})
+		if err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+		d.fanout([]uint{1, 2, 3, 4}, 2, msg)
+	}
+	for _, id := range []uint{1, 3} {
+		for i := 0; i < count; i++ {
+			event := readEvent(t, conns[id], 5*time.Second)
+			if event == nil || event["n"] != float64(i) {
+				t.Fatalf("user %d event %d = %v", id, i, event)
+			}
+		}
+	}
+	if event := readEvent(t, conns[2], 100*time.Millisecond); event != nil {
+		t.Fatalf("skipped user got %v", event)
+	}
+}
+
+func TestFanoutWritesAlongsideHub(t *testing.T) {
+	hub := NewHub(nil)
+	d := NewGroupDelivery(hub, nil, nil)
+	conns := connectUsers(t, hub, 1)
+
+	// The workers and direct sends write to the same connection at once;
+	// every frame has to arrive whole.
+	const count = 50
+	msg, _ := hub.PrepareMessage(map[string]interface{}{"type": "message"})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; i++ {
+			d.fanout([]uint{1}, 0, msg)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; i++ {
+			_ = hub.SendToUser(1, map[string]interface{}{"type": "typing"})
+		}
+	}()
+	wg.Wait()
+
+	for i := 0; i < 2*count; i++ {
+		if event := readEvent(t, conns[1], 5*time.Second); event == nil {
+			t.Fatalf("got %d of %d events", i, 2*count)
+		}
+	}
+}
+
+func TestFanoutDropsWhenWorkerBackedUp(t *testing.T) {
+	hub := NewHub(nil)
+	connectUsers(t, hub, 1)
+	// A worker that never drains its queue.
+	queue := make(chan fanoutJob, 1)
+	d := &GroupDelivery{hub: hub, workers: []chan fanoutJob{queue}}
+	msg, _ := hub.PrepareMessage(map[string]interface{}{"type": "message"})
+
+	done := make(chan struct{})
+	go func() {
+		d.fanout([]uint{1}, 0, msg)
+		d.fanout([]uint{1}, 0, msg)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fanout blocked on a full worker queue")
+	}
+	if len(queue) != 1 {
+		t.Fatalf("queued jobs = %d", len(queue))
+	}
+}
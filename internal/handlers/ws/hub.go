@@ -21,6 +21,25 @@ type ClientConnection struct {
 	SupportsGzip bool
 	PingTicker   *time.Ticker
 	CloseChan    chan struct{}
+
+	// writeMu serializes writes: the connection's own handler, the hub and
+	// the fan-out workers all write to it, and a websocket connection
+	// supports only one concurrent writer.
+	writeMu sync.Mutex
+}
+
+// WriteMessage writes a data frame to the connection.
+func (c *ClientConnection) WriteMessage(frameType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.WriteMessage(frameType, data)
+}
+
+// WriteJSON writes v to the connection as a JSON text frame.
+func (c *ClientConnection) WriteJSON(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.WriteJSON(v)
 }
 
 // Hub manages all active WebSocket connections
@@ -63,8 +82,9 @@ func NewHub(pendingRepo repository.PendingMessageRepositoryInterface) *Hub {
 	return hub
 }
 
-// Register adds a client connection with health monitoring
-func (h *Hub) Register(userID uint, conn *websocket.Conn, supportsGzip bool) {
+// Register adds a client connection with health monitoring. Writes to conn
+// must go through the returned ClientConnection from then on.
+func (h *Hub) Register(userID uint, conn *websocket.Conn, supportsGzip bool) *ClientConnection {
 	clientConn := &ClientConnection{
 		Conn:         conn,
 		UserID:       userID,
@@ -95,6 +115,7 @@ func (h *Hub) Register(userID uint, conn *websocket.Conn, supportsGzip bool) {
 	go h.pingRoutine(clientConn)
 
 	log.Printf("User %d connected to hub (total: %d, gzip: %v)", userID, len(h.clients), supportsGzip)
+	return clientConn
 }
 
 // Unregister removes a client connection
@@ -157,7 +178,7 @@ func (h *Hub) SendToUserWithID(userID uint, messageID uint, data interface{}) er
 		finalData = jsonData
 	}
 
-	if err := clientConn.Conn.WriteMessage(frameType, finalData); err != nil {
+	if err := clientConn.WriteMessage(frameType, finalData); err != nil {
 		log.Printf("Error sending message to user %d: %v", userID, err)
 		// Connection may be dead, unregister and queue message
 		h.Unregister(userID)
@@ -211,7 +232,7 @@ func (h *Hub) Broadcast(data interface{}) {
 	}
 
 	for userID, clientConn := range clients {
-		if err := clientConn.Conn.WriteMessage(websocket.TextMessage, jsonData); err != nil {
+		if err := clientConn.WriteMessage(websocket.TextMessage, jsonData); err != nil {
 			log.Printf("Error broadcasting to user %d: %v", userID, err)
 			h.Unregister(userID)
 		}
@@ -231,13 +252,71 @@ func (h *Hub) BroadcastToUsers(userIDs []uint, data interface{}) {
 
 	for _, userID := range userIDs {
 		if clientConn, exists := h.clients[userID]; exists {
-			if err := clientConn.Conn.WriteMessage(websocket.TextMessage, jsonData); err != nil {
+			if err := clientConn.WriteMessage(websocket.TextMessage, jsonData); err != nil {
 				log.Printf("Error sending to user %d: %v", userID, err)
 			}
 		}
 	}
 }
 
+// PreparedMessage is a payload encoded once for delivery to many users.
+type PreparedMessage struct {
+	data       []byte
+	compressed []byte // nil unless gzip saves space
+}
+
+// PrepareMessage marshals data and, for payloads worth it, gzips it so that
+// fan-out doesn't repeat the work per recipient.
+func (h *Hub) PrepareMessage(data interface{}) (*PreparedMessage, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	msg := &PreparedMessage{data: jsonData}
+	if len(jsonData) > 512 {
+		if compressed, err := h.compressData(jsonData); err == nil && len(compressed) < len(jsonData) {
+			msg.compressed = compressed
+		}
+	}
+	return msg, nil
+}
+
+// SendPrepared writes msg to the user if they are connected. Nothing is
+// queued: it reports false when the user is offline or the write failed.
+func (h *Hub) SendPrepared(userID uint, msg *PreparedMessage) bool {
+	h.clientsMux.RLock()
+	clientConn, exists := h.clients[userID]
+	h.clientsMux.RUnlock()
+	if !exists {
+		return false
+	}
+
+	frameType, data := websocket.TextMessage, msg.data
+	if clientConn.SupportsGzip && msg.compressed != nil {
+		frameType, data = websocket.BinaryMessage, msg.compressed
+	}
+	if err := clientConn.WriteMessage(frameType, data); err != nil {
+		log.Printf("Error sending message to user %d: %v", userID, err)
+		h.Unregister(userID)
+		return false
+	}
+	return true
+}
+
+// OnlineAmong returns the users in userIDs that are currently connected.
+func (h *Hub) OnlineAmong(userIDs []uint) []uint {
+	h.clientsMux.RLock()
+	defer h.clientsMux.RUnlock()
+
+	online := make([]uint, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if _, exists := h.clients[userID]; exists {
+			online = append(online, userID)
+		}
+	}
+	return online
+}
+
 // GetOnlineUsers returns list of currently connected user IDs
 func (h *Hub) GetOnlineUsers() []uint {
 	h.clientsMux.RLock()
@@ -307,7 +386,7 @@ func (h *Hub) FlushPendingMessages(userID uint) error {
 		"count":    len(batch),
 	}
 
-	if err := clientConn.Conn.WriteJSON(batchMessage); err != nil {
+	if err := clientConn.WriteJSON(batchMessage); err != nil {
 		log.Printf("Error sending batch to user %d: %v", userID, err)
 		// Connection failed, messages stay in queue
 		return err
@@ -376,7 +455,7 @@ func (h *Hub) retryWorker() {
 			}
 
 			jsonData, _ := json.Marshal(data)
-			if err := clientConn.Conn.WriteMessage(websocket.TextMessage, jsonData); err != nil {
+			if err := clientConn.WriteMessage(websocket.TextMessage, jsonData); err != nil {
 				log.Printf("Retry delivery failed for user %d: %v", pm.UserID, err)
 				// Mark for next retry
 				attempts := pm.Attempts + 1
@@ -2,10 +2,10 @@ package ws
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 
-	"github.com/gofiber/websocket/v2"
 	"github.com/noteduco342/OMMessenger-backend/internal/cache"
 	"github.com/noteduco342/OMMessenger-backend/internal/service"
 )
@@ -13,13 +13,16 @@ import (
 // MessageContext provides all dependencies needed for message processing
 type MessageContext struct {
 	UserID         uint
-	Conn           *websocket.Conn
+	Conn           *ClientConnection
 	Hub            *Hub
 	MessageService *service.MessageService
 	UserService    *service.UserService
 	GroupService   *service.GroupService
 	MessageCache   *cache.MessageCache
 	UserCache      *cache.UserCache
+
+	AttachmentService *service.AttachmentService
+	Delivery          *GroupDelivery
 }
 
 // Message interface for all WebSocket message types
@@ -40,6 +43,8 @@ type ErrorResponse struct {
 	Error   string `json:"error"`
 	Code    string `json:"code"`
 	Details string `json:"details,omitempty"`
+	// RetryAfter is set on slow_mode errors, in seconds.
+	RetryAfter int `json:"retry_after,omitempty"`
 }
 
 func ToJson(msg Message) ([]byte, error) {
@@ -61,7 +66,7 @@ func CreateMessage(msgType string, typeRegistry map[string]reflect.Type) (Messag
 }
 
 // SendError sends an error response to the client
-func SendError(conn *websocket.Conn, code, message, details string) error {
+func SendError(conn *ClientConnection, code, message, details string) error {
 	errResp := ErrorResponse{
 		Type:    "error",
 		Error:   message,
@@ -70,3 +75,36 @@ func SendError(conn *websocket.Conn, code, message, details string) error {
 	}
 	return conn.WriteJSON(errResp)
 }
+
+// sendSlowModeError tells the client to wait before posting to the group again.
+func sendSlowModeError(ctx *MessageContext, err *service.SlowModeError) error {
+	return ctx.Conn.WriteJSON(ErrorResponse{
+		Type:       "error",
+		Error:      "Slow mode is on; wait before sending again",
+		Code:       "slow_mode",
+		RetryAfter: err.RetrySeconds(),
+	})
+}
+
+// sendGroupAccessError reports a GroupService.Authorize failure to the client.
+func sendGroupAccessError(ctx *MessageContext, err error) error {
+	if errors.Is(err, service.ErrNotGroupMember) {
+		return SendError(ctx.Conn, "not_group_member", "Not a group member", "")
+	}
+	if errors.Is(err, service.ErrChannelAdminOnly) {
+		return SendError(ctx.Conn, "channel_admin_only", "Only admins can post in this channel", "")
+	}
+	if errors.Is(err, service.ErrGroupPermissionDenied) {
+		return SendError(ctx.Conn, "missing_permission", "Not allowed in this group", "")
+	}
+	if errors.Is(err, service.ErrTopicNotFound) {
+		return SendError(ctx.Conn, "topic_not_found", "Topic not found", "")
+	}
+	if errors.Is(err, service.ErrTopicClosed) {
+		return SendError(ctx.Conn, "topic_closed", "This topic is closed", "")
+	}
+	if errors.Is(err, service.ErrNotForum) {
+		return SendError(ctx.Conn, "not_forum", "This group has no topics", "")
+	}
+	return SendError(ctx.Conn, "membership_check_failed", "Failed to check group membership", err.Error())
+}
@@ -2,12 +2,16 @@ package ws
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"time"
 
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/richtext"
+	"github.com/noteduco342/OMMessenger-backend/internal/service"
+	"github.com/noteduco342/OMMessenger-backend/internal/validation"
 )
 
 const (
@@ -93,12 +97,16 @@ type SyncResponse struct {
 
 // MessageChat is a new chat message from client
 type MessageChat struct {
-	ClientID       string `json:"client_id"` // UUID from client for deduplication
-	ConversationID string `json:"conversation_id"`
-	RecipientID    *uint  `json:"recipient_id,omitempty"`
-	GroupID        *uint  `json:"group_id,omitempty"`
-	Content        string `json:"content"`
-	MessageType    string `json:"message_type"`
+	ClientID       string                 `json:"client_id"` // UUID from client for deduplication
+	ConversationID string                 `json:"conversation_id"`
+	RecipientID    *uint                  `json:"recipient_id,omitempty"`
+	GroupID        *uint                  `json:"group_id,omitempty"`
+	TopicID        *uint                  `json:"topic_id,omitempty"` // forum topic; omit for General
+	Content        string                 `json:"content"`
+	Entities       []models.MessageEntity `json:"entities,omitempty"`
+	ParseMode      richtext.ParseMode     `json:"parse_mode,omitempty"` // "markdown" instead of entities
+	MessageType    string                 `json:"message_type"`
+	AttachmentID   *uint                  `json:"attachment_id,omitempty"`
 }
 
 func (msg *MessageChat) GetType() string {
@@ -117,13 +125,38 @@ func (msg *MessageChat) Process(ctx *MessageContext) error {
 	if msg.RecipientID != nil && msg.GroupID != nil {
 		return SendError(ctx.Conn, "invalid_target", "Only one of recipient_id or group_id is allowed", "")
 	}
+	if msg.TopicID != nil && (msg.GroupID == nil || *msg.TopicID == 0) {
+		return SendError(ctx.Conn, "invalid_topic", "topic_id needs a group_id", "")
+	}
+	content, entities, err := richtext.Format(msg.Content, msg.Entities, msg.ParseMode, validation.MaxMessageLength())
+	if err != nil {
+		code, _ := service.EntityErrorCode(err)
+		return SendError(ctx.Conn, code, "Invalid message formatting", "")
+	}
+	msg.Content, msg.Entities = content, entities
+	if msg.AttachmentID != nil {
+		if ctx.AttachmentService == nil {
+			return SendError(ctx.Conn, "storage_not_configured", "Attachments are not available", "")
+		}
+		if _, err := ctx.AttachmentService.CheckAttachable(ctx.UserID, *msg.AttachmentID); err != nil {
+			if errors.Is(err, service.ErrAttachmentInfected) {
+				return SendError(ctx.Conn, "attachment_infected", "Attachment failed malware scan", "")
+			}
+			return SendError(ctx.Conn, "invalid_attachment", "Invalid attachment_id", "")
+		}
+	}
 	if msg.GroupID != nil {
-		isMember, err := ctx.GroupService.IsMember(*msg.GroupID, ctx.UserID)
-		if err != nil {
-			return SendError(ctx.Conn, "membership_check_failed", "Failed to check group membership", err.Error())
+		perm := models.PermSendMessages
+		if msg.AttachmentID != nil {
+			perm |= models.PermSendMedia
 		}
-		if !isMember {
-			return SendError(ctx.Conn, "not_group_member", "Not a group member", "")
+		if err := ctx.GroupService.Authorize(*msg.GroupID, ctx.UserID, perm); err != nil {
+			return sendGroupAccessError(ctx, err)
+		}
+		if msg.TopicID != nil {
+			if err := ctx.GroupService.CheckTopicPost(*msg.GroupID, *msg.TopicID, ctx.UserID); err != nil {
+				return sendGroupAccessError(ctx, err)
+			}
 		}
 	}
 
@@ -144,12 +177,24 @@ func (msg *MessageChat) Process(ctx *MessageContext) error {
 		}
 		return ctx.Conn.WriteJSON(ackWrapper)
 	}
+	if msg.GroupID != nil {
+		if err := ctx.GroupService.CheckSendRate(*msg.GroupID, ctx.UserID); err != nil {
+			var slow *service.SlowModeError
+			if errors.As(err, &slow) {
+				return sendSlowModeError(ctx, slow)
+			}
+			return sendGroupAccessError(ctx, err)
+		}
+	}
 
 	// Save message to database
 	log.Printf("💾 Saving new message to database...")
 	messageType := parseMessageType(msg.MessageType)
-	message, err := ctx.MessageService.CreateWithClientIDAndType(ctx.UserID, msg.ClientID, msg.RecipientID, msg.GroupID, msg.Content, messageType)
+	message, err := ctx.MessageService.CreateWithAttachment(ctx.UserID, msg.ClientID, msg.RecipientID, msg.GroupID, msg.TopicID, msg.Content, msg.Entities, messageType, msg.AttachmentID)
 	if err != nil {
+		if code, ok := service.EntityErrorCode(err); ok {
+			return SendError(ctx.Conn, code, "Invalid message formatting", "")
+		}
 		log.Printf("❌ Error saving message: %v", err)
 		return SendError(ctx.Conn, "save_failed", "Failed to save message", err.Error())
 	}
@@ -162,9 +207,6 @@ func (msg *MessageChat) Process(ctx *MessageContext) error {
 		_ = ctx.MessageCache.InvalidateConversationList(*msg.RecipientID)
 		_ = ctx.MessageCache.InvalidateUnreadCount(*msg.RecipientID, ctx.UserID)
 	}
-	if msg.GroupID != nil && ctx.MessageCache != nil {
-		_ = ctx.MessageCache.InvalidateGroupConversation(*msg.GroupID)
-	}
 
 	// Send ACK to sender with proper wrapper
 	log.Printf("📤 Sending ACK to sender...")
@@ -191,26 +233,8 @@ func (msg *MessageChat) Process(ctx *MessageContext) error {
 			"type":    "message",
 			"message": message.ToResponse(),
 		})
-	} else if msg.GroupID != nil {
-		// Broadcast to group members
-		members, err := ctx.GroupService.GetGroupMembers(*msg.GroupID)
-		if err == nil {
-			var memberIDs []uint
-			for _, member := range members {
-				if member.ID != ctx.UserID {
-					memberIDs = append(memberIDs, member.ID)
-				}
-			}
-			for _, memberID := range memberIDs {
-				_ = ctx.Hub.SendToUserWithID(memberID, message.ID, map[string]interface{}{
-					"type":    "message",
-					"message": message.ToResponse(),
-				})
-				if ctx.MessageCache != nil {
-					_ = ctx.MessageCache.InvalidateConversationList(memberID)
-				}
-			}
-		}
+	} else if msg.GroupID != nil && ctx.Delivery != nil {
+		ctx.Delivery.DeliverGroupMessage(message, ctx.UserID)
 	}
 
 	return nil
@@ -324,9 +348,11 @@ func (msg *MessageDelivery) Process(ctx *MessageContext) error {
 	return ctx.MessageService.MarkAsDelivered(msg.MessageID)
 }
 
-// MessageGroupRead updates per-member read state for groups
+// MessageGroupRead updates per-member read state for groups, per topic in
+// forum groups
 type MessageGroupRead struct {
 	GroupID           uint `json:"group_id"`
+	TopicID           uint `json:"topic_id,omitempty"` // 0 is the General stream
 	LastReadMessageID uint `json:"last_read_message_id"`
 }
 
@@ -339,16 +365,15 @@ func (msg *MessageGroupRead) Process(ctx *MessageContext) error {
 		return SendError(ctx.Conn, "missing_group_id", "group_id is required", "")
 	}
 
-	isMember, err := ctx.GroupService.IsMember(msg.GroupID, ctx.UserID)
-	if err != nil {
-		return SendError(ctx.Conn, "membership_check_failed", "Failed to check group membership", err.Error())
+	if err := ctx.GroupService.Authorize(msg.GroupID, ctx.UserID, 0); err != nil {
+		return sendGroupAccessError(ctx, err)
 	}
-	if !isMember {
-		return SendError(ctx.Conn, "not_group_member", "Not a group member", "")
+	if err := ctx.GroupService.CheckTopic(msg.GroupID, msg.TopicID); err != nil {
+		return sendGroupAccessError(ctx, err)
 	}
 
 	if msg.LastReadMessageID > 0 {
-		belongs, err := ctx.MessageService.IsMessageInGroup(msg.LastReadMessageID, msg.GroupID)
+		belongs, err := ctx.MessageService.IsMessageInGroup(msg.LastReadMessageID, msg.GroupID, msg.TopicID)
 		if err != nil {
 			return SendError(ctx.Conn, "validate_message_failed", "Failed to validate message", err.Error())
 		}
@@ -357,7 +382,7 @@ func (msg *MessageGroupRead) Process(ctx *MessageContext) error {
 		}
 	}
 
-	latestID, err := ctx.MessageService.GetLatestGroupMessageID(msg.GroupID)
+	latestID, err := ctx.MessageService.GetLatestGroupMessageID(msg.GroupID, msg.TopicID)
 	if err != nil {
 		return SendError(ctx.Conn, "latest_message_failed", "Failed to get latest message", err.Error())
 	}
@@ -366,31 +391,15 @@ func (msg *MessageGroupRead) Process(ctx *MessageContext) error {
 		lastRead = latestID
 	}
 
-	if err := ctx.GroupService.UpsertReadStateMonotonic(msg.GroupID, ctx.UserID, lastRead); err != nil {
+	if err := ctx.GroupService.UpsertReadStateMonotonic(msg.GroupID, msg.TopicID, ctx.UserID, lastRead); err != nil {
 		return SendError(ctx.Conn, "mark_group_read_failed", "Failed to update read state", err.Error())
 	}
 	if ctx.MessageCache != nil {
 		_ = ctx.MessageCache.InvalidateConversationList(ctx.UserID)
 	}
 
-	// Broadcast read update to group members
-	members, err := ctx.GroupService.GetGroupMembers(msg.GroupID)
-	if err == nil {
-		memberIDs := make([]uint, 0, len(members))
-		for _, member := range members {
-			if member.ID != ctx.UserID {
-				memberIDs = append(memberIDs, member.ID)
-			}
-		}
-		if len(memberIDs) > 0 {
-			ctx.Hub.BroadcastToUsers(memberIDs, map[string]interface{}{
-				"type":                 "group_read_update",
-				"group_id":             msg.GroupID,
-				"user_id":              ctx.UserID,
-				"last_read_message_id": lastRead,
-			})
-		}
+	if ctx.Delivery != nil {
+		ctx.Delivery.DeliverReadUpdate(msg.GroupID, msg.TopicID, ctx.UserID, lastRead)
 	}
-
 	return nil
 }
@@ -2,6 +2,7 @@ package httpx
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -10,6 +11,8 @@ type ErrorResponse struct {
 	Error     string `json:"error"`
 	Code      string `json:"code,omitempty"`
 	RequestID string `json:"request_id,omitempty"`
+	// RetryAfter is set on 429s, in seconds.
+	RetryAfter int `json:"retry_after,omitempty"`
 }
 
 func requestID(c *fiber.Ctx) string {
@@ -44,6 +47,18 @@ func Forbidden(c *fiber.Ctx, code string, message string) error {
 	return Error(c, fiber.StatusForbidden, code, message)
 }
 
+// TooManyRequests answers 429 with a Retry-After header and the same delay,
+// in seconds, in the body.
+func TooManyRequests(c *fiber.Ctx, code string, message string, retryAfter int) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return c.Status(fiber.StatusTooManyRequests).JSON(ErrorResponse{
+		Error:      message,
+		Code:       code,
+		RequestID:  requestID(c),
+		RetryAfter: retryAfter,
+	})
+}
+
 func Internal(c *fiber.Ctx, code string) error {
 	return Error(c, fiber.StatusInternalServerError, code, "Internal server error")
 }
@@ -0,0 +1,176 @@
+package httpx
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// ByteRange is a resolved byte range within a representation.
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange formats the Content-Range header value for r.
+func (r ByteRange) ContentRange(size int64) string {
+	return "bytes " + strconv.FormatInt(r.Start, 10) + "-" + strconv.FormatInt(r.Start+r.Length-1, 10) + "/" + strconv.FormatInt(size, 10)
+}
+
+// ParseRange resolves a Range header (RFC 7233) against a representation of
+// the given size. It returns nil ranges when the header is absent or should be
+// ignored (unknown unit, bad syntax), and ErrRangeNotSatisfiable when it is
+// well-formed but no range overlaps the representation.
+func ParseRange(header string, size int64) ([]ByteRange, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil, nil
+	}
+	const prefix = "bytes="
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return nil, nil
+	}
+
+	var ranges []ByteRange
+	for _, spec := range strings.Split(header[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		dash := strings.IndexByte(spec, '-')
+		if dash < 0 {
+			return nil, nil
+		}
+		first, last := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+		if first == "" {
+			// Suffix range: the last N bytes.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			n = min(n, size)
+			ranges = append(ranges, ByteRange{Start: size - n, Length: n})
+			continue
+		}
+
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, nil
+		}
+		end := size - 1
+		if last != "" {
+			end, err = strconv.ParseInt(last, 10, 64)
+			if err != nil || end < start {
+				return nil, nil
+			}
+			end = min(end, size-1)
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, ByteRange{Start: start, Length: end - start + 1})
+	}
+
+	if len(ranges) == 0 {
+		return nil, ErrRangeNotSatisfiable
+	}
+	return ranges, nil
+}
+
+// TotalLength sums the lengths of the ranges.
+func TotalLength(ranges []ByteRange) int64 {
+	var n int64
+	for _, r := range ranges {
+		n += r.Length
+	}
+	return n
+}
+
+func trimETag(v string) (tag string, weak bool) {
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "W/") {
+		weak = true
+		v = v[2:]
+	}
+	return strings.Trim(v, "\""), weak
+}
+
+// etagListMatches reports whether etag is in a comma-separated If-Match /
+// If-None-Match list. Strong comparison rejects weak validators.
+func etagListMatches(list, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		tag, weak := trimETag(candidate)
+		if strong && weak {
+			continue
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func parseHTTPDate(v string) (time.Time, bool) {
+	t, err := http.ParseTime(strings.TrimSpace(v))
+	return t, err == nil
+}
+
+// CheckPreconditions evaluates If-Match, If-Unmodified-Since, If-None-Match and
+// If-Modified-Since in RFC 7232 order for a GET/HEAD. It returns 0 when the
+// request should proceed, otherwise 304 or 412.
+func CheckPreconditions(c *fiber.Ctx, etag string, lastModified time.Time) int {
+	lastModified = lastModified.Truncate(time.Second)
+
+	if im := c.Get(fiber.HeaderIfMatch); im != "" {
+		if !etagListMatches(im, etag, true) {
+			return fiber.StatusPreconditionFailed
+		}
+	} else if ius := c.Get(fiber.HeaderIfUnmodifiedSince); ius != "" && !lastModified.IsZero() {
+		if t, ok := parseHTTPDate(ius); ok && lastModified.After(t) {
+			return fiber.StatusPreconditionFailed
+		}
+	}
+
+	if inm := c.Get(fiber.HeaderIfNoneMatch); inm != "" {
+		if etagListMatches(inm, etag, false) {
+			return fiber.StatusNotModified
+		}
+	} else if ims := c.Get(fiber.HeaderIfModifiedSince); ims != "" && !lastModified.IsZero() {
+		if t, ok := parseHTTPDate(ims); ok && !lastModified.After(t) {
+			return fiber.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// IfRangeMatches reports whether a Range header should be honoured given the
+// If-Range validator (an ETag or an HTTP-date). Absent If-Range always matches.
+func IfRangeMatches(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	ir := strings.TrimSpace(c.Get(fiber.HeaderIfRange))
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, "\"") || strings.HasPrefix(ir, "W/") {
+		tag, weak := trimETag(ir)
+		return !weak && etag != "" && tag == etag
+	}
+	t, ok := parseHTTPDate(ir)
+	return ok && !lastModified.IsZero() && lastModified.Truncate(time.Second).Equal(t)
+}
@@ -0,0 +1,93 @@
+package httpx
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		want   []ByteRange
+		err    error
+	}{
+		{"", 100, nil, nil},
+		{"items=0-1", 100, nil, nil},
+		{"bytes=abc", 100, nil, nil},
+		{"bytes=5-2", 100, nil, nil},
+		{"bytes=0-9", 100, []ByteRange{{0, 10}}, nil},
+		{"bytes=90-", 100, []ByteRange{{90, 10}}, nil},
+		{"bytes=-20", 100, []ByteRange{{80, 20}}, nil},
+		{"bytes=-500", 100, []ByteRange{{0, 100}}, nil},
+		{"bytes=95-200", 100, []ByteRange{{95, 5}}, nil},
+		{"bytes=0-0, 10-19 ,-1", 100, []ByteRange{{0, 1}, {10, 10}, {99, 1}}, nil},
+		{"bytes=100-", 100, nil, ErrRangeNotSatisfiable},
+		{"bytes=-0", 100, nil, ErrRangeNotSatisfiable},
+		{"bytes=0-", 0, nil, ErrRangeNotSatisfiable},
+		{"bytes=200-300,0-1", 100, []ByteRange{{0, 2}}, nil},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRange(tt.header, tt.size)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseRange(%q, %d) err = %v, want %v", tt.header, tt.size, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRange(%q, %d) = %v, want %v", tt.header, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if status := CheckPreconditions(c, "abc", modified); status != 0 {
+			return c.SendStatus(status)
+		}
+		if !IfRangeMatches(c, "abc", modified) {
+			return c.SendStatus(fiber.StatusAccepted)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"none", nil, 200},
+		{"inm match", map[string]string{"If-None-Match": `"x", W/"abc"`}, 304},
+		{"inm miss", map[string]string{"If-None-Match": `"x"`}, 200},
+		{"ims not modified", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, 304},
+		{"ims modified", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 11:59:59 GMT"}, 200},
+		{"inm wins over ims", map[string]string{"If-None-Match": `"x"`, "If-Modified-Since": "Sat, 02 Mar 2024 00:00:00 GMT"}, 200},
+		{"if-match miss", map[string]string{"If-Match": `"x"`}, 412},
+		{"if-match weak", map[string]string{"If-Match": `W/"abc"`}, 412},
+		{"if-match ok", map[string]string{"If-Match": `"abc"`}, 200},
+		{"ius failed", map[string]string{"If-Unmodified-Since": "Thu, 29 Feb 2024 00:00:00 GMT"}, 412},
+		{"if-range stale", map[string]string{"If-Range": `"old"`}, 202},
+		{"if-range date", map[string]string{"If-Range": "Fri, 01 Mar 2024 12:00:00 GMT"}, 200},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ScanStatus is the malware scan state of stored content.
+type ScanStatus string
+
+const (
+	// ScanQuarantined content is stored but not downloadable until scanned.
+	ScanQuarantined ScanStatus = "quarantined"
+	ScanClean       ScanStatus = "clean"
+	ScanInfected    ScanStatus = "infected"
+)
+
+// MediaBlob is a content-addressed stored object. Identical uploads share one
+// blob; RefCount tracks how many attachments point at it.
+type MediaBlob struct {
+	Hash        string    `gorm:"primaryKey;size:64" json:"hash"` // hex SHA-256
+	Key         string    `gorm:"size:255;uniqueIndex;not null" json:"-"`
+	SizeBytes   int64     `gorm:"not null" json:"size_bytes"`
+	ContentType string    `gorm:"size:127;not null" json:"content_type"`
+	RefCount    int       `gorm:"not null;default:0" json:"ref_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Scan state is per content, so a verdict covers every deduplicated upload.
+	ScanStatus    ScanStatus `gorm:"type:varchar(16);not null;default:'clean';index" json:"scan_status"`
+	ScanSignature string     `gorm:"size:255" json:"-"`
+	ScannedAt     *time.Time `json:"scanned_at,omitempty"`
+}
+
+// Attachment is a user upload that messages can reference. Several attachments
+// may share the same MediaBlob.
+type Attachment struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	UploaderID  uint   `gorm:"index;not null" json:"uploader_id"`
+	BlobHash    string `gorm:"size:64;index;not null" json:"-"`
+	FileName    string `gorm:"size:255" json:"file_name"`
+	ContentType string `gorm:"size:127;not null" json:"content_type"`
+	SizeBytes   int64  `gorm:"not null" json:"size_bytes"`
+
+	Blob MediaBlob `gorm:"foreignKey:BlobHash;references:Hash" json:"-"`
+}
+
+type AttachmentResponse struct {
+	ID          uint   `json:"id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+	URL         string `json:"url"`
+	// ScanStatus is empty when the blob wasn't loaded.
+	ScanStatus ScanStatus `json:"scan_status,omitempty"`
+}
+
+// ToResponse builds the client view. The URL is relative to the API base.
+func (a *Attachment) ToResponse() AttachmentResponse {
+	return AttachmentResponse{
+		ID:          a.ID,
+		FileName:    a.FileName,
+		ContentType: a.ContentType,
+		SizeBytes:   a.SizeBytes,
+		URL:         "/media/attachments/" + strconv.FormatUint(uint64(a.ID), 10),
+		ScanStatus:  a.Blob.ScanStatus,
+	}
+}
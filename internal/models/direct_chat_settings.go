@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// DirectChatSettings holds the settings both participants of a direct
+// conversation share. UserLowID is the smaller of the two user IDs.
+type DirectChatSettings struct {
+	UserLowID  uint      `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	UserHighID uint      `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// MessageTTLSeconds makes new messages disappear after this long; 0 is off.
+	MessageTTLSeconds int            `gorm:"not null;default:0" json:"message_ttl_seconds"`
+	MessageTTLMode    MessageTTLMode `gorm:"type:varchar(8);not null;default:'send'" json:"message_ttl_mode"`
+	UpdatedBy         uint           `json:"updated_by"`
+}
@@ -9,28 +9,139 @@ import (
 type GroupRole string
 
 const (
-	RoleAdmin  GroupRole = "admin"
-	RoleMember GroupRole = "member"
+	RoleOwner     GroupRole = "owner"
+	RoleAdmin     GroupRole = "admin"
+	RoleModerator GroupRole = "moderator"
+	RoleMember    GroupRole = "member"
 )
 
+var groupRoleRank = map[GroupRole]int{
+	RoleMember:    1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+	RoleOwner:     4,
+}
+
+// Rank orders roles from member (1) to owner (4); unknown roles rank 0.
+func (r GroupRole) Rank() int {
+	return groupRoleRank[r]
+}
+
+func (r GroupRole) Valid() bool {
+	return r.Rank() > 0
+}
+
+// IsAdmin reports whether the role is admin or owner.
+func (r GroupRole) IsAdmin() bool {
+	return r.Rank() >= RoleAdmin.Rank()
+}
+
+// GroupPermission is a bitmap of actions a role may take in a group.
+type GroupPermission uint32
+
+const (
+	PermSendMessages GroupPermission = 1 << iota
+	PermSendMedia
+	PermAddMembers
+	PermPinMessages
+	PermChangeInfo
+	PermDeleteMessages // delete other members' messages
+	PermManageInvites
+	PermManageTopics // create, rename and close forum topics
+
+	PermAll = PermSendMessages | PermSendMedia | PermAddMembers | PermPinMessages |
+		PermChangeInfo | PermDeleteMessages | PermManageInvites | PermManageTopics
+
+	DefaultMemberPermissions    = PermSendMessages | PermSendMedia
+	DefaultModeratorPermissions = DefaultMemberPermissions | PermAddMembers | PermPinMessages | PermDeleteMessages
+
+	// PermPost covers posting of any kind, which channels reserve to admins.
+	PermPost = PermSendMessages | PermSendMedia
+)
+
+func (p GroupPermission) Has(perm GroupPermission) bool {
+	return p&perm == perm
+}
+
+// GroupType distinguishes regular groups from broadcast channels.
+type GroupType string
+
+const (
+	GroupTypeGroup GroupType = "group"
+	// GroupTypeChannel is one-to-many: only admins post and subscribers
+	// can't see each other.
+	GroupTypeChannel GroupType = "channel"
+)
+
+func (t GroupType) Valid() bool {
+	return t == GroupTypeGroup || t == GroupTypeChannel
+}
+
 type Group struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Name        string  `gorm:"size:100;not null" json:"name"`
-	Description string  `gorm:"size:255" json:"description"`
-	Icon        string  `json:"icon"`
-	CreatorID   uint    `gorm:"not null" json:"creator_id"`
-	IsPublic    bool    `gorm:"default:false" json:"is_public"`
-	Handle      *string `gorm:"size:32;uniqueIndex" json:"handle,omitempty"`
+	Name        string    `gorm:"size:100;not null" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+	Icon        string    `json:"icon"`
+	IconKey     string    `gorm:"size:255" json:"-"`
+	CreatorID   uint      `gorm:"not null" json:"creator_id"`
+	OwnerID     uint      `gorm:"index" json:"owner_id"` // current owner; CreatorID never changes
+	IsPublic    bool      `gorm:"default:false" json:"is_public"`
+	Type        GroupType `gorm:"type:varchar(16);not null;default:'group'" json:"type"`
+	Handle      *string   `gorm:"size:32;uniqueIndex" json:"handle,omitempty"`
+
+	// JoinRequiresApproval turns public joins into join requests.
+	JoinRequiresApproval bool `gorm:"not null;default:false" json:"join_requires_approval"`
+
+	// SlowModeSeconds is the minimum gap between a non-admin's messages; 0 is off.
+	SlowModeSeconds int `gorm:"not null;default:0" json:"slow_mode_seconds"`
+
+	// IsForum splits the group's messages into topics (see GroupTopic).
+	IsForum bool `gorm:"not null;default:false" json:"is_forum"`
+
+	// MessageTTLSeconds makes new messages disappear after this long; 0 is off.
+	MessageTTLSeconds int            `gorm:"not null;default:0" json:"message_ttl_seconds"`
+	MessageTTLMode    MessageTTLMode `gorm:"type:varchar(8);not null;default:'send'" json:"message_ttl_mode"`
+
+	// Permission bitmaps granted to members and moderators; admins and the
+	// owner always hold PermAll.
+	MemberPermissions    GroupPermission `gorm:"not null;default:3" json:"member_permissions"`
+	ModeratorPermissions GroupPermission `gorm:"not null;default:47" json:"moderator_permissions"`
+
+	// MemberCount is filled in by the service where clients show it (the
+	// subscriber count of a channel); it isn't stored.
+	MemberCount int64 `gorm:"-" json:"member_count,omitempty"`
 
 	// Associations
 	Creator User          `gorm:"foreignKey:CreatorID" json:"creator"`
 	Members []GroupMember `gorm:"foreignKey:GroupID" json:"members"`
 }
 
+func (g *Group) IsChannel() bool {
+	return g.Type == GroupTypeChannel
+}
+
+// PermissionsFor returns the permissions a member with the given role holds.
+// In channels only admins may post, whatever the bitmaps say.
+func (g *Group) PermissionsFor(role GroupRole) GroupPermission {
+	var perms GroupPermission
+	switch role {
+	case RoleOwner, RoleAdmin:
+		return PermAll
+	case RoleModerator:
+		perms = g.ModeratorPermissions | g.MemberPermissions
+	case RoleMember:
+		perms = g.MemberPermissions
+	}
+	if g.IsChannel() {
+		perms &^= PermPost
+	}
+	return perms
+}
+
 type GroupInviteLink struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -45,10 +156,111 @@ type GroupInviteLink struct {
 	UsedCount int        `gorm:"default:0" json:"used_count"`
 	RevokedAt *time.Time `json:"revoked_at"`
 
+	// RequiresApproval makes joins through the link create join requests.
+	RequiresApproval bool `gorm:"not null;default:false" json:"requires_approval"`
+
 	Group   Group `gorm:"foreignKey:GroupID" json:"-"`
 	Creator User  `gorm:"foreignKey:CreatedBy" json:"-"`
 }
 
+// UsableAt reports whether the link can still admit someone at t.
+func (l *GroupInviteLink) UsableAt(t time.Time) bool {
+	if l.RevokedAt != nil {
+		return false
+	}
+	if l.ExpiresAt != nil && !t.Before(*l.ExpiresAt) {
+		return false
+	}
+	return l.MaxUses == nil || l.UsedCount < *l.MaxUses
+}
+
+// GroupInviteLinkResponse is the admin view of a link, with its creator.
+type GroupInviteLinkResponse struct {
+	ID        uint         `json:"id"`
+	Token     string       `json:"token"`
+	Creator   UserResponse `json:"creator"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt *time.Time   `json:"expires_at"`
+	MaxUses   *int         `json:"max_uses"`
+	UsedCount int          `json:"used_count"`
+	RevokedAt *time.Time   `json:"revoked_at"`
+	Active    bool         `json:"active"`
+
+	RequiresApproval bool `json:"requires_approval"`
+}
+
+func (l *GroupInviteLink) ToResponse(now time.Time) GroupInviteLinkResponse {
+	return GroupInviteLinkResponse{
+		ID:        l.ID,
+		Token:     l.Token,
+		Creator:   l.Creator.ToResponse(),
+		CreatedAt: l.CreatedAt,
+		ExpiresAt: l.ExpiresAt,
+		MaxUses:   l.MaxUses,
+		UsedCount: l.UsedCount,
+		RevokedAt: l.RevokedAt,
+		Active:    l.UsableAt(now),
+
+		RequiresApproval: l.RequiresApproval,
+	}
+}
+
+// GroupInviteUse records who joined through an invite link. Rows outlive the
+// membership so admins can audit a link after people leave.
+type GroupInviteUse struct {
+	ID       uint      `gorm:"primarykey" json:"id"`
+	LinkID   uint      `gorm:"index;not null" json:"link_id"`
+	GroupID  uint      `gorm:"index;not null" json:"group_id"`
+	UserID   uint      `gorm:"not null" json:"user_id"`
+	JoinedAt time.Time `gorm:"not null" json:"joined_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"user"`
+}
+
+type JoinRequestStatus string
+
+const (
+	JoinRequestPending  JoinRequestStatus = "pending"
+	JoinRequestApproved JoinRequestStatus = "approved"
+	JoinRequestDeclined JoinRequestStatus = "declined"
+)
+
+// GroupJoinRequest is a pending or decided request to join a group that
+// requires approval. InviteLinkID is set when it came through a link.
+type GroupJoinRequest struct {
+	ID           uint              `gorm:"primarykey" json:"id"`
+	GroupID      uint              `gorm:"index:idx_join_requests_group_status;not null" json:"group_id"`
+	UserID       uint              `gorm:"index;not null" json:"user_id"`
+	InviteLinkID *uint             `json:"invite_link_id,omitempty"`
+	Status       JoinRequestStatus `gorm:"type:varchar(16);index:idx_join_requests_group_status;not null;default:'pending'" json:"status"`
+	DecidedBy    *uint             `json:"decided_by,omitempty"`
+	Reason       string            `gorm:"size:255" json:"reason,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	DecidedAt    *time.Time        `json:"decided_at,omitempty"`
+
+	User User `gorm:"foreignKey:UserID" json:"user"`
+
+	// Filed is set on a request just created, as opposed to an open one
+	// returned again to a user who asks twice.
+	Filed bool `gorm:"-" json:"-"`
+}
+
+// GroupBan keeps a user from rejoining a group until ExpiresAt (nil = forever).
+type GroupBan struct {
+	GroupID   uint       `gorm:"primaryKey" json:"group_id"`
+	UserID    uint       `gorm:"primaryKey" json:"user_id"`
+	BannedBy  uint       `gorm:"not null" json:"banned_by"`
+	Reason    string     `gorm:"size:255" json:"reason"`
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"user"`
+}
+
+func (b *GroupBan) ActiveAt(t time.Time) bool {
+	return b.ExpiresAt == nil || t.Before(*b.ExpiresAt)
+}
+
 type GroupMember struct {
 	GroupID  uint      `gorm:"primaryKey" json:"group_id"`
 	UserID   uint      `gorm:"primaryKey" json:"user_id"`
@@ -58,3 +270,95 @@ type GroupMember struct {
 	User  User  `gorm:"foreignKey:UserID" json:"user"`
 	Group Group `gorm:"foreignKey:GroupID" json:"-"`
 }
+
+// GroupMemberResponse is a member list entry. It leaves out the user's email.
+type GroupMemberResponse struct {
+	UserID   uint       `json:"user_id"`
+	Username string     `json:"username"`
+	FullName string     `json:"full_name"`
+	Avatar   string     `json:"avatar"`
+	IsOnline bool       `json:"is_online"`
+	LastSeen *time.Time `json:"last_seen"`
+	Role     GroupRole  `json:"role"`
+	JoinedAt time.Time  `json:"joined_at"`
+}
+
+// ToResponse expects User to be loaded.
+func (m *GroupMember) ToResponse() GroupMemberResponse {
+	return GroupMemberResponse{
+		UserID:   m.UserID,
+		Username: m.User.Username,
+		FullName: m.User.FullName,
+		Avatar:   m.User.Avatar,
+		IsOnline: m.User.IsOnline,
+		LastSeen: m.User.LastSeen,
+		Role:     m.Role,
+		JoinedAt: m.JoinedAt,
+	}
+}
+
+// GroupAuditAction names an entry in a group's audit log. Actions that also
+// appear on the timeline share their SystemAction value.
+type GroupAuditAction string
+
+const (
+	AuditGroupCreated        GroupAuditAction = "group_created"
+	AuditGroupUpdated        GroupAuditAction = "group_updated"
+	AuditMemberJoined        GroupAuditAction = "member_joined"
+	AuditMemberLeft          GroupAuditAction = "member_left"
+	AuditMemberRemoved       GroupAuditAction = "member_removed"
+	AuditMemberBanned        GroupAuditAction = "member_banned"
+	AuditMemberRoleChanged   GroupAuditAction = "member_role_changed"
+	AuditOwnershipChanged    GroupAuditAction = "ownership_transferred"
+	AuditMemberUnbanned      GroupAuditAction = "member_unbanned"
+	AuditJoinRequestApproved GroupAuditAction = "join_request_approved"
+	AuditJoinRequestDeclined GroupAuditAction = "join_request_declined"
+	AuditInviteLinkCreated   GroupAuditAction = "invite_link_created"
+	AuditInviteLinkEdited    GroupAuditAction = "invite_link_edited"
+	AuditInviteLinkRevoked   GroupAuditAction = "invite_link_revoked"
+	AuditTopicCreated        GroupAuditAction = "topic_created"
+	AuditTopicEdited         GroupAuditAction = "topic_edited"
+	// Reserved for message pinning and moderator deletions; nothing records
+	// them yet.
+	AuditMessagePinned   GroupAuditAction = "message_pinned"
+	AuditMessageUnpinned GroupAuditAction = "message_unpinned"
+	AuditMessageDeleted  GroupAuditAction = "message_deleted"
+)
+
+func (a GroupAuditAction) Valid() bool {
+	switch a {
+	case AuditGroupCreated, AuditGroupUpdated, AuditMemberJoined, AuditMemberLeft,
+		AuditMemberRemoved, AuditMemberBanned, AuditMemberRoleChanged, AuditOwnershipChanged,
+		AuditMemberUnbanned, AuditJoinRequestApproved, AuditJoinRequestDeclined,
+		AuditInviteLinkCreated, AuditInviteLinkEdited, AuditInviteLinkRevoked,
+		AuditTopicCreated, AuditTopicEdited,
+		AuditMessagePinned, AuditMessageUnpinned, AuditMessageDeleted:
+		return true
+	}
+	return false
+}
+
+// GroupAuditDetails holds the action-specific part of an audit entry.
+type GroupAuditDetails struct {
+	Role      GroupRole  `json:"role,omitempty"`    // member_role_changed
+	Changes   []string   `json:"changes,omitempty"` // group_updated, invite_link_edited, topic_edited
+	Name      string     `json:"name,omitempty"`    // group or topic name after the change
+	Reason    string     `json:"reason,omitempty"`  // bans and join request decisions
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// GroupAuditEntry is one row of a group's append-only audit log.
+type GroupAuditEntry struct {
+	ID           uint               `gorm:"primarykey;index:idx_group_audit_group_id,priority:2" json:"id"`
+	GroupID      uint               `gorm:"index:idx_group_audit_group_id,priority:1;index:idx_group_audit_actor,priority:1;not null" json:"group_id"`
+	ActorID      uint               `gorm:"index:idx_group_audit_actor,priority:2;not null" json:"actor_id"`
+	Action       GroupAuditAction   `gorm:"type:varchar(32);not null" json:"action"`
+	TargetUserID *uint              `json:"target_user_id,omitempty"`
+	InviteLinkID *uint              `json:"invite_link_id,omitempty"`
+	MessageID    *uint              `json:"message_id,omitempty"`
+	TopicID      *uint              `json:"topic_id,omitempty"`
+	Details      *GroupAuditDetails `gorm:"type:jsonb;serializer:json" json:"details,omitempty"`
+	CreatedAt    time.Time          `json:"created_at"`
+
+	Actor User `gorm:"foreignKey:ActorID" json:"actor"`
+}
@@ -4,12 +4,25 @@ import (
 	"time"
 )
 
-// GroupReadState tracks per-user read progress in a group.
+// GroupReadState tracks per-user read progress in a group; forum groups keep
+// one row per topic the user has opened.
 // last_read_message_id is monotonic and represents the highest message ID the user has read.
 type GroupReadState struct {
 	GroupID           uint      `gorm:"primaryKey" json:"group_id"`
 	UserID            uint      `gorm:"primaryKey" json:"user_id"`
+	TopicID           uint      `gorm:"primaryKey;default:0" json:"topic_id"` // 0 is the General stream
 	LastReadMessageID uint      `gorm:"not null;default:0" json:"last_read_message_id"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
+
+// GroupMention is an unread mention of a user in a group topic (0 for the
+// General stream). Rows are deleted as the user's read mark passes them, so
+// the user's rows are their unread mentions.
+type GroupMention struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false;index:idx_group_mentions_user_topic,priority:1" json:"user_id"`
+	MessageID uint      `gorm:"primaryKey;autoIncrement:false;index" json:"message_id"`
+	GroupID   uint      `gorm:"not null;index:idx_group_mentions_user_topic,priority:2" json:"group_id"`
+	TopicID   uint      `gorm:"not null;default:0;index:idx_group_mentions_user_topic,priority:3" json:"topic_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
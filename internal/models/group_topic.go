@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// GroupTopic is a topic of a forum group: its own message stream and read
+// state, shared with the group's membership. Messages without a topic make
+// up the group's General stream.
+type GroupTopic struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	GroupID   uint   `gorm:"not null;index" json:"group_id"`
+	Title     string `gorm:"size:128;not null" json:"title"`
+	CreatorID uint   `gorm:"not null" json:"creator_id"`
+	// IsClosed stops members without PermManageTopics from posting.
+	IsClosed bool `gorm:"not null;default:false" json:"is_closed"`
+}
@@ -0,0 +1,42 @@
+package models
+
+// LinkPreview describes the first web page a message links to, read from the
+// page's OpenGraph and Twitter card tags. It is attached after the message is
+// sent, once the page has been fetched.
+type LinkPreview struct {
+	URL         string `json:"url"`
+	SiteName    string `json:"site_name,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// ImageURL is the public URL of the stored copy of the page's image,
+	// served by the backend proxy; ImageKey is its object key.
+	ImageURL    string `json:"image_url,omitempty"`
+	ImageKey    string `json:"image_key,omitempty"`
+	ImageWidth  int    `json:"image_width,omitempty"`
+	ImageHeight int    `json:"image_height,omitempty"`
+}
+
+type LinkPreviewResponse struct {
+	URL         string `json:"url"`
+	SiteName    string `json:"site_name,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	ImageWidth  int    `json:"image_width,omitempty"`
+	ImageHeight int    `json:"image_height,omitempty"`
+}
+
+func (p *LinkPreview) ToResponse() *LinkPreviewResponse {
+	if p == nil {
+		return nil
+	}
+	return &LinkPreviewResponse{
+		URL:         p.URL,
+		SiteName:    p.SiteName,
+		Title:       p.Title,
+		Description: p.Description,
+		ImageURL:    p.ImageURL,
+		ImageWidth:  p.ImageWidth,
+		ImageHeight: p.ImageHeight,
+	}
+}
@@ -12,8 +12,52 @@ const (
 	TextMessage  MessageType = "text"
 	ImageMessage MessageType = "image"
 	FileMessage  MessageType = "file"
+
+	// SystemMessage records a group event (joins, role changes, edits). The
+	// sender is the acting user and System carries the structured payload.
+	SystemMessage MessageType = "system"
+)
+
+type SystemAction string
+
+const (
+	SystemGroupCreated      SystemAction = "group_created"
+	SystemMemberJoined      SystemAction = "member_joined"
+	SystemMemberLeft        SystemAction = "member_left"
+	SystemMemberRemoved     SystemAction = "member_removed"
+	SystemMemberBanned      SystemAction = "member_banned"
+	SystemMemberRoleChanged SystemAction = "member_role_changed"
+	SystemGroupUpdated      SystemAction = "group_updated"
+	SystemOwnershipChanged  SystemAction = "ownership_transferred"
+	SystemTopicCreated      SystemAction = "topic_created"
+	SystemTopicEdited       SystemAction = "topic_edited"
+)
+
+// SystemEvent is the payload of a system message. Clients render it from the
+// action and IDs; Message.Content only holds a plain-text fallback.
+type SystemEvent struct {
+	Action    SystemAction `json:"action"`
+	ActorID   uint         `json:"actor_id"`
+	TargetIDs []uint       `json:"target_ids,omitempty"`
+	Role      GroupRole    `json:"role,omitempty"`    // member_role_changed
+	Changes   []string     `json:"changes,omitempty"` // group_updated, topic_edited
+	Name      string       `json:"name,omitempty"`    // group or topic name after the event
+	// TopicID places topic events in the topic's stream instead of General.
+	TopicID uint `json:"topic_id,omitempty"`
+}
+
+// MessageTTLMode says when a disappearing message's timer starts.
+type MessageTTLMode string
+
+const (
+	TTLAfterSend MessageTTLMode = "send"
+	TTLAfterRead MessageTTLMode = "read" // first read by someone other than the sender
 )
 
+func (m MessageTTLMode) Valid() bool {
+	return m == TTLAfterSend || m == TTLAfterRead
+}
+
 type MessageStatus string
 
 const (
@@ -38,9 +82,17 @@ type Message struct {
 	RecipientID *uint  `gorm:"index:idx_recipient_created;index:idx_conversation" json:"recipient_id"` // null for group messages
 	GroupID     *uint  `gorm:"index:idx_group_created" json:"group_id"`                                // null for direct messages
 	Group       *Group `gorm:"foreignKey:GroupID" json:"group,omitempty"`
+	TopicID     *uint  `gorm:"index" json:"topic_id,omitempty"` // forum topic; null is the group's General stream
+
+	Content     string          `gorm:"type:text;not null" json:"content"`
+	Entities    []MessageEntity `gorm:"type:jsonb;serializer:json" json:"entities,omitempty"`
+	MessageType MessageType     `gorm:"type:varchar(20);default:'text'" json:"message_type"`
+	System      *SystemEvent    `gorm:"type:jsonb;serializer:json" json:"system,omitempty"`
+	LinkPreview *LinkPreview    `gorm:"type:jsonb;serializer:json" json:"link_preview,omitempty"`
 
-	Content     string      `gorm:"type:text;not null" json:"content"`
-	MessageType MessageType `gorm:"type:varchar(20);default:'text'" json:"message_type"`
+	// Optional uploaded file (image/file messages)
+	AttachmentID *uint       `gorm:"index" json:"attachment_id"`
+	Attachment   *Attachment `gorm:"foreignKey:AttachmentID" json:"attachment,omitempty"`
 
 	// Status tracking
 	Status      MessageStatus `gorm:"type:varchar(20);default:'pending';index" json:"status"`
@@ -49,6 +101,12 @@ type Message struct {
 	DeliveredAt *time.Time    `json:"delivered_at"`
 	ReadAt      *time.Time    `json:"read_at"`
 
+	// Disappearing messages: TTLSeconds is the conversation's timer when the
+	// message was sent and ExpiresAt is set once the timer starts, at send or
+	// first read depending on the mode. The reaper deletes it after ExpiresAt.
+	TTLSeconds int        `gorm:"not null;default:0" json:"ttl_seconds,omitempty"`
+	ExpiresAt  *time.Time `gorm:"index" json:"expires_at,omitempty"`
+
 	// Version for edit tracking
 	Version int `gorm:"default:1" json:"version"`
 
@@ -57,37 +115,55 @@ type Message struct {
 }
 
 type MessageResponse struct {
-	ID            uint          `json:"id"`
-	ClientID      string        `json:"client_id"`
-	SenderID      uint          `json:"sender_id"`
-	Sender        UserResponse  `json:"sender"`
-	RecipientID   *uint         `json:"recipient_id"`
-	GroupID       *uint         `json:"group_id"`
-	Content       string        `json:"content"`
-	MessageType   MessageType   `json:"message_type"`
-	Status        MessageStatus `json:"status"`
-	IsDelivered   bool          `json:"is_delivered"`
-	IsRead        bool          `json:"is_read"`
-	Version       int           `json:"version"`
-	CreatedAt     time.Time     `json:"created_at"`
-	CreatedAtUnix int64         `json:"created_at_unix"`
+	ID            uint                 `json:"id"`
+	ClientID      string               `json:"client_id"`
+	SenderID      uint                 `json:"sender_id"`
+	Sender        UserResponse         `json:"sender"`
+	RecipientID   *uint                `json:"recipient_id"`
+	GroupID       *uint                `json:"group_id"`
+	TopicID       *uint                `json:"topic_id,omitempty"`
+	Content       string               `json:"content"`
+	Entities      []MessageEntity      `json:"entities,omitempty"`
+	MessageType   MessageType          `json:"message_type"`
+	Attachment    *AttachmentResponse  `json:"attachment,omitempty"`
+	System        *SystemEvent         `json:"system,omitempty"`
+	LinkPreview   *LinkPreviewResponse `json:"link_preview,omitempty"`
+	Status        MessageStatus        `json:"status"`
+	IsDelivered   bool                 `json:"is_delivered"`
+	IsRead        bool                 `json:"is_read"`
+	Version       int                  `json:"version"`
+	TTLSeconds    int                  `json:"ttl_seconds,omitempty"`
+	ExpiresAt     *time.Time           `json:"expires_at,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	CreatedAtUnix int64                `json:"created_at_unix"`
 }
 
 func (m *Message) ToResponse() MessageResponse {
-	return MessageResponse{
+	resp := MessageResponse{
 		ID:            m.ID,
 		ClientID:      m.ClientID,
 		SenderID:      m.SenderID,
 		Sender:        m.Sender.ToResponse(),
 		RecipientID:   m.RecipientID,
 		GroupID:       m.GroupID,
+		TopicID:       m.TopicID,
 		Content:       m.Content,
+		Entities:      m.Entities,
 		MessageType:   m.MessageType,
+		System:        m.System,
+		LinkPreview:   m.LinkPreview.ToResponse(),
 		Status:        m.Status,
 		IsDelivered:   m.IsDelivered,
 		IsRead:        m.IsRead,
 		Version:       m.Version,
+		TTLSeconds:    m.TTLSeconds,
+		ExpiresAt:     m.ExpiresAt,
 		CreatedAt:     m.CreatedAt,
 		CreatedAtUnix: m.CreatedAt.UTC().Unix(),
 	}
+	if m.Attachment != nil {
+		att := m.Attachment.ToResponse()
+		resp.Attachment = &att
+	}
+	return resp
 }
@@ -0,0 +1,55 @@
+package models
+
+import "unicode/utf16"
+
+type MessageEntityType string
+
+const (
+	EntityBold       MessageEntityType = "bold"
+	EntityItalic     MessageEntityType = "italic"
+	EntityCode       MessageEntityType = "code"        // inline monospace
+	EntityPre        MessageEntityType = "pre"         // code block; Language is optional
+	EntityLink       MessageEntityType = "link"        // URL is set
+	EntitySpoiler    MessageEntityType = "spoiler"     // hidden until tapped
+	EntityMention    MessageEntityType = "mention"     // a group member; UserID is set
+	EntityMentionAll MessageEntityType = "mention_all" // @all, sent by an admin
+)
+
+func (t MessageEntityType) Valid() bool {
+	switch t {
+	case EntityBold, EntityItalic, EntityCode, EntityPre, EntityLink, EntitySpoiler, EntityMention, EntityMentionAll:
+		return true
+	}
+	return false
+}
+
+// Verbatim reports whether the entity's text is shown as typed, so no other
+// entity may lie inside it.
+func (t MessageEntityType) Verbatim() bool {
+	return t == EntityCode || t == EntityPre || t == EntityMention || t == EntityMentionAll
+}
+
+// MessageEntity marks a span of a message's content. Offset and Length count
+// UTF-16 code units, the way JavaScript and most client toolkits index text.
+type MessageEntity struct {
+	Type     MessageEntityType `json:"type"`
+	Offset   int               `json:"offset"`
+	Length   int               `json:"length"`
+	UserID   uint              `json:"user_id,omitempty"`
+	URL      string            `json:"url,omitempty"`
+	Language string            `json:"language,omitempty"`
+}
+
+// End returns the offset just past the entity.
+func (e MessageEntity) End() int {
+	return e.Offset + e.Length
+}
+
+// UTF16Len returns the length of s in UTF-16 code units.
+func UTF16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
@@ -198,3 +198,28 @@ func TestMessageResponseFields(t *testing.T) {
 		t.Errorf("MessageResponse IsDelivered = %v, want true", response.IsDelivered)
 	}
 }
+
+func TestGroupInviteLinkUsableAt(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+	one := 1
+
+	tests := []struct {
+		name string
+		link GroupInviteLink
+		want bool
+	}{
+		{"unlimited", GroupInviteLink{}, true},
+		{"revoked", GroupInviteLink{RevokedAt: &past}, false},
+		{"expired", GroupInviteLink{ExpiresAt: &past}, false},
+		{"not yet expired", GroupInviteLink{ExpiresAt: &future}, true},
+		{"uses left", GroupInviteLink{MaxUses: &one}, true},
+		{"exhausted", GroupInviteLink{MaxUses: &one, UsedCount: 1}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.link.UsableAt(now); got != tt.want {
+			t.Errorf("%s: UsableAt = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
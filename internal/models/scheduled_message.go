@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+type ScheduledMessageStatus string
+
+const (
+	ScheduledPending ScheduledMessageStatus = "pending"
+	ScheduledSending ScheduledMessageStatus = "sending" // claimed by a scheduler run
+	ScheduledFailed  ScheduledMessageStatus = "failed"
+)
+
+// ScheduledMessage is a message written now and sent at SendAt. When it comes
+// due the scheduler creates the real message with the same ClientID, so a
+// send interrupted by a restart is never duplicated, and deletes the row.
+type ScheduledMessage struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ClientID    string `gorm:"type:varchar(36);uniqueIndex:idx_scheduled_client_sender;not null" json:"client_id"`
+	SenderID    uint   `gorm:"uniqueIndex:idx_scheduled_client_sender;index;not null" json:"sender_id"`
+	RecipientID *uint  `json:"recipient_id,omitempty"`
+	GroupID     *uint  `json:"group_id,omitempty"`
+	TopicID     *uint  `json:"topic_id,omitempty"`
+
+	Content      string          `gorm:"type:text;not null" json:"content"`
+	Entities     []MessageEntity `gorm:"type:jsonb;serializer:json" json:"entities,omitempty"`
+	MessageType  MessageType     `gorm:"type:varchar(20);default:'text'" json:"message_type"`
+	AttachmentID *uint           `json:"attachment_id,omitempty"`
+
+	SendAt   time.Time              `gorm:"index:idx_scheduled_status_send_at,priority:2;not null" json:"send_at"`
+	Status   ScheduledMessageStatus `gorm:"type:varchar(16);index:idx_scheduled_status_send_at,priority:1;not null;default:'pending'" json:"status"`
+	Attempts int                    `gorm:"not null;default:0" json:"-"`
+	// Error is the API error code that made a send fail for good, such as
+	// not_group_member when the sender lost access before it was due.
+	Error string `gorm:"size:64" json:"error,omitempty"`
+}
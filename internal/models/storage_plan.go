@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// StoragePlan sets how much stored media a user may own. Users without an
+// explicit plan fall back to the default plan (or the server default quota).
+type StoragePlan struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	Name       string `gorm:"size:64;uniqueIndex;not null" json:"name"`
+	QuotaBytes int64  `gorm:"not null" json:"quota_bytes"`
+	// MaxFileBytes caps a single attachment; 0 uses the server limit.
+	MaxFileBytes int64     `gorm:"not null;default:0" json:"max_file_bytes"`
+	IsDefault    bool      `gorm:"not null;default:false" json:"is_default"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// StorageUsage is the media a user currently owns.
+type StorageUsage struct {
+	AvatarBytes     int64 `json:"avatar_bytes"`
+	AttachmentBytes int64 `json:"attachment_bytes"`
+	AttachmentCount int64 `json:"attachment_count"`
+}
+
+func (u StorageUsage) TotalBytes() int64 {
+	return u.AvatarBytes + u.AttachmentBytes
+}
+
+type StorageUsageResponse struct {
+	Plan           *StoragePlan `json:"plan"`
+	QuotaBytes     int64        `json:"quota_bytes"`
+	MaxFileBytes   int64        `json:"max_file_bytes"`
+	UsedBytes      int64        `json:"used_bytes"`
+	RemainingBytes int64        `json:"remaining_bytes"`
+	Breakdown      StorageUsage `json:"breakdown"`
+}
@@ -32,6 +32,9 @@ type User struct {
 	IsOnline   bool       `gorm:"default:false" json:"is_online"`
 	LastSeen   *time.Time `json:"last_seen"`
 
+	// StoragePlanID overrides the default storage plan (nil = default).
+	StoragePlanID *uint `gorm:"index" json:"-"`
+
 	Messages     []Message     `gorm:"foreignKey:SenderID" json:"-"`
 	GroupMembers []GroupMember `gorm:"foreignKey:UserID" json:"-"`
 }
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AttachmentRepository struct {
+	db *gorm.DB
+}
+
+func NewAttachmentRepository(db *gorm.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+// CreateWithBlob inserts the attachment and takes a reference on its blob,
+// creating the blob row when the content is new. The uploader's quota
+// (quotaBytes, <= 0 for unlimited) is checked in the same transaction and
+// ErrStorageQuotaExceeded returned when it would be exceeded. ensure runs
+// inside the transaction while the blob row is locked; created reports whether
+// this call inserted the row, in which case the object must be written before
+// commit. blob.ScanStatus is the state for new content; on return it holds the
+// stored state.
+func (r *AttachmentRepository) CreateWithBlob(att *models.Attachment, blob *models.MediaBlob, quotaBytes int64, ensure func(created bool) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkAttachmentQuota(tx, att.UploaderID, att.SizeBytes, quotaBytes); err != nil {
+			return err
+		}
+
+		if blob.ScanStatus == "" {
+			blob.ScanStatus = models.ScanClean
+		}
+		var row struct {
+			RefCount   int
+			Created    bool
+			ScanStatus models.ScanStatus
+		}
+		err := tx.Raw(`
+			INSERT INTO media_blobs (hash, key, size_bytes, content_type, ref_count, scan_status, created_at, updated_at)
+			VALUES (?, ?, ?, ?, 1, ?, NOW(), NOW())
+			ON CONFLICT (hash) DO UPDATE
+			SET ref_count = media_blobs.ref_count + 1,
+				updated_at = NOW()
+			RETURNING ref_count, (xmax = 0) AS created, scan_status
+		`, blob.Hash, blob.Key, blob.SizeBytes, blob.ContentType, blob.ScanStatus).Scan(&row).Error
+		if err != nil {
+			return err
+		}
+		blob.RefCount = row.RefCount
+		blob.ScanStatus = row.ScanStatus
+
+		if ensure != nil {
+			if err := ensure(row.Created); err != nil {
+				return err
+			}
+		}
+
+		att.BlobHash = blob.Hash
+		return tx.Create(att).Error
+	})
+}
+
+func (r *AttachmentRepository) FindByID(id uint) (*models.Attachment, error) {
+	var att models.Attachment
+	if err := r.db.Preload("Blob").First(&att, id).Error; err != nil {
+		return nil, err
+	}
+	return &att, nil
+}
+
+func (r *AttachmentRepository) FindBlob(hash string) (*models.MediaBlob, error) {
+	var blob models.MediaBlob
+	if err := r.db.Where("hash = ?", hash).First(&blob).Error; err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+// SetBlobScanResult records a scan verdict. Only quarantined blobs are
+// updated, so a late result can't overturn a newer one.
+func (r *AttachmentRepository) SetBlobScanResult(hash string, status models.ScanStatus, signature string) error {
+	return r.db.Model(&models.MediaBlob{}).
+		Where("hash = ? AND scan_status = ?", hash, models.ScanQuarantined).
+		Updates(map[string]interface{}{
+			"scan_status":    status,
+			"scan_signature": signature,
+			"scanned_at":     gorm.Expr("NOW()"),
+		}).Error
+}
+
+// ListQuarantinedBlobs returns blobs still awaiting a verdict that were last
+// touched before the given time, oldest first.
+func (r *AttachmentRepository) ListQuarantinedBlobs(before time.Time, limit int) ([]models.MediaBlob, error) {
+	var blobs []models.MediaBlob
+	err := r.db.Where("scan_status = ? AND updated_at < ?", models.ScanQuarantined, before).
+		Order("updated_at ASC").
+		Limit(limit).
+		Find(&blobs).Error
+	return blobs, err
+}
+
+// DeleteAndRelease soft-deletes the attachment and drops its blob reference.
+// When the last reference goes away release runs with the blob row locked and
+// the row is removed, so a concurrent upload of the same content waits and then
+// re-creates the object instead of pointing at a deleted one.
+func (r *AttachmentRepository) DeleteAndRelease(id uint, release func(blob models.MediaBlob) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var att models.Attachment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&att, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&att).Error; err != nil {
+			return err
+		}
+
+		var blob models.MediaBlob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hash = ?", att.BlobHash).First(&blob).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if blob.RefCount > 1 {
+			return tx.Model(&blob).Updates(map[string]interface{}{
+				"ref_count":  gorm.Expr("ref_count - 1"),
+				"updated_at": gorm.Expr("NOW()"),
+			}).Error
+		}
+
+		if release != nil {
+			if err := release(blob); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&blob).Error
+	})
+}
+
+// IsReferenced reports whether any message still carries the attachment.
+func (r *AttachmentRepository) IsReferenced(attachmentID uint) (bool, error) {
+	var ok bool
+	err := r.db.Raw(`SELECT EXISTS (SELECT 1 FROM messages WHERE attachment_id = ? AND deleted_at IS NULL)`, attachmentID).
+		Scan(&ok).Error
+	return ok, err
+}
+
+// CanAccess reports whether the user uploaded the attachment or can see a
+// message that carries it (DM participant or member of the group).
+func (r *AttachmentRepository) CanAccess(attachmentID, userID uint) (bool, error) {
+	var ok bool
+	err := r.db.Raw(`
+		SELECT EXISTS (
+			SELECT 1 FROM attachments a
+			WHERE a.id = ? AND a.deleted_at IS NULL AND (
+				a.uploader_id = ?
+				OR EXISTS (
+					SELECT 1 FROM messages m
+					WHERE m.attachment_id = a.id
+					  AND m.deleted_at IS NULL
+					  AND (
+						m.sender_id = ?
+						OR m.recipient_id = ?
+						OR m.group_id IN (SELECT group_id FROM group_members WHERE user_id = ?)
+					  )
+				)
+			)
+		)
+	`, attachmentID, userID, userID, userID, userID).Scan(&ok).Error
+	return ok, err
+}
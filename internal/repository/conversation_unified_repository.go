@@ -8,8 +8,10 @@ import (
 	"gorm.io/gorm"
 )
 
-// ConversationUnifiedRow is a denormalized row representing either a DM or group conversation
-// with last message + unread count + peer/group info.
+// ConversationUnifiedRow is a denormalized row representing a DM, a group or
+// a forum topic conversation with last message + unread and mention counts +
+// peer/group info.
+// Group rows cover the group's General stream; each topic gets its own row.
 type ConversationUnifiedRow struct {
 	ConversationType string         `gorm:"column:conversation_type"`
 	PeerID           sql.NullInt64  `gorm:"column:peer_id"`
@@ -24,7 +26,11 @@ type ConversationUnifiedRow struct {
 	GroupName          sql.NullString `gorm:"column:group_name"`
 	GroupIcon          sql.NullString `gorm:"column:group_icon"`
 	MemberCount        sql.NullInt64  `gorm:"column:member_count"`
+	TopicID            sql.NullInt64  `gorm:"column:topic_id"`
+	TopicTitle         sql.NullString `gorm:"column:topic_title"`
+	TopicIsClosed      sql.NullBool   `gorm:"column:topic_is_closed"`
 	UnreadCount        int64          `gorm:"column:unread_count"`
+	UnreadMentionCount int64          `gorm:"column:unread_mention_count"`
 	MessageID          uint           `gorm:"column:message_id"`
 	MessageClientID    string         `gorm:"column:message_client_id"`
 	MessageSenderID    uint           `gorm:"column:message_sender_id"`
@@ -61,6 +67,7 @@ func (r *MessageRepository) ListConversationsUnified(userID uint, cursorCreatedA
 	args := []interface{}{
 		userID, userID, userID, userID, userID, userID, userID, // dm_ranked peer/unread
 		userID, userID, // group_ranked member join + read state
+		userID, userID, // topic_ranked member join + read state
 		userID, // group_empty member join
 	}
 	if cursorCreatedAt != nil && cursorMessageID > 0 {
@@ -84,9 +91,13 @@ WITH dm_ranked AS (
 		NULL::text AS group_name,
 		NULL::text AS group_icon,
 		NULL::bigint AS member_count,
+		NULL::bigint AS topic_id,
+		NULL::text AS topic_title,
+		NULL::boolean AS topic_is_closed,
 		SUM(CASE WHEN m.recipient_id = ? AND m.is_read = false THEN 1 ELSE 0 END) OVER (
 			PARTITION BY CASE WHEN m.sender_id = ? THEN m.recipient_id ELSE m.sender_id END
 		) AS unread_count,
+		0::bigint AS unread_mention_count,
 		m.id AS message_id,
 		m.client_id AS message_client_id,
 		m.sender_id AS message_sender_id,
@@ -136,9 +147,17 @@ group_ranked AS (
 			FROM group_members gm2
 			WHERE gm2.group_id = g.id
 		) AS member_count,
-		SUM(CASE WHEN m.id > COALESCE(grs.last_read_message_id, 0) THEN 1 ELSE 0 END) OVER (
+		NULL::bigint AS topic_id,
+		NULL::text AS topic_title,
+		NULL::boolean AS topic_is_closed,
+		SUM(CASE WHEN m.id > COALESCE(grs.last_read_message_id, 0) AND m.message_type <> 'system' THEN 1 ELSE 0 END) OVER (
 			PARTITION BY m.group_id
 		) AS unread_count,
+		(
+			SELECT COUNT(*)
+			FROM group_mentions mn
+			WHERE mn.user_id = gm.user_id AND mn.group_id = g.id AND mn.topic_id = 0
+		) AS unread_mention_count,
 		m.id AS message_id,
 		m.client_id AS message_client_id,
 		m.sender_id AS message_sender_id,
@@ -165,9 +184,69 @@ group_ranked AS (
 	FROM messages m
 	JOIN group_members gm ON gm.group_id = m.group_id AND gm.user_id = ?
 	JOIN groups g ON g.id = m.group_id
-	LEFT JOIN group_read_states grs ON grs.group_id = m.group_id AND grs.user_id = ?
+	LEFT JOIN group_read_states grs ON grs.group_id = m.group_id AND grs.user_id = ? AND grs.topic_id = 0
 	JOIN users sender ON sender.id = m.sender_id
-	WHERE m.group_id IS NOT NULL
+	WHERE m.group_id IS NOT NULL AND m.topic_id IS NULL
+),
+topic_ranked AS (
+	SELECT
+		'topic'::text AS conversation_type,
+		NULL::bigint AS peer_id,
+		NULL::text AS peer_username,
+		NULL::text AS peer_email,
+		NULL::text AS peer_full_name,
+		NULL::text AS peer_avatar,
+		NULL::boolean AS peer_is_online,
+		NULL::timestamp AS peer_last_seen,
+		g.id AS group_id,
+		g.name AS group_name,
+		g.icon AS group_icon,
+		(
+			SELECT COUNT(*)
+			FROM group_members gm2
+			WHERE gm2.group_id = g.id
+		) AS member_count,
+		t.id AS topic_id,
+		t.title::text AS topic_title,
+		t.is_closed AS topic_is_closed,
+		SUM(CASE WHEN m.id > COALESCE(grs.last_read_message_id, 0) AND m.message_type <> 'system' THEN 1 ELSE 0 END) OVER (
+			PARTITION BY m.topic_id
+		) AS unread_count,
+		(
+			SELECT COUNT(*)
+			FROM group_mentions mn
+			WHERE mn.user_id = gm.user_id AND mn.group_id = g.id AND mn.topic_id = t.id
+		) AS unread_mention_count,
+		m.id AS message_id,
+		m.client_id AS message_client_id,
+		m.sender_id AS message_sender_id,
+		NULL::bigint AS message_recipient_id,
+		m.group_id AS message_group_id,
+		m.content AS message_content,
+		m.message_type AS message_type,
+		m.status AS message_status,
+		m.is_delivered AS message_is_delivered,
+		m.is_read AS message_is_read,
+		m.created_at AS message_created_at,
+		m.created_at AS last_activity,
+		sender.id AS sender_id,
+		sender.username AS sender_username,
+		sender.email AS sender_email,
+		sender.full_name AS sender_full_name,
+		sender.avatar AS sender_avatar,
+		sender.is_online AS sender_is_online,
+		sender.last_seen AS sender_last_seen,
+		ROW_NUMBER() OVER (
+			PARTITION BY m.topic_id
+			ORDER BY m.created_at DESC, m.id DESC
+		) AS rn
+	FROM messages m
+	JOIN group_topics t ON t.id = m.topic_id
+	JOIN group_members gm ON gm.group_id = m.group_id AND gm.user_id = ?
+	JOIN groups g ON g.id = m.group_id
+	LEFT JOIN group_read_states grs ON grs.group_id = m.group_id AND grs.user_id = ? AND grs.topic_id = m.topic_id
+	JOIN users sender ON sender.id = m.sender_id
+	WHERE m.topic_id IS NOT NULL
 ),
 group_empty AS (
 	SELECT
@@ -187,7 +266,11 @@ group_empty AS (
 			FROM group_members gm2
 			WHERE gm2.group_id = g.id
 		) AS member_count,
+		NULL::bigint AS topic_id,
+		NULL::text AS topic_title,
+		NULL::boolean AS topic_is_closed,
 		0 AS unread_count,
+		0::bigint AS unread_mention_count,
 		0::bigint AS message_id,
 		''::text AS message_client_id,
 		0::bigint AS message_sender_id,
@@ -214,7 +297,7 @@ group_empty AS (
 		AND NOT EXISTS (
 			SELECT 1
 			FROM messages m
-			WHERE m.group_id = g.id
+			WHERE m.group_id = g.id AND m.topic_id IS NULL
 		)
 ),
 combined AS (
@@ -222,6 +305,8 @@ combined AS (
 	UNION ALL
 	SELECT * FROM group_ranked WHERE rn = 1
 	UNION ALL
+	SELECT * FROM topic_ranked WHERE rn = 1
+	UNION ALL
 	SELECT * FROM group_empty WHERE rn = 1
 )
 SELECT * FROM combined c
@@ -35,9 +35,20 @@ func InitDB() (*gorm.DB, error) {
 		&models.Group{},
 		&models.GroupMember{},
 		&models.GroupInviteLink{},
+		&models.GroupInviteUse{},
+		&models.GroupBan{},
+		&models.GroupJoinRequest{},
+		&models.GroupAuditEntry{},
+		&models.GroupTopic{},
 		&models.GroupReadState{},
+		&models.GroupMention{},
 		&models.PendingMessage{},
+		&models.ScheduledMessage{},
+		&models.DirectChatSettings{},
 		&models.AppVersion{},
+		&models.MediaBlob{},
+		&models.Attachment{},
+		&models.StoragePlan{},
 	); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DirectChatSettingsRepository struct {
+	db *gorm.DB
+}
+
+func NewDirectChatSettingsRepository(db *gorm.DB) *DirectChatSettingsRepository {
+	return &DirectChatSettingsRepository{db: db}
+}
+
+func orderedPair(userID1, userID2 uint) (low, high uint) {
+	if userID1 > userID2 {
+		return userID2, userID1
+	}
+	return userID1, userID2
+}
+
+// Get returns the settings of the conversation between the two users, or
+// defaults when none were saved.
+func (r *DirectChatSettingsRepository) Get(userID1, userID2 uint) (*models.DirectChatSettings, error) {
+	low, high := orderedPair(userID1, userID2)
+	var settings models.DirectChatSettings
+	err := r.db.Where("user_low_id = ? AND user_high_id = ?", low, high).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.DirectChatSettings{UserLowID: low, UserHighID: high, MessageTTLMode: models.TTLAfterSend}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// Save inserts or replaces the conversation's settings. The user pair is
+// normalized, so callers may set the IDs in either order.
+func (r *DirectChatSettingsRepository) Save(settings *models.DirectChatSettings) error {
+	settings.UserLowID, settings.UserHighID = orderedPair(settings.UserLowID, settings.UserHighID)
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_low_id"}, {Name: "user_high_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"message_ttl_seconds", "message_ttl_mode", "updated_by", "updated_at"}),
+	}).Create(settings).Error
+}
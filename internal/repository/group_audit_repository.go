@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// GroupAuditRepository stores group audit entries. Entries are only ever
+// inserted and read.
+type GroupAuditRepository struct {
+	db *gorm.DB
+}
+
+func NewGroupAuditRepository(db *gorm.DB) *GroupAuditRepository {
+	return &GroupAuditRepository{db: db}
+}
+
+// AuditQuery filters and pages List. Zero values mean no filter.
+type AuditQuery struct {
+	ActorID  uint
+	Actions  []models.GroupAuditAction
+	BeforeID uint
+	Limit    int
+}
+
+func (r *GroupAuditRepository) Create(entry *models.GroupAuditEntry) error {
+	return r.db.Create(entry).Error
+}
+
+// List returns the group's entries, newest first, with their actors.
+func (r *GroupAuditRepository) List(groupID uint, q AuditQuery) ([]models.GroupAuditEntry, error) {
+	query := r.db.Where("group_id = ?", groupID)
+	if q.ActorID != 0 {
+		query = query.Where("actor_id = ?", q.ActorID)
+	}
+	if len(q.Actions) > 0 {
+		query = query.Where("action IN ?", q.Actions)
+	}
+	if q.BeforeID != 0 {
+		query = query.Where("id < ?", q.BeforeID)
+	}
+	var entries []models.GroupAuditEntry
+	err := query.Preload("Actor").Order("id DESC").Limit(q.Limit).Find(&entries).Error
+	return entries, err
+}
@@ -74,13 +74,13 @@ WITH ranked AS (
 			PARTITION BY m.group_id
 			ORDER BY m.created_at DESC, m.id DESC
 		) AS rn,
-		SUM(CASE WHEN m.id > COALESCE(grs.last_read_message_id, 0) THEN 1 ELSE 0 END) OVER (
+		SUM(CASE WHEN m.id > COALESCE(grs.last_read_message_id, 0) AND m.message_type <> 'system' THEN 1 ELSE 0 END) OVER (
 			PARTITION BY m.group_id
 		) AS unread_count
 	FROM messages m
 	JOIN group_members gm ON gm.group_id = m.group_id AND gm.user_id = ?
-	LEFT JOIN group_read_states grs ON grs.group_id = m.group_id AND grs.user_id = ?
-	WHERE m.group_id IS NOT NULL
+	LEFT JOIN group_read_states grs ON grs.group_id = m.group_id AND grs.user_id = ? AND grs.topic_id = 0
+	WHERE m.group_id IS NOT NULL AND m.topic_id IS NULL
 )
 SELECT
 	t.group_id,
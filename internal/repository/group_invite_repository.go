@@ -5,6 +5,7 @@ import (
 
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type GroupInviteRepository struct {
@@ -28,9 +29,73 @@ func (r *GroupInviteRepository) FindByToken(token string) (*models.GroupInviteLi
 	return &link, nil
 }
 
-func (r *GroupInviteRepository) IncrementUse(id uint) error {
-	return r.db.Model(&models.GroupInviteLink{}).Where("id = ?", id).
-		UpdateColumn("used_count", gorm.Expr("used_count + 1")).Error
+func (r *GroupInviteRepository) FindByID(id uint) (*models.GroupInviteLink, error) {
+	var link models.GroupInviteLink
+	if err := r.db.Preload("Creator").First(&link, id).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// ListByGroup returns the group's links, newest first, with their creators.
+func (r *GroupInviteRepository) ListByGroup(groupID uint) ([]models.GroupInviteLink, error) {
+	var links []models.GroupInviteLink
+	err := r.db.Where("group_id = ?", groupID).
+		Preload("Creator").
+		Order("created_at DESC").
+		Find(&links).Error
+	return links, err
+}
+
+// UpdateSettings saves the link's expiry, max uses and approval flag.
+func (r *GroupInviteRepository) UpdateSettings(link *models.GroupInviteLink) error {
+	return r.db.Model(&models.GroupInviteLink{}).Where("id = ?", link.ID).Updates(map[string]interface{}{
+		"expires_at":        link.ExpiresAt,
+		"max_uses":          link.MaxUses,
+		"requires_approval": link.RequiresApproval,
+	}).Error
+}
+
+// IncrementUse redeems the link for userID. The link row is locked and
+// re-checked, so concurrent joins can't push used_count past max_uses; it
+// reports false when the link was no longer usable. join runs in the same
+// transaction while the lock is held, so the membership it adds and the
+// recorded use commit or roll back together.
+func (r *GroupInviteRepository) IncrementUse(id, userID uint, now time.Time, join func(tx *gorm.DB) error) (bool, error) {
+	used := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var link models.GroupInviteLink
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&link, id).Error; err != nil {
+			return err
+		}
+		if !link.UsableAt(now) {
+			return nil
+		}
+		if join != nil {
+			if err := join(tx); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&link).UpdateColumn("used_count", gorm.Expr("used_count + 1")).Error; err != nil {
+			return err
+		}
+		use := models.GroupInviteUse{LinkID: link.ID, GroupID: link.GroupID, UserID: userID, JoinedAt: now}
+		if err := tx.Create(&use).Error; err != nil {
+			return err
+		}
+		used = true
+		return nil
+	})
+	return used, err
+}
+
+func (r *GroupInviteRepository) ListUses(linkID uint) ([]models.GroupInviteUse, error) {
+	var uses []models.GroupInviteUse
+	err := r.db.Where("link_id = ?", linkID).
+		Preload("User").
+		Order("joined_at DESC").
+		Find(&uses).Error
+	return uses, err
 }
 
 func (r *GroupInviteRepository) Revoke(id uint, revokedAt time.Time) error {
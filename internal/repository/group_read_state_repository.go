@@ -3,6 +3,7 @@ package repository
 import (
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type GroupReadStateRepository struct {
@@ -17,35 +18,140 @@ func (r *GroupReadStateRepository) EnsureForMember(groupID, userID uint) error {
 	return r.db.Exec(`
 		INSERT INTO group_read_states (group_id, user_id, last_read_message_id, created_at, updated_at)
 		VALUES (?, ?, 0, NOW(), NOW())
-		ON CONFLICT (group_id, user_id) DO NOTHING
+		ON CONFLICT (group_id, user_id, topic_id) DO NOTHING
 	`, groupID, userID).Error
 }
 
+// DeleteForMember drops the member's read marks and unread mentions.
 func (r *GroupReadStateRepository) DeleteForMember(groupID, userID uint) error {
-	return r.db.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupReadState{}).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupMention{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupReadState{}).Error
+	})
 }
 
-func (r *GroupReadStateRepository) UpsertMonotonic(groupID, userID uint, lastReadMessageID uint) error {
+// UpsertMonotonic advances the user's read mark in a topic of the group
+// (topicID 0 for the General stream); it never moves backwards. Mentions up
+// to the mark are cleared.
+func (r *GroupReadStateRepository) UpsertMonotonic(groupID, topicID, userID uint, lastReadMessageID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			INSERT INTO group_read_states (group_id, user_id, topic_id, last_read_message_id, created_at, updated_at)
+			VALUES (?, ?, ?, ?, NOW(), NOW())
+			ON CONFLICT (group_id, user_id, topic_id) DO UPDATE
+			SET last_read_message_id = GREATEST(group_read_states.last_read_message_id, EXCLUDED.last_read_message_id),
+				updated_at = NOW()
+		`, groupID, userID, topicID, lastReadMessageID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND group_id = ? AND topic_id = ? AND message_id <= ?", userID, groupID, topicID, lastReadMessageID).
+			Delete(&models.GroupMention{}).Error
+	})
+}
+
+// AddMentions records an unread mention of each user in the message.
+func (r *GroupReadStateRepository) AddMentions(groupID, topicID, messageID uint, userIDs []uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	mentions := make([]models.GroupMention, len(userIDs))
+	for i, id := range userIDs {
+		mentions[i] = models.GroupMention{UserID: id, MessageID: messageID, GroupID: groupID, TopicID: topicID}
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&mentions).Error
+}
+
+// AddMentionAll records an unread mention of every member but the sender.
+func (r *GroupReadStateRepository) AddMentionAll(groupID, topicID, messageID, senderID uint) error {
 	return r.db.Exec(`
-		INSERT INTO group_read_states (group_id, user_id, last_read_message_id, created_at, updated_at)
-		VALUES (?, ?, ?, NOW(), NOW())
-		ON CONFLICT (group_id, user_id) DO UPDATE
-		SET last_read_message_id = GREATEST(group_read_states.last_read_message_id, EXCLUDED.last_read_message_id),
-			updated_at = NOW()
-	`, groupID, userID, lastReadMessageID).Error
+		INSERT INTO group_mentions (user_id, message_id, group_id, topic_id, created_at)
+		SELECT gm.user_id, ?, gm.group_id, ?, NOW()
+		FROM group_members gm
+		WHERE gm.group_id = ? AND gm.user_id <> ?
+		ON CONFLICT DO NOTHING
+	`, messageID, topicID, groupID, senderID).Error
+}
+
+// CountMentions returns the user's unread mentions in a topic of the group.
+func (r *GroupReadStateRepository) CountMentions(groupID, topicID, userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.GroupMention{}).
+		Where("user_id = ? AND group_id = ? AND topic_id = ?", userID, groupID, topicID).
+		Count(&count).Error
+	return count, err
+}
+
+// NextMention returns the oldest unread mention of the user after afterID,
+// or 0 when there is none.
+func (r *GroupReadStateRepository) NextMention(groupID, topicID, userID, afterID uint) (uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.GroupMention{}).
+		Where("user_id = ? AND group_id = ? AND topic_id = ? AND message_id > ?", userID, groupID, topicID, afterID).
+		Order("message_id ASC").Limit(1).Pluck("message_id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	return ids[0], nil
 }
 
-func (r *GroupReadStateRepository) Get(groupID, userID uint) (*models.GroupReadState, error) {
+func (r *GroupReadStateRepository) Get(groupID, topicID, userID uint) (*models.GroupReadState, error) {
 	var state models.GroupReadState
-	err := r.db.Where("group_id = ? AND user_id = ?", groupID, userID).First(&state).Error
+	err := r.db.Where("group_id = ? AND topic_id = ? AND user_id = ?", groupID, topicID, userID).First(&state).Error
 	if err != nil {
 		return nil, err
 	}
 	return &state, nil
 }
 
-func (r *GroupReadStateRepository) ListByGroup(groupID uint) ([]models.GroupReadState, error) {
+func (r *GroupReadStateRepository) ListByGroup(groupID, topicID uint) ([]models.GroupReadState, error) {
 	var states []models.GroupReadState
-	err := r.db.Where("group_id = ?", groupID).Find(&states).Error
+	err := r.db.Where("group_id = ? AND topic_id = ?", groupID, topicID).Find(&states).Error
 	return states, err
 }
+
+// GroupCatchUpRow describes a group, or a topic of a forum group, with
+// messages past the user's read mark. TopicID is 0 for the General stream.
+type GroupCatchUpRow struct {
+	GroupID           uint  `gorm:"column:group_id"`
+	TopicID           uint  `gorm:"column:topic_id"`
+	LastReadMessageID uint  `gorm:"column:last_read_message_id"`
+	LatestMessageID   uint  `gorm:"column:latest_message_id"`
+	UnreadCount       int64 `gorm:"column:unread_count"`
+}
+
+// ListBehind returns the user's groups and topics that have messages newer
+// than their read mark. Group messages aren't queued per member, so this is
+// what a reconnecting client catches up from. A topic the user never opened
+// counts from the start, as the General stream does for a new member.
+func (r *GroupReadStateRepository) ListBehind(userID uint) ([]GroupCatchUpRow, error) {
+	var rows []GroupCatchUpRow
+	err := r.db.Raw(`
+		SELECT rs.group_id,
+			0 AS topic_id,
+			rs.last_read_message_id,
+			MAX(m.id) AS latest_message_id,
+			COUNT(*) FILTER (WHERE m.message_type <> 'system') AS unread_count
+		FROM group_read_states rs
+		JOIN group_members gm ON gm.group_id = rs.group_id AND gm.user_id = rs.user_id
+		JOIN messages m ON m.group_id = rs.group_id AND m.topic_id IS NULL AND m.id > rs.last_read_message_id
+		WHERE rs.user_id = ? AND rs.topic_id = 0
+		GROUP BY rs.group_id, rs.last_read_message_id
+		UNION ALL
+		SELECT t.group_id,
+			t.id AS topic_id,
+			COALESCE(rs.last_read_message_id, 0) AS last_read_message_id,
+			MAX(m.id) AS latest_message_id,
+			COUNT(*) FILTER (WHERE m.message_type <> 'system') AS unread_count
+		FROM group_members gm
+		JOIN group_topics t ON t.group_id = gm.group_id
+		LEFT JOIN group_read_states rs ON rs.group_id = t.group_id AND rs.user_id = gm.user_id AND rs.topic_id = t.id
+		JOIN messages m ON m.topic_id = t.id AND m.id > COALESCE(rs.last_read_message_id, 0)
+		WHERE gm.user_id = ?
+		GROUP BY t.group_id, t.id, rs.last_read_message_id
+		ORDER BY latest_message_id DESC
+	`, userID, userID).Scan(&rows).Error
+	return rows, err
+}
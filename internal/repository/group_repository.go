@@ -1,10 +1,17 @@
 package repository
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var ErrGroupFull = errors.New("group is full")
+
 type GroupRepository struct {
 	db *gorm.DB
 }
@@ -13,10 +20,20 @@ func NewGroupRepository(db *gorm.DB) *GroupRepository {
 	return &GroupRepository{db: db}
 }
 
+// WithTx returns a repository that runs its queries in tx.
+func (r *GroupRepository) WithTx(tx *gorm.DB) GroupRepositoryInterface {
+	return &GroupRepository{db: tx}
+}
+
 func (r *GroupRepository) Create(group *models.Group) error {
 	return r.db.Create(group).Error
 }
 
+// Update saves the group's own columns; members and creator are left alone.
+func (r *GroupRepository) Update(group *models.Group) error {
+	return r.db.Omit(clause.Associations).Save(group).Error
+}
+
 func (r *GroupRepository) FindByID(id uint) (*models.Group, error) {
 	var group models.Group
 	if err := r.db.Preload("Members").Preload("Creator").First(&group, id).Error; err != nil {
@@ -25,6 +42,15 @@ func (r *GroupRepository) FindByID(id uint) (*models.Group, error) {
 	return &group, nil
 }
 
+// FindInfo loads the group row alone, without members or creator.
+func (r *GroupRepository) FindInfo(id uint) (*models.Group, error) {
+	var group models.Group
+	if err := r.db.First(&group, id).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
 func (r *GroupRepository) FindByHandle(handle string) (*models.Group, error) {
 	var group models.Group
 	err := r.db.Where("LOWER(handle) = LOWER(?)", handle).
@@ -36,27 +62,122 @@ func (r *GroupRepository) FindByHandle(handle string) (*models.Group, error) {
 	return &group, nil
 }
 
-func (r *GroupRepository) AddMember(groupID, userID uint, role models.GroupRole) error {
+// AddMember inserts the membership. With maxMembers > 0 the group row is
+// locked first and the insert fails with ErrGroupFull once the group already
+// has that many members.
+func (r *GroupRepository) AddMember(groupID, userID uint, role models.GroupRole, maxMembers int64) error {
 	member := models.GroupMember{
 		GroupID: groupID,
 		UserID:  userID,
 		Role:    role,
 	}
-	return r.db.Create(&member).Error
+	if maxMembers <= 0 {
+		return r.db.Create(&member).Error
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var id uint
+		if err := tx.Model(&models.Group{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			Where("id = ?", groupID).
+			Scan(&id).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.GroupMember{}).Where("group_id = ?", groupID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= maxMembers {
+			return ErrGroupFull
+		}
+		return tx.Create(&member).Error
+	})
 }
 
 func (r *GroupRepository) RemoveMember(groupID, userID uint) error {
 	return r.db.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupMember{}).Error
 }
 
-func (r *GroupRepository) GetMembers(groupID uint) ([]models.User, error) {
-	var members []models.User
-	err := r.db.Joins("JOIN group_members ON group_members.user_id = users.id").
-		Where("group_members.group_id = ?", groupID).
+// MemberQuery filters and pages ListMembers.
+type MemberQuery struct {
+	// Search matches username or full name, case-insensitively.
+	Search string
+	Roles  []models.GroupRole
+	After  *MemberCursor
+	Limit  int
+}
+
+// MemberCursor is the sort key of the last member of the previous page.
+type MemberCursor struct {
+	Online   bool
+	JoinedAt time.Time
+	UserID   uint
+}
+
+// likeEscaper makes user input match literally in a LIKE pattern with
+// ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListMembers returns a page of the group's members with their users loaded,
+// online members first, then by join time.
+func (r *GroupRepository) ListMembers(groupID uint, q MemberQuery) ([]models.GroupMember, error) {
+	query := r.db.
+		Joins("JOIN users ON users.id = group_members.user_id AND users.deleted_at IS NULL").
+		Where("group_members.group_id = ?", groupID)
+	if q.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(q.Search)) + "%"
+		query = query.Where(`LOWER(users.username) LIKE ? ESCAPE '\' OR LOWER(users.full_name) LIKE ? ESCAPE '\'`, pattern, pattern)
+	}
+	if len(q.Roles) > 0 {
+		query = query.Where("group_members.role IN ?", q.Roles)
+	}
+	if c := q.After; c != nil {
+		later := "(group_members.joined_at, group_members.user_id) > (?, ?)"
+		if c.Online {
+			query = query.Where("users.is_online = false OR (users.is_online = true AND "+later+")", c.JoinedAt, c.UserID)
+		} else {
+			query = query.Where("users.is_online = false AND "+later, c.JoinedAt, c.UserID)
+		}
+	}
+
+	var members []models.GroupMember
+	err := query.Preload("User").
+		Order("users.is_online DESC, group_members.joined_at ASC, group_members.user_id ASC").
+		Limit(q.Limit).
 		Find(&members).Error
 	return members, err
 }
 
+func (r *GroupRepository) GetMemberIDs(groupID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.GroupMember{}).Where("group_id = ?", groupID).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// CountMembers returns the member count of each group.
+func (r *GroupRepository) CountMembers(groupIDs []uint) (map[uint]int64, error) {
+	out := make(map[uint]int64, len(groupIDs))
+	if len(groupIDs) == 0 {
+		return out, nil
+	}
+	var rows []struct {
+		GroupID uint
+		Count   int64
+	}
+	err := r.db.Model(&models.GroupMember{}).
+		Select("group_id, COUNT(*) AS count").
+		Where("group_id IN ?", groupIDs).
+		Group("group_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		out[row.GroupID] = row.Count
+	}
+	return out, nil
+}
+
 func (r *GroupRepository) IsMember(groupID, userID uint) (bool, error) {
 	var count int64
 	err := r.db.Model(&models.GroupMember{}).
@@ -73,6 +194,266 @@ func (r *GroupRepository) GetMemberRole(groupID, userID uint) (models.GroupRole,
 	return member.Role, nil
 }
 
+// FindMember returns the membership row with its group loaded.
+func (r *GroupRepository) FindMember(groupID, userID uint) (*models.GroupMember, error) {
+	var member models.GroupMember
+	if err := r.db.Preload("Group").Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *GroupRepository) UpdatePermissions(groupID uint, member, moderator models.GroupPermission) error {
+	return r.db.Model(&models.Group{}).Where("id = ?", groupID).Updates(map[string]interface{}{
+		"member_permissions":    member,
+		"moderator_permissions": moderator,
+	}).Error
+}
+
+func (r *GroupRepository) UpdateMemberRole(groupID, userID uint, role models.GroupRole) error {
+	res := r.db.Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		Update("role", role)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SaveBan creates the ban or replaces an existing one for the same user.
+func (r *GroupRepository) SaveBan(ban *models.GroupBan) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "group_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"banned_by", "reason", "expires_at", "created_at"}),
+	}).Create(ban).Error
+}
+
+func (r *GroupRepository) DeleteBan(groupID, userID uint) error {
+	return r.db.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupBan{}).Error
+}
+
+func (r *GroupRepository) FindActiveBan(groupID, userID uint, now time.Time) (*models.GroupBan, error) {
+	var ban models.GroupBan
+	err := r.db.Where("group_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)", groupID, userID, now).
+		First(&ban).Error
+	if err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+func (r *GroupRepository) ListActiveBans(groupID uint, now time.Time) ([]models.GroupBan, error) {
+	var bans []models.GroupBan
+	err := r.db.Where("group_id = ? AND (expires_at IS NULL OR expires_at > ?)", groupID, now).
+		Preload("User").
+		Order("created_at DESC").
+		Find(&bans).Error
+	return bans, err
+}
+
+// TransferOwnership makes toUserID the owner and demotes fromUserID to admin.
+func (r *GroupRepository) TransferOwnership(groupID, fromUserID, toUserID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.GroupMember{}).
+			Where("group_id = ? AND user_id = ?", groupID, toUserID).
+			Update("role", models.RoleOwner)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Model(&models.GroupMember{}).
+			Where("group_id = ? AND user_id = ?", groupID, fromUserID).
+			Update("role", models.RoleAdmin).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Group{}).Where("id = ?", groupID).Update("owner_id", toUserID).Error
+	})
+}
+
+// FindOldestMember returns the longest-standing member other than excludeUserID.
+func (r *GroupRepository) FindOldestMember(groupID, excludeUserID uint) (*models.GroupMember, error) {
+	var member models.GroupMember
+	err := r.db.Where("group_id = ? AND user_id <> ?", groupID, excludeUserID).
+		Order("joined_at ASC, user_id ASC").
+		First(&member).Error
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// Delete soft-deletes the group and its messages and drops everything that
+// only makes sense for a live group: memberships, read states, bans, invite
+// links and queued deliveries of its messages. The handle is released and
+// the icon key cleared so the media GC reclaims the icon object. It returns
+// the attachments the messages carried, for the caller to release.
+func (r *GroupRepository) Delete(groupID uint) ([]uint, error) {
+	var attachmentIDs []uint
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Group{}).Where("id = ?", groupID).Updates(map[string]interface{}{
+			"handle":   nil,
+			"icon":     "",
+			"icon_key": "",
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Delete(&models.Group{}, groupID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`DELETE FROM pending_messages WHERE message_id IN (SELECT id FROM messages WHERE group_id = ?)`, groupID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Message{}).
+			Where("group_id = ? AND attachment_id IS NOT NULL", groupID).
+			Distinct().Pluck("attachment_id", &attachmentIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", groupID).Delete(&models.Message{}).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{
+			&models.GroupInviteUse{},
+			&models.GroupInviteLink{},
+			&models.GroupReadState{},
+			&models.GroupMention{},
+			&models.GroupTopic{},
+			&models.GroupBan{},
+			&models.GroupJoinRequest{},
+			&models.GroupMember{},
+		} {
+			if err := tx.Where("group_id = ?", groupID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return attachmentIDs, err
+}
+
+// FilterMembers returns which of the users are members of the group.
+func (r *GroupRepository) FilterMembers(groupID uint, userIDs []uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id IN ?", groupID, userIDs).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// GetMemberIDsByRoles returns the IDs of members holding any of roles.
+func (r *GroupRepository) GetMemberIDsByRoles(groupID uint, roles []models.GroupRole) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.GroupMember{}).
+		Where("group_id = ? AND role IN ?", groupID, roles).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+func (r *GroupRepository) CreateJoinRequest(req *models.GroupJoinRequest) error {
+	return r.db.Create(req).Error
+}
+
+func (r *GroupRepository) FindJoinRequest(id uint) (*models.GroupJoinRequest, error) {
+	var req models.GroupJoinRequest
+	if err := r.db.Preload("User").First(&req, id).Error; err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (r *GroupRepository) FindPendingJoinRequest(groupID, userID uint) (*models.GroupJoinRequest, error) {
+	var req models.GroupJoinRequest
+	err := r.db.Where("group_id = ? AND user_id = ? AND status = ?", groupID, userID, models.JoinRequestPending).
+		First(&req).Error
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ListPendingJoinRequests returns the group's open requests, oldest first.
+func (r *GroupRepository) ListPendingJoinRequests(groupID uint) ([]models.GroupJoinRequest, error) {
+	var reqs []models.GroupJoinRequest
+	err := r.db.Where("group_id = ? AND status = ?", groupID, models.JoinRequestPending).
+		Preload("User").
+		Order("created_at ASC").
+		Find(&reqs).Error
+	return reqs, err
+}
+
+// DecideJoinRequest closes a pending request. It returns
+// gorm.ErrRecordNotFound if the request was already decided.
+func (r *GroupRepository) DecideJoinRequest(id uint, status models.JoinRequestStatus, deciderID uint, reason string, at time.Time) error {
+	res := r.db.Model(&models.GroupJoinRequest{}).
+		Where("id = ? AND status = ?", id, models.JoinRequestPending).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"decided_by": deciderID,
+			"reason":     reason,
+			"decided_at": at,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ReopenJoinRequest puts an approved request back to pending, for when
+// admitting the requester failed.
+func (r *GroupRepository) ReopenJoinRequest(id uint) error {
+	res := r.db.Model(&models.GroupJoinRequest{}).
+		Where("id = ? AND status = ?", id, models.JoinRequestApproved).
+		Updates(map[string]interface{}{
+			"status":     models.JoinRequestPending,
+			"decided_by": nil,
+			"reason":     "",
+			"decided_at": nil,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GroupRepository) CreateTopic(topic *models.GroupTopic) error {
+	return r.db.Create(topic).Error
+}
+
+func (r *GroupRepository) FindTopic(id uint) (*models.GroupTopic, error) {
+	var topic models.GroupTopic
+	if err := r.db.First(&topic, id).Error; err != nil {
+		return nil, err
+	}
+	return &topic, nil
+}
+
+// ListTopics returns the group's topics, most recently active first.
+func (r *GroupRepository) ListTopics(groupID uint) ([]models.GroupTopic, error) {
+	var topics []models.GroupTopic
+	err := r.db.Where("group_id = ?", groupID).
+		Order("(SELECT COALESCE(MAX(m.id), 0) FROM messages m WHERE m.topic_id = group_topics.id) DESC, id DESC").
+		Find(&topics).Error
+	return topics, err
+}
+
+func (r *GroupRepository) UpdateTopic(topic *models.GroupTopic) error {
+	return r.db.Model(topic).Select("title", "is_closed").Updates(topic).Error
+}
+
 func (r *GroupRepository) GetUserGroups(userID uint) ([]models.Group, error) {
 	var groups []models.Group
 	err := r.db.Joins("JOIN group_members ON group_members.group_id = groups.id").
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"gorm.io/gorm"
 )
 
 // UserRepositoryInterface defines the contract for user repository operations
@@ -11,6 +12,7 @@ type UserRepositoryInterface interface {
 	Create(user *models.User) error
 	FindByEmail(email string) (*models.User, error)
 	FindByUsername(username string) (*models.User, error)
+	FindByUsernames(usernames []string) ([]models.User, error)
 	FindByID(id uint) (*models.User, error)
 	Update(user *models.User) error
 	UpdateOnlineStatus(userID uint, isOnline bool) error
@@ -24,18 +26,28 @@ type MessageRepositoryInterface interface {
 	FindByClientID(clientID string, senderID uint) (*models.Message, error)
 	FindConversation(userID1, userID2 uint, limit int) ([]models.Message, error)
 	FindConversationCursor(userID1, userID2 uint, cursor uint, limit int) ([]models.Message, error)
-	FindGroupMessages(groupID uint, cursor uint, limit int) ([]models.Message, error)
+	FindGroupMessages(groupID, topicID uint, cursor uint, limit int) ([]models.Message, error)
 	FindMessagesSince(requestingUserID uint, conversationID string, lastMessageID uint, limit int) ([]models.Message, error)
 	GetLatestDirectMessageID(userID1, userID2 uint) (uint, error)
 	ListDirectConversations(userID uint, cursorCreatedAt *time.Time, cursorMessageID uint, limit int) ([]ConversationRow, error)
 	ListRecentPeers(userID uint, limit int) ([]RecentPeerRow, error)
 	ListGroupConversations(userID uint, cursorCreatedAt *time.Time, cursorMessageID uint, limit int) ([]GroupConversationRow, error)
 	ListConversationsUnified(userID uint, cursorCreatedAt *time.Time, cursorMessageID uint, limit int) ([]ConversationUnifiedRow, error)
-	GetLatestGroupMessageID(groupID uint) (uint, error)
-	IsMessageInGroup(messageID uint, groupID uint) (bool, error)
+	GetLatestGroupMessageID(groupID, topicID uint) (uint, error)
+	IsMessageInGroup(messageID uint, groupID, topicID uint) (bool, error)
 	MarkAsDelivered(messageID uint) error
 	MarkAsRead(messageID uint) error
 	MarkConversationAsRead(userID uint, peerID uint) (int64, error)
+	StartGroupReadTimers(groupID, topicID, readerID, upToID uint) error
+	FindExpired(now time.Time, limit int) ([]models.Message, error)
+	DeleteMessages(ids []uint) error
+	SetLinkPreview(messageID uint, preview *models.LinkPreview) (bool, error)
+}
+
+// DirectChatSettingsRepositoryInterface defines the contract for settings shared by a DM's participants
+type DirectChatSettingsRepositoryInterface interface {
+	Get(userID1, userID2 uint) (*models.DirectChatSettings, error)
+	Save(settings *models.DirectChatSettings) error
 }
 
 // RefreshTokenRepositoryInterface defines the contract for refresh token repository operations
@@ -47,33 +59,91 @@ type RefreshTokenRepositoryInterface interface {
 
 // GroupRepositoryInterface defines the contract for group repository operations
 type GroupRepositoryInterface interface {
+	WithTx(tx *gorm.DB) GroupRepositoryInterface
 	Create(group *models.Group) error
+	Update(group *models.Group) error
 	FindByID(id uint) (*models.Group, error)
+	FindInfo(id uint) (*models.Group, error)
 	FindByHandle(handle string) (*models.Group, error)
 	SearchPublicGroups(query string, limit int) ([]models.Group, error)
-	AddMember(groupID, userID uint, role models.GroupRole) error
+	AddMember(groupID, userID uint, role models.GroupRole, maxMembers int64) error
 	RemoveMember(groupID, userID uint) error
-	GetMembers(groupID uint) ([]models.User, error)
+	GetMemberIDs(groupID uint) ([]uint, error)
+	FilterMembers(groupID uint, userIDs []uint) ([]uint, error)
+	ListMembers(groupID uint, q MemberQuery) ([]models.GroupMember, error)
+	CountMembers(groupIDs []uint) (map[uint]int64, error)
 	IsMember(groupID, userID uint) (bool, error)
 	GetMemberRole(groupID, userID uint) (models.GroupRole, error)
+	FindMember(groupID, userID uint) (*models.GroupMember, error)
+	UpdatePermissions(groupID uint, member, moderator models.GroupPermission) error
+	UpdateMemberRole(groupID, userID uint, role models.GroupRole) error
+	SaveBan(ban *models.GroupBan) error
+	DeleteBan(groupID, userID uint) error
+	FindActiveBan(groupID, userID uint, now time.Time) (*models.GroupBan, error)
+	ListActiveBans(groupID uint, now time.Time) ([]models.GroupBan, error)
 	GetUserGroups(userID uint) ([]models.Group, error)
+	TransferOwnership(groupID, fromUserID, toUserID uint) error
+	FindOldestMember(groupID, excludeUserID uint) (*models.GroupMember, error)
+	Delete(groupID uint) ([]uint, error)
+	GetMemberIDsByRoles(groupID uint, roles []models.GroupRole) ([]uint, error)
+	CreateJoinRequest(req *models.GroupJoinRequest) error
+	FindJoinRequest(id uint) (*models.GroupJoinRequest, error)
+	FindPendingJoinRequest(groupID, userID uint) (*models.GroupJoinRequest, error)
+	ListPendingJoinRequests(groupID uint) ([]models.GroupJoinRequest, error)
+	DecideJoinRequest(id uint, status models.JoinRequestStatus, deciderID uint, reason string, at time.Time) error
+	ReopenJoinRequest(id uint) error
+	CreateTopic(topic *models.GroupTopic) error
+	FindTopic(id uint) (*models.GroupTopic, error)
+	ListTopics(groupID uint) ([]models.GroupTopic, error)
+	UpdateTopic(topic *models.GroupTopic) error
 }
 
 // GroupInviteRepositoryInterface defines the contract for group invite link operations
 type GroupInviteRepositoryInterface interface {
 	Create(link *models.GroupInviteLink) error
 	FindByToken(token string) (*models.GroupInviteLink, error)
-	IncrementUse(id uint) error
+	FindByID(id uint) (*models.GroupInviteLink, error)
+	ListByGroup(groupID uint) ([]models.GroupInviteLink, error)
+	UpdateSettings(link *models.GroupInviteLink) error
+	IncrementUse(id, userID uint, now time.Time, join func(tx *gorm.DB) error) (bool, error)
 	Revoke(id uint, revokedAt time.Time) error
+	ListUses(linkID uint) ([]models.GroupInviteUse, error)
+}
+
+// GroupAuditRepositoryInterface defines the contract for group audit log operations
+type GroupAuditRepositoryInterface interface {
+	Create(entry *models.GroupAuditEntry) error
+	List(groupID uint, q AuditQuery) ([]models.GroupAuditEntry, error)
 }
 
 // GroupReadStateRepositoryInterface defines the contract for group read state operations
 type GroupReadStateRepositoryInterface interface {
 	EnsureForMember(groupID, userID uint) error
 	DeleteForMember(groupID, userID uint) error
-	UpsertMonotonic(groupID, userID uint, lastReadMessageID uint) error
-	Get(groupID, userID uint) (*models.GroupReadState, error)
-	ListByGroup(groupID uint) ([]models.GroupReadState, error)
+	UpsertMonotonic(groupID, topicID, userID uint, lastReadMessageID uint) error
+	Get(groupID, topicID, userID uint) (*models.GroupReadState, error)
+	ListByGroup(groupID, topicID uint) ([]models.GroupReadState, error)
+	ListBehind(userID uint) ([]GroupCatchUpRow, error)
+	AddMentions(groupID, topicID, messageID uint, userIDs []uint) error
+	AddMentionAll(groupID, topicID, messageID, senderID uint) error
+	CountMentions(groupID, topicID, userID uint) (int64, error)
+	NextMention(groupID, topicID, userID, afterID uint) (uint, error)
+}
+
+// ScheduledMessageRepositoryInterface defines the contract for scheduled message operations
+type ScheduledMessageRepositoryInterface interface {
+	Create(msg *models.ScheduledMessage) error
+	FindByID(id uint) (*models.ScheduledMessage, error)
+	FindByClientID(clientID string, senderID uint) (*models.ScheduledMessage, error)
+	ListBySender(senderID uint) ([]models.ScheduledMessage, error)
+	CountPending(senderID uint) (int64, error)
+	UpdatePending(msg *models.ScheduledMessage) error
+	Delete(id uint) error
+	ClaimDue(now time.Time, limit int) ([]models.ScheduledMessage, error)
+	ReleaseStale(claimedBefore time.Time) (int64, error)
+	Retry(id uint, attempts int, sendAt time.Time) error
+	Complete(id uint) error
+	MarkFailed(id uint, reason string) error
 }
 
 // PendingMessageRepositoryInterface defines the contract for pending message queue operations
@@ -87,3 +157,31 @@ type PendingMessageRepositoryInterface interface {
 	CountPendingForUser(userID uint) (int64, error)
 	CleanupOld(olderThan time.Duration) error
 }
+
+// MediaReferenceRepositoryInterface resolves which stored object keys are still referenced by the database
+type MediaReferenceRepositoryInterface interface {
+	ReferencedKeys(keys []string) (map[string]bool, error)
+}
+
+// AttachmentRepositoryInterface defines the contract for attachment and content-addressed blob operations
+type AttachmentRepositoryInterface interface {
+	CreateWithBlob(att *models.Attachment, blob *models.MediaBlob, quotaBytes int64, ensure func(created bool) error) error
+	FindByID(id uint) (*models.Attachment, error)
+	FindBlob(hash string) (*models.MediaBlob, error)
+	SetBlobScanResult(hash string, status models.ScanStatus, signature string) error
+	ListQuarantinedBlobs(before time.Time, limit int) ([]models.MediaBlob, error)
+	DeleteAndRelease(id uint, release func(blob models.MediaBlob) error) error
+	IsReferenced(attachmentID uint) (bool, error)
+	CanAccess(attachmentID, userID uint) (bool, error)
+}
+
+// StorageRepositoryInterface defines the contract for storage plans and usage accounting
+type StorageRepositoryInterface interface {
+	ListPlans() ([]models.StoragePlan, error)
+	FindPlan(id uint) (*models.StoragePlan, error)
+	SavePlan(plan *models.StoragePlan) error
+	AssignPlan(userID uint, planID *uint) error
+	PlanForUser(userID uint) (*models.StoragePlan, error)
+	GetUsage(userID uint) (models.StorageUsage, error)
+	SaveAvatarWithinQuota(user *models.User, quotaBytes int64) error
+}
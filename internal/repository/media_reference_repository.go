@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+type MediaReferenceRepository struct {
+	db *gorm.DB
+}
+
+func NewMediaReferenceRepository(db *gorm.DB) *MediaReferenceRepository {
+	return &MediaReferenceRepository{db: db}
+}
+
+// ReferencedKeys returns the subset of keys that are referenced by any row that
+// owns stored media. Soft-deleted rows still count so that restores keep working
+// until the row is purged.
+func (r *MediaReferenceRepository) ReferencedKeys(keys []string) (map[string]bool, error) {
+	out := make(map[string]bool, len(keys))
+	if len(keys) == 0 {
+		return out, nil
+	}
+
+	var found []string
+	err := r.db.Raw(`
+		SELECT avatar_key FROM users WHERE avatar_key IN ?
+		UNION
+		SELECT icon_key FROM groups WHERE icon_key IN ?
+		UNION
+		SELECT key FROM media_blobs WHERE key IN ?
+		UNION
+		SELECT link_preview->>'image_key' FROM messages
+		WHERE link_preview IS NOT NULL AND link_preview->>'image_key' IN ?
+	`, keys, keys, keys, keys).Scan(&found).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range found {
+		out[k] = true
+	}
+	return out, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
 	"gorm.io/gorm"
@@ -23,13 +24,13 @@ func (r *MessageRepository) Create(message *models.Message) error {
 
 func (r *MessageRepository) FindByID(id uint) (*models.Message, error) {
 	var message models.Message
-	err := r.db.Preload("Sender").First(&message, id).Error
+	err := r.db.Preload("Sender").Preload("Attachment.Blob").First(&message, id).Error
 	return &message, err
 }
 
 func (r *MessageRepository) FindConversation(userID1, userID2 uint, limit int) ([]models.Message, error) {
 	var messages []models.Message
-	err := r.db.Preload("Sender").
+	err := notExpired(r.db.Preload("Sender").Preload("Attachment.Blob")).
 		Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
 			userID1, userID2, userID2, userID1).
 		Order("id DESC").
@@ -42,7 +43,7 @@ func (r *MessageRepository) FindConversation(userID1, userID2 uint, limit int) (
 // FindConversationCursor fetches messages using cursor-based pagination (more efficient)
 func (r *MessageRepository) FindConversationCursor(userID1, userID2 uint, cursor uint, limit int) ([]models.Message, error) {
 	var messages []models.Message
-	query := r.db.Preload("Sender").
+	query := notExpired(r.db.Preload("Sender").Preload("Attachment.Blob")).
 		Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
 			userID1, userID2, userID2, userID1)
 
@@ -55,10 +56,26 @@ func (r *MessageRepository) FindConversationCursor(userID1, userID2 uint, cursor
 	return messages, err
 }
 
-// FindGroupMessages fetches group messages with cursor-based pagination
-func (r *MessageRepository) FindGroupMessages(groupID uint, cursor uint, limit int) ([]models.Message, error) {
+// notExpired hides disappearing messages whose timer has run out but which the
+// expiry reaper hasn't deleted yet.
+func notExpired(query *gorm.DB) *gorm.DB {
+	return query.Where("messages.expires_at IS NULL OR messages.expires_at > NOW()")
+}
+
+// inTopic narrows a group message query to one topic; topicID 0 selects the
+// General stream.
+func inTopic(query *gorm.DB, topicID uint) *gorm.DB {
+	if topicID == 0 {
+		return query.Where("topic_id IS NULL")
+	}
+	return query.Where("topic_id = ?", topicID)
+}
+
+// FindGroupMessages fetches the messages of a group topic (0 for the General
+// stream) with cursor-based pagination
+func (r *MessageRepository) FindGroupMessages(groupID, topicID uint, cursor uint, limit int) ([]models.Message, error) {
 	var messages []models.Message
-	query := r.db.Preload("Sender").Where("group_id = ?", groupID)
+	query := inTopic(notExpired(r.db.Preload("Sender").Preload("Attachment.Blob")).Where("group_id = ?", groupID), topicID)
 
 	if cursor > 0 {
 		query = query.Where("id < ?", cursor)
@@ -89,12 +106,17 @@ func (r *MessageRepository) MarkAsDelivered(messageID uint) error {
 		}).Error
 }
 
+// startReadTimer sets expires_at on disappearing messages whose timer starts
+// at first read and hasn't started yet.
+var startReadTimer = gorm.Expr("CASE WHEN ttl_seconds > 0 AND expires_at IS NULL THEN NOW() + ttl_seconds * INTERVAL '1 second' ELSE expires_at END")
+
 func (r *MessageRepository) MarkAsRead(messageID uint) error {
 	return r.db.Model(&models.Message{}).Where("id = ?", messageID).
 		Updates(map[string]interface{}{
-			"is_read": true,
-			"read_at": gorm.Expr("NOW()"),
-			"status":  models.StatusRead,
+			"is_read":    true,
+			"read_at":    gorm.Expr("NOW()"),
+			"status":     models.StatusRead,
+			"expires_at": startReadTimer,
 		}).Error
 }
 
@@ -105,17 +127,66 @@ func (r *MessageRepository) MarkConversationAsRead(userID uint, peerID uint) (in
 		Where("sender_id = ?", peerID).
 		Where("is_read = false").
 		Updates(map[string]interface{}{
-			"is_read": true,
-			"read_at": gorm.Expr("NOW()"),
-			"status":  models.StatusRead,
+			"is_read":    true,
+			"read_at":    gorm.Expr("NOW()"),
+			"status":     models.StatusRead,
+			"expires_at": startReadTimer,
 		})
 	return tx.RowsAffected, tx.Error
 }
 
+// StartGroupReadTimers starts the timers of read-mode disappearing messages in
+// a group topic up to upToID that readerID didn't send. The first member to
+// read a message starts its timer for everyone.
+func (r *MessageRepository) StartGroupReadTimers(groupID, topicID, readerID, upToID uint) error {
+	return inTopic(r.db.Model(&models.Message{}).Where("group_id = ?", groupID), topicID).
+		Where("id <= ? AND sender_id <> ?", upToID, readerID).
+		Where("ttl_seconds > 0 AND expires_at IS NULL").
+		Update("expires_at", gorm.Expr("NOW() + ttl_seconds * INTERVAL '1 second'")).Error
+}
+
+// FindExpired returns up to limit messages whose expiry has passed, oldest
+// expiry first. Only the fields needed to delete them and notify clients are
+// loaded.
+func (r *MessageRepository) FindExpired(now time.Time, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.db.Select("id", "sender_id", "recipient_id", "group_id", "topic_id", "attachment_id", "expires_at").
+		Where("expires_at <= ?", now).
+		Order("expires_at ASC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+// SetLinkPreview attaches a link preview to a message. updated is false when
+// the message was deleted in the meantime.
+func (r *MessageRepository) SetLinkPreview(messageID uint, preview *models.LinkPreview) (bool, error) {
+	res := r.db.Model(&models.Message{ID: messageID}).Select("link_preview").
+		Updates(&models.Message{LinkPreview: preview})
+	return res.RowsAffected > 0, res.Error
+}
+
+// DeleteMessages permanently removes the messages, their queued offline
+// deliveries and unread mentions.
+func (r *MessageRepository) DeleteMessages(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM pending_messages WHERE message_id IN ?`, ids).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`DELETE FROM group_mentions WHERE message_id IN ?`, ids).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Message{}).Error
+	})
+}
+
 // FindByClientID finds a message by client ID and sender
 func (r *MessageRepository) FindByClientID(clientID string, senderID uint) (*models.Message, error) {
 	var message models.Message
-	err := r.db.Preload("Sender").
+	err := r.db.Preload("Sender").Preload("Attachment.Blob").
 		Where("client_id = ? AND sender_id = ?", clientID, senderID).
 		First(&message).Error
 	if err != nil {
@@ -147,6 +218,14 @@ func parseConversationID(conversationID string) (kind string, id uint, err error
 		}
 		return "group", uint(v), nil
 	}
+	if strings.HasPrefix(conversationID, "topic_") {
+		s := strings.TrimPrefix(conversationID, "topic_")
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid topic conversation_id: %w", err)
+		}
+		return "topic", uint(v), nil
+	}
 	return "", 0, fmt.Errorf("unknown conversation_id format")
 }
 
@@ -165,7 +244,7 @@ func (r *MessageRepository) FindMessagesSince(requestingUserID uint, conversatio
 		return nil, err
 	}
 
-	query := r.db.Preload("Sender").Where("messages.id > ?", lastMessageID)
+	query := notExpired(r.db.Preload("Sender").Preload("Attachment.Blob")).Where("messages.id > ?", lastMessageID)
 
 	switch kind {
 	case "user":
@@ -179,7 +258,11 @@ func (r *MessageRepository) FindMessagesSince(requestingUserID uint, conversatio
 		// Enforce group membership by joining group_members with requestingUserID.
 		query = query.
 			Joins("JOIN group_members gm ON gm.group_id = messages.group_id AND gm.user_id = ?", requestingUserID).
-			Where("messages.group_id = ?", groupID)
+			Where("messages.group_id = ? AND messages.topic_id IS NULL", groupID)
+	case "topic":
+		query = query.
+			Joins("JOIN group_members gm ON gm.group_id = messages.group_id AND gm.user_id = ?", requestingUserID).
+			Where("messages.topic_id = ?", id)
 	default:
 		return nil, fmt.Errorf("unsupported conversation kind")
 	}
@@ -189,21 +272,19 @@ func (r *MessageRepository) FindMessagesSince(requestingUserID uint, conversatio
 	return messages, err
 }
 
-// GetLatestGroupMessageID returns the latest message ID in a group (0 if none)
-func (r *MessageRepository) GetLatestGroupMessageID(groupID uint) (uint, error) {
+// GetLatestGroupMessageID returns the latest message ID in a group topic (0 if none)
+func (r *MessageRepository) GetLatestGroupMessageID(groupID, topicID uint) (uint, error) {
 	var maxID uint
-	err := r.db.Model(&models.Message{}).
-		Where("group_id = ?", groupID).
+	err := inTopic(r.db.Model(&models.Message{}).Where("group_id = ?", groupID), topicID).
 		Select("COALESCE(MAX(id), 0)").
 		Scan(&maxID).Error
 	return maxID, err
 }
 
-// IsMessageInGroup checks whether a message belongs to a group
-func (r *MessageRepository) IsMessageInGroup(messageID uint, groupID uint) (bool, error) {
+// IsMessageInGroup checks whether a message belongs to a group topic
+func (r *MessageRepository) IsMessageInGroup(messageID uint, groupID, topicID uint) (bool, error) {
 	var count int64
-	err := r.db.Model(&models.Message{}).
-		Where("id = ? AND group_id = ?", messageID, groupID).
+	err := inTopic(r.db.Model(&models.Message{}).Where("id = ? AND group_id = ?", messageID, groupID), topicID).
 		Count(&count).Error
 	return count > 0, err
 }
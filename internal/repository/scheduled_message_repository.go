@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"sort"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type ScheduledMessageRepository struct {
+	db *gorm.DB
+}
+
+func NewScheduledMessageRepository(db *gorm.DB) *ScheduledMessageRepository {
+	return &ScheduledMessageRepository{db: db}
+}
+
+func (r *ScheduledMessageRepository) Create(msg *models.ScheduledMessage) error {
+	return r.db.Create(msg).Error
+}
+
+func (r *ScheduledMessageRepository) FindByID(id uint) (*models.ScheduledMessage, error) {
+	var msg models.ScheduledMessage
+	if err := r.db.First(&msg, id).Error; err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (r *ScheduledMessageRepository) FindByClientID(clientID string, senderID uint) (*models.ScheduledMessage, error) {
+	var msg models.ScheduledMessage
+	if err := r.db.Where("client_id = ? AND sender_id = ?", clientID, senderID).First(&msg).Error; err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// ListBySender returns the user's unsent scheduled messages, soonest first.
+func (r *ScheduledMessageRepository) ListBySender(senderID uint) ([]models.ScheduledMessage, error) {
+	var msgs []models.ScheduledMessage
+	err := r.db.Where("sender_id = ?", senderID).
+		Order("send_at ASC, id ASC").
+		Find(&msgs).Error
+	return msgs, err
+}
+
+// CountPending counts the user's messages still waiting to be sent.
+func (r *ScheduledMessageRepository) CountPending(senderID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.ScheduledMessage{}).
+		Where("sender_id = ? AND status IN ?", senderID, []models.ScheduledMessageStatus{models.ScheduledPending, models.ScheduledSending}).
+		Count(&count).Error
+	return count, err
+}
+
+// UpdatePending saves new content and send time. It returns
+// gorm.ErrRecordNotFound if the message was claimed for sending meanwhile.
+func (r *ScheduledMessageRepository) UpdatePending(msg *models.ScheduledMessage) error {
+	res := r.db.Model(&models.ScheduledMessage{}).
+		Where("id = ? AND status = ?", msg.ID, models.ScheduledPending).
+		Select("content", "entities", "send_at", "updated_at").
+		Updates(&models.ScheduledMessage{
+			Content:   msg.Content,
+			Entities:  msg.Entities,
+			SendAt:    msg.SendAt,
+			UpdatedAt: time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Delete removes a scheduled message unless a scheduler run is sending it;
+// then it returns gorm.ErrRecordNotFound.
+func (r *ScheduledMessageRepository) Delete(id uint) error {
+	res := r.db.Where("status <> ?", models.ScheduledSending).Delete(&models.ScheduledMessage{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ClaimDue marks up to limit pending messages due by now as sending and
+// returns them, soonest first. Rows locked by another instance are skipped.
+func (r *ScheduledMessageRepository) ClaimDue(now time.Time, limit int) ([]models.ScheduledMessage, error) {
+	var msgs []models.ScheduledMessage
+	err := r.db.Raw(`
+		UPDATE scheduled_messages SET status = ?, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM scheduled_messages
+			WHERE status = ? AND send_at <= ?
+			ORDER BY send_at ASC
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`, models.ScheduledSending, models.ScheduledPending, now, limit).Scan(&msgs).Error
+	sort.Slice(msgs, func(i, j int) bool {
+		if !msgs[i].SendAt.Equal(msgs[j].SendAt) {
+			return msgs[i].SendAt.Before(msgs[j].SendAt)
+		}
+		return msgs[i].ID < msgs[j].ID
+	})
+	return msgs, err
+}
+
+// ReleaseStale hands messages claimed before the cutoff back to the queue;
+// their scheduler run died before finishing them.
+func (r *ScheduledMessageRepository) ReleaseStale(claimedBefore time.Time) (int64, error) {
+	res := r.db.Model(&models.ScheduledMessage{}).
+		Where("status = ? AND updated_at < ?", models.ScheduledSending, claimedBefore).
+		Updates(map[string]interface{}{"status": models.ScheduledPending, "updated_at": time.Now()})
+	return res.RowsAffected, res.Error
+}
+
+// Retry puts a claimed message back in the queue after a transient failure,
+// to be sent again at sendAt.
+func (r *ScheduledMessageRepository) Retry(id uint, attempts int, sendAt time.Time) error {
+	return r.db.Model(&models.ScheduledMessage{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":     models.ScheduledPending,
+			"attempts":   attempts,
+			"send_at":    sendAt,
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// Complete removes a message the scheduler has sent.
+func (r *ScheduledMessageRepository) Complete(id uint) error {
+	return r.db.Delete(&models.ScheduledMessage{}, id).Error
+}
+
+// MarkFailed records why a message can never be sent.
+func (r *ScheduledMessageRepository) MarkFailed(id uint, reason string) error {
+	return r.db.Model(&models.ScheduledMessage{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":     models.ScheduledFailed,
+			"error":      reason,
+			"updated_at": time.Now(),
+		}).Error
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+type StorageRepository struct {
+	db *gorm.DB
+}
+
+func NewStorageRepository(db *gorm.DB) *StorageRepository {
+	return &StorageRepository{db: db}
+}
+
+func (r *StorageRepository) ListPlans() ([]models.StoragePlan, error) {
+	var plans []models.StoragePlan
+	err := r.db.Order("quota_bytes ASC, id ASC").Find(&plans).Error
+	return plans, err
+}
+
+func (r *StorageRepository) FindPlan(id uint) (*models.StoragePlan, error) {
+	var plan models.StoragePlan
+	if err := r.db.First(&plan, id).Error; err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// SavePlan creates or updates a plan. Marking a plan default clears the flag
+// on every other plan in the same transaction.
+func (r *StorageRepository) SavePlan(plan *models.StoragePlan) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if plan.IsDefault {
+			if err := tx.Model(&models.StoragePlan{}).
+				Where("is_default = ? AND id <> ?", true, plan.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(plan).Error
+	})
+}
+
+func (r *StorageRepository) AssignPlan(userID uint, planID *uint) error {
+	res := r.db.Model(&models.User{}).Where("id = ?", userID).Update("storage_plan_id", planID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// PlanForUser returns the user's plan, the default plan, or nil if neither exists.
+func (r *StorageRepository) PlanForUser(userID uint) (*models.StoragePlan, error) {
+	var plans []models.StoragePlan
+	err := r.db.Raw(`
+		SELECT p.* FROM storage_plans p
+		WHERE p.id = (SELECT storage_plan_id FROM users WHERE id = ?)
+		   OR p.is_default
+		ORDER BY p.is_default ASC
+		LIMIT 1
+	`, userID).Scan(&plans).Error
+	if err != nil || len(plans) == 0 {
+		return nil, err
+	}
+	return &plans[0], nil
+}
+
+func (r *StorageRepository) GetUsage(userID uint) (models.StorageUsage, error) {
+	return usageFor(r.db, userID)
+}
+
+// SaveAvatarWithinQuota persists the user's new avatar fields if the new
+// avatar plus existing attachments fit in quotaBytes (<= 0 means unlimited).
+func (r *StorageRepository) SaveAvatarWithinQuota(user *models.User, quotaBytes int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserForQuota(tx, user.ID); err != nil {
+			return err
+		}
+		if quotaBytes > 0 {
+			usage, err := usageFor(tx, user.ID)
+			if err != nil {
+				return err
+			}
+			if usage.AttachmentBytes+user.AvatarSizeBytes > quotaBytes {
+				return ErrStorageQuotaExceeded
+			}
+		}
+		return tx.Save(user).Error
+	})
+}
+
+func usageFor(db *gorm.DB, userID uint) (models.StorageUsage, error) {
+	var usage models.StorageUsage
+	err := db.Raw(`
+		SELECT
+			COALESCE((SELECT avatar_size_bytes FROM users WHERE id = ?), 0) AS avatar_bytes,
+			COALESCE(SUM(size_bytes), 0) AS attachment_bytes,
+			COUNT(*) AS attachment_count
+		FROM attachments
+		WHERE uploader_id = ? AND deleted_at IS NULL
+	`, userID, userID).Scan(&usage).Error
+	return usage, err
+}
+
+// lockUserForQuota serializes quota checks for one user so concurrent uploads
+// can't both pass against the same remaining space.
+func lockUserForQuota(tx *gorm.DB, userID uint) error {
+	var id uint
+	return tx.Model(&models.User{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("id = ?", userID).
+		Scan(&id).Error
+}
+
+// checkAttachmentQuota must run inside the transaction that inserts the
+// attachment.
+func checkAttachmentQuota(tx *gorm.DB, userID uint, addBytes, quotaBytes int64) error {
+	if quotaBytes <= 0 {
+		return nil
+	}
+	if err := lockUserForQuota(tx, userID); err != nil {
+		return err
+	}
+	usage, err := usageFor(tx, userID)
+	if err != nil {
+		return err
+	}
+	if usage.TotalBytes()+addBytes > quotaBytes {
+		return ErrStorageQuotaExceeded
+	}
+	return nil
+}
@@ -29,6 +29,14 @@ func (r *UserRepository) FindByUsername(username string) (*models.User, error) {
 	return &user, err
 }
 
+// FindByUsernames returns the users with any of the names, which must be
+// lower-case.
+func (r *UserRepository) FindByUsernames(usernames []string) ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("LOWER(username) IN ?", usernames).Find(&users).Error
+	return users, err
+}
+
 func (r *UserRepository) FindByID(id uint) (*models.User, error) {
 	var user models.User
 	err := r.db.First(&user, id).Error
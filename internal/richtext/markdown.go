@@ -0,0 +1,237 @@
+package richtext
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+)
+
+// The markdown subset:
+//
+//	**bold**  *italic*  _italic_  ||spoiler||  `code`  [text](https://url)
+//	```lang
+//	pre block
+//	```
+//
+// A backslash escapes the next punctuation character. Markers that don't
+// pair up, and _ inside a word, are kept as text.
+
+type tokenKind int
+
+const (
+	tokText tokenKind = iota
+	tokCode
+	tokPre
+	tokMarker
+	tokLinkOpen
+	tokLinkClose
+)
+
+type token struct {
+	kind tokenKind
+	// text is the literal text, the body of code, or the source of a marker,
+	// written out as is when the marker isn't paired.
+	text     string
+	entity   models.MessageEntityType
+	url      string
+	language string
+	canOpen  bool
+	canClose bool
+	match    int
+}
+
+type marker struct {
+	text   string
+	entity models.MessageEntityType
+}
+
+var markers = []marker{
+	{"**", models.EntityBold},
+	{"||", models.EntitySpoiler},
+	{"*", models.EntityItalic},
+	{"_", models.EntityItalic},
+}
+
+// ParseMarkdown converts markdown to plain text and the entities that format
+// it.
+func ParseMarkdown(source string) (string, []models.MessageEntity) {
+	tokens := tokenize(source)
+	pair(tokens)
+
+	var out strings.Builder
+	var entities []models.MessageEntity
+	pos := 0
+	starts := make(map[int]int)
+	for i, tk := range tokens {
+		switch {
+		case tk.kind == tokCode || tk.kind == tokPre:
+			n := models.UTF16Len(tk.text)
+			entities = append(entities, models.MessageEntity{Type: tk.entity, Offset: pos, Length: n, Language: tk.language})
+			out.WriteString(tk.text)
+			pos += n
+		case tk.kind == tokText || tk.match < 0:
+			out.WriteString(tk.text)
+			pos += models.UTF16Len(tk.text)
+		case tk.match > i:
+			starts[i] = pos
+		case pos > starts[tk.match]:
+			opener := tokens[tk.match]
+			entities = append(entities, models.MessageEntity{Type: opener.entity, Offset: starts[tk.match], Length: pos - starts[tk.match], URL: tk.url})
+		}
+	}
+	Sort(entities)
+	return out.String(), entities
+}
+
+func tokenize(s string) []token {
+	var tokens []token
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			tokens = append(tokens, token{kind: tokText, text: text.String(), match: -1})
+			text.Reset()
+		}
+	}
+	push := func(tk token) {
+		flush()
+		tk.match = -1
+		tokens = append(tokens, tk)
+	}
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && isEscapable(rest[1]):
+			text.WriteByte(rest[1])
+			i += 2
+			continue
+		case strings.HasPrefix(rest, "```"):
+			if end := strings.Index(rest[3:], "```"); end > 0 {
+				language, body := splitFence(rest[3 : 3+end])
+				if body != "" {
+					push(token{kind: tokPre, text: body, entity: models.EntityPre, language: language})
+					i += 3 + end + 3
+					continue
+				}
+			}
+			text.WriteString("```")
+			i += 3
+			continue
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				push(token{kind: tokCode, text: rest[1 : 1+end], entity: models.EntityCode})
+				i += 1 + end + 1
+				continue
+			}
+		case rest[0] == '[':
+			push(token{kind: tokLinkOpen, text: "[", entity: models.EntityLink})
+			i++
+			continue
+		case strings.HasPrefix(rest, "]("):
+			if end := strings.IndexByte(rest[2:], ')'); end > 0 && ValidURL(rest[2:2+end]) {
+				push(token{kind: tokLinkClose, text: rest[:2+end+1], url: rest[2 : 2+end]})
+				i += 2 + end + 1
+				continue
+			}
+		}
+
+		if m, ok := markerAt(rest); ok {
+			prev, _ := utf8.DecodeLastRuneInString(s[:i])
+			next, _ := utf8.DecodeRuneInString(rest[len(m.text):])
+			hasPrev, hasNext := i > 0, len(rest) > len(m.text)
+			intraword := m.text == "_" && hasPrev && hasNext && isWordRune(prev) && isWordRune(next)
+			if !intraword {
+				push(token{
+					kind:     tokMarker,
+					text:     m.text,
+					entity:   m.entity,
+					canOpen:  hasNext && !unicode.IsSpace(next),
+					canClose: hasPrev && !unicode.IsSpace(prev),
+				})
+				i += len(m.text)
+				continue
+			}
+		}
+		text.WriteByte(rest[0])
+		i++
+	}
+	flush()
+	return tokens
+}
+
+// pair matches openers with closers. Pairs nest: a closer drops the openers
+// left open inside its pair, which stay text. Links don't nest, so a link
+// drops the [ left open before it too.
+func pair(tokens []token) {
+	var stack []int
+	openerOf := func(i int) int {
+		for j := len(stack) - 1; j >= 0; j-- {
+			tk := tokens[stack[j]]
+			if tokens[i].kind == tokLinkClose && tk.kind == tokLinkOpen ||
+				tokens[i].kind == tokMarker && tk.kind == tokMarker && tk.text == tokens[i].text {
+				return j
+			}
+		}
+		return -1
+	}
+	isOpen := func(entity models.MessageEntityType) bool {
+		for _, j := range stack {
+			if tokens[j].entity == entity {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := range tokens {
+		tk := &tokens[i]
+		switch tk.kind {
+		case tokLinkOpen:
+			stack = append(stack, i)
+		case tokLinkClose, tokMarker:
+			if tk.kind == tokLinkClose || tk.canClose {
+				if j := openerOf(i); j >= 0 && stack[j] != i-1 {
+					tk.match = stack[j]
+					tokens[stack[j]].match = i
+					stack = stack[:j]
+					if tk.kind == tokLinkClose {
+						stack = slices.DeleteFunc(stack, func(k int) bool { return tokens[k].kind == tokLinkOpen })
+					}
+					continue
+				}
+			}
+			if tk.kind == tokMarker && tk.canOpen && !isOpen(tk.entity) {
+				stack = append(stack, i)
+			}
+		}
+	}
+}
+
+// splitFence takes the language from the first line of a fenced block, as
+// in ```go, and drops the newlines just inside the fences.
+func splitFence(body string) (language, code string) {
+	if line, rest, ok := strings.Cut(body, "\n"); ok && (line == "" || languageRe.MatchString(line)) {
+		language, body = line, rest
+	}
+	return language, strings.TrimSuffix(body, "\n")
+}
+
+func markerAt(s string) (marker, bool) {
+	for _, m := range markers {
+		if strings.HasPrefix(s, m.text) {
+			return m, true
+		}
+	}
+	return marker{}, false
+}
+
+func isEscapable(c byte) bool {
+	return c < utf8.RuneSelf && (unicode.IsPunct(rune(c)) || unicode.IsSymbol(rune(c)))
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,176 @@
+// Package richtext validates the formatting entities of message text and
+// parses the markdown subset clients may send instead of entities.
+package richtext
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/validation"
+)
+
+const (
+	MaxEntities  = 100
+	maxURLLength = 2048
+)
+
+var (
+	ErrInvalidEntities  = errors.New("invalid message entities")
+	ErrTooManyEntities  = errors.New("too many message entities")
+	ErrInvalidParseMode = errors.New("invalid parse mode")
+)
+
+var languageRe = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,32}$`)
+
+// ParseMode says how a message's text is written. The zero value is plain
+// text, formatted only by the entities sent with it.
+type ParseMode string
+
+const (
+	ModePlain    ParseMode = ""
+	ModeMarkdown ParseMode = "markdown"
+)
+
+// Format prepares message text for storage: it parses markdown when mode
+// asks for it, trims surrounding whitespace and cuts the text to maxRunes
+// characters, moving the entities along. Entities cut in half keep the part
+// that is left, except mentions, which are dropped.
+func Format(text string, entities []models.MessageEntity, mode ParseMode, maxRunes int) (string, []models.MessageEntity, error) {
+	switch mode {
+	case ModePlain:
+	case ModeMarkdown:
+		if len(entities) > 0 {
+			return "", nil, ErrInvalidEntities
+		}
+		text, entities = ParseMarkdown(text)
+	default:
+		return "", nil, ErrInvalidParseMode
+	}
+	entities, err := Validate(text, entities)
+	if err != nil {
+		return "", nil, err
+	}
+
+	lead := len(text) - len(strings.TrimLeftFunc(text, unicode.IsSpace))
+	shift := models.UTF16Len(text[:lead])
+	text = validation.TrimAndLimit(text, maxRunes)
+	size := models.UTF16Len(text)
+
+	kept := entities[:0]
+	for _, e := range entities {
+		start, end := max(e.Offset-shift, 0), min(e.End()-shift, size)
+		if end <= start {
+			continue
+		}
+		if e.Type == models.EntityMention && end-start != e.Length {
+			continue
+		}
+		e.Offset, e.Length = start, end-start
+		kept = append(kept, e)
+	}
+	if len(kept) == 0 {
+		return text, nil, nil
+	}
+	return text, kept, nil
+}
+
+// Validate checks entities sent by a client against text and returns them
+// sorted. Each must lie within the text on character boundaries and carry
+// the fields its type needs. Entities may nest but not partly overlap, no
+// entity may lie inside code, a pre block or a mention, and an entity can't
+// nest in one of its own type. @all is resolved by the server, so clients
+// can't send it.
+func Validate(text string, entities []models.MessageEntity) ([]models.MessageEntity, error) {
+	if len(entities) == 0 {
+		return nil, nil
+	}
+	if len(entities) > MaxEntities {
+		return nil, ErrTooManyEntities
+	}
+	units := utf16.Encode([]rune(text))
+	boundary := func(offset int) bool {
+		return offset == len(units) || !isLowSurrogate(units[offset])
+	}
+
+	out := make([]models.MessageEntity, 0, len(entities))
+	for _, e := range entities {
+		if !e.Type.Valid() || e.Type == models.EntityMentionAll {
+			return nil, ErrInvalidEntities
+		}
+		if e.Offset < 0 || e.Length <= 0 || e.End() > len(units) || !boundary(e.Offset) || !boundary(e.End()) {
+			return nil, ErrInvalidEntities
+		}
+		clean := models.MessageEntity{Type: e.Type, Offset: e.Offset, Length: e.Length}
+		switch e.Type {
+		case models.EntityMention:
+			if e.UserID == 0 {
+				return nil, ErrInvalidEntities
+			}
+			clean.UserID = e.UserID
+		case models.EntityLink:
+			if !ValidURL(e.URL) {
+				return nil, ErrInvalidEntities
+			}
+			clean.URL = e.URL
+		case models.EntityPre:
+			if e.Language != "" && !languageRe.MatchString(e.Language) {
+				return nil, ErrInvalidEntities
+			}
+			clean.Language = e.Language
+		}
+		out = append(out, clean)
+	}
+
+	Sort(out)
+	var open []models.MessageEntity
+	for _, e := range out {
+		for len(open) > 0 && open[len(open)-1].End() <= e.Offset {
+			open = open[:len(open)-1]
+		}
+		for _, outer := range open {
+			if e.End() > outer.End() || outer.Type.Verbatim() || outer.Type == e.Type {
+				return nil, ErrInvalidEntities
+			}
+		}
+		open = append(open, e)
+	}
+	return out, nil
+}
+
+// Sort orders entities by offset, outer entities before the ones they
+// contain. Of two entities over the same text, code and mentions go inside.
+func Sort(entities []models.MessageEntity) {
+	sort.SliceStable(entities, func(i, j int) bool {
+		a, b := entities[i], entities[j]
+		if a.Offset != b.Offset {
+			return a.Offset < b.Offset
+		}
+		if a.Length != b.Length {
+			return a.Length > b.Length
+		}
+		return !a.Type.Verbatim() && b.Type.Verbatim()
+	})
+}
+
+// ValidURL reports whether s may be the target of a link: an absolute http
+// or https URL.
+func ValidURL(s string) bool {
+	if s == "" || len(s) > maxURLLength || strings.ContainsAny(s, " \t\r\n") {
+		return false
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func isLowSurrogate(u uint16) bool {
+	return u >= 0xDC00 && u <= 0xDFFF
+}
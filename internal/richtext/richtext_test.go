@@ -0,0 +1,116 @@
+package richtext
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+)
+
+func entity(t models.MessageEntityType, offset, length int) models.MessageEntity {
+	return models.MessageEntity{Type: t, Offset: offset, Length: length}
+}
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		text     string
+		entities []models.MessageEntity
+	}{
+		{"Plain", "hello", "hello", nil},
+		{"Bold and italic", "**hi** *there* _you_", "hi there you", []models.MessageEntity{
+			entity(models.EntityBold, 0, 2), entity(models.EntityItalic, 3, 5), entity(models.EntityItalic, 9, 3),
+		}},
+		{"Nested", "**bold _both_**", "bold both", []models.MessageEntity{
+			entity(models.EntityBold, 0, 9), entity(models.EntityItalic, 5, 4),
+		}},
+		{"Spoiler", "||secret||", "secret", []models.MessageEntity{entity(models.EntitySpoiler, 0, 6)}},
+		{"Code is verbatim", "run `a *b* c`", "run a *b* c", []models.MessageEntity{entity(models.EntityCode, 4, 7)}},
+		{"Pre with language", "```go\nfmt.Println()\n```", "fmt.Println()", []models.MessageEntity{
+			{Type: models.EntityPre, Offset: 0, Length: 13, Language: "go"},
+		}},
+		{"Link", "see [docs](https://example.com/a) now", "see docs now", []models.MessageEntity{
+			{Type: models.EntityLink, Offset: 4, Length: 4, URL: "https://example.com/a"},
+		}},
+		{"Link with unsafe URL", "[x](javascript:alert(1))", "[x](javascript:alert(1))", nil},
+		{"Brackets before a link", "[x] [y](https://e.com)", "[x] y", []models.MessageEntity{
+			{Type: models.EntityLink, Offset: 4, Length: 1, URL: "https://e.com"},
+		}},
+		{"Unpaired markers", "2 * 3 and **open", "2 * 3 and **open", nil},
+		{"Intraword underscore", "snake_case_name", "snake_case_name", nil},
+		{"Escapes", `\*not italic\*`, "*not italic*", nil},
+		{"Empty pair", "****", "****", nil},
+		{"UTF-16 offsets", "👋 **hé**", "👋 hé", []models.MessageEntity{entity(models.EntityBold, 3, 2)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := ParseMarkdown(tt.input)
+			if text != tt.text || !reflect.DeepEqual(entities, tt.entities) {
+				t.Errorf("ParseMarkdown(%q) = %q, %+v; want %q, %+v", tt.input, text, entities, tt.text, tt.entities)
+			}
+			if _, err := Validate(text, entities); err != nil {
+				t.Errorf("parsed entities invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	text := "👋 hello world"
+	tests := []struct {
+		name     string
+		entities []models.MessageEntity
+		valid    bool
+	}{
+		{"Bold", []models.MessageEntity{entity(models.EntityBold, 3, 5)}, true},
+		{"Nested", []models.MessageEntity{entity(models.EntityItalic, 3, 2), entity(models.EntityBold, 3, 11)}, true},
+		{"Same span", []models.MessageEntity{entity(models.EntityCode, 3, 5), entity(models.EntityBold, 3, 5)}, true},
+		{"Splits surrogate pair", []models.MessageEntity{entity(models.EntityBold, 1, 3)}, false},
+		{"Past the end", []models.MessageEntity{entity(models.EntityBold, 9, 6)}, false},
+		{"Unknown type", []models.MessageEntity{entity("underline", 3, 5)}, false},
+		{"Partial overlap", []models.MessageEntity{entity(models.EntityBold, 3, 5), entity(models.EntityItalic, 6, 5)}, false},
+		{"Inside code", []models.MessageEntity{entity(models.EntityCode, 3, 11), entity(models.EntityBold, 3, 5)}, false},
+		{"Same type nested", []models.MessageEntity{entity(models.EntityBold, 3, 11), entity(models.EntityBold, 3, 5)}, false},
+		{"Mention without user", []models.MessageEntity{entity(models.EntityMention, 3, 5)}, false},
+		{"Mention all", []models.MessageEntity{entity(models.EntityMentionAll, 3, 5)}, false},
+		{"Link without URL", []models.MessageEntity{entity(models.EntityLink, 3, 5)}, false},
+		{"Link", []models.MessageEntity{{Type: models.EntityLink, Offset: 3, Length: 5, URL: "http://e.com"}}, true},
+		{"Bad language", []models.MessageEntity{{Type: models.EntityPre, Offset: 3, Length: 5, Language: "c c"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Validate(text, tt.entities)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate(%+v) = %v, want valid %v", tt.entities, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	text, entities, err := Format("  **hi** @bob  ", nil, ModeMarkdown, 0)
+	if err != nil || text != "hi @bob" || !reflect.DeepEqual(entities, []models.MessageEntity{entity(models.EntityBold, 0, 2)}) {
+		t.Fatalf("markdown = %q, %+v, %v", text, entities, err)
+	}
+
+	// Trimming moves the entities; the limit cuts them or drops cut mentions.
+	entities = []models.MessageEntity{
+		entity(models.EntityBold, 2, 5),
+		{Type: models.EntityMention, Offset: 8, Length: 4, UserID: 2},
+	}
+	text, entities, err = Format("  hello @bob", entities, ModePlain, 7)
+	if err != nil || text != "hello @" || !reflect.DeepEqual(entities, []models.MessageEntity{entity(models.EntityBold, 0, 5)}) {
+		t.Fatalf("plain = %q, %+v, %v", text, entities, err)
+	}
+
+	if _, _, err := Format("**x**", []models.MessageEntity{entity(models.EntityBold, 0, 1)}, ModeMarkdown, 0); !errors.Is(err, ErrInvalidEntities) {
+		t.Fatalf("markdown with entities err = %v", err)
+	}
+	if _, _, err := Format("x", nil, "html", 0); !errors.Is(err, ErrInvalidParseMode) {
+		t.Fatalf("unknown mode err = %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd is a minimal clamd stand-in that flags any stream containing "EICAR".
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, err := r.ReadString(0)
+				if err != nil {
+					return
+				}
+				switch strings.TrimSuffix(cmd, "\x00") {
+				case "zPING":
+					conn.Write([]byte("PONG\x00"))
+				case "zINSTREAM":
+					var data bytes.Buffer
+					for {
+						var size uint32
+						if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+							return
+						}
+						if size == 0 {
+							break
+						}
+						if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+							return
+						}
+					}
+					if bytes.Contains(data.Bytes(), []byte("EICAR")) {
+						conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					} else {
+						conn.Write([]byte("stream: OK\x00"))
+					}
+				default:
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+				}
+			}(conn)
+		}
+	}()
+	return "tcp://" + ln.Addr().String()
+}
+
+func TestClamdScanner(t *testing.T) {
+	s := NewClamdScanner(fakeClamd(t), 5*time.Second)
+	ctx := context.Background()
+
+	if err := s.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	res, err := s.Scan(ctx, bytes.NewReader(bytes.Repeat([]byte("clean data "), 20000)))
+	if err != nil {
+		t.Fatalf("Scan clean: %v", err)
+	}
+	if res.Infected {
+		t.Fatalf("clean stream reported infected: %+v", res)
+	}
+
+	res, err = s.Scan(ctx, strings.NewReader("X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*"))
+	if err != nil {
+		t.Fatalf("Scan infected: %v", err)
+	}
+	if !res.Infected || res.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("result = %+v", res)
+	}
+}
+
+func TestClamdScannerUnavailable(t *testing.T) {
+	s := NewClamdScanner("tcp://127.0.0.1:1", time.Second)
+	if _, err := s.Scan(context.Background(), strings.NewReader("x")); err == nil {
+		t.Fatalf("expected error for unreachable daemon")
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	if _, err := parseReply("INSTREAM size limit exceeded. ERROR"); err == nil {
+		t.Fatalf("expected error reply to fail")
+	}
+	if _, err := parseReply("garbage"); err == nil {
+		t.Fatalf("expected unknown reply to fail")
+	}
+}
@@ -0,0 +1,41 @@
+// Package scanner checks uploaded files for malware before other users can
+// download them.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrScannerUnavailable = errors.New("malware scanner unavailable")
+
+// Result is the verdict for one scanned stream.
+type Result struct {
+	Infected bool
+	// Signature names the detected malware when Infected is set.
+	Signature string
+}
+
+// Scanner inspects a byte stream for malware.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// NewScannerFromEnv returns a clamd client when CLAMD_ADDR is set
+// (e.g. "tcp://clamav:3310" or "unix:///run/clamav/clamd.ctl") and nil
+// otherwise, which disables scanning.
+func NewScannerFromEnv() Scanner {
+	addr := strings.TrimSpace(os.Getenv("CLAMD_ADDR"))
+	if addr == "" {
+		return nil
+	}
+	timeout := 60 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("CLAMD_TIMEOUT")); err == nil && d > 0 {
+		timeout = d
+	}
+	return NewClamdScanner(addr, timeout)
+}
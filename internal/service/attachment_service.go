@@ -0,0 +1,284 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"github.com/noteduco342/OMMessenger-backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrAttachmentForbidden = errors.New("attachment belongs to another user")
+	ErrAttachmentTooLarge  = errors.New("attachment too large")
+	ErrAttachmentEmpty     = errors.New("attachment is empty")
+	// ErrAttachmentQuarantined means the file hasn't been scanned yet.
+	ErrAttachmentQuarantined = errors.New("attachment is awaiting malware scan")
+	ErrAttachmentInfected    = errors.New("attachment failed malware scan")
+)
+
+const (
+	defaultMaxAttachmentBytes = 20 * 1024 * 1024
+	maxAttachmentFileName     = 255
+)
+
+// MaxAttachmentBytes returns the per-file upload limit (ATTACHMENT_MAX_BYTES).
+func MaxAttachmentBytes() int64 {
+	n, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_BYTES"), 10, 64)
+	if err != nil || n <= 0 {
+		return defaultMaxAttachmentBytes
+	}
+	return n
+}
+
+// BlobKeyForHash returns the storage key for content with the given SHA-256.
+func BlobKeyForHash(hash string) string {
+	return "media/sha256/" + hash[:2] + "/" + hash
+}
+
+type AttachmentService struct {
+	repo     repository.AttachmentRepositoryInterface
+	store    storage.BlobStore
+	quotas   *StorageService
+	scans    *ScanService
+	maxBytes int64
+}
+
+// NewAttachmentService wires the attachment pipeline. quotas may be nil, in
+// which case only the server-wide per-file limit applies; scans may be nil to
+// skip malware scanning.
+func NewAttachmentService(repo repository.AttachmentRepositoryInterface, store storage.BlobStore, quotas *StorageService, scans *ScanService) *AttachmentService {
+	return &AttachmentService{repo: repo, store: store, quotas: quotas, scans: scans, maxBytes: MaxAttachmentBytes()}
+}
+
+// limitsFor returns the per-file limit and quota (<= 0 = unlimited) for the user.
+func (s *AttachmentService) limitsFor(userID uint) (maxBytes, quotaBytes int64, err error) {
+	if s.quotas == nil {
+		return s.maxBytes, 0, nil
+	}
+	limits, err := s.quotas.LimitsFor(userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return min(limits.MaxFileBytes, s.maxBytes), limits.QuotaBytes, nil
+}
+
+// CheckUpload rejects an upload of size bytes early, before the body is read.
+func (s *AttachmentService) CheckUpload(userID uint, size int64) error {
+	if s.quotas == nil {
+		if size > s.maxBytes {
+			return ErrAttachmentTooLarge
+		}
+		return nil
+	}
+	_, err := s.quotas.CheckUpload(userID, size)
+	return err
+}
+
+// Upload stores a file for the user. Content is keyed by its SHA-256, so an
+// upload of bytes we already have only adds an attachment row and bumps the
+// blob's reference count. The full size counts against the uploader's quota
+// even when the bytes are shared.
+func (s *AttachmentService) Upload(ctx context.Context, uploaderID uint, fileName string, r io.Reader) (*models.Attachment, error) {
+	if s.store == nil {
+		return nil, ErrStorageNotConfigured
+	}
+
+	maxBytes, quotaBytes, err := s.limitsFor(uploaderID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrAttachmentTooLarge
+	}
+	if len(data) == 0 {
+		return nil, ErrAttachmentEmpty
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	// Never trust the client's Content-Type; it decides how browsers render the file.
+	contentType := http.DetectContentType(data)
+	size := int64(len(data))
+
+	// Known-bad content is refused outright instead of stored again.
+	if known, err := s.repo.FindBlob(hash); err == nil && known.ScanStatus == models.ScanInfected {
+		return nil, ErrAttachmentInfected
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	blob := &models.MediaBlob{
+		Hash:        hash,
+		Key:         BlobKeyForHash(hash),
+		SizeBytes:   size,
+		ContentType: contentType,
+		ScanStatus:  s.scans.InitialStatus(),
+	}
+	att := &models.Attachment{
+		UploaderID:  uploaderID,
+		FileName:    sanitizeFileName(fileName),
+		ContentType: contentType,
+		SizeBytes:   size,
+	}
+
+	err = s.repo.CreateWithBlob(att, blob, quotaBytes, func(created bool) error {
+		if !created {
+			// Known content: metadata-only insert, as long as the object is
+			// really there. Re-upload if storage lost it.
+			_, err := s.store.Stat(ctx, blob.Key)
+			if err == nil {
+				return nil
+			}
+			if !errors.Is(err, storage.ErrObjectNotFound) {
+				return err
+			}
+			log.Printf("[attachments] blob %s missing from storage, re-uploading", blob.Key)
+		}
+		// If the transaction fails after this the object is unreferenced and
+		// the media GC removes it.
+		_, err := s.store.Put(ctx, blob.Key, bytes.NewReader(data), size, contentType)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if blob.ScanStatus == models.ScanQuarantined {
+		s.scans.Enqueue(hash)
+	}
+	att.Blob = *blob
+	return att, nil
+}
+
+// GetForUser returns the attachment if the user may download it. Unknown and
+// inaccessible attachments both yield ErrAttachmentNotFound; files that are
+// unscanned or infected yield ErrAttachmentQuarantined or ErrAttachmentInfected.
+func (s *AttachmentService) GetForUser(userID, attachmentID uint) (*models.Attachment, error) {
+	ok, err := s.repo.CanAccess(attachmentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrAttachmentNotFound
+	}
+	att, err := s.find(attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	switch att.Blob.ScanStatus {
+	case models.ScanQuarantined:
+		return att, ErrAttachmentQuarantined
+	case models.ScanInfected:
+		return att, ErrAttachmentInfected
+	}
+	return att, nil
+}
+
+// CheckAttachable verifies the user may attach the upload to a message they send.
+func (s *AttachmentService) CheckAttachable(userID, attachmentID uint) (*models.Attachment, error) {
+	att, err := s.find(attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	if att.UploaderID != userID {
+		return nil, ErrAttachmentForbidden
+	}
+	// Quarantined files may be sent; recipients can't download them until
+	// the scan clears them.
+	if att.Blob.ScanStatus == models.ScanInfected {
+		return nil, ErrAttachmentInfected
+	}
+	return att, nil
+}
+
+// Delete removes the user's attachment. The stored object is deleted once no
+// other attachment references the same content.
+func (s *AttachmentService) Delete(ctx context.Context, userID, attachmentID uint) error {
+	if s.store == nil {
+		return ErrStorageNotConfigured
+	}
+	if _, err := s.CheckAttachable(userID, attachmentID); err != nil {
+		return err
+	}
+	err := s.deleteAndRelease(ctx, attachmentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAttachmentNotFound
+	}
+	return err
+}
+
+// DeleteIfUnreferenced removes an attachment once no message carries it, as
+// when the messages it was sent with disappear. Missing attachments are
+// ignored.
+func (s *AttachmentService) DeleteIfUnreferenced(ctx context.Context, attachmentID uint) error {
+	if s.store == nil {
+		return ErrStorageNotConfigured
+	}
+	referenced, err := s.repo.IsReferenced(attachmentID)
+	if err != nil || referenced {
+		return err
+	}
+	err = s.deleteAndRelease(ctx, attachmentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *AttachmentService) deleteAndRelease(ctx context.Context, attachmentID uint) error {
+	return s.repo.DeleteAndRelease(attachmentID, func(blob models.MediaBlob) error {
+		if err := s.store.Delete(ctx, blob.Key); err != nil {
+			// Leave it to the media GC rather than failing the delete.
+			log.Printf("[attachments] delete blob %s failed: %v", blob.Key, err)
+		}
+		return nil
+	})
+}
+
+func (s *AttachmentService) find(attachmentID uint) (*models.Attachment, error) {
+	att, err := s.repo.FindByID(attachmentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+	return att, nil
+}
+
+func sanitizeFileName(name string) string {
+	name = strings.TrimSpace(path.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "." || name == "/" {
+		return ""
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	for len(name) > maxAttachmentFileName {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/scanner"
+	"github.com/noteduco342/OMMessenger-backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+// fakeAttachmentRepo mimics the refcounting done by AttachmentRepository.
+type fakeAttachmentRepo struct {
+	blobs       map[string]*models.MediaBlob
+	attachments map[uint]*models.Attachment
+	referenced  map[uint]bool // attachments still carried by a message
+	nextID      uint
+}
+
+func newFakeAttachmentRepo() *fakeAttachmentRepo {
+	return &fakeAttachmentRepo{blobs: map[string]*models.MediaBlob{}, attachments: map[uint]*models.Attachment{}}
+}
+
+func (f *fakeAttachmentRepo) CreateWithBlob(att *models.Attachment, blob *models.MediaBlob, quotaBytes int64, ensure func(created bool) error) error {
+	existing, ok := f.blobs[blob.Hash]
+	if err := ensure(!ok); err != nil {
+		return err
+	}
+	if ok {
+		existing.RefCount++
+		blob.RefCount = existing.RefCount
+		blob.ScanStatus = existing.ScanStatus
+	} else {
+		if blob.ScanStatus == "" {
+			blob.ScanStatus = models.ScanClean
+		}
+		b := *blob
+		b.RefCount = 1
+		f.blobs[blob.Hash] = &b
+		blob.RefCount = 1
+	}
+	f.nextID++
+	att.ID = f.nextID
+	att.BlobHash = blob.Hash
+	f.attachments[att.ID] = att
+	return nil
+}
+
+func (f *fakeAttachmentRepo) FindByID(id uint) (*models.Attachment, error) {
+	att, ok := f.attachments[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	out := *att
+	out.Blob = *f.blobs[att.BlobHash]
+	return &out, nil
+}
+
+func (f *fakeAttachmentRepo) FindBlob(hash string) (*models.MediaBlob, error) {
+	blob, ok := f.blobs[hash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	out := *blob
+	return &out, nil
+}
+
+func (f *fakeAttachmentRepo) SetBlobScanResult(hash string, status models.ScanStatus, signature string) error {
+	if blob, ok := f.blobs[hash]; ok && blob.ScanStatus == models.ScanQuarantined {
+		blob.ScanStatus = status
+		blob.ScanSignature = signature
+	}
+	return nil
+}
+
+func (f *fakeAttachmentRepo) ListQuarantinedBlobs(before time.Time, limit int) ([]models.MediaBlob, error) {
+	var out []models.MediaBlob
+	for _, blob := range f.blobs {
+		if blob.ScanStatus == models.ScanQuarantined && len(out) < limit {
+			out = append(out, *blob)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeAttachmentRepo) DeleteAndRelease(id uint, release func(blob models.MediaBlob) error) error {
+	att, ok := f.attachments[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(f.attachments, id)
+	blob := f.blobs[att.BlobHash]
+	blob.RefCount--
+	if blob.RefCount > 0 {
+		return nil
+	}
+	delete(f.blobs, att.BlobHash)
+	return release(*blob)
+}
+
+func (f *fakeAttachmentRepo) IsReferenced(attachmentID uint) (bool, error) {
+	return f.referenced[attachmentID], nil
+}
+
+func (f *fakeAttachmentRepo) CanAccess(attachmentID, userID uint) (bool, error) {
+	att, ok := f.attachments[attachmentID]
+	return ok && att.UploaderID == userID, nil
+}
+
+func TestAttachmentService_DeduplicatesContent(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	repo := newFakeAttachmentRepo()
+	svc := NewAttachmentService(repo, store, nil, nil)
+
+	payload := []byte("%PDF-1.4 same document")
+	first, err := svc.Upload(ctx, 1, "report.pdf", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	second, err := svc.Upload(ctx, 2, "../../copy.pdf", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("second upload: %v", err)
+	}
+
+	if first.BlobHash != second.BlobHash {
+		t.Fatalf("expected shared blob, got %s and %s", first.BlobHash, second.BlobHash)
+	}
+	if second.FileName != "copy.pdf" {
+		t.Fatalf("file name = %q", second.FileName)
+	}
+	if first.ContentType != "application/pdf" {
+		t.Fatalf("content type = %q", first.ContentType)
+	}
+	if got := repo.blobs[first.BlobHash].RefCount; got != 2 {
+		t.Fatalf("ref count = %d, want 2", got)
+	}
+
+	objects := 0
+	_ = store.List(ctx, "media/", func(storage.ObjectStat) error { objects++; return nil })
+	if objects != 1 {
+		t.Fatalf("stored objects = %d, want 1", objects)
+	}
+
+	if err := svc.Delete(ctx, 2, first.ID); !errors.Is(err, ErrAttachmentForbidden) {
+		t.Fatalf("delete by non-owner err = %v", err)
+	}
+	if err := svc.Delete(ctx, 1, first.ID); err != nil {
+		t.Fatalf("delete first: %v", err)
+	}
+	key := BlobKeyForHash(first.BlobHash)
+	if _, err := store.Stat(ctx, key); err != nil {
+		t.Fatalf("object removed while still referenced: %v", err)
+	}
+	if err := svc.Delete(ctx, 2, second.ID); err != nil {
+		t.Fatalf("delete second: %v", err)
+	}
+	if _, err := store.Stat(ctx, key); !errors.Is(err, storage.ErrObjectNotFound) {
+		t.Fatalf("object should be gone after last reference, err = %v", err)
+	}
+}
+
+func TestAttachmentService_ReuploadsMissingBlob(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	svc := NewAttachmentService(newFakeAttachmentRepo(), store, nil, nil)
+
+	payload := []byte("hello")
+	att, err := svc.Upload(ctx, 1, "a.txt", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	key := BlobKeyForHash(att.BlobHash)
+	_ = store.Delete(ctx, key)
+
+	if _, err := svc.Upload(ctx, 1, "b.txt", bytes.NewReader(payload)); err != nil {
+		t.Fatalf("second upload: %v", err)
+	}
+	if _, err := store.Stat(ctx, key); err != nil {
+		t.Fatalf("expected blob to be restored: %v", err)
+	}
+}
+
+func TestAttachmentService_Limits(t *testing.T) {
+	svc := NewAttachmentService(newFakeAttachmentRepo(), storage.NewMemoryStorage(), nil, nil)
+	svc.maxBytes = 4
+
+	if _, err := svc.Upload(context.Background(), 1, "big", bytes.NewReader([]byte("12345"))); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("err = %v, want ErrAttachmentTooLarge", err)
+	}
+	if _, err := svc.Upload(context.Background(), 1, "empty", bytes.NewReader(nil)); !errors.Is(err, ErrAttachmentEmpty) {
+		t.Fatalf("err = %v, want ErrAttachmentEmpty", err)
+	}
+}
+
+// stubScanner flags any content containing "EICAR".
+type stubScanner struct{}
+
+func (stubScanner) Scan(ctx context.Context, r io.Reader) (scanner.Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return scanner.Result{}, err
+	}
+	if strings.Contains(string(data), "EICAR") {
+		return scanner.Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return scanner.Result{}, nil
+}
+
+func TestAttachmentService_ScanStates(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	repo := newFakeAttachmentRepo()
+	scans := NewScanService(repo, store, stubScanner{})
+	svc := NewAttachmentService(repo, store, nil, scans)
+
+	clean, err := svc.Upload(ctx, 1, "notes.txt", strings.NewReader("plain text"))
+	if err != nil {
+		t.Fatalf("upload clean: %v", err)
+	}
+	bad, err := svc.Upload(ctx, 1, "bad.com", strings.NewReader("X5O!P%@AP EICAR test"))
+	if err != nil {
+		t.Fatalf("upload infected: %v", err)
+	}
+	if clean.Blob.ScanStatus != models.ScanQuarantined {
+		t.Fatalf("new upload status = %q, want quarantined", clean.Blob.ScanStatus)
+	}
+	if _, err := svc.GetForUser(1, clean.ID); !errors.Is(err, ErrAttachmentQuarantined) {
+		t.Fatalf("get before scan err = %v, want ErrAttachmentQuarantined", err)
+	}
+	if _, err := svc.CheckAttachable(1, clean.ID); err != nil {
+		t.Fatalf("quarantined file should be attachable: %v", err)
+	}
+
+	for _, hash := range []string{clean.BlobHash, bad.BlobHash} {
+		if err := scans.ScanBlob(ctx, hash); err != nil {
+			t.Fatalf("scan %s: %v", hash, err)
+		}
+	}
+
+	if _, err := svc.GetForUser(1, clean.ID); err != nil {
+		t.Fatalf("get clean: %v", err)
+	}
+	if _, err := svc.GetForUser(1, bad.ID); !errors.Is(err, ErrAttachmentInfected) {
+		t.Fatalf("get infected err = %v", err)
+	}
+	if _, err := svc.CheckAttachable(1, bad.ID); !errors.Is(err, ErrAttachmentInfected) {
+		t.Fatalf("attach infected err = %v", err)
+	}
+	if _, err := svc.Upload(ctx, 2, "again.com", strings.NewReader("X5O!P%@AP EICAR test")); !errors.Is(err, ErrAttachmentInfected) {
+		t.Fatalf("re-upload infected err = %v", err)
+	}
+}
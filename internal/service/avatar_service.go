@@ -18,18 +18,40 @@ import (
 var ErrStorageNotConfigured = errors.New("storage not configured")
 
 type AvatarService struct {
-	userRepo repository.UserRepositoryInterface
-	s3       *storage.S3Storage
+	userRepo  repository.UserRepositoryInterface
+	groupRepo repository.GroupRepositoryInterface
+	store     storage.BlobStore
+	quotas    *StorageService
 }
 
-func NewAvatarService(userRepo repository.UserRepositoryInterface, s3 *storage.S3Storage) *AvatarService {
-	return &AvatarService{userRepo: userRepo, s3: s3}
+// NewAvatarService wires avatar and group icon uploads. quotas may be nil to
+// skip quota checks.
+func NewAvatarService(userRepo repository.UserRepositoryInterface, groupRepo repository.GroupRepositoryInterface, store storage.BlobStore, quotas *StorageService) *AvatarService {
+	return &AvatarService{userRepo: userRepo, groupRepo: groupRepo, store: store, quotas: quotas}
 }
 
-// UploadAvatar processes an uploaded image and stores it as a JPEG avatar.
+// storeImage runs an upload through the avatar image pipeline and stores it
+// under keyPrefix with a fresh name.
+func (s *AvatarService) storeImage(ctx context.Context, keyPrefix string, fileReader io.Reader) (key, contentType string, size int64, st storage.ObjectStat, err error) {
+	opts := storage.DefaultAvatarOptions()
+	imgBytes, contentType, size, err := storage.ProcessAvatarImage(fileReader, opts)
+	if err != nil {
+		return "", "", 0, storage.ObjectStat{}, err
+	}
+
+	key = keyPrefix + uuid.NewString() + storage.ExtensionForContentType(contentType)
+	st, err = s.store.Put(ctx, key, bytes.NewReader(imgBytes), size, contentType)
+	if err != nil {
+		return "", "", 0, storage.ObjectStat{}, err
+	}
+	return key, contentType, size, st, nil
+}
+
+// UploadAvatar processes an uploaded image and stores it as an avatar
+// (JPEG by default; see storage.ImageProcessOptions for transparent formats).
 // Returns updated user.
 func (s *AvatarService) UploadAvatar(ctx context.Context, userID uint, fileReader io.Reader, publicAPIBaseURL string) (*models.User, error) {
-	if s.s3 == nil {
+	if s.store == nil {
 		return nil, ErrStorageNotConfigured
 	}
 	publicAPIBaseURL = strings.TrimRight(strings.TrimSpace(publicAPIBaseURL), "/")
@@ -42,14 +64,7 @@ func (s *AvatarService) UploadAvatar(ctx context.Context, userID uint, fileReade
 		return nil, errors.New("user not found")
 	}
 
-	opts := storage.DefaultAvatarOptions()
-	jpegBytes, contentType, outSize, err := storage.ProcessAvatarImage(fileReader, opts)
-	if err != nil {
-		return nil, err
-	}
-
-	key := fmt.Sprintf("avatars/%d/%s.jpg", userID, uuid.NewString())
-	st, err := s.s3.PutObject(ctx, key, bytes.NewReader(jpegBytes), outSize, contentType)
+	key, contentType, outSize, st, err := s.storeImage(ctx, fmt.Sprintf("avatars/%d/", userID), fileReader)
 	if err != nil {
 		return nil, err
 	}
@@ -67,15 +82,19 @@ func (s *AvatarService) UploadAvatar(ctx context.Context, userID uint, fileReade
 	user.AvatarUpdatedAt = &now
 	user.AvatarETag = st.ETag
 
-	if err := s.userRepo.Update(user); err != nil {
+	save := s.userRepo.Update
+	if s.quotas != nil {
+		save = s.quotas.SaveAvatar
+	}
+	if err := save(user); err != nil {
 		// Try to delete newly created object to avoid orphan.
-		_ = s.s3.DeleteObject(ctx, key)
+		_ = s.store.Delete(ctx, key)
 		return nil, err
 	}
 
 	// Best-effort delete previous object if present.
 	if oldKey != "" && oldKey != key {
-		_ = s.s3.DeleteObject(ctx, oldKey)
+		_ = s.store.Delete(ctx, oldKey)
 	}
 
 	return user, nil
@@ -84,7 +103,7 @@ func (s *AvatarService) UploadAvatar(ctx context.Context, userID uint, fileReade
 // DeleteAvatar removes the user's avatar reference and deletes the stored object
 // (best-effort). Returns updated user.
 func (s *AvatarService) DeleteAvatar(ctx context.Context, userID uint) (*models.User, error) {
-	if s.s3 == nil {
+	if s.store == nil {
 		return nil, ErrStorageNotConfigured
 	}
 
@@ -108,8 +127,69 @@ func (s *AvatarService) DeleteAvatar(ctx context.Context, userID uint) (*models.
 
 	// Best-effort delete previous object if present.
 	if oldKey != "" {
-		_ = s.s3.DeleteObject(ctx, oldKey)
+		_ = s.store.Delete(ctx, oldKey)
 	}
 
 	return user, nil
 }
+
+// UploadGroupIcon processes an image like UploadAvatar and makes it the
+// group's icon. Icons live under avatars/groups/ so they're served by the
+// avatar media route. Callers check the actor's permission.
+func (s *AvatarService) UploadGroupIcon(ctx context.Context, groupID uint, fileReader io.Reader, publicAPIBaseURL string) (*models.Group, error) {
+	if s.store == nil {
+		return nil, ErrStorageNotConfigured
+	}
+	publicAPIBaseURL = strings.TrimRight(strings.TrimSpace(publicAPIBaseURL), "/")
+	if publicAPIBaseURL == "" {
+		return nil, errors.New("missing public api base url")
+	}
+
+	group, err := s.groupRepo.FindByID(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, _, _, err := s.storeImage(ctx, fmt.Sprintf("avatars/groups/%d/", groupID), fileReader)
+	if err != nil {
+		return nil, err
+	}
+
+	oldKey := strings.TrimSpace(group.IconKey)
+	group.Icon = publicAPIBaseURL + "/media/avatars/" + key
+	group.IconKey = key
+	if err := s.groupRepo.Update(group); err != nil {
+		_ = s.store.Delete(ctx, key)
+		return nil, err
+	}
+
+	if oldKey != "" && oldKey != key {
+		_ = s.store.Delete(ctx, oldKey)
+	}
+	return group, nil
+}
+
+// DeleteGroupIcon clears the group's icon and deletes the stored object
+// (best-effort).
+func (s *AvatarService) DeleteGroupIcon(ctx context.Context, groupID uint) (*models.Group, error) {
+	if s.store == nil {
+		return nil, ErrStorageNotConfigured
+	}
+
+	group, err := s.groupRepo.FindByID(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	oldKey := strings.TrimSpace(group.IconKey)
+	group.Icon = ""
+	group.IconKey = ""
+	if err := s.groupRepo.Update(group); err != nil {
+		return nil, err
+	}
+
+	if oldKey != "" {
+		_ = s.store.Delete(ctx, oldKey)
+	}
+	return group, nil
+}
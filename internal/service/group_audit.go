@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"log"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+var ErrInvalidAuditAction = errors.New("invalid audit action")
+
+// AuditLogFilter narrows ListAuditLog. Cursor is the ID of the oldest entry
+// of the previous page.
+type AuditLogFilter struct {
+	ActorID uint
+	Actions []models.GroupAuditAction
+	Cursor  uint
+	Limit   int
+}
+
+type AuditLogPage struct {
+	Entries    []models.GroupAuditEntry `json:"entries"`
+	NextCursor uint                     `json:"next_cursor,omitempty"`
+}
+
+// EnableAuditLog makes the service record administrative actions in each
+// group's audit log.
+func (s *GroupService) EnableAuditLog(auditRepo repository.GroupAuditRepositoryInterface) {
+	s.auditRepo = auditRepo
+}
+
+// ListAuditLog returns the group's audit entries, newest first; admins only.
+func (s *GroupService) ListAuditLog(groupID, actorID uint, filter AuditLogFilter) (*AuditLogPage, error) {
+	for _, action := range filter.Actions {
+		if !action.Valid() {
+			return nil, ErrInvalidAuditAction
+		}
+	}
+	role, err := s.roleOf(groupID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, ErrNotGroupMember
+	}
+	if !role.IsAdmin() {
+		return nil, ErrGroupPermissionDenied
+	}
+	page := &AuditLogPage{Entries: []models.GroupAuditEntry{}}
+	if s.auditRepo == nil {
+		return page, nil
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditPageSize
+	}
+	if limit > maxAuditPageSize {
+		limit = maxAuditPageSize
+	}
+	entries, err := s.auditRepo.List(groupID, repository.AuditQuery{
+		ActorID:  filter.ActorID,
+		Actions:  filter.Actions,
+		BeforeID: filter.Cursor,
+		Limit:    limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	page.Entries = entries
+	if len(entries) == limit {
+		page.NextCursor = entries[len(entries)-1].ID
+	}
+	return page, nil
+}
+
+// recordEvent audits a group event and puts it on the group's timeline.
+func (s *GroupService) recordEvent(groupID uint, event models.SystemEvent) {
+	entry := models.GroupAuditEntry{
+		Action:  models.GroupAuditAction(event.Action),
+		ActorID: event.ActorID,
+	}
+	if len(event.TargetIDs) > 0 {
+		entry.TargetUserID = &event.TargetIDs[0]
+	}
+	if event.TopicID != 0 {
+		entry.TopicID = &event.TopicID
+	}
+	if event.Role != "" || len(event.Changes) > 0 || event.Name != "" {
+		entry.Details = &models.GroupAuditDetails{Role: event.Role, Changes: event.Changes, Name: event.Name}
+	}
+	s.audit(groupID, entry)
+	s.emitSystemMessage(groupID, event)
+}
+
+// audit appends entry to the group's audit log. Like system messages it is
+// best-effort: the action it records has already happened.
+func (s *GroupService) audit(groupID uint, entry models.GroupAuditEntry) {
+	if s.auditRepo == nil {
+		return
+	}
+	entry.GroupID = groupID
+	if err := s.auditRepo.Create(&entry); err != nil {
+		log.Printf("group %d: failed to record %s in audit log: %v", groupID, entry.Action, err)
+	}
+}
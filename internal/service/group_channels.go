@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+)
+
+var (
+	ErrInvalidGroupType = errors.New("invalid group type")
+	// ErrChannelAdminOnly is the ErrGroupPermissionDenied returned when a
+	// non-admin tries to post in a channel.
+	ErrChannelAdminOnly = fmt.Errorf("%w: only admins can post in channels", ErrGroupPermissionDenied)
+	ErrMemberListHidden = errors.New("channel subscribers are hidden")
+)
+
+// GetGroupInfo returns the group row without loading its members.
+func (s *GroupService) GetGroupInfo(groupID uint) (*models.Group, error) {
+	return s.groupRepo.FindInfo(groupID)
+}
+
+// checkMemberListAccess enforces who may list members: members of public
+// groups are visible to everyone, but channel subscribers only to the
+// channel's admins.
+func (s *GroupService) checkMemberListAccess(groupID, viewerID uint) error {
+	group, err := s.groupRepo.FindInfo(groupID)
+	if err != nil {
+		return err
+	}
+	if group.IsChannel() || !group.IsPublic {
+		role, err := s.roleOf(groupID, viewerID)
+		if err != nil {
+			return err
+		}
+		if role == "" {
+			return ErrNotGroupMember
+		}
+		if group.IsChannel() && !role.IsAdmin() {
+			return ErrMemberListHidden
+		}
+	}
+	return nil
+}
+
+// HideMembersFrom drops the preloaded member list from a channel the viewer
+// doesn't administer, before the group is sent to them.
+func (s *GroupService) HideMembersFrom(group *models.Group, viewerID uint) {
+	if group == nil || !group.IsChannel() {
+		return
+	}
+	if role, err := s.roleOf(group.ID, viewerID); err == nil && role.IsAdmin() {
+		return
+	}
+	group.Members = nil
+}
+
+func (s *GroupService) fillMemberCount(group *models.Group) error {
+	counts, err := s.groupRepo.CountMembers([]uint{group.ID})
+	if err != nil {
+		return err
+	}
+	group.MemberCount = counts[group.ID]
+	return nil
+}
+
+func (s *GroupService) fillMemberCounts(groups []models.Group) error {
+	if len(groups) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(groups))
+	for i := range groups {
+		ids[i] = groups[i].ID
+	}
+	counts, err := s.groupRepo.CountMembers(ids)
+	if err != nil {
+		return err
+	}
+	for i := range groups {
+		groups[i].MemberCount = counts[groups[i].ID]
+	}
+	return nil
+}
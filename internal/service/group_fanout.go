@@ -0,0 +1,53 @@
+package service
+
+import (
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+)
+
+// MemberIDCache keeps group member ID lists out of the database on the
+// message fan-out path. It is implemented by cache.GroupCache.
+type MemberIDCache interface {
+	GetMemberIDs(groupID uint) ([]uint, bool)
+	SetMemberIDs(groupID uint, ids []uint) error
+	InvalidateMemberIDs(groupID uint) error
+}
+
+// EnableMemberCache makes GetMemberIDs read through cache. Membership
+// changes made by the service invalidate it.
+func (s *GroupService) EnableMemberCache(cache MemberIDCache) {
+	s.memberCache = cache
+}
+
+// GetMemberIDs returns the IDs of the group's members, for fan-out.
+func (s *GroupService) GetMemberIDs(groupID uint) ([]uint, error) {
+	if s.memberCache != nil {
+		if ids, ok := s.memberCache.GetMemberIDs(groupID); ok {
+			return ids, nil
+		}
+	}
+	ids, err := s.groupRepo.GetMemberIDs(groupID)
+	if err != nil {
+		return nil, err
+	}
+	if s.memberCache != nil {
+		_ = s.memberCache.SetMemberIDs(groupID, ids)
+	}
+	return ids, nil
+}
+
+// membersChanged drops the cached member list after a join, leave or delete.
+func (s *GroupService) membersChanged(groupID uint) {
+	if s.memberCache != nil {
+		_ = s.memberCache.InvalidateMemberIDs(groupID)
+	}
+}
+
+// ListGroupsBehind returns the user's groups, and topics of forum groups,
+// with messages past their read mark. Group messages aren't queued for offline members; reconnecting
+// clients use this to decide which groups to sync.
+func (s *GroupService) ListGroupsBehind(userID uint) ([]repository.GroupCatchUpRow, error) {
+	if s.groupReadStateRepo == nil {
+		return nil, nil
+	}
+	return s.groupReadStateRepo.ListBehind(userID)
+}
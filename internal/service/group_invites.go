@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInviteLinkNotFound = errors.New("invite link not found")
+	ErrInvalidInviteLimit = errors.New("invalid invite link limits")
+)
+
+// UpdateInviteLinkInput changes a link's settings; nil fields are left alone
+// and 0 removes a limit.
+type UpdateInviteLinkInput struct {
+	ExpiresInSeconds *int  `json:"expires_in_seconds"`
+	MaxUses          *int  `json:"max_uses"`
+	RequiresApproval *bool `json:"requires_approval"`
+}
+
+// ListInviteLinks returns the group's links with usage counts and creators.
+// Needs PermManageInvites.
+func (s *GroupService) ListInviteLinks(groupID, actorID uint) ([]models.GroupInviteLink, error) {
+	if err := s.authorizeInvites(groupID, actorID); err != nil {
+		return nil, err
+	}
+	return s.inviteRepo.ListByGroup(groupID)
+}
+
+// RevokeInviteLink disables the link; people who already joined stay.
+func (s *GroupService) RevokeInviteLink(groupID, actorID, linkID uint) (*models.GroupInviteLink, error) {
+	link, err := s.findInviteLink(groupID, actorID, linkID)
+	if err != nil {
+		return nil, err
+	}
+	if link.RevokedAt != nil {
+		return link, nil
+	}
+	now := time.Now()
+	if err := s.inviteRepo.Revoke(link.ID, now); err != nil {
+		return nil, err
+	}
+	link.RevokedAt = &now
+	s.audit(groupID, models.GroupAuditEntry{
+		Action:       models.AuditInviteLinkRevoked,
+		ActorID:      actorID,
+		InviteLinkID: &link.ID,
+	})
+	return link, nil
+}
+
+func (s *GroupService) UpdateInviteLink(groupID, actorID, linkID uint, input UpdateInviteLinkInput) (*models.GroupInviteLink, error) {
+	if (input.ExpiresInSeconds != nil && *input.ExpiresInSeconds < 0) || (input.MaxUses != nil && *input.MaxUses < 0) {
+		return nil, ErrInvalidInviteLimit
+	}
+	link, err := s.findInviteLink(groupID, actorID, linkID)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	if input.ExpiresInSeconds != nil {
+		changed = append(changed, "expires_at")
+		link.ExpiresAt = nil
+		if *input.ExpiresInSeconds > 0 {
+			t := time.Now().Add(time.Duration(*input.ExpiresInSeconds) * time.Second)
+			link.ExpiresAt = &t
+		}
+	}
+	if input.MaxUses != nil {
+		changed = append(changed, "max_uses")
+		link.MaxUses = nil
+		if *input.MaxUses > 0 {
+			v := *input.MaxUses
+			link.MaxUses = &v
+		}
+	}
+	if input.RequiresApproval != nil {
+		changed = append(changed, "requires_approval")
+		link.RequiresApproval = *input.RequiresApproval
+	}
+	if err := s.inviteRepo.UpdateSettings(link); err != nil {
+		return nil, err
+	}
+	if len(changed) > 0 {
+		s.audit(groupID, models.GroupAuditEntry{
+			Action:       models.AuditInviteLinkEdited,
+			ActorID:      actorID,
+			InviteLinkID: &link.ID,
+			Details:      &models.GroupAuditDetails{Changes: changed},
+		})
+	}
+	return link, nil
+}
+
+// ListInviteLinkUses returns who joined through the link, newest first.
+func (s *GroupService) ListInviteLinkUses(groupID, actorID, linkID uint) ([]models.GroupInviteUse, error) {
+	link, err := s.findInviteLink(groupID, actorID, linkID)
+	if err != nil {
+		return nil, err
+	}
+	return s.inviteRepo.ListUses(link.ID)
+}
+
+func (s *GroupService) authorizeInvites(groupID, actorID uint) error {
+	if s.inviteRepo == nil {
+		return errors.New("invite repository not configured")
+	}
+	return s.Authorize(groupID, actorID, models.PermManageInvites)
+}
+
+// findInviteLink loads a link of the group after checking the actor may
+// manage invites.
+func (s *GroupService) findInviteLink(groupID, actorID, linkID uint) (*models.GroupInviteLink, error) {
+	if err := s.authorizeInvites(groupID, actorID); err != nil {
+		return nil, err
+	}
+	link, err := s.inviteRepo.FindByID(linkID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInviteLinkNotFound
+		}
+		return nil, err
+	}
+	if link.GroupID != groupID {
+		return nil, ErrInviteLinkNotFound
+	}
+	return link, nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/validation"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrJoinRequestNotFound = errors.New("join request not found")
+	ErrJoinRequestDecided  = errors.New("join request already decided")
+)
+
+// requestToJoin files a pending join request, returning the user's open
+// request if there already is one. Only a new request has Filed set.
+func (s *GroupService) requestToJoin(groupID, userID uint, linkID *uint) (*models.GroupJoinRequest, error) {
+	existing, err := s.groupRepo.FindPendingJoinRequest(groupID, userID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	req := &models.GroupJoinRequest{
+		GroupID:      groupID,
+		UserID:       userID,
+		InviteLinkID: linkID,
+		Status:       models.JoinRequestPending,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.groupRepo.CreateJoinRequest(req); err != nil {
+		return nil, err
+	}
+	created, err := s.groupRepo.FindJoinRequest(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	created.Filed = true
+	return created, nil
+}
+
+// JoinRequestReviewers returns the members who may decide join requests,
+// i.e. those whose role holds PermAddMembers.
+func (s *GroupService) JoinRequestReviewers(groupID uint) ([]uint, error) {
+	group, err := s.groupRepo.FindByID(groupID)
+	if err != nil {
+		return nil, err
+	}
+	var roles []models.GroupRole
+	for _, role := range []models.GroupRole{models.RoleOwner, models.RoleAdmin, models.RoleModerator, models.RoleMember} {
+		if group.PermissionsFor(role).Has(models.PermAddMembers) {
+			roles = append(roles, role)
+		}
+	}
+	return s.groupRepo.GetMemberIDsByRoles(groupID, roles)
+}
+
+// ListJoinRequests returns the group's pending requests, oldest first.
+// Needs PermAddMembers.
+func (s *GroupService) ListJoinRequests(groupID, actorID uint) ([]models.GroupJoinRequest, error) {
+	if err := s.Authorize(groupID, actorID, models.PermAddMembers); err != nil {
+		return nil, err
+	}
+	return s.groupRepo.ListPendingJoinRequests(groupID)
+}
+
+// DecideJoinRequest approves or declines a pending request. Approval admits
+// the requester, counting a use of the invite link it came through while
+// the link is still usable. Needs PermAddMembers.
+func (s *GroupService) DecideJoinRequest(groupID, actorID, requestID uint, approve bool, reason string) (*models.GroupJoinRequest, error) {
+	if err := s.Authorize(groupID, actorID, models.PermAddMembers); err != nil {
+		return nil, err
+	}
+	req, err := s.groupRepo.FindJoinRequest(requestID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrJoinRequestNotFound
+		}
+		return nil, err
+	}
+	if req.GroupID != groupID {
+		return nil, ErrJoinRequestNotFound
+	}
+	if req.Status != models.JoinRequestPending {
+		return nil, ErrJoinRequestDecided
+	}
+	if approve {
+		if err := s.checkNotBanned(groupID, req.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	status := models.JoinRequestDeclined
+	if approve {
+		status = models.JoinRequestApproved
+	}
+	reason = validation.TrimAndLimit(reason, 255)
+	now := time.Now()
+	// Closing the request first keeps two reviewers from both admitting.
+	if err := s.groupRepo.DecideJoinRequest(req.ID, status, actorID, reason, now); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrJoinRequestDecided
+		}
+		return nil, err
+	}
+	req.Status = status
+	req.DecidedBy = &actorID
+	req.Reason = reason
+	req.DecidedAt = &now
+
+	action := models.AuditJoinRequestDeclined
+	if approve {
+		// A request whose requester couldn't be admitted, say because the
+		// group is full, stays open for another try.
+		if err := s.admit(req); err != nil {
+			if rerr := s.groupRepo.ReopenJoinRequest(req.ID); rerr != nil {
+				log.Printf("group %d: failed to reopen join request %d: %v", groupID, req.ID, rerr)
+			}
+			return nil, err
+		}
+		action = models.AuditJoinRequestApproved
+	}
+	s.audit(groupID, models.GroupAuditEntry{
+		Action:       action,
+		ActorID:      actorID,
+		TargetUserID: &req.UserID,
+		Details:      &models.GroupAuditDetails{Reason: reason},
+	})
+	return req, nil
+}
+
+func (s *GroupService) admit(req *models.GroupJoinRequest) error {
+	isMember, err := s.groupRepo.IsMember(req.GroupID, req.UserID)
+	if err != nil || isMember {
+		return err
+	}
+	group, err := s.groupRepo.FindInfo(req.GroupID)
+	if err != nil {
+		return err
+	}
+	addMember := func(tx *gorm.DB) error {
+		return s.addMemberTx(tx, group, req.UserID, models.RoleMember)
+	}
+	used := false
+	if req.InviteLinkID != nil && s.inviteRepo != nil {
+		used, err = s.inviteRepo.IncrementUse(*req.InviteLinkID, req.UserID, time.Now(), addMember)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	// A reviewer's approval stands even if the link has since run out.
+	if !used {
+		if err := addMember(nil); err != nil {
+			return err
+		}
+	}
+	s.admitted(req.GroupID, req.UserID)
+	return nil
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMemberPageSize = 50
+	maxMemberPageSize     = 200
+)
+
+var (
+	ErrGroupFull           = repository.ErrGroupFull
+	ErrInvalidMemberCursor = errors.New("invalid member cursor")
+)
+
+// MemberLimits caps the number of members of groups and channels; 0 means
+// no limit.
+type MemberLimits struct {
+	Group   int64
+	Channel int64
+}
+
+// DefaultMemberLimits caps groups at 200,000 members and leaves channels unlimited.
+func DefaultMemberLimits() MemberLimits {
+	return MemberLimits{Group: 200000, Channel: 0}
+}
+
+// LoadMemberLimitsFromEnv reads GROUP_MAX_MEMBERS and CHANNEL_MAX_MEMBERS
+// overrides on top of the defaults.
+func LoadMemberLimitsFromEnv() MemberLimits {
+	limits := DefaultMemberLimits()
+	if n, err := strconv.ParseInt(os.Getenv("GROUP_MAX_MEMBERS"), 10, 64); err == nil && n >= 0 {
+		limits.Group = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("CHANNEL_MAX_MEMBERS"), 10, 64); err == nil && n >= 0 {
+		limits.Channel = n
+	}
+	return limits
+}
+
+// SetMemberLimits replaces the default member limits.
+func (s *GroupService) SetMemberLimits(limits MemberLimits) {
+	s.memberLimits = limits
+}
+
+func (s *GroupService) maxMembers(group *models.Group) int64 {
+	if group.IsChannel() {
+		return s.memberLimits.Channel
+	}
+	return s.memberLimits.Group
+}
+
+// addMember adds the user unless the group is at its size limit.
+func (s *GroupService) addMember(group *models.Group, userID uint, role models.GroupRole) error {
+	return s.addMemberTx(nil, group, userID, role)
+}
+
+// addMemberTx is addMember inside tx, such as an invite link redemption; a
+// nil tx runs on its own.
+func (s *GroupService) addMemberTx(tx *gorm.DB, group *models.Group, userID uint, role models.GroupRole) error {
+	repo := s.groupRepo
+	if tx != nil {
+		repo = repo.WithTx(tx)
+	}
+	return repo.AddMember(group.ID, userID, role, s.maxMembers(group))
+}
+
+// MemberListOptions filters and pages ListMembers. Cursor is the NextCursor
+// of the previous page.
+type MemberListOptions struct {
+	Search string
+	Roles  []models.GroupRole
+	Cursor string
+	Limit  int
+}
+
+type MemberPage struct {
+	Members    []models.GroupMemberResponse `json:"members"`
+	NextCursor string                       `json:"next_cursor,omitempty"`
+}
+
+// ListMembers returns a page of the group's members as the viewer may see
+// them, online members first, then by join time.
+func (s *GroupService) ListMembers(groupID, viewerID uint, opts MemberListOptions) (*MemberPage, error) {
+	for _, role := range opts.Roles {
+		if !role.Valid() {
+			return nil, ErrInvalidGroupRole
+		}
+	}
+	if err := s.checkMemberListAccess(groupID, viewerID); err != nil {
+		return nil, err
+	}
+	query := repository.MemberQuery{
+		Search: strings.TrimSpace(opts.Search),
+		Roles:  opts.Roles,
+		Limit:  opts.Limit,
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultMemberPageSize
+	}
+	if query.Limit > maxMemberPageSize {
+		query.Limit = maxMemberPageSize
+	}
+	if opts.Cursor != "" {
+		cursor, err := decodeMemberCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query.After = cursor
+	}
+
+	members, err := s.groupRepo.ListMembers(groupID, query)
+	if err != nil {
+		return nil, err
+	}
+	page := &MemberPage{Members: make([]models.GroupMemberResponse, len(members))}
+	for i := range members {
+		page.Members[i] = members[i].ToResponse()
+	}
+	if len(members) == query.Limit {
+		last := members[len(members)-1]
+		page.NextCursor = encodeMemberCursor(repository.MemberCursor{
+			Online:   last.User.IsOnline,
+			JoinedAt: last.JoinedAt,
+			UserID:   last.UserID,
+		})
+	}
+	return page, nil
+}
+
+func encodeMemberCursor(c repository.MemberCursor) string {
+	online := 0
+	if c.Online {
+		online = 1
+	}
+	raw := fmt.Sprintf("%d:%d:%d", online, c.JoinedAt.UnixNano(), c.UserID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeMemberCursor(s string) (*repository.MemberCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidMemberCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || (parts[0] != "0" && parts[0] != "1") {
+		return nil, ErrInvalidMemberCursor
+	}
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidMemberCursor
+	}
+	userID, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return nil, ErrInvalidMemberCursor
+	}
+	return &repository.MemberCursor{
+		Online:   parts[0] == "1",
+		JoinedAt: time.Unix(0, nanos),
+		UserID:   uint(userID),
+	}, nil
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/validation"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrGroupBanned         = errors.New("banned from this group")
+	ErrGroupMemberNotFound = errors.New("user is not a member of this group")
+	ErrCannotManageMember  = errors.New("cannot manage a member with an equal or higher role")
+	ErrInvalidGroupRole    = errors.New("invalid group role")
+	ErrInvalidBanExpiry    = errors.New("ban expiry must be in the future")
+)
+
+const maxBanReasonLength = 255
+
+// roleOf returns the user's role in the group, or "" for non-members.
+func (s *GroupService) roleOf(groupID, userID uint) (models.GroupRole, error) {
+	role, err := s.groupRepo.GetMemberRole(groupID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return role, err
+}
+
+// checkModerates verifies the actor is at least a moderator and outranks the
+// target, returning the target's role ("" for non-members).
+func (s *GroupService) checkModerates(groupID, actorID, targetID uint) (models.GroupRole, error) {
+	actorRole, err := s.roleOf(groupID, actorID)
+	if err != nil {
+		return "", err
+	}
+	if actorRole == "" {
+		return "", ErrNotGroupMember
+	}
+	if actorRole.Rank() < models.RoleModerator.Rank() {
+		return "", ErrGroupPermissionDenied
+	}
+	if actorID == targetID {
+		return "", ErrCannotManageMember
+	}
+	targetRole, err := s.roleOf(groupID, targetID)
+	if err != nil {
+		return "", err
+	}
+	if targetRole.Rank() >= actorRole.Rank() {
+		return "", ErrCannotManageMember
+	}
+	return targetRole, nil
+}
+
+// checkNotBanned returns ErrGroupBanned if the user has an active ban.
+func (s *GroupService) checkNotBanned(groupID, userID uint) error {
+	_, err := s.groupRepo.FindActiveBan(groupID, userID, time.Now())
+	if err == nil {
+		return ErrGroupBanned
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// SetMemberRole promotes or demotes a member. Only admins may change roles,
+// and only for members below them and to roles below their own, so admins
+// can appoint moderators while only the owner appoints admins. Ownership
+// can't be granted this way.
+func (s *GroupService) SetMemberRole(groupID, actorID, targetID uint, role models.GroupRole) error {
+	if !role.Valid() || role == models.RoleOwner {
+		return ErrInvalidGroupRole
+	}
+	actorRole, err := s.roleOf(groupID, actorID)
+	if err != nil {
+		return err
+	}
+	if actorRole == "" {
+		return ErrNotGroupMember
+	}
+	if !actorRole.IsAdmin() {
+		return ErrGroupPermissionDenied
+	}
+	targetRole, err := s.roleOf(groupID, targetID)
+	if err != nil {
+		return err
+	}
+	if targetRole == "" {
+		return ErrGroupMemberNotFound
+	}
+	if actorID == targetID || targetRole.Rank() >= actorRole.Rank() || role.Rank() >= actorRole.Rank() {
+		return ErrCannotManageMember
+	}
+	if role == targetRole {
+		return nil
+	}
+	if err := s.groupRepo.UpdateMemberRole(groupID, targetID, role); err != nil {
+		return err
+	}
+	s.recordEvent(groupID, models.SystemEvent{
+		Action:    models.SystemMemberRoleChanged,
+		ActorID:   actorID,
+		TargetIDs: []uint{targetID},
+		Role:      role,
+	})
+	return nil
+}
+
+// RemoveMember kicks a member. They may rejoin unless also banned.
+func (s *GroupService) RemoveMember(groupID, actorID, targetID uint) error {
+	targetRole, err := s.checkModerates(groupID, actorID, targetID)
+	if err != nil {
+		return err
+	}
+	if targetRole == "" {
+		return ErrGroupMemberNotFound
+	}
+	if err := s.removeMember(groupID, targetID); err != nil {
+		return err
+	}
+	s.recordEvent(groupID, models.SystemEvent{
+		Action:    models.SystemMemberRemoved,
+		ActorID:   actorID,
+		TargetIDs: []uint{targetID},
+	})
+	return nil
+}
+
+// BanMember removes the user (if a member) and keeps them from rejoining by
+// any route until expiresAt (nil = permanent). Non-members can be banned
+// pre-emptively. It reports whether the user was a member.
+func (s *GroupService) BanMember(groupID, actorID, targetID uint, reason string, expiresAt *time.Time) (*models.GroupBan, bool, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, false, ErrInvalidBanExpiry
+	}
+	targetRole, err := s.checkModerates(groupID, actorID, targetID)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.userRepo != nil {
+		if _, err := s.userRepo.FindByID(targetID); err != nil {
+			return nil, false, ErrUserNotFound
+		}
+	}
+
+	ban := &models.GroupBan{
+		GroupID:   groupID,
+		UserID:    targetID,
+		BannedBy:  actorID,
+		Reason:    validation.TrimAndLimit(reason, maxBanReasonLength),
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	// Ban before removing so a concurrent rejoin can't slip in between.
+	if err := s.groupRepo.SaveBan(ban); err != nil {
+		return nil, false, err
+	}
+	wasMember := targetRole != ""
+	if wasMember {
+		if err := s.removeMember(groupID, targetID); err != nil {
+			return nil, false, err
+		}
+		// Pre-emptive bans of outsiders stay off the group's timeline.
+		s.emitSystemMessage(groupID, models.SystemEvent{
+			Action:    models.SystemMemberBanned,
+			ActorID:   actorID,
+			TargetIDs: []uint{targetID},
+		})
+	}
+	s.audit(groupID, models.GroupAuditEntry{
+		Action:       models.AuditMemberBanned,
+		ActorID:      actorID,
+		TargetUserID: &targetID,
+		Details:      &models.GroupAuditDetails{Reason: ban.Reason, ExpiresAt: expiresAt},
+	})
+	return ban, wasMember, nil
+}
+
+func (s *GroupService) UnbanMember(groupID, actorID, targetID uint) error {
+	if _, err := s.checkModerates(groupID, actorID, targetID); err != nil {
+		return err
+	}
+	if err := s.groupRepo.DeleteBan(groupID, targetID); err != nil {
+		return err
+	}
+	s.audit(groupID, models.GroupAuditEntry{
+		Action:       models.AuditMemberUnbanned,
+		ActorID:      actorID,
+		TargetUserID: &targetID,
+	})
+	return nil
+}
+
+// ListBans returns the group's active bans; moderators and above only.
+func (s *GroupService) ListBans(groupID, actorID uint) ([]models.GroupBan, error) {
+	actorRole, err := s.roleOf(groupID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if actorRole == "" {
+		return nil, ErrNotGroupMember
+	}
+	if actorRole.Rank() < models.RoleModerator.Rank() {
+		return nil, ErrGroupPermissionDenied
+	}
+	return s.groupRepo.ListActiveBans(groupID, time.Now())
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+)
+
+var ErrNotGroupOwner = errors.New("only the group owner can do this")
+
+// TransferOwnership hands the group to another member. The previous owner
+// stays on as an admin.
+func (s *GroupService) TransferOwnership(groupID, ownerID, newOwnerID uint) error {
+	if err := s.checkOwner(groupID, ownerID); err != nil {
+		return err
+	}
+	if ownerID == newOwnerID {
+		return ErrCannotManageMember
+	}
+	targetRole, err := s.roleOf(groupID, newOwnerID)
+	if err != nil {
+		return err
+	}
+	if targetRole == "" {
+		return ErrGroupMemberNotFound
+	}
+	if err := s.groupRepo.TransferOwnership(groupID, ownerID, newOwnerID); err != nil {
+		return err
+	}
+	s.recordEvent(groupID, models.SystemEvent{
+		Action:    models.SystemOwnershipChanged,
+		ActorID:   ownerID,
+		TargetIDs: []uint{newOwnerID},
+	})
+	return nil
+}
+
+// DeleteGroup soft-deletes the group; owner only. It returns the IDs of the
+// members at the time of deletion so callers can notify them.
+func (s *GroupService) DeleteGroup(groupID, actorID uint) ([]uint, error) {
+	if err := s.checkOwner(groupID, actorID); err != nil {
+		return nil, err
+	}
+	memberIDs, err := s.groupRepo.GetMemberIDs(groupID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.deleteGroup(groupID); err != nil {
+		return nil, err
+	}
+	return memberIDs, nil
+}
+
+// deleteGroup deletes the group with its messages and releases the
+// attachments no other message carries.
+func (s *GroupService) deleteGroup(groupID uint) error {
+	attachmentIDs, err := s.groupRepo.Delete(groupID)
+	if err != nil {
+		return err
+	}
+	s.membersChanged(groupID)
+	if s.attachments == nil {
+		return nil
+	}
+	ctx := context.Background()
+	for _, id := range attachmentIDs {
+		if err := s.attachments.DeleteIfUnreferenced(ctx, id); err != nil && !errors.Is(err, ErrStorageNotConfigured) {
+			log.Printf("group %d: failed to delete attachment %d: %v", groupID, id, err)
+		}
+	}
+	return nil
+}
+
+// EnableAttachmentCleanup makes deleting a group delete the attachments of
+// its messages as well.
+func (s *GroupService) EnableAttachmentCleanup(attachments *AttachmentService) {
+	s.attachments = attachments
+}
+
+func (s *GroupService) checkOwner(groupID, userID uint) error {
+	role, err := s.roleOf(groupID, userID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return ErrNotGroupMember
+	}
+	if role != models.RoleOwner {
+		return ErrNotGroupOwner
+	}
+	return nil
+}
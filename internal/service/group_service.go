@@ -4,7 +4,10 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"log"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
 	"github.com/noteduco342/OMMessenger-backend/internal/repository"
@@ -12,11 +15,29 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	ErrNotGroupMember         = errors.New("not a group member")
+	ErrGroupPermissionDenied  = errors.New("missing group permission")
+	ErrInvalidGroupPermission = errors.New("invalid group permissions")
+	ErrGroupHandleRequired    = errors.New("handle is required for public groups")
+	ErrInvalidGroupHandle     = errors.New("invalid handle")
+	ErrGroupHandleTaken       = errors.New("handle already taken")
+	ErrInvalidGroupName       = errors.New("invalid group name")
+)
+
 type GroupService struct {
 	groupRepo          repository.GroupRepositoryInterface
 	groupReadStateRepo repository.GroupReadStateRepositoryInterface
 	userRepo           repository.UserRepositoryInterface
 	inviteRepo         repository.GroupInviteRepositoryInterface
+	messageRepo        repository.MessageRepositoryInterface
+	delivery           MessageDelivery
+	memberCache        MemberIDCache
+	rateLimiter        SendRateLimiter
+	floodLimit         FloodLimit
+	memberLimits       MemberLimits
+	auditRepo          repository.GroupAuditRepositoryInterface
+	attachments        *AttachmentService
 }
 
 func NewGroupService(
@@ -30,6 +51,7 @@ func NewGroupService(
 		groupReadStateRepo: groupReadStateRepo,
 		userRepo:           userRepo,
 		inviteRepo:         inviteRepo,
+		memberLimits:       DefaultMemberLimits(),
 	}
 }
 
@@ -38,31 +60,32 @@ func (s *GroupService) CreateGroup(name, description string, creatorID uint) (*m
 }
 
 func (s *GroupService) CreateGroupWithVisibility(name, description string, creatorID uint, isPublic bool, handle string) (*models.Group, error) {
+	return s.CreateGroupOfType(models.GroupTypeGroup, name, description, creatorID, isPublic, handle)
+}
+
+// CreateGroupOfType creates a group or a broadcast channel.
+func (s *GroupService) CreateGroupOfType(groupType models.GroupType, name, description string, creatorID uint, isPublic bool, handle string) (*models.Group, error) {
+	if groupType == "" {
+		groupType = models.GroupTypeGroup
+	}
+	if !groupType.Valid() {
+		return nil, ErrInvalidGroupType
+	}
 	group := &models.Group{
-		Name:        name,
-		Description: description,
-		CreatorID:   creatorID,
-		IsPublic:    isPublic,
+		Type:                 groupType,
+		Name:                 name,
+		Description:          description,
+		CreatorID:            creatorID,
+		OwnerID:              creatorID,
+		IsPublic:             isPublic,
+		MemberPermissions:    models.DefaultMemberPermissions,
+		ModeratorPermissions: models.DefaultModeratorPermissions,
 	}
 
 	if isPublic {
-		if handle == "" {
-			return nil, errors.New("handle is required for public groups")
-		}
-		if s.userRepo == nil {
-			return nil, errors.New("user repository not configured")
-		}
-		normalized := validation.NormalizeHandle(handle)
-		if !validation.ValidateHandle(normalized) {
-			return nil, errors.New("invalid handle")
-		}
-		// Ensure handle not used by a user
-		if _, err := s.userRepo.FindByUsername(normalized); err == nil {
-			return nil, errors.New("handle already taken")
-		}
-		// Ensure handle not used by another group
-		if _, err := s.groupRepo.FindByHandle(normalized); err == nil {
-			return nil, errors.New("handle already taken")
+		normalized, err := s.checkHandleAvailable(handle, 0)
+		if err != nil {
+			return nil, err
 		}
 		group.Handle = &normalized
 	}
@@ -71,60 +94,255 @@ func (s *GroupService) CreateGroupWithVisibility(name, description string, creat
 		return nil, err
 	}
 
-	// Add creator as admin
-	if err := s.groupRepo.AddMember(group.ID, creatorID, models.RoleAdmin); err != nil {
+	// Add creator as owner
+	if err := s.addMember(group, creatorID, models.RoleOwner); err != nil {
 		return nil, err
 	}
 
 	if s.groupReadStateRepo != nil {
 		_ = s.groupReadStateRepo.EnsureForMember(group.ID, creatorID)
 	}
+	s.recordEvent(group.ID, models.SystemEvent{
+		Action:  models.SystemGroupCreated,
+		ActorID: creatorID,
+		Name:    group.Name,
+	})
 
 	return s.groupRepo.FindByID(group.ID)
 }
 
-func (s *GroupService) JoinGroup(groupID, userID uint) error {
+const maxGroupNameLength = 100
+
+// UpdateGroupInput holds the group info to change; nil fields are left alone.
+type UpdateGroupInput struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	IsPublic    *bool   `json:"is_public"`
+	Handle      *string `json:"handle"`
+
+	JoinRequiresApproval *bool `json:"join_requires_approval"`
+	SlowModeSeconds      *int  `json:"slow_mode_seconds"`
+	IsForum              *bool `json:"is_forum"`
+
+	// Disappearing message timer for messages sent from now on; 0 turns it off.
+	MessageTTLSeconds *int                   `json:"message_ttl_seconds"`
+	MessageTTLMode    *models.MessageTTLMode `json:"message_ttl_mode"`
+}
+
+// UpdateGroup edits the group's info. Name and description need
+// PermChangeInfo; visibility, handle, join approval, slow mode, forum mode and
+// the disappearing message timer are reserved to admins.
+// It returns the group and the JSON names of the fields that changed.
+func (s *GroupService) UpdateGroup(groupID, actorID uint, input UpdateGroupInput) (*models.Group, []string, error) {
+	if err := s.Authorize(groupID, actorID, models.PermChangeInfo); err != nil {
+		return nil, nil, err
+	}
+	if input.SlowModeSeconds != nil && (*input.SlowModeSeconds < 0 || *input.SlowModeSeconds > maxSlowModeSeconds) {
+		return nil, nil, ErrInvalidSlowMode
+	}
+	if input.IsPublic != nil || input.Handle != nil || input.JoinRequiresApproval != nil || input.SlowModeSeconds != nil ||
+		input.IsForum != nil || input.MessageTTLSeconds != nil || input.MessageTTLMode != nil {
+		isAdmin, err := s.IsAdmin(groupID, actorID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !isAdmin {
+			return nil, nil, ErrGroupPermissionDenied
+		}
+	}
+
 	group, err := s.groupRepo.FindByID(groupID)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	var changed []string
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxGroupNameLength {
+			return nil, nil, ErrInvalidGroupName
+		}
+		if name != group.Name {
+			group.Name = name
+			changed = append(changed, "name")
+		}
+	}
+	if input.Description != nil {
+		desc := validation.TrimAndLimit(*input.Description, 255)
+		if desc != group.Description {
+			group.Description = desc
+			changed = append(changed, "description")
+		}
+	}
+
+	isPublic := group.IsPublic
+	if input.IsPublic != nil {
+		isPublic = *input.IsPublic
+	}
+	if isPublic {
+		handle := ""
+		if group.Handle != nil {
+			handle = *group.Handle
+		}
+		if input.Handle != nil {
+			handle = *input.Handle
+		}
+		normalized, err := s.checkHandleAvailable(handle, group.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if group.Handle == nil || *group.Handle != normalized {
+			group.Handle = &normalized
+			changed = append(changed, "handle")
+		}
+	} else {
+		if input.Handle != nil && *input.Handle != "" {
+			return nil, nil, ErrInvalidGroupHandle
+		}
+		// Private groups have no handle; release it for others.
+		if group.Handle != nil {
+			group.Handle = nil
+			changed = append(changed, "handle")
+		}
+	}
+	if isPublic != group.IsPublic {
+		group.IsPublic = isPublic
+		changed = append(changed, "is_public")
+	}
+	if input.JoinRequiresApproval != nil && *input.JoinRequiresApproval != group.JoinRequiresApproval {
+		group.JoinRequiresApproval = *input.JoinRequiresApproval
+		changed = append(changed, "join_requires_approval")
+	}
+	if input.SlowModeSeconds != nil && *input.SlowModeSeconds != group.SlowModeSeconds {
+		group.SlowModeSeconds = *input.SlowModeSeconds
+		changed = append(changed, "slow_mode_seconds")
+	}
+	if input.IsForum != nil && *input.IsForum != group.IsForum {
+		if *input.IsForum && group.IsChannel() {
+			return nil, nil, ErrInvalidGroupType
+		}
+		group.IsForum = *input.IsForum
+		changed = append(changed, "is_forum")
+	}
+	if input.MessageTTLSeconds != nil || input.MessageTTLMode != nil {
+		seconds, mode := group.MessageTTLSeconds, group.MessageTTLMode
+		if input.MessageTTLSeconds != nil {
+			seconds = *input.MessageTTLSeconds
+		}
+		if input.MessageTTLMode != nil {
+			mode = *input.MessageTTLMode
+		}
+		mode, err := normalizeMessageTTL(seconds, mode)
+		if err != nil {
+			return nil, nil, err
+		}
+		if seconds != group.MessageTTLSeconds {
+			group.MessageTTLSeconds = seconds
+			changed = append(changed, "message_ttl_seconds")
+		}
+		if mode != group.MessageTTLMode {
+			group.MessageTTLMode = mode
+			changed = append(changed, "message_ttl_mode")
+		}
+	}
+
+	if len(changed) == 0 {
+		return group, nil, nil
+	}
+	if err := s.groupRepo.Update(group); err != nil {
+		return nil, nil, err
+	}
+	s.recordEvent(group.ID, models.SystemEvent{
+		Action:  models.SystemGroupUpdated,
+		ActorID: actorID,
+		Changes: changed,
+		Name:    group.Name,
+	})
+	return group, changed, nil
+}
+
+// checkHandleAvailable normalizes a public group handle and verifies no user
+// or other group (besides groupID) uses it.
+func (s *GroupService) checkHandleAvailable(handle string, groupID uint) (string, error) {
+	if handle == "" {
+		return "", ErrGroupHandleRequired
+	}
+	if s.userRepo == nil {
+		return "", errors.New("user repository not configured")
+	}
+	normalized := validation.NormalizeHandle(handle)
+	if !validation.ValidateHandle(normalized) {
+		return "", ErrInvalidGroupHandle
+	}
+	// Ensure handle not used by a user
+	if _, err := s.userRepo.FindByUsername(normalized); err == nil {
+		return "", ErrGroupHandleTaken
+	}
+	// Ensure handle not used by another group
+	if existing, err := s.groupRepo.FindByHandle(normalized); err == nil && existing.ID != groupID {
+		return "", ErrGroupHandleTaken
+	}
+	return normalized, nil
+}
+
+// JoinGroup adds the user to a public group. If the group requires approval
+// a join request is filed (or the open one reused) and returned instead.
+func (s *GroupService) JoinGroup(groupID, userID uint) (*models.GroupJoinRequest, error) {
+	group, err := s.groupRepo.FindByID(groupID)
+	if err != nil {
+		return nil, err
 	}
 	if !group.IsPublic {
-		return errors.New("group is private")
+		return nil, errors.New("group is private")
 	}
 
 	// Check if already a member
 	isMember, err := s.groupRepo.IsMember(groupID, userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if isMember {
-		return errors.New("user is already a member of this group")
+		return nil, errors.New("user is already a member of this group")
+	}
+	if err := s.checkNotBanned(groupID, userID); err != nil {
+		return nil, err
+	}
+	if group.JoinRequiresApproval {
+		return s.requestToJoin(groupID, userID, nil)
 	}
 
-	if err := s.groupRepo.AddMember(groupID, userID, models.RoleMember); err != nil {
-		return err
+	if err := s.addMember(group, userID, models.RoleMember); err != nil {
+		return nil, err
 	}
+	s.admitted(groupID, userID)
+	return nil, nil
+}
+
+// admitted finishes a join: member cache, read state and the timeline entry.
+func (s *GroupService) admitted(groupID, userID uint) {
+	s.membersChanged(groupID)
 	if s.groupReadStateRepo != nil {
 		_ = s.groupReadStateRepo.EnsureForMember(groupID, userID)
 	}
-	return nil
+	s.recordEvent(groupID, models.SystemEvent{Action: models.SystemMemberJoined, ActorID: userID})
 }
 
-func (s *GroupService) JoinGroupByHandle(handle string, userID uint) (*models.Group, error) {
+func (s *GroupService) JoinGroupByHandle(handle string, userID uint) (*models.Group, *models.GroupJoinRequest, error) {
 	if handle == "" {
-		return nil, errors.New("handle is required")
+		return nil, nil, errors.New("handle is required")
 	}
 	group, err := s.groupRepo.FindByHandle(handle)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if !group.IsPublic {
-		return nil, errors.New("group is private")
+		return nil, nil, errors.New("group is private")
 	}
-	if err := s.JoinGroup(group.ID, userID); err != nil {
-		return nil, err
+	req, err := s.JoinGroup(group.ID, userID)
+	if err != nil {
+		return nil, nil, err
 	}
-	return group, nil
+	return group, req, nil
 }
 
 func (s *GroupService) EnsureReadState(groupID, userID uint) {
@@ -134,22 +352,61 @@ func (s *GroupService) EnsureReadState(groupID, userID uint) {
 	_ = s.groupReadStateRepo.EnsureForMember(groupID, userID)
 }
 
+// LeaveGroup removes the user from the group. An owner's leaving hands the
+// group to the longest-standing remaining member; the last member leaving
+// deletes it.
 func (s *GroupService) LeaveGroup(groupID, userID uint) error {
+	role, err := s.roleOf(groupID, userID)
+	if err != nil {
+		return err
+	}
+	var heir *models.GroupMember
+	if role == models.RoleOwner {
+		heir, err = s.groupRepo.FindOldestMember(groupID, userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.deleteGroup(groupID)
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.groupRepo.TransferOwnership(groupID, userID, heir.UserID); err != nil {
+			return err
+		}
+	}
+	if err := s.removeMember(groupID, userID); err != nil {
+		return err
+	}
+	if role != "" {
+		s.recordEvent(groupID, models.SystemEvent{Action: models.SystemMemberLeft, ActorID: userID})
+	}
+	if heir != nil {
+		s.recordEvent(groupID, models.SystemEvent{
+			Action:    models.SystemOwnershipChanged,
+			ActorID:   userID,
+			TargetIDs: []uint{heir.UserID},
+		})
+	}
+	return nil
+}
+
+// removeMember drops the membership and its read state without announcing it.
+func (s *GroupService) removeMember(groupID, userID uint) error {
 	if err := s.groupRepo.RemoveMember(groupID, userID); err != nil {
 		return err
 	}
+	s.membersChanged(groupID)
 	if s.groupReadStateRepo != nil {
 		_ = s.groupReadStateRepo.DeleteForMember(groupID, userID)
 	}
 	return nil
 }
 
-func (s *GroupService) GetGroupMembers(groupID uint) ([]models.User, error) {
-	return s.groupRepo.GetMembers(groupID)
-}
-
 func (s *GroupService) GetUserGroups(userID uint) ([]models.Group, error) {
-	return s.groupRepo.GetUserGroups(userID)
+	groups, err := s.groupRepo.GetUserGroups(userID)
+	if err != nil {
+		return nil, err
+	}
+	return groups, s.fillMemberCounts(groups)
 }
 
 func (s *GroupService) GetGroup(groupID uint) (*models.Group, error) {
@@ -164,63 +421,160 @@ func (s *GroupService) GetPublicGroupByHandle(handle string) (*models.Group, err
 	if !group.IsPublic {
 		return nil, errors.New("group is private")
 	}
-	return group, nil
+	return group, s.fillMemberCount(group)
 }
 
 func (s *GroupService) SearchPublicGroups(query string, limit int) ([]models.Group, error) {
-	return s.groupRepo.SearchPublicGroups(query, limit)
+	groups, err := s.groupRepo.SearchPublicGroups(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return groups, s.fillMemberCounts(groups)
 }
 
 func (s *GroupService) IsMember(groupID, userID uint) (bool, error) {
 	return s.groupRepo.IsMember(groupID, userID)
 }
 
+// IsAdmin reports whether the user is an admin or the owner of the group.
 func (s *GroupService) IsAdmin(groupID, userID uint) (bool, error) {
 	role, err := s.groupRepo.GetMemberRole(groupID, userID)
 	if err != nil {
 		return false, err
 	}
-	return role == models.RoleAdmin, nil
+	return role.IsAdmin(), nil
 }
 
-func (s *GroupService) UpsertReadStateMonotonic(groupID, userID, lastReadMessageID uint) error {
+// Can reports whether the user is a member of the group and their role holds
+// every permission in perm. A zero perm only checks membership.
+func (s *GroupService) Can(groupID, userID uint, perm models.GroupPermission) (bool, error) {
+	err := s.Authorize(groupID, userID, perm)
+	if errors.Is(err, ErrNotGroupMember) || errors.Is(err, ErrGroupPermissionDenied) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Authorize is Can for callers that need to tell non-members
+// (ErrNotGroupMember) from members lacking a permission (ErrGroupPermissionDenied).
+func (s *GroupService) Authorize(groupID, userID uint, perm models.GroupPermission) error {
+	member, err := s.groupRepo.FindMember(groupID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotGroupMember
+		}
+		return err
+	}
+	if !member.Group.PermissionsFor(member.Role).Has(perm) {
+		if member.Group.IsChannel() && perm&models.PermPost != 0 {
+			return ErrChannelAdminOnly
+		}
+		return ErrGroupPermissionDenied
+	}
+	return nil
+}
+
+// UpdatePermissions replaces the group's member and moderator bitmaps.
+// Only admins may change them.
+func (s *GroupService) UpdatePermissions(groupID, actorID uint, member, moderator models.GroupPermission) (*models.Group, error) {
+	if member&^models.PermAll != 0 || moderator&^models.PermAll != 0 {
+		return nil, ErrInvalidGroupPermission
+	}
+	isAdmin, err := s.IsAdmin(groupID, actorID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotGroupMember
+		}
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, ErrGroupPermissionDenied
+	}
+	if err := s.groupRepo.UpdatePermissions(groupID, member, moderator); err != nil {
+		return nil, err
+	}
+	group, err := s.groupRepo.FindByID(groupID)
+	if err != nil {
+		return nil, err
+	}
+	s.recordEvent(groupID, models.SystemEvent{
+		Action:  models.SystemGroupUpdated,
+		ActorID: actorID,
+		Changes: []string{"permissions"},
+		Name:    group.Name,
+	})
+	return group, nil
+}
+
+// UpsertReadStateMonotonic advances the user's read mark in a topic of the
+// group; topicID 0 is the General stream. Disappearing messages that time
+// out after being read start their timers here.
+func (s *GroupService) UpsertReadStateMonotonic(groupID, topicID, userID, lastReadMessageID uint) error {
 	if s.groupReadStateRepo == nil {
 		return nil
 	}
-	return s.groupReadStateRepo.UpsertMonotonic(groupID, userID, lastReadMessageID)
+	if err := s.groupReadStateRepo.UpsertMonotonic(groupID, topicID, userID, lastReadMessageID); err != nil {
+		return err
+	}
+	if s.messageRepo != nil {
+		if err := s.messageRepo.StartGroupReadTimers(groupID, topicID, userID, lastReadMessageID); err != nil {
+			log.Printf("group %d: failed to start read timers: %v", groupID, err)
+		}
+	}
+	return nil
 }
 
-func (s *GroupService) GetReadState(groupID, userID uint) (*models.GroupReadState, error) {
+func (s *GroupService) GetReadState(groupID, topicID, userID uint) (*models.GroupReadState, error) {
+	empty := &models.GroupReadState{GroupID: groupID, UserID: userID, TopicID: topicID, LastReadMessageID: 0}
 	if s.groupReadStateRepo == nil {
-		return &models.GroupReadState{GroupID: groupID, UserID: userID, LastReadMessageID: 0}, nil
+		return empty, nil
 	}
-	state, err := s.groupReadStateRepo.Get(groupID, userID)
+	state, err := s.groupReadStateRepo.Get(groupID, topicID, userID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return &models.GroupReadState{GroupID: groupID, UserID: userID, LastReadMessageID: 0}, nil
+			return empty, nil
 		}
 		return nil, err
 	}
 	return state, nil
 }
 
-func (s *GroupService) ListReadStates(groupID uint) ([]models.GroupReadState, error) {
+// ListReadStates returns the members' read marks in a group topic. A channel
+// subscriber who isn't an admin only gets their own, as the subscriber list
+// is hidden from them.
+func (s *GroupService) ListReadStates(groupID, topicID, viewerID uint) ([]models.GroupReadState, error) {
 	if s.groupReadStateRepo == nil {
 		return []models.GroupReadState{}, nil
 	}
-	return s.groupReadStateRepo.ListByGroup(groupID)
+	hidden := false
+	if err := s.checkMemberListAccess(groupID, viewerID); err != nil {
+		if !errors.Is(err, ErrMemberListHidden) {
+			return nil, err
+		}
+		hidden = true
+	}
+	states, err := s.groupReadStateRepo.ListByGroup(groupID, topicID)
+	if err != nil || !hidden {
+		return states, err
+	}
+	own := states[:0]
+	for _, state := range states {
+		if state.UserID == viewerID {
+			own = append(own, state)
+		}
+	}
+	return own, nil
 }
 
-func (s *GroupService) CreateInviteLink(groupID, creatorID uint, singleUse bool, expiresAt *time.Time) (*models.GroupInviteLink, error) {
+func (s *GroupService) CreateInviteLink(groupID, creatorID uint, singleUse, requiresApproval bool, expiresAt *time.Time) (*models.GroupInviteLink, error) {
 	if s.inviteRepo == nil {
 		return nil, errors.New("invite repository not configured")
 	}
-	// Only admins can create invite links
-	isAdmin, err := s.IsAdmin(groupID, creatorID)
+	allowed, err := s.Can(groupID, creatorID, models.PermManageInvites)
 	if err != nil {
 		return nil, err
 	}
-	if !isAdmin {
+	if !allowed {
 		return nil, errors.New("forbidden")
 	}
 
@@ -237,54 +591,76 @@ func (s *GroupService) CreateInviteLink(groupID, creatorID uint, singleUse bool,
 		ExpiresAt: expiresAt,
 		MaxUses:   maxUses,
 		UsedCount: 0,
+
+		RequiresApproval: requiresApproval,
 	}
 
 	if err := s.inviteRepo.Create(link); err != nil {
 		return nil, err
 	}
+	s.audit(groupID, models.GroupAuditEntry{
+		Action:       models.AuditInviteLinkCreated,
+		ActorID:      creatorID,
+		InviteLinkID: &link.ID,
+	})
 	return link, nil
 }
 
-func (s *GroupService) JoinGroupByInvite(token string, userID uint) (*models.Group, error) {
+// JoinGroupByInvite joins through an invite link. Links that require
+// approval file a join request, which is returned instead.
+func (s *GroupService) JoinGroupByInvite(token string, userID uint) (*models.Group, *models.GroupJoinRequest, error) {
 	if s.inviteRepo == nil {
-		return nil, errors.New("invite repository not configured")
+		return nil, nil, errors.New("invite repository not configured")
 	}
 	link, err := s.inviteRepo.FindByToken(token)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if link.RevokedAt != nil {
-		return nil, errors.New("invite link revoked")
+		return nil, nil, errors.New("invite link revoked")
 	}
 	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
-		return nil, errors.New("invite link expired")
+		return nil, nil, errors.New("invite link expired")
 	}
 	if link.MaxUses != nil && link.UsedCount >= *link.MaxUses {
-		return nil, errors.New("invite link exhausted")
+		return nil, nil, errors.New("invite link exhausted")
 	}
 
 	group, err := s.groupRepo.FindByID(link.GroupID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Check if already a member
 	isMember, err := s.groupRepo.IsMember(group.ID, userID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if !isMember {
-		if err := s.groupRepo.AddMember(group.ID, userID, models.RoleMember); err != nil {
-			return nil, err
+		if err := s.checkNotBanned(group.ID, userID); err != nil {
+			return nil, nil, err
 		}
-		if s.groupReadStateRepo != nil {
-			_ = s.groupReadStateRepo.EnsureForMember(group.ID, userID)
+		if link.RequiresApproval {
+			req, err := s.requestToJoin(group.ID, userID, &link.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			return group, req, nil
 		}
-		if err := s.inviteRepo.IncrementUse(link.ID); err != nil {
-			return nil, err
+		// The checks above are re-done under a row lock so concurrent joins
+		// can't oversubscribe the link.
+		used, err := s.inviteRepo.IncrementUse(link.ID, userID, time.Now(), func(tx *gorm.DB) error {
+			return s.addMemberTx(tx, group, userID, models.RoleMember)
+		})
+		if err != nil {
+			return nil, nil, err
 		}
+		if !used {
+			return nil, nil, errors.New("invite link exhausted")
+		}
+		s.admitted(group.ID, userID)
 	}
-	return group, nil
+	return group, nil, nil
 }
 
 func (s *GroupService) GetInvitePreview(token string) (*models.GroupInviteLink, *models.Group, error) {
@@ -309,7 +685,7 @@ func (s *GroupService) GetInvitePreview(token string) (*models.GroupInviteLink,
 	if err != nil {
 		return nil, nil, err
 	}
-	return link, group, nil
+	return link, group, s.fillMemberCount(group)
 }
 
 func generateInviteToken() string {
@@ -0,0 +1,801 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"github.com/noteduco342/OMMessenger-backend/internal/storage"
+)
+
+func TestGroupService_Can(t *testing.T) {
+	repo := NewMockGroupRepository()
+	svc := NewGroupService(repo, nil, NewMockUserRepository(), nil)
+
+	group, err := svc.CreateGroup("team", "", 1)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	_ = repo.AddMember(group.ID, 2, models.RoleModerator, 0)
+	_ = repo.AddMember(group.ID, 3, models.RoleMember, 0)
+
+	tests := []struct {
+		name   string
+		userID uint
+		perm   models.GroupPermission
+		want   bool
+	}{
+		{"owner has everything", 1, models.PermAll, true},
+		{"member sends", 3, models.PermSendMessages | models.PermSendMedia, true},
+		{"member can't pin", 3, models.PermPinMessages, false},
+		{"moderator deletes", 2, models.PermDeleteMessages, true},
+		{"moderator can't change info", 2, models.PermChangeInfo, false},
+		{"non-member membership check", 4, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.Can(group.ID, tt.userID, tt.perm)
+			if err != nil {
+				t.Fatalf("Can: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Can = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := svc.Authorize(group.ID, 4, 0); !errors.Is(err, ErrNotGroupMember) {
+		t.Fatalf("Authorize non-member err = %v", err)
+	}
+
+	// Read-only group: members lose send rights, moderators keep theirs.
+	if _, err := svc.UpdatePermissions(group.ID, 3, 0, models.PermSendMessages); !errors.Is(err, ErrGroupPermissionDenied) {
+		t.Fatalf("member updating permissions err = %v", err)
+	}
+	if _, err := svc.UpdatePermissions(group.ID, 1, 0, models.PermSendMessages); err != nil {
+		t.Fatalf("UpdatePermissions: %v", err)
+	}
+	if err := svc.Authorize(group.ID, 3, models.PermSendMessages); !errors.Is(err, ErrGroupPermissionDenied) {
+		t.Fatalf("member send after lockdown err = %v", err)
+	}
+	if ok, _ := svc.Can(group.ID, 2, models.PermSendMessages); !ok {
+		t.Fatal("moderator should still send")
+	}
+	if _, err := svc.UpdatePermissions(group.ID, 1, 1<<20, 0); !errors.Is(err, ErrInvalidGroupPermission) {
+		t.Fatalf("unknown bit err = %v", err)
+	}
+}
+
+func TestGroupService_Moderation(t *testing.T) {
+	repo := NewMockGroupRepository()
+	svc := NewGroupService(repo, nil, nil, nil)
+
+	group, err := svc.CreateGroupWithVisibility("public", "", 1, false, "")
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	group.IsPublic = true
+	_ = repo.AddMember(group.ID, 2, models.RoleAdmin, 0)
+	_ = repo.AddMember(group.ID, 3, models.RoleMember, 0)
+	_ = repo.AddMember(group.ID, 4, models.RoleMember, 0)
+
+	// Admins appoint moderators; only the owner appoints admins.
+	if err := svc.SetMemberRole(group.ID, 2, 3, models.RoleModerator); err != nil {
+		t.Fatalf("admin promotes to moderator: %v", err)
+	}
+	if err := svc.SetMemberRole(group.ID, 2, 4, models.RoleAdmin); !errors.Is(err, ErrCannotManageMember) {
+		t.Fatalf("admin promotes to admin err = %v", err)
+	}
+	if err := svc.SetMemberRole(group.ID, 2, 1, models.RoleMember); !errors.Is(err, ErrCannotManageMember) {
+		t.Fatalf("admin demotes owner err = %v", err)
+	}
+	if err := svc.SetMemberRole(group.ID, 1, 4, models.RoleOwner); !errors.Is(err, ErrInvalidGroupRole) {
+		t.Fatalf("grant owner err = %v", err)
+	}
+
+	// Moderators can kick members but not admins.
+	if err := svc.RemoveMember(group.ID, 3, 2); !errors.Is(err, ErrCannotManageMember) {
+		t.Fatalf("moderator kicks admin err = %v", err)
+	}
+	if err := svc.RemoveMember(group.ID, 3, 4); err != nil {
+		t.Fatalf("moderator kicks member: %v", err)
+	}
+	if _, err := svc.JoinGroup(group.ID, 4); err != nil {
+		t.Fatalf("rejoin after kick: %v", err)
+	}
+
+	// A ban removes the member and blocks rejoining until lifted.
+	_, wasMember, err := svc.BanMember(group.ID, 2, 4, "  spam  ", nil)
+	if err != nil || !wasMember {
+		t.Fatalf("ban: wasMember=%v err=%v", wasMember, err)
+	}
+	if ok, _ := svc.IsMember(group.ID, 4); ok {
+		t.Fatal("banned user still a member")
+	}
+	if _, err := svc.JoinGroup(group.ID, 4); !errors.Is(err, ErrGroupBanned) {
+		t.Fatalf("join while banned err = %v", err)
+	}
+	bans, err := svc.ListBans(group.ID, 3)
+	if err != nil || len(bans) != 1 || bans[0].Reason != "spam" {
+		t.Fatalf("ListBans = %+v, %v", bans, err)
+	}
+	if err := svc.UnbanMember(group.ID, 2, 4); err != nil {
+		t.Fatalf("unban: %v", err)
+	}
+	if _, err := svc.JoinGroup(group.ID, 4); err != nil {
+		t.Fatalf("join after unban: %v", err)
+	}
+
+	// Expired bans don't count.
+	past := time.Now().Add(-time.Minute)
+	_ = repo.SaveBan(&models.GroupBan{GroupID: group.ID, UserID: 5, ExpiresAt: &past})
+	if _, err := svc.JoinGroup(group.ID, 5); err != nil {
+		t.Fatalf("join with expired ban: %v", err)
+	}
+}
+
+func TestGroupService_UpdateGroup(t *testing.T) {
+	repo := NewMockGroupRepository()
+	users := NewMockUserRepository()
+	svc := NewGroupService(repo, nil, users, nil)
+
+	group, err := svc.CreateGroupWithVisibility("team", "", 1, true, "team_chat")
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	other, err := svc.CreateGroupWithVisibility("other", "", 1, true, "other_chat")
+	if err != nil {
+		t.Fatalf("create other group: %v", err)
+	}
+	_ = repo.AddMember(group.ID, 2, models.RoleModerator, 0)
+
+	str := func(s string) *string { return &s }
+	no := false
+
+	if _, _, err := svc.UpdateGroup(group.ID, 2, UpdateGroupInput{Name: str("x")}); !errors.Is(err, ErrGroupPermissionDenied) {
+		t.Fatalf("moderator without change-info err = %v", err)
+	}
+
+	updated, changed, err := svc.UpdateGroup(group.ID, 1, UpdateGroupInput{Name: str("  Team  "), Description: str("about")})
+	if err != nil {
+		t.Fatalf("update info: %v", err)
+	}
+	if updated.Name != "Team" || len(changed) != 2 {
+		t.Fatalf("name=%q changed=%v", updated.Name, changed)
+	}
+	if _, _, err := svc.UpdateGroup(group.ID, 1, UpdateGroupInput{Name: str("   ")}); !errors.Is(err, ErrInvalidGroupName) {
+		t.Fatalf("blank name err = %v", err)
+	}
+
+	if _, _, err := svc.UpdateGroup(group.ID, 1, UpdateGroupInput{Handle: str(*other.Handle)}); !errors.Is(err, ErrGroupHandleTaken) {
+		t.Fatalf("taken handle err = %v", err)
+	}
+	// Keeping its own handle isn't a collision.
+	if _, changed, err := svc.UpdateGroup(group.ID, 1, UpdateGroupInput{Handle: str("team_chat")}); err != nil || len(changed) != 0 {
+		t.Fatalf("same handle: changed=%v err=%v", changed, err)
+	}
+
+	updated, changed, err = svc.UpdateGroup(group.ID, 1, UpdateGroupInput{IsPublic: &no})
+	if err != nil {
+		t.Fatalf("make private: %v", err)
+	}
+	if updated.IsPublic || updated.Handle != nil || len(changed) != 2 {
+		t.Fatalf("private group: public=%v handle=%v changed=%v", updated.IsPublic, updated.Handle, changed)
+	}
+	if _, err := repo.FindByHandle("team_chat"); err == nil {
+		t.Fatal("handle should be released")
+	}
+}
+
+type recordingDelivery struct {
+	messages []*models.Message
+}
+
+func (d *recordingDelivery) DeliverGroupMessage(message *models.Message, skipUserID uint) {
+	d.messages = append(d.messages, message)
+}
+
+func TestGroupService_SystemMessages(t *testing.T) {
+	repo := NewMockGroupRepository()
+	delivery := &recordingDelivery{}
+	svc := NewGroupService(repo, nil, nil, nil)
+	svc.EnableSystemMessages(NewMockMessageRepository(), delivery)
+
+	group, err := svc.CreateGroupWithVisibility("team", "", 1, false, "")
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	group.IsPublic = true
+	if _, err := svc.JoinGroup(group.ID, 2); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	if err := svc.SetMemberRole(group.ID, 1, 2, models.RoleModerator); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	// Re-applying the same role isn't an event.
+	if err := svc.SetMemberRole(group.ID, 1, 2, models.RoleModerator); err != nil {
+		t.Fatalf("promote again: %v", err)
+	}
+	if err := svc.RemoveMember(group.ID, 1, 2); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, _, err := svc.BanMember(group.ID, 1, 3, "", nil); err != nil {
+		t.Fatalf("pre-emptive ban: %v", err)
+	}
+	if err := svc.LeaveGroup(group.ID, 2); err != nil {
+		t.Fatalf("leave as non-member: %v", err)
+	}
+
+	want := []models.SystemAction{
+		models.SystemGroupCreated,
+		models.SystemMemberJoined,
+		models.SystemMemberRoleChanged,
+		models.SystemMemberRemoved,
+	}
+	if len(delivery.messages) != len(want) {
+		t.Fatalf("delivered %d system messages, want %d", len(delivery.messages), len(want))
+	}
+	for i, msg := range delivery.messages {
+		if msg.MessageType != models.SystemMessage || msg.System == nil || msg.System.Action != want[i] {
+			t.Fatalf("message %d = %s %+v, want %s", i, msg.MessageType, msg.System, want[i])
+		}
+		if msg.GroupID == nil || *msg.GroupID != group.ID || msg.Content == "" {
+			t.Fatalf("message %d: group=%v content=%q", i, msg.GroupID, msg.Content)
+		}
+	}
+	if role := delivery.messages[2].System; role.Role != models.RoleModerator || role.TargetIDs[0] != 2 {
+		t.Fatalf("role change payload = %+v", role)
+	}
+
+	// Channels only announce changes to the channel itself.
+	delivery.messages = nil
+	channel, err := svc.CreateGroupOfType(models.GroupTypeChannel, "news", "", 1, false, "")
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	_ = repo.AddMember(channel.ID, 2, models.RoleMember, 0)
+	_ = repo.AddMember(channel.ID, 3, models.RoleMember, 0)
+	if err := svc.SetMemberRole(channel.ID, 1, 2, models.RoleAdmin); err != nil {
+		t.Fatalf("promote in channel: %v", err)
+	}
+	if err := svc.RemoveMember(channel.ID, 1, 3); err != nil {
+		t.Fatalf("remove from channel: %v", err)
+	}
+	if _, _, err := svc.BanMember(channel.ID, 1, 2, "", nil); err != nil {
+		t.Fatalf("ban in channel: %v", err)
+	}
+	if len(delivery.messages) != 1 || delivery.messages[0].System.Action != models.SystemGroupCreated {
+		t.Fatalf("channel system messages = %d", len(delivery.messages))
+	}
+}
+
+func TestGroupService_Ownership(t *testing.T) {
+	repo := NewMockGroupRepository()
+	svc := NewGroupService(repo, nil, nil, nil)
+
+	group, err := svc.CreateGroup("team", "", 1)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	_ = repo.AddMember(group.ID, 2, models.RoleAdmin, 0)
+	_ = repo.AddMember(group.ID, 3, models.RoleMember, 0)
+	_ = repo.AddMember(group.ID, 4, models.RoleMember, 0)
+
+	if err := svc.TransferOwnership(group.ID, 2, 3); !errors.Is(err, ErrNotGroupOwner) {
+		t.Fatalf("admin transfer err = %v", err)
+	}
+	if err := svc.TransferOwnership(group.ID, 1, 5); !errors.Is(err, ErrGroupMemberNotFound) {
+		t.Fatalf("transfer to outsider err = %v", err)
+	}
+	if err := svc.TransferOwnership(group.ID, 1, 3); err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if role, _ := repo.GetMemberRole(group.ID, 1); role != models.RoleAdmin {
+		t.Fatalf("previous owner role = %s", role)
+	}
+	if group.OwnerID != 3 {
+		t.Fatalf("owner_id = %d", group.OwnerID)
+	}
+
+	// The owner leaving hands the group to the oldest remaining member.
+	if err := svc.LeaveGroup(group.ID, 3); err != nil {
+		t.Fatalf("owner leaves: %v", err)
+	}
+	if role, _ := repo.GetMemberRole(group.ID, 1); role != models.RoleOwner {
+		t.Fatalf("oldest member role = %s", role)
+	}
+
+	if _, err := svc.DeleteGroup(group.ID, 2); !errors.Is(err, ErrNotGroupOwner) {
+		t.Fatalf("admin delete err = %v", err)
+	}
+	memberIDs, err := svc.DeleteGroup(group.ID, 1)
+	if err != nil || len(memberIDs) != 3 {
+		t.Fatalf("delete: members=%v err=%v", memberIDs, err)
+	}
+	if _, err := svc.GetGroup(group.ID); err == nil {
+		t.Fatal("deleted group still found")
+	}
+
+	// The last member out takes the group with them.
+	solo, _ := svc.CreateGroup("solo", "", 7)
+	if err := svc.LeaveGroup(solo.ID, 7); err != nil {
+		t.Fatalf("last member leaves: %v", err)
+	}
+	if _, err := svc.GetGroup(solo.ID); err == nil {
+		t.Fatal("empty group should be deleted")
+	}
+}
+
+func TestGroupService_DeleteGroupReleasesAttachments(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockGroupRepository()
+	svc := NewGroupService(repo, nil, nil, nil)
+	attachmentRepo := newFakeAttachmentRepo()
+	attachments := NewAttachmentService(attachmentRepo, storage.NewMemoryStorage(), nil, nil)
+	svc.EnableAttachmentCleanup(attachments)
+
+	group, err := svc.CreateGroup("photos", "", 1)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	own, err := attachments.Upload(ctx, 1, "a.pdf", bytes.NewReader([]byte("%PDF-1.4 a")))
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	shared, err := attachments.Upload(ctx, 1, "b.pdf", bytes.NewReader([]byte("%PDF-1.4 b")))
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	// shared was forwarded to a conversation that outlives the group.
+	attachmentRepo.referenced = map[uint]bool{shared.ID: true}
+	repo.groupAttachments = map[uint][]uint{group.ID: {own.ID, shared.ID}}
+
+	if _, err := svc.DeleteGroup(group.ID, 1); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok := attachmentRepo.attachments[own.ID]; ok {
+		t.Fatal("attachment of the deleted group kept")
+	}
+	if _, ok := attachmentRepo.attachments[shared.ID]; !ok {
+		t.Fatal("attachment carried elsewhere deleted")
+	}
+}
+
+func TestGroupService_JoinRequests(t *testing.T) {
+	repo := NewMockGroupRepository()
+	svc := NewGroupService(repo, nil, nil, nil)
+
+	group, err := svc.CreateGroup("club", "", 1)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	group.IsPublic = true
+	group.JoinRequiresApproval = true
+	_ = repo.AddMember(group.ID, 2, models.RoleModerator, 0)
+	_ = repo.AddMember(group.ID, 3, models.RoleMember, 0)
+
+	req, err := svc.JoinGroup(group.ID, 4)
+	if err != nil || req == nil || req.Status != models.JoinRequestPending {
+		t.Fatalf("join = %+v, %v", req, err)
+	}
+	if ok, _ := svc.IsMember(group.ID, 4); ok {
+		t.Fatal("requester admitted before approval")
+	}
+	again, _ := svc.JoinGroup(group.ID, 4)
+	if again == nil || again.ID != req.ID || !req.Filed || again.Filed {
+		t.Fatalf("repeat join should reuse request, got %+v", again)
+	}
+
+	reviewers, _ := svc.JoinRequestReviewers(group.ID)
+	if len(reviewers) != 2 {
+		t.Fatalf("reviewers = %v, want owner and moderator", reviewers)
+	}
+	if _, err := svc.ListJoinRequests(group.ID, 3); !errors.Is(err, ErrGroupPermissionDenied) {
+		t.Fatalf("member lists requests err = %v", err)
+	}
+
+	decided, err := svc.DecideJoinRequest(group.ID, 2, req.ID, true, "")
+	if err != nil || decided.Status != models.JoinRequestApproved {
+		t.Fatalf("approve = %+v, %v", decided, err)
+	}
+	if ok, _ := svc.IsMember(group.ID, 4); !ok {
+		t.Fatal("approved requester not a member")
+	}
+	if _, err := svc.DecideJoinRequest(group.ID, 1, req.ID, false, ""); !errors.Is(err, ErrJoinRequestDecided) {
+		t.Fatalf("decide twice err = %v", err)
+	}
+
+	req, _ = svc.JoinGroup(group.ID, 5)
+	decided, err = svc.DecideJoinRequest(group.ID, 1, req.ID, false, "  not now ")
+	if err != nil || decided.Status != models.JoinRequestDeclined || decided.Reason != "not now" {
+		t.Fatalf("decline = %+v, %v", decided, err)
+	}
+	if ok, _ := svc.IsMember(group.ID, 5); ok {
+		t.Fatal("declined requester is a member")
+	}
+	if pending, _ := svc.ListJoinRequests(group.ID, 1); len(pending) != 0 {
+		t.Fatalf("pending after decisions = %d", len(pending))
+	}
+
+	// A request that can't be carried out stays open.
+	svc.SetMemberLimits(MemberLimits{Group: 4})
+	req, _ = svc.JoinGroup(group.ID, 6)
+	if _, err := svc.DecideJoinRequest(group.ID, 1, req.ID, true, ""); !errors.Is(err, repository.ErrGroupFull) {
+		t.Fatalf("approve into full group err = %v", err)
+	}
+	if pending, _ := svc.ListJoinRequests(group.ID, 1); len(pending) != 1 || pending[0].ID != req.ID || pending[0].DecidedBy != nil {
+		t.Fatalf("pending after failed approval = %+v", pending)
+	}
+}
+
+func TestGroupService_Channels(t *testing.T) {
+	repo := NewMockGroupRepository()
+	svc := NewGroupService(repo, nil, nil, nil)
+
+	if _, err := svc.CreateGroupOfType("forum", "x", "", 1, false, ""); !errors.Is(err, ErrInvalidGroupType) {
+		t.Fatalf("bad type err = %v", err)
+	}
+	channel, err := svc.CreateGroupOfType(models.GroupTypeChannel, "news", "", 1, false, "")
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	_ = repo.AddMember(channel.ID, 2, models.RoleModerator, 0)
+	_ = repo.AddMember(channel.ID, 3, models.RoleMember, 0)
+
+	// Only admins post, whatever the bitmaps grant.
+	if err := svc.Authorize(channel.ID, 1, models.PermSendMessages); err != nil {
+		t.Fatalf("owner posts: %v", err)
+	}
+	for _, uid := range []uint{2, 3} {
+		err := svc.Authorize(channel.ID, uid, models.PermSendMessages)
+		if !errors.Is(err, ErrChannelAdminOnly) || !errors.Is(err, ErrGroupPermissionDenied) {
+			t.Fatalf("user %d posts err = %v", uid, err)
+		}
+	}
+	if err := svc.Authorize(channel.ID, 2, models.PermDeleteMessages); err != nil {
+		t.Fatalf("moderator keeps other rights: %v", err)
+	}
+
+	if _, err := svc.ListMembers(channel.ID, 3, MemberListOptions{}); !errors.Is(err, ErrMemberListHidden) {
+		t.Fatalf("subscriber lists members err = %v", err)
+	}
+	if page, err := svc.ListMembers(channel.ID, 1, MemberListOptions{}); err != nil || len(page.Members) != 3 {
+		t.Fatalf("admin lists members = %+v, %v", page, err)
+	}
+
+	// Read marks would list the subscribers just the same.
+	readStates := &fixedReadStateRepository{states: []models.GroupReadState{
+		{GroupID: channel.ID, UserID: 1}, {GroupID: channel.ID, UserID: 2}, {GroupID: channel.ID, UserID: 3},
+	}}
+	reads := NewGroupService(repo, readStates, nil, nil)
+	if states, err := reads.ListReadStates(channel.ID, 0, 3); err != nil || len(states) != 1 || states[0].UserID != 3 {
+		t.Fatalf("subscriber read states = %+v, %v", states, err)
+	}
+	if states, err := reads.ListReadStates(channel.ID, 0, 1); err != nil || len(states) != 3 {
+		t.Fatalf("admin read states = %+v, %v", states, err)
+	}
+
+	groups, err := svc.GetUserGroups(3)
+	if err != nil || len(groups) != 1 || groups[0].MemberCount != 3 {
+		t.Fatalf("subscriber count: %+v, %v", groups, err)
+	}
+}
+
+// fixedReadStateRepository lists the same read states for every group.
+type fixedReadStateRepository struct {
+	nopReadStateRepository
+	states []models.GroupReadState
+}
+
+func (r *fixedReadStateRepository) ListByGroup(groupID, topicID uint) ([]models.GroupReadState, error) {
+	return slices.Clone(r.states), nil
+}
+
+type mapMemberCache map[uint][]uint
+
+func (c mapMemberCache) GetMemberIDs(groupID uint) ([]uint, bool) {
+	ids, ok := c[groupID]
+	return ids, ok
+}
+
+func (c mapMemberCache) SetMemberIDs(groupID uint, ids []uint) error {
+	c[groupID] = ids
+	return nil
+}
+
+func (c mapMemberCache) InvalidateMemberIDs(groupID uint) error {
+	delete(c, groupID)
+	return nil
+}
+
+func TestGroupService_MemberIDCache(t *testing.T) {
+	repo := NewMockGroupRepository()
+	svc := NewGroupService(repo, nil, NewMockUserRepository(), nil)
+	memberCache := mapMemberCache{}
+	svc.EnableMemberCache(memberCache)
+
+	group, err := svc.CreateGroupWithVisibility("g", "", 1, true, "cached")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if ids, _ := svc.GetMemberIDs(group.ID); len(ids) != 1 {
+		t.Fatalf("members = %v", ids)
+	}
+	if _, ok := memberCache[group.ID]; !ok {
+		t.Fatalf("member IDs not cached")
+	}
+
+	if _, err := svc.JoinGroup(group.ID, 2); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	if ids, _ := svc.GetMemberIDs(group.ID); len(ids) != 2 {
+		t.Fatalf("members after join = %v", ids)
+	}
+	if err := svc.LeaveGroup(group.ID, 2); err != nil {
+		t.Fatalf("leave: %v", err)
+	}
+	if ids, _ := svc.GetMemberIDs(group.ID); len(ids) != 1 {
+		t.Fatalf("members after leave = %v", ids)
+	}
+	if _, err := svc.DeleteGroup(group.ID, 1); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok := memberCache[group.ID]; ok {
+		t.Fatalf("deleted group still cached")
+	}
+}
+
+// memoryRateLimiter is a SendRateLimiter over a fake clock.
+type memoryRateLimiter struct {
+	now   time.Time
+	slots map[[2]uint]time.Time
+	count map[[2]uint]int64
+}
+
+func (l *memoryRateLimiter) TakeSlowModeSlot(groupID, userID uint, interval time.Duration) (time.Duration, error) {
+	key := [2]uint{groupID, userID}
+	if until, ok := l.slots[key]; ok && l.now.Before(until) {
+		return until.Sub(l.now), nil
+	}
+	l.slots[key] = l.now.Add(interval)
+	return 0, nil
+}
+
+func (l *memoryRateLimiter) CountGroupMessage(groupID, userID uint, window time.Duration) (int64, time.Duration, error) {
+	key := [2]uint{groupID, userID}
+	l.count[key]++
+	return l.count[key], window, nil
+}
+
+func TestGroupService_CheckSendRate(t *testing.T) {
+	repo := NewMockGroupRepository()
+	svc := NewGroupService(repo, nil, nil, nil)
+	limiter := &memoryRateLimiter{now: time.Now(), slots: map[[2]uint]time.Time{}, count: map[[2]uint]int64{}}
+	svc.EnableRateLimits(limiter, FloodLimit{Messages: 3, Window: time.Minute})
+
+	group, err := svc.CreateGroup("g", "", 1)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_ = repo.AddMember(group.ID, 2, models.RoleMember, 0)
+
+	bad := -1
+	if _, _, err := svc.UpdateGroup(group.ID, 1, UpdateGroupInput{SlowModeSeconds: &bad}); !errors.Is(err, ErrInvalidSlowMode) {
+		t.Fatalf("negative slow mode err = %v", err)
+	}
+	thirty := 30
+	if _, _, err := svc.UpdateGroup(group.ID, 2, UpdateGroupInput{SlowModeSeconds: &thirty}); !errors.Is(err, ErrGroupPermissionDenied) {
+		t.Fatalf("member sets slow mode err = %v", err)
+	}
+	if _, changed, err := svc.UpdateGroup(group.ID, 1, UpdateGroupInput{SlowModeSeconds: &thirty}); err != nil || len(changed) != 1 {
+		t.Fatalf("admin sets slow mode: %v %v", changed, err)
+	}
+
+	if err := svc.CheckSendRate(group.ID, 2); err != nil {
+		t.Fatalf("first message: %v", err)
+	}
+	var slow *SlowModeError
+	if err := svc.CheckSendRate(group.ID, 2); !errors.As(err, &slow) || slow.RetrySeconds() != 30 {
+		t.Fatalf("second message err = %v", err)
+	}
+	limiter.now = limiter.now.Add(31 * time.Second)
+	if err := svc.CheckSendRate(group.ID, 2); err != nil {
+		t.Fatalf("after interval: %v", err)
+	}
+	// The flood limit applies on top of slow mode.
+	limiter.now = limiter.now.Add(31 * time.Second)
+	if err := svc.CheckSendRate(group.ID, 2); !errors.Is(err, ErrSlowMode) {
+		t.Fatalf("over flood limit err = %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := svc.CheckSendRate(group.ID, 1); err != nil {
+			t.Fatalf("admin message %d: %v", i, err)
+		}
+	}
+	if err := svc.CheckSendRate(group.ID, 9); !errors.Is(err, ErrNotGroupMember) {
+		t.Fatalf("outsider err = %v", err)
+	}
+}
+
+func TestGroupService_MemberLimitsAndPaging(t *testing.T) {
+	repo := NewMockGroupRepository()
+	svc := NewGroupService(repo, nil, NewMockUserRepository(), nil)
+	svc.SetMemberLimits(MemberLimits{Group: 4})
+
+	group, err := svc.CreateGroupWithVisibility("big", "", 1, true, "biggroup")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for uid := uint(2); uid <= 4; uid++ {
+		if _, err := svc.JoinGroup(group.ID, uid); err != nil {
+			t.Fatalf("join %d: %v", uid, err)
+		}
+	}
+	if _, err := svc.JoinGroup(group.ID, 5); !errors.Is(err, ErrGroupFull) {
+		t.Fatalf("join full group err = %v", err)
+	}
+
+	var seen []uint
+	cursor := ""
+	for {
+		page, err := svc.ListMembers(group.ID, 5, MemberListOptions{Cursor: cursor, Limit: 3})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		for _, m := range page.Members {
+			seen = append(seen, m.UserID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(seen) != 4 || seen[0] != 1 || seen[3] != 4 {
+		t.Fatalf("paged members = %v", seen)
+	}
+
+	page, err := svc.ListMembers(group.ID, 1, MemberListOptions{Roles: []models.GroupRole{models.RoleOwner}})
+	if err != nil || len(page.Members) != 1 || page.Members[0].UserID != 1 {
+		t.Fatalf("owner filter = %+v, %v", page, err)
+	}
+	if _, err := svc.ListMembers(group.ID, 1, MemberListOptions{Roles: []models.GroupRole{"king"}}); !errors.Is(err, ErrInvalidGroupRole) {
+		t.Fatalf("bad role err = %v", err)
+	}
+	if _, err := svc.ListMembers(group.ID, 1, MemberListOptions{Cursor: "%%%"}); !errors.Is(err, ErrInvalidMemberCursor) {
+		t.Fatalf("bad cursor err = %v", err)
+	}
+}
+
+func TestGroupService_AuditLog(t *testing.T) {
+	repo := NewMockGroupRepository()
+	svc := NewGroupService(repo, nil, nil, nil)
+	auditRepo := &MockGroupAuditRepository{}
+	svc.EnableAuditLog(auditRepo)
+
+	group, err := svc.CreateGroup("g", "", 1)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_ = repo.AddMember(group.ID, 2, models.RoleMember, 0)
+	_ = repo.AddMember(group.ID, 3, models.RoleMember, 0)
+	if err := svc.SetMemberRole(group.ID, 1, 2, models.RoleModerator); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	if _, _, err := svc.BanMember(group.ID, 2, 3, "spam", nil); err != nil {
+		t.Fatalf("ban: %v", err)
+	}
+	if err := svc.UnbanMember(group.ID, 1, 3); err != nil {
+		t.Fatalf("unban: %v", err)
+	}
+
+	if _, err := svc.ListAuditLog(group.ID, 2, AuditLogFilter{}); !errors.Is(err, ErrGroupPermissionDenied) {
+		t.Fatalf("moderator reads audit log err = %v", err)
+	}
+	page, err := svc.ListAuditLog(group.ID, 1, AuditLogFilter{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var actions []models.GroupAuditAction
+	for _, e := range page.Entries {
+		actions = append(actions, e.Action)
+	}
+	want := []models.GroupAuditAction{models.AuditMemberUnbanned, models.AuditMemberBanned, models.AuditMemberRoleChanged, models.AuditGroupCreated}
+	if !slices.Equal(actions, want) {
+		t.Fatalf("actions = %v, want %v", actions, want)
+	}
+	ban := page.Entries[1]
+	if ban.ActorID != 2 || ban.TargetUserID == nil || *ban.TargetUserID != 3 || ban.Details.Reason != "spam" {
+		t.Fatalf("ban entry = %+v", ban)
+	}
+
+	page, err = svc.ListAuditLog(group.ID, 1, AuditLogFilter{ActorID: 2})
+	if err != nil || len(page.Entries) != 1 || page.Entries[0].Action != models.AuditMemberBanned {
+		t.Fatalf("actor filter = %+v, %v", page, err)
+	}
+	page, err = svc.ListAuditLog(group.ID, 1, AuditLogFilter{Actions: []models.GroupAuditAction{models.AuditMemberRoleChanged}})
+	if err != nil || len(page.Entries) != 1 || page.Entries[0].Details.Role != models.RoleModerator {
+		t.Fatalf("action filter = %+v, %v", page, err)
+	}
+	if _, err := svc.ListAuditLog(group.ID, 1, AuditLogFilter{Actions: []models.GroupAuditAction{"nope"}}); !errors.Is(err, ErrInvalidAuditAction) {
+		t.Fatalf("bad action err = %v", err)
+	}
+}
+
+func TestGroupService_Topics(t *testing.T) {
+	repo := NewMockGroupRepository()
+	delivery := &recordingDelivery{}
+	svc := NewGroupService(repo, nil, nil, nil)
+	svc.EnableSystemMessages(NewMockMessageRepository(), delivery)
+	auditRepo := &MockGroupAuditRepository{}
+	svc.EnableAuditLog(auditRepo)
+
+	group, err := svc.CreateGroup("community", "", 1)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	other, _ := svc.CreateGroup("other", "", 1)
+	_ = repo.AddMember(group.ID, 2, models.RoleMember, 0)
+
+	if _, err := svc.CreateTopic(group.ID, 1, "Releases"); !errors.Is(err, ErrNotForum) {
+		t.Fatalf("topic in plain group err = %v", err)
+	}
+	forum := true
+	if _, _, err := svc.UpdateGroup(group.ID, 2, UpdateGroupInput{IsForum: &forum}); !errors.Is(err, ErrGroupPermissionDenied) {
+		t.Fatalf("member enables forum err = %v", err)
+	}
+	if _, changed, err := svc.UpdateGroup(group.ID, 1, UpdateGroupInput{IsForum: &forum}); err != nil || !slices.Equal(changed, []string{"is_forum"}) {
+		t.Fatalf("enable forum = %v, %v", changed, err)
+	}
+
+	if _, err := svc.CreateTopic(group.ID, 2, "Mine"); !errors.Is(err, ErrGroupPermissionDenied) {
+		t.Fatalf("member creates topic err = %v", err)
+	}
+	if _, err := svc.CreateTopic(group.ID, 1, "   "); !errors.Is(err, ErrInvalidTopicTitle) {
+		t.Fatalf("blank title err = %v", err)
+	}
+	topic, err := svc.CreateTopic(group.ID, 1, " Releases ")
+	if err != nil {
+		t.Fatalf("create topic: %v", err)
+	}
+	if topic.Title != "Releases" {
+		t.Fatalf("title = %q", topic.Title)
+	}
+	last := delivery.messages[len(delivery.messages)-1]
+	if last.TopicID == nil || *last.TopicID != topic.ID || last.System.Action != models.SystemTopicCreated {
+		t.Fatalf("topic_created message = %+v", last)
+	}
+	if entry := auditRepo.entries[len(auditRepo.entries)-1]; entry.Action != models.AuditTopicCreated || entry.TopicID == nil || *entry.TopicID != topic.ID {
+		t.Fatalf("audit entry = %+v", entry)
+	}
+
+	topics, err := svc.ListTopics(group.ID, 2)
+	if err != nil || len(topics) != 1 || topics[0].ID != topic.ID {
+		t.Fatalf("list = %+v, %v", topics, err)
+	}
+	if _, err := svc.ListTopics(group.ID, 3); !errors.Is(err, ErrNotGroupMember) {
+		t.Fatalf("outsider lists topics err = %v", err)
+	}
+	if err := svc.CheckTopic(other.ID, topic.ID); !errors.Is(err, ErrTopicNotFound) {
+		t.Fatalf("topic of another group err = %v", err)
+	}
+	if err := svc.CheckTopicPost(group.ID, topic.ID, 2); err != nil {
+		t.Fatalf("member posts in open topic: %v", err)
+	}
+
+	closed := true
+	if _, changed, err := svc.UpdateTopic(group.ID, topic.ID, 1, UpdateTopicInput{IsClosed: &closed}); err != nil || !slices.Equal(changed, []string{"is_closed"}) {
+		t.Fatalf("close = %v, %v", changed, err)
+	}
+	if err := svc.CheckTopicPost(group.ID, topic.ID, 2); !errors.Is(err, ErrTopicClosed) {
+		t.Fatalf("member posts in closed topic err = %v", err)
+	}
+	if err := svc.CheckTopicPost(group.ID, topic.ID, 1); err != nil {
+		t.Fatalf("admin posts in closed topic: %v", err)
+	}
+}
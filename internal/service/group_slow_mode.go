@@ -0,0 +1,119 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const maxSlowModeSeconds = 3600
+
+var (
+	ErrSlowMode        = errors.New("slow mode")
+	ErrInvalidSlowMode = errors.New("slow mode must be between 0 and 3600 seconds")
+)
+
+// SlowModeError is the ErrSlowMode returned when a member has to wait before
+// posting again, either for the group's slow mode or the flood limit.
+type SlowModeError struct {
+	RetryAfter time.Duration
+}
+
+func (e *SlowModeError) Error() string {
+	return fmt.Sprintf("slow mode: retry in %ds", e.RetrySeconds())
+}
+
+func (e *SlowModeError) Unwrap() error {
+	return ErrSlowMode
+}
+
+// RetrySeconds is RetryAfter rounded up to whole seconds, at least 1.
+func (e *SlowModeError) RetrySeconds() int {
+	secs := int((e.RetryAfter + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
+
+// SendRateLimiter keeps the per-member counters behind slow mode and the
+// flood limit. It is implemented by cache.GroupCache.
+type SendRateLimiter interface {
+	TakeSlowModeSlot(groupID, userID uint, interval time.Duration) (time.Duration, error)
+	CountGroupMessage(groupID, userID uint, window time.Duration) (int64, time.Duration, error)
+}
+
+// FloodLimit caps how many messages a member may send to one group within
+// Window. A zero Messages disables it.
+type FloodLimit struct {
+	Messages int64
+	Window   time.Duration
+}
+
+// DefaultFloodLimit allows 20 messages per member per group every 10 seconds.
+func DefaultFloodLimit() FloodLimit {
+	return FloodLimit{Messages: 20, Window: 10 * time.Second}
+}
+
+// LoadFloodLimitFromEnv reads GROUP_FLOOD_MESSAGES and GROUP_FLOOD_WINDOW
+// overrides on top of the defaults. GROUP_FLOOD_MESSAGES=0 turns it off.
+func LoadFloodLimitFromEnv() FloodLimit {
+	limit := DefaultFloodLimit()
+	if n, err := strconv.ParseInt(os.Getenv("GROUP_FLOOD_MESSAGES"), 10, 64); err == nil && n >= 0 {
+		limit.Messages = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("GROUP_FLOOD_WINDOW")); err == nil && d > 0 {
+		limit.Window = d
+	}
+	return limit
+}
+
+// EnableRateLimits turns on slow mode and flood limiting in CheckSendRate.
+func (s *GroupService) EnableRateLimits(limiter SendRateLimiter, flood FloodLimit) {
+	s.rateLimiter = limiter
+	s.floodLimit = flood
+}
+
+// CheckSendRate counts a message the user is about to post in the group and
+// returns a *SlowModeError if they are over the flood limit or inside the
+// group's slow-mode interval. Admins are exempt. Limiter failures let the
+// message through rather than block the chat.
+func (s *GroupService) CheckSendRate(groupID, userID uint) error {
+	if s.rateLimiter == nil {
+		return nil
+	}
+	member, err := s.groupRepo.FindMember(groupID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotGroupMember
+		}
+		return err
+	}
+	if member.Role.IsAdmin() {
+		return nil
+	}
+
+	if s.floodLimit.Messages > 0 {
+		count, wait, err := s.rateLimiter.CountGroupMessage(groupID, userID, s.floodLimit.Window)
+		if err != nil {
+			log.Printf("group %d: flood counter failed for user %d: %v", groupID, userID, err)
+		} else if count > s.floodLimit.Messages {
+			return &SlowModeError{RetryAfter: wait}
+		}
+	}
+	if member.Group.SlowModeSeconds > 0 {
+		interval := time.Duration(member.Group.SlowModeSeconds) * time.Second
+		wait, err := s.rateLimiter.TakeSlowModeSlot(groupID, userID, interval)
+		if err != nil {
+			log.Printf("group %d: slow mode check failed for user %d: %v", groupID, userID, err)
+		} else if wait > 0 {
+			return &SlowModeError{RetryAfter: wait}
+		}
+	}
+	return nil
+}
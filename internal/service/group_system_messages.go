@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+)
+
+// MessageDelivery pushes a stored group message to the group's members. It is
+// implemented by the websocket layer, which the service can't import.
+type MessageDelivery interface {
+	DeliverGroupMessage(message *models.Message, skipUserID uint)
+}
+
+// EnableSystemMessages makes the service record group events as system
+// messages. The delivery is optional; without it they are only stored and
+// reach clients through history and sync.
+func (s *GroupService) EnableSystemMessages(messageRepo repository.MessageRepositoryInterface, delivery MessageDelivery) {
+	s.messageRepo = messageRepo
+	s.delivery = delivery
+}
+
+// RecordGroupUpdated emits a group_updated system message for changes made
+// outside UpdateGroup, such as icon uploads.
+func (s *GroupService) RecordGroupUpdated(groupID, actorID uint, changes ...string) {
+	if len(changes) == 0 {
+		return
+	}
+	name := ""
+	if group, err := s.groupRepo.FindByID(groupID); err == nil {
+		name = group.Name
+	}
+	s.recordEvent(groupID, models.SystemEvent{
+		Action:  models.SystemGroupUpdated,
+		ActorID: actorID,
+		Changes: changes,
+		Name:    name,
+	})
+}
+
+// emitSystemMessage stores the event in the group's timeline and delivers it
+// to every member, the actor included. Failures are logged rather than
+// returned: the change it describes has already been made.
+func (s *GroupService) emitSystemMessage(groupID uint, event models.SystemEvent) {
+	if s.messageRepo == nil {
+		return
+	}
+	// Channels don't name their subscribers: joins, leaves and every event
+	// with a target stay in the admins' audit log.
+	if event.Action == models.SystemMemberJoined || event.Action == models.SystemMemberLeft || len(event.TargetIDs) > 0 {
+		if group, err := s.groupRepo.FindInfo(groupID); err == nil && group.IsChannel() {
+			return
+		}
+	}
+	message := &models.Message{
+		ClientID:    uuid.NewString(),
+		SenderID:    event.ActorID,
+		GroupID:     &groupID,
+		Content:     systemMessageText(event),
+		MessageType: models.SystemMessage,
+		System:      &event,
+		Status:      models.StatusSent,
+	}
+	if event.TopicID != 0 {
+		message.TopicID = &event.TopicID
+	}
+	if err := s.messageRepo.Create(message); err != nil {
+		log.Printf("group %d: failed to store %s system message: %v", groupID, event.Action, err)
+		return
+	}
+	if s.delivery == nil {
+		return
+	}
+	stored, err := s.messageRepo.FindByID(message.ID)
+	if err != nil {
+		log.Printf("group %d: failed to load system message %d: %v", groupID, message.ID, err)
+		return
+	}
+	s.delivery.DeliverGroupMessage(stored, 0)
+}
+
+// systemMessageText is the plain-text fallback for clients that don't render
+// system payloads. It refers to users by ID; clients resolve names.
+func systemMessageText(e models.SystemEvent) string {
+	targets := make([]string, len(e.TargetIDs))
+	for i, id := range e.TargetIDs {
+		targets[i] = fmt.Sprintf("user %d", id)
+	}
+	target := strings.Join(targets, ", ")
+
+	switch e.Action {
+	case models.SystemGroupCreated:
+		return fmt.Sprintf("user %d created the group %q", e.ActorID, e.Name)
+	case models.SystemMemberJoined:
+		return fmt.Sprintf("user %d joined the group", e.ActorID)
+	case models.SystemMemberLeft:
+		return fmt.Sprintf("user %d left the group", e.ActorID)
+	case models.SystemMemberRemoved:
+		return fmt.Sprintf("user %d removed %s", e.ActorID, target)
+	case models.SystemMemberBanned:
+		return fmt.Sprintf("user %d banned %s", e.ActorID, target)
+	case models.SystemMemberRoleChanged:
+		return fmt.Sprintf("user %d made %s %s", e.ActorID, target, e.Role)
+	case models.SystemOwnershipChanged:
+		return fmt.Sprintf("user %d made %s the owner", e.ActorID, target)
+	case models.SystemGroupUpdated:
+		return fmt.Sprintf("user %d changed the group %s", e.ActorID, strings.Join(e.Changes, ", "))
+	case models.SystemTopicCreated:
+		return fmt.Sprintf("user %d created the topic %q", e.ActorID, e.Name)
+	case models.SystemTopicEdited:
+		return fmt.Sprintf("user %d changed the topic %s", e.ActorID, strings.Join(e.Changes, ", "))
+	default:
+		return string(e.Action)
+	}
+}
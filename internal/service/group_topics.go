@@ -0,0 +1,168 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+const maxTopicTitleLength = 128
+
+var (
+	ErrNotForum          = errors.New("group is not a forum")
+	ErrTopicNotFound     = errors.New("topic not found")
+	ErrTopicClosed       = errors.New("topic is closed")
+	ErrInvalidTopicTitle = errors.New("invalid topic title")
+)
+
+// UpdateTopicInput holds the topic fields to change; nil fields are left alone.
+type UpdateTopicInput struct {
+	Title    *string `json:"title"`
+	IsClosed *bool   `json:"is_closed"`
+}
+
+func normalizeTopicTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" || utf8.RuneCountInString(title) > maxTopicTitleLength {
+		return "", ErrInvalidTopicTitle
+	}
+	return title, nil
+}
+
+// CreateTopic opens a new topic in a forum group. Needs PermManageTopics.
+func (s *GroupService) CreateTopic(groupID, actorID uint, title string) (*models.GroupTopic, error) {
+	title, err := normalizeTopicTitle(title)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Authorize(groupID, actorID, models.PermManageTopics); err != nil {
+		return nil, err
+	}
+	group, err := s.groupRepo.FindInfo(groupID)
+	if err != nil {
+		return nil, err
+	}
+	if !group.IsForum {
+		return nil, ErrNotForum
+	}
+
+	topic := &models.GroupTopic{GroupID: groupID, Title: title, CreatorID: actorID}
+	if err := s.groupRepo.CreateTopic(topic); err != nil {
+		return nil, err
+	}
+	s.recordEvent(groupID, models.SystemEvent{
+		Action:  models.SystemTopicCreated,
+		ActorID: actorID,
+		Name:    topic.Title,
+		TopicID: topic.ID,
+	})
+	return topic, nil
+}
+
+// UpdateTopic renames, closes or reopens a topic. Needs PermManageTopics.
+// It returns the topic and the JSON names of the fields that changed.
+func (s *GroupService) UpdateTopic(groupID, topicID, actorID uint, input UpdateTopicInput) (*models.GroupTopic, []string, error) {
+	if err := s.Authorize(groupID, actorID, models.PermManageTopics); err != nil {
+		return nil, nil, err
+	}
+	topic, err := s.findTopic(groupID, topicID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changed []string
+	if input.Title != nil {
+		title, err := normalizeTopicTitle(*input.Title)
+		if err != nil {
+			return nil, nil, err
+		}
+		if title != topic.Title {
+			topic.Title = title
+			changed = append(changed, "title")
+		}
+	}
+	if input.IsClosed != nil && *input.IsClosed != topic.IsClosed {
+		topic.IsClosed = *input.IsClosed
+		changed = append(changed, "is_closed")
+	}
+	if len(changed) == 0 {
+		return topic, nil, nil
+	}
+
+	if err := s.groupRepo.UpdateTopic(topic); err != nil {
+		return nil, nil, err
+	}
+	s.recordEvent(groupID, models.SystemEvent{
+		Action:  models.SystemTopicEdited,
+		ActorID: actorID,
+		Changes: changed,
+		Name:    topic.Title,
+		TopicID: topic.ID,
+	})
+	return topic, changed, nil
+}
+
+// ListTopics returns the group's topics, most recently active first.
+func (s *GroupService) ListTopics(groupID, viewerID uint) ([]models.GroupTopic, error) {
+	if err := s.Authorize(groupID, viewerID, 0); err != nil {
+		return nil, err
+	}
+	return s.groupRepo.ListTopics(groupID)
+}
+
+// CheckTopic verifies that topicID names a topic of the group; 0, the General
+// stream, always does.
+func (s *GroupService) CheckTopic(groupID, topicID uint) error {
+	if topicID == 0 {
+		return nil
+	}
+	_, err := s.findTopic(groupID, topicID)
+	return err
+}
+
+// CheckTopicPost verifies the user may post in the topic: the group must
+// still be a forum, and closed topics only take posts from members holding
+// PermManageTopics. Group-wide send permissions are checked by Authorize.
+func (s *GroupService) CheckTopicPost(groupID, topicID, userID uint) error {
+	if topicID == 0 {
+		return nil
+	}
+	topic, err := s.findTopic(groupID, topicID)
+	if err != nil {
+		return err
+	}
+	group, err := s.groupRepo.FindInfo(groupID)
+	if err != nil {
+		return err
+	}
+	if !group.IsForum {
+		return ErrNotForum
+	}
+	if topic.IsClosed {
+		allowed, err := s.Can(groupID, userID, models.PermManageTopics)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrTopicClosed
+		}
+	}
+	return nil
+}
+
+func (s *GroupService) findTopic(groupID, topicID uint) (*models.GroupTopic, error) {
+	topic, err := s.groupRepo.FindTopic(topicID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTopicNotFound
+		}
+		return nil, err
+	}
+	if topic.GroupID != groupID {
+		return nil, ErrTopicNotFound
+	}
+	return topic, nil
+}
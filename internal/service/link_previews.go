@@ -0,0 +1,376 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"github.com/noteduco342/OMMessenger-backend/internal/richtext"
+	"github.com/noteduco342/OMMessenger-backend/internal/storage"
+	"github.com/noteduco342/OMMessenger-backend/internal/unfurl"
+)
+
+const (
+	linkPreviewKeyPrefix   = "previews/"
+	linkPreviewImageMaxDim = 1024
+	// linkPreviewImageMaxPixels bounds the images decoded at all; a small
+	// file can declare dimensions that take gigabytes to decode.
+	linkPreviewImageMaxPixels = 4096 * 4096
+)
+
+// LinkPreviewCache keeps unfurled previews by URL, including the absence of
+// one. It is implemented by cache.LinkPreviewCache.
+type LinkPreviewCache interface {
+	GetLinkPreview(url string) (*models.LinkPreview, bool)
+	SetLinkPreview(url string, preview *models.LinkPreview, ttl time.Duration) error
+}
+
+// LinkPreviewDelivery tells clients a message gained a link preview. The
+// websocket layer implements it and invalidates the cached conversations.
+type LinkPreviewDelivery interface {
+	DeliverMessageUpdated(message *models.Message)
+}
+
+// LinkPreviewConfig controls link unfurling.
+type LinkPreviewConfig struct {
+	Enabled bool
+	// Workers fetch pages concurrently; QueueSize messages may wait for one,
+	// beyond which new messages go without a preview.
+	Workers   int
+	QueueSize int
+	// Timeout bounds each request, redirects included.
+	Timeout time.Duration
+	// MaxPageBytes of a page are read; the head comes first, so the rest
+	// isn't needed. Larger images are skipped.
+	MaxPageBytes  int64
+	MaxImageBytes int64
+	// CacheTTL keeps a preview, and the stored image it references, for
+	// reuse; keep it below MEDIA_GC_GRACE. FailureTTL keeps the absence of
+	// one, so a failing site isn't fetched for every message.
+	CacheTTL   time.Duration
+	FailureTTL time.Duration
+	// PublicAPIBaseURL prefixes the preview image URLs; without it they are
+	// relative to the host, under /api.
+	PublicAPIBaseURL string
+}
+
+func DefaultLinkPreviewConfig() LinkPreviewConfig {
+	return LinkPreviewConfig{
+		Enabled:       true,
+		Workers:       4,
+		QueueSize:     256,
+		Timeout:       5 * time.Second,
+		MaxPageBytes:  512 * 1024,
+		MaxImageBytes: 5 * 1024 * 1024,
+		CacheTTL:      12 * time.Hour,
+		FailureTTL:    time.Hour,
+	}
+}
+
+// LoadLinkPreviewConfigFromEnv reads LINK_PREVIEW_* and PUBLIC_API_BASE_URL
+// on top of the defaults.
+func LoadLinkPreviewConfigFromEnv() LinkPreviewConfig {
+	cfg := DefaultLinkPreviewConfig()
+	if b, err := strconv.ParseBool(os.Getenv("LINK_PREVIEW_ENABLED")); err == nil {
+		cfg.Enabled = b
+	}
+	if n, err := strconv.Atoi(os.Getenv("LINK_PREVIEW_WORKERS")); err == nil && n > 0 {
+		cfg.Workers = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LINK_PREVIEW_TIMEOUT")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("LINK_PREVIEW_CACHE_TTL")); err == nil && d > 0 {
+		cfg.CacheTTL = d
+	}
+	cfg.PublicAPIBaseURL = strings.TrimRight(strings.TrimSpace(os.Getenv("PUBLIC_API_BASE_URL")), "/")
+	return cfg
+}
+
+type linkPreviewJob struct {
+	messageID uint
+	url       string
+}
+
+// LinkPreviewService unfurls the first link of new messages: it fetches the
+// page, reads its OpenGraph and Twitter card tags and stores a copy of its
+// image. Previews are attached after the message is sent and announced with a
+// message_updated event, except for cached ones, which new messages get
+// straight away.
+type LinkPreviewService struct {
+	messageRepo repository.MessageRepositoryInterface
+	fetcher     unfurl.Fetcher
+	store       storage.BlobStore
+	cache       LinkPreviewCache
+	delivery    LinkPreviewDelivery
+	cfg         LinkPreviewConfig
+	jobs        chan linkPreviewJob
+}
+
+// NewLinkPreviewService wires link previews. store may be nil when storage
+// isn't configured, and previews then go without images; cache may be nil.
+func NewLinkPreviewService(
+	messageRepo repository.MessageRepositoryInterface,
+	fetcher unfurl.Fetcher,
+	store storage.BlobStore,
+	cache LinkPreviewCache,
+	cfg LinkPreviewConfig,
+) *LinkPreviewService {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 256
+	}
+	return &LinkPreviewService{
+		messageRepo: messageRepo,
+		fetcher:     fetcher,
+		store:       store,
+		cache:       cache,
+		cfg:         cfg,
+		jobs:        make(chan linkPreviewJob, cfg.QueueSize),
+	}
+}
+
+// EnableDelivery sends message_updated events for new previews.
+func (s *LinkPreviewService) EnableDelivery(delivery LinkPreviewDelivery) {
+	s.delivery = delivery
+}
+
+// Start runs the unfurl workers until ctx is cancelled.
+func (s *LinkPreviewService) Start(ctx context.Context) {
+	if !s.cfg.Enabled {
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < s.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-s.jobs:
+					s.process(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// prepare picks the link a new message should preview. A cached preview is
+// attached to the message right away; otherwise the link is returned, to be
+// queued once the message is stored.
+func (s *LinkPreviewService) prepare(message *models.Message) string {
+	if !s.cfg.Enabled || message.IsEncrypted || message.MessageType == models.SystemMessage {
+		return ""
+	}
+	url := previewURL(message.Content, message.Entities)
+	if url == "" {
+		return ""
+	}
+	if s.cache != nil {
+		if preview, ok := s.cache.GetLinkPreview(url); ok {
+			message.LinkPreview = preview
+			return ""
+		}
+	}
+	return url
+}
+
+// enqueue queues the message for unfurling, unless the queue is full.
+func (s *LinkPreviewService) enqueue(messageID uint, url string) {
+	select {
+	case s.jobs <- linkPreviewJob{messageID: messageID, url: url}:
+	default:
+		log.Printf("[link-preview] queue full, skipping message %d", messageID)
+	}
+}
+
+func (s *LinkPreviewService) process(ctx context.Context, job linkPreviewJob) {
+	var preview *models.LinkPreview
+	var ok bool
+	if s.cache != nil {
+		preview, ok = s.cache.GetLinkPreview(job.url)
+	}
+	if !ok {
+		fetchCtx, cancel := context.WithTimeout(ctx, 3*s.cfg.Timeout)
+		var err error
+		preview, err = s.Unfurl(fetchCtx, job.url)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("[link-preview] message %d: %v", job.messageID, err)
+		}
+		if s.cache != nil {
+			ttl := s.cfg.CacheTTL
+			if preview == nil {
+				ttl = s.cfg.FailureTTL
+			}
+			_ = s.cache.SetLinkPreview(job.url, preview, ttl)
+		}
+	}
+	if preview == nil {
+		return
+	}
+
+	updated, err := s.messageRepo.SetLinkPreview(job.messageID, preview)
+	if err != nil {
+		log.Printf("[link-preview] message %d: failed to save preview: %v", job.messageID, err)
+		return
+	}
+	if !updated || s.delivery == nil {
+		return
+	}
+	message, err := s.messageRepo.FindByID(job.messageID)
+	if err != nil {
+		log.Printf("[link-preview] message %d: failed to reload: %v", job.messageID, err)
+		return
+	}
+	s.delivery.DeliverMessageUpdated(message)
+}
+
+// Unfurl fetches rawURL and builds its preview. It returns nil without an
+// error when the link isn't an HTML page or the page has no title or
+// description. A page whose image can't be fetched gets a preview without one.
+func (s *LinkPreviewService) Unfurl(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	res, err := s.fetcher.Fetch(ctx, rawURL, s.cfg.MaxPageBytes, true)
+	if err != nil {
+		return nil, err
+	}
+	if res.ContentType != "text/html" && res.ContentType != "application/xhtml+xml" {
+		return nil, nil
+	}
+	page := unfurl.ParsePage(res.Body, res.Charset, res.URL)
+	if page.Empty() {
+		return nil, nil
+	}
+
+	preview := &models.LinkPreview{
+		URL:         rawURL,
+		SiteName:    page.SiteName,
+		Title:       page.Title,
+		Description: page.Description,
+	}
+	if page.ImageURL != "" && s.store != nil {
+		if err := s.storeImage(ctx, page.ImageURL, preview); err != nil {
+			log.Printf("[link-preview] image %s: %v", page.ImageURL, err)
+		}
+	}
+	return preview, nil
+}
+
+// storeImage runs a page's image through the avatar image pipeline, which
+// re-encodes it without metadata, and stores it under a key derived from its
+// content, so an image shared by many pages is stored once. Images whose
+// header declares more than linkPreviewImageMaxPixels aren't decoded.
+func (s *LinkPreviewService) storeImage(ctx context.Context, imageURL string, preview *models.LinkPreview) error {
+	res, err := s.fetcher.Fetch(ctx, imageURL, s.cfg.MaxImageBytes, false)
+	if err != nil {
+		return err
+	}
+	src, _, err := image.DecodeConfig(bytes.NewReader(res.Body))
+	if err != nil {
+		return err
+	}
+	if int64(src.Width)*int64(src.Height) > linkPreviewImageMaxPixels {
+		return fmt.Errorf("%w: %dx%d pixels", storage.ErrTooLarge, src.Width, src.Height)
+	}
+	opts := storage.DefaultAvatarOptions()
+	opts.MaxBytes = s.cfg.MaxImageBytes
+	opts.MaxDim = linkPreviewImageMaxDim
+	imgBytes, contentType, size, err := storage.ProcessAvatarImage(bytes.NewReader(res.Body), opts)
+	if err != nil {
+		return err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(imgBytes))
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(imgBytes)
+	key := linkPreviewKeyPrefix + hex.EncodeToString(sum[:]) + storage.ExtensionForContentType(contentType)
+	if _, err := s.store.Put(ctx, key, bytes.NewReader(imgBytes), size, contentType); err != nil {
+		return err
+	}
+
+	base := s.cfg.PublicAPIBaseURL
+	if base == "" {
+		base = "/api"
+	}
+	preview.ImageKey = key
+	preview.ImageURL = base + "/media/previews/" + strings.TrimPrefix(key, linkPreviewKeyPrefix)
+	preview.ImageWidth, preview.ImageHeight = cfg.Width, cfg.Height
+	return nil
+}
+
+// bareURLRe finds links typed into message text without a link entity.
+var bareURLRe = regexp.MustCompile(`\bhttps?://[^\s<>"'` + "`" + `]+`)
+
+// previewURL returns the first link of a message: a link entity or an http(s)
+// URL in the text outside code, pre blocks and links.
+func previewURL(content string, entities []models.MessageEntity) string {
+	url, offset := "", -1
+	for _, e := range entities {
+		if e.Type == models.EntityLink && (offset < 0 || e.Offset < offset) {
+			url, offset = e.URL, e.Offset
+		}
+	}
+	for _, m := range bareURLRe.FindAllStringIndex(content, -1) {
+		at := models.UTF16Len(content[:m[0]])
+		if offset >= 0 && at >= offset {
+			break
+		}
+		if insideEntity(entities, at) {
+			continue
+		}
+		if candidate := trimURL(content[m[0]:m[1]]); richtext.ValidURL(candidate) {
+			return candidate
+		}
+	}
+	return url
+}
+
+func insideEntity(entities []models.MessageEntity, at int) bool {
+	for _, e := range entities {
+		if (e.Type == models.EntityCode || e.Type == models.EntityPre || e.Type == models.EntityLink) &&
+			e.Offset <= at && at < e.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// trimURL drops the punctuation that ends the sentence around a URL, and a
+// closing bracket that has no opening one in the URL.
+func trimURL(u string) string {
+	for u != "" {
+		last := u[len(u)-1]
+		switch {
+		case strings.IndexByte(".,:;!?'\"", last) >= 0:
+			u = u[:len(u)-1]
+		case last == ')' && strings.Count(u, "(") < strings.Count(u, ")"),
+			last == ']' && strings.Count(u, "[") < strings.Count(u, "]"):
+			u = u[:len(u)-1]
+		default:
+			return u
+		}
+	}
+	return u
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/storage"
+	"github.com/noteduco342/OMMessenger-backend/internal/unfurl"
+)
+
+// memoryLinkPreviewCache keeps previews in memory; unlike Redis it's only
+// touched from one worker in these tests.
+type memoryLinkPreviewCache struct {
+	entries map[string]*models.LinkPreview
+}
+
+func (c *memoryLinkPreviewCache) GetLinkPreview(url string) (*models.LinkPreview, bool) {
+	p, ok := c.entries[url]
+	return p, ok
+}
+
+func (c *memoryLinkPreviewCache) SetLinkPreview(url string, preview *models.LinkPreview, ttl time.Duration) error {
+	c.entries[url] = preview
+	return nil
+}
+
+type channelPreviewDelivery chan *models.Message
+
+func (d channelPreviewDelivery) DeliverMessageUpdated(message *models.Message) {
+	d <- message
+}
+
+func TestPreviewURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		entities []models.MessageEntity
+		want     string
+	}{
+		{"None", "no links here", nil, ""},
+		{"Bare", "see https://example.com/a.", nil, "https://example.com/a"},
+		{"Parentheses", "(https://en.wikipedia.org/wiki/Go_(game))", nil, "https://en.wikipedia.org/wiki/Go_(game)"},
+		{"In code", "`https://a.example` https://b.example", []models.MessageEntity{{Type: models.EntityCode, Offset: 0, Length: 17}}, "https://b.example"},
+		{"Link entity first", "docs then https://b.example", []models.MessageEntity{{Type: models.EntityLink, Offset: 0, Length: 4, URL: "https://a.example"}}, "https://a.example"},
+		{"Bare before link", "https://b.example then docs", []models.MessageEntity{{Type: models.EntityLink, Offset: 23, Length: 4, URL: "https://a.example"}}, "https://b.example"},
+		{"Not a word boundary", "xhttps://example.com", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := previewURL(tt.content, tt.entities); got != tt.want {
+				t.Errorf("previewURL(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkPreviews(t *testing.T) {
+	var img bytes.Buffer
+	_ = png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 40, 20)))
+
+	var pageHits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			pageHits.Add(1)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<html><head>
+				<meta property="og:title" content="An article">
+				<meta property="og:description" content="What it says">
+				<meta property="og:image" content="/cover.png">
+				</head><body>` + strings.Repeat("x", 4096) + `</body></html>`))
+		case "/cover.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(img.Bytes())
+		case "/file.zip":
+			w.Header().Set("Content-Type", "application/zip")
+			_, _ = w.Write([]byte("PK"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	repo := NewMockMessageRepository()
+	store := storage.NewMemoryStorage()
+	cache := &memoryLinkPreviewCache{entries: make(map[string]*models.LinkPreview)}
+	cfg := DefaultLinkPreviewConfig()
+	cfg.Workers = 1
+	cfg.MaxPageBytes = 1024
+	cfg.PublicAPIBaseURL = "https://api.example.com/api"
+	previews := NewLinkPreviewService(repo, unfurl.NewClientFetcher(srv.Client()), store, cache, cfg)
+	delivered := make(channelPreviewDelivery, 1)
+	previews.EnableDelivery(delivered)
+	messages := NewMessageService(repo)
+	messages.EnableLinkPreviews(previews)
+
+	bob := uint(2)
+	link := srv.URL + "/article"
+	msg, err := messages.CreateWithAttachment(1, "c-1", &bob, nil, nil, "read "+link+"!", nil, models.TextMessage, nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if msg.LinkPreview != nil {
+		t.Fatalf("preview attached before unfurling: %+v", msg.LinkPreview)
+	}
+	// The message waits in the queue until the workers start.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go previews.Start(ctx)
+
+	var updated *models.Message
+	select {
+	case updated = <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message_updated delivery")
+	}
+	p := updated.LinkPreview
+	if updated.ID != msg.ID || p == nil || p.URL != link || p.Title != "An article" || p.Description != "What it says" {
+		t.Fatalf("preview = %+v", p)
+	}
+	if !strings.HasPrefix(p.ImageKey, "previews/") || p.ImageURL != "https://api.example.com/api/media/"+p.ImageKey ||
+		p.ImageWidth != 40 || p.ImageHeight != 20 {
+		t.Fatalf("preview image = %+v", p)
+	}
+	if _, err := store.Stat(ctx, p.ImageKey); err != nil {
+		t.Fatalf("stored image: %v", err)
+	}
+	if resp := updated.ToResponse(); resp.LinkPreview == nil || resp.LinkPreview.ImageURL != p.ImageURL {
+		t.Fatalf("response preview = %+v", resp.LinkPreview)
+	}
+
+	// The cached preview is attached to the next message straight away.
+	again, err := messages.CreateWithAttachment(1, "c-2", &bob, nil, nil, link, nil, models.TextMessage, nil)
+	if err != nil || again.LinkPreview == nil || again.LinkPreview.Title != "An article" || pageHits.Load() != 1 {
+		t.Fatalf("cached preview = %+v, %v, %d fetches", again.LinkPreview, err, pageHits.Load())
+	}
+
+	// Links to anything but a page get no preview.
+	if preview, err := previews.Unfurl(ctx, srv.URL+"/file.zip"); err != nil || preview != nil {
+		t.Fatalf("file preview = %+v, %v", preview, err)
+	}
+}
+
+func TestLinkPreviewImagePixelCap(t *testing.T) {
+	// A 1x1 PNG whose header claims 20000x20000 pixels.
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	huge := buf.Bytes()
+	binary.BigEndian.PutUint32(huge[16:], 20000)
+	binary.BigEndian.PutUint32(huge[20:], 20000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(huge)
+	}))
+	defer srv.Close()
+
+	previews := NewLinkPreviewService(NewMockMessageRepository(), unfurl.NewClientFetcher(srv.Client()),
+		storage.NewMemoryStorage(), nil, DefaultLinkPreviewConfig())
+	var preview models.LinkPreview
+	if err := previews.storeImage(context.Background(), srv.URL+"/huge.png", &preview); !errors.Is(err, storage.ErrTooLarge) {
+		t.Fatalf("storeImage err = %v", err)
+	}
+	if preview.ImageKey != "" {
+		t.Fatalf("preview image = %+v", preview)
+	}
+}
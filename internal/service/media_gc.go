@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"github.com/noteduco342/OMMessenger-backend/internal/storage"
+)
+
+var ErrMediaGCRunning = errors.New("media gc already running")
+
+// MediaGCConfig controls the orphaned media collector.
+type MediaGCConfig struct {
+	// Prefixes are the bucket prefixes that hold DB-referenced media.
+	Prefixes []string
+	// GracePeriod protects objects that were just uploaded but whose DB row
+	// isn't committed yet.
+	GracePeriod time.Duration
+	// Interval between background runs. Zero disables the background loop.
+	Interval time.Duration
+	// DryRun reports candidates without deleting anything.
+	DryRun bool
+	// DeletesPerSecond caps delete calls against the storage backend.
+	DeletesPerSecond int
+	// BatchSize is the number of keys checked against the DB per query.
+	BatchSize int
+	// MaxReportedKeys caps the candidate list returned in a report.
+	MaxReportedKeys int
+}
+
+func DefaultMediaGCConfig() MediaGCConfig {
+	return MediaGCConfig{
+		Prefixes:         []string{"avatars/", "media/", "previews/"},
+		GracePeriod:      24 * time.Hour,
+		Interval:         0,
+		DryRun:           true,
+		DeletesPerSecond: 20,
+		BatchSize:        200,
+		MaxReportedKeys:  500,
+	}
+}
+
+// LoadMediaGCConfigFromEnv reads MEDIA_GC_* overrides on top of the defaults.
+// The collector only deletes when MEDIA_GC_DRY_RUN=false is set explicitly.
+func LoadMediaGCConfigFromEnv() MediaGCConfig {
+	cfg := DefaultMediaGCConfig()
+	if v := strings.TrimSpace(os.Getenv("MEDIA_GC_PREFIXES")); v != "" {
+		cfg.Prefixes = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				cfg.Prefixes = append(cfg.Prefixes, p)
+			}
+		}
+	}
+	if d, err := time.ParseDuration(os.Getenv("MEDIA_GC_GRACE")); err == nil && d > 0 {
+		cfg.GracePeriod = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("MEDIA_GC_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if b, err := strconv.ParseBool(os.Getenv("MEDIA_GC_DRY_RUN")); err == nil {
+		cfg.DryRun = b
+	}
+	if n, err := strconv.Atoi(os.Getenv("MEDIA_GC_DELETES_PER_SEC")); err == nil && n > 0 {
+		cfg.DeletesPerSecond = n
+	}
+	return cfg
+}
+
+// MediaGCReport summarizes a collector run.
+type MediaGCReport struct {
+	StartedAt      time.Time `json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+	DryRun         bool      `json:"dry_run"`
+	Scanned        int       `json:"scanned"`
+	Referenced     int       `json:"referenced"`
+	WithinGrace    int       `json:"within_grace"`
+	Orphaned       int       `json:"orphaned"`
+	Deleted        int       `json:"deleted"`
+	Failed         int       `json:"failed"`
+	OrphanedBytes  int64     `json:"orphaned_bytes"`
+	ReclaimedBytes int64     `json:"reclaimed_bytes"`
+	// Candidates lists orphaned keys (capped by MaxReportedKeys).
+	Candidates []string `json:"candidates"`
+	Truncated  bool     `json:"truncated"`
+}
+
+// MediaGCService deletes stored objects that no DB row references anymore.
+type MediaGCService struct {
+	store   storage.BlobStore
+	refRepo repository.MediaReferenceRepositoryInterface
+	cfg     MediaGCConfig
+	now     func() time.Time
+
+	mu      sync.Mutex
+	running bool
+}
+
+func NewMediaGCService(store storage.BlobStore, refRepo repository.MediaReferenceRepositoryInterface, cfg MediaGCConfig) *MediaGCService {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 200
+	}
+	if cfg.MaxReportedKeys <= 0 {
+		cfg.MaxReportedKeys = 500
+	}
+	return &MediaGCService{store: store, refRepo: refRepo, cfg: cfg, now: time.Now}
+}
+
+// Start runs the collector every cfg.Interval until ctx is cancelled.
+func (s *MediaGCService) Start(ctx context.Context) {
+	if s.cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.Run(ctx, s.cfg.DryRun)
+			if err != nil {
+				log.Printf("[media-gc] run failed: %v", err)
+				continue
+			}
+			log.Printf("[media-gc] scanned=%d orphaned=%d deleted=%d failed=%d dry_run=%v",
+				report.Scanned, report.Orphaned, report.Deleted, report.Failed, report.DryRun)
+		}
+	}
+}
+
+// Run performs one pass over all configured prefixes. With dryRun set nothing
+// is deleted and the report lists what would have been removed.
+func (s *MediaGCService) Run(ctx context.Context, dryRun bool) (*MediaGCReport, error) {
+	if s.store == nil {
+		return nil, ErrStorageNotConfigured
+	}
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return nil, ErrMediaGCRunning
+	}
+	s.running = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	report := &MediaGCReport{StartedAt: s.now().UTC(), DryRun: dryRun, Candidates: []string{}}
+	cutoff := s.now().Add(-s.cfg.GracePeriod)
+
+	var throttle <-chan time.Time
+	if !dryRun && s.cfg.DeletesPerSecond > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(s.cfg.DeletesPerSecond))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	batch := make([]storage.ObjectStat, 0, s.cfg.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() { batch = batch[:0] }()
+		return s.processBatch(ctx, batch, dryRun, throttle, report)
+	}
+
+	for _, prefix := range s.cfg.Prefixes {
+		err := s.store.List(ctx, prefix, func(obj storage.ObjectStat) error {
+			report.Scanned++
+			if obj.LastModified.After(cutoff) {
+				report.WithinGrace++
+				return nil
+			}
+			batch = append(batch, obj)
+			if len(batch) >= s.cfg.BatchSize {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	report.FinishedAt = s.now().UTC()
+	return report, nil
+}
+
+func (s *MediaGCService) processBatch(ctx context.Context, batch []storage.ObjectStat, dryRun bool, throttle <-chan time.Time, report *MediaGCReport) error {
+	keys := make([]string, len(batch))
+	for i, obj := range batch {
+		keys[i] = obj.Key
+	}
+	referenced, err := s.refRepo.ReferencedKeys(keys)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range batch {
+		if referenced[obj.Key] {
+			report.Referenced++
+			continue
+		}
+		report.Orphaned++
+		report.OrphanedBytes += obj.Size
+		if len(report.Candidates) < s.cfg.MaxReportedKeys {
+			report.Candidates = append(report.Candidates, obj.Key)
+		} else {
+			report.Truncated = true
+		}
+		if dryRun {
+			continue
+		}
+
+		if throttle != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-throttle:
+			}
+		}
+		if err := s.store.Delete(ctx, obj.Key); err != nil {
+			log.Printf("[media-gc] delete failed key=%q err=%v", obj.Key, err)
+			report.Failed++
+			continue
+		}
+		report.Deleted++
+		report.ReclaimedBytes += obj.Size
+	}
+	return nil
+}
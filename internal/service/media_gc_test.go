@@ -0,0 +1,75 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/storage"
+)
+
+type fakeMediaReferenceRepo struct {
+	referenced map[string]bool
+}
+
+func (f *fakeMediaReferenceRepo) ReferencedKeys(keys []string) (map[string]bool, error) {
+	out := make(map[string]bool)
+	for _, k := range keys {
+		if f.referenced[k] {
+			out[k] = true
+		}
+	}
+	return out, nil
+}
+
+func TestMediaGCService_Run(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	for _, key := range []string{"avatars/1/live.jpg", "avatars/2/orphan.jpg", "other/untouched.bin"} {
+		if _, err := store.Put(ctx, key, bytes.NewReader([]byte("data")), 4, "image/jpeg"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	refs := &fakeMediaReferenceRepo{referenced: map[string]bool{"avatars/1/live.jpg": true}}
+
+	cfg := DefaultMediaGCConfig()
+	cfg.DeletesPerSecond = 1000
+	gc := NewMediaGCService(store, refs, cfg)
+
+	// Everything was just uploaded: grace period protects it.
+	report, err := gc.Run(ctx, false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.WithinGrace != 2 || report.Deleted != 0 {
+		t.Fatalf("grace report = %+v", report)
+	}
+
+	gc.now = func() time.Time { return time.Now().Add(48 * time.Hour) }
+
+	report, err = gc.Run(ctx, true)
+	if err != nil {
+		t.Fatalf("Run dry: %v", err)
+	}
+	if report.Orphaned != 1 || report.Deleted != 0 || len(report.Candidates) != 1 || report.Candidates[0] != "avatars/2/orphan.jpg" {
+		t.Fatalf("dry-run report = %+v", report)
+	}
+	if _, err := store.Stat(ctx, "avatars/2/orphan.jpg"); err != nil {
+		t.Fatalf("dry run deleted object: %v", err)
+	}
+
+	report, err = gc.Run(ctx, false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Deleted != 1 || report.Referenced != 1 || report.ReclaimedBytes != 4 {
+		t.Fatalf("report = %+v", report)
+	}
+	if _, err := store.Stat(ctx, "avatars/2/orphan.jpg"); err == nil {
+		t.Fatalf("orphan still present")
+	}
+	if _, err := store.Stat(ctx, "other/untouched.bin"); err != nil {
+		t.Fatalf("object outside prefixes was touched: %v", err)
+	}
+}
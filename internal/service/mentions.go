@@ -0,0 +1,241 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/richtext"
+	"gorm.io/gorm"
+)
+
+const maxMentionsPerMessage = 50
+
+var ErrTooManyMentions = errors.New("too many mentions")
+
+// EntityErrorCode names the API error code for message text whose entities,
+// markdown or mentions were rejected.
+func EntityErrorCode(err error) (string, bool) {
+	switch {
+	case errors.Is(err, richtext.ErrInvalidEntities):
+		return "invalid_entities", true
+	case errors.Is(err, richtext.ErrTooManyEntities):
+		return "too_many_entities", true
+	case errors.Is(err, richtext.ErrInvalidParseMode):
+		return "invalid_parse_mode", true
+	case errors.Is(err, ErrTooManyMentions):
+		return "too_many_mentions", true
+	}
+	return "", false
+}
+
+// mentionRe matches @username where the @ doesn't follow a word character,
+// so e-mail addresses aren't taken for mentions.
+var mentionRe = regexp.MustCompile(`(?:^|[^A-Za-z0-9_@])(@([A-Za-z0-9_]{3,32}))\b`)
+
+// mentionAllName is the reserved @all, which mentions every member when an
+// admin sends it.
+const mentionAllName = "all"
+
+// ResolveMentions completes the entities of a group message, already checked
+// by richtext.Validate, with the @usernames in content. Mentions of users
+// outside the group are dropped, and @all only counts when the sender is an
+// admin; otherwise both stay plain text. Names inside code, pre blocks and
+// links aren't mentions.
+func (s *GroupService) ResolveMentions(groupID, senderID uint, content string, entities []models.MessageEntity) ([]models.MessageEntity, error) {
+	// Explicit mentions come first and are checked with the names below.
+	var explicit []uint
+	for _, e := range entities {
+		if e.Type == models.EntityMention {
+			explicit = append(explicit, e.UserID)
+		}
+	}
+	if len(explicit) > maxMentionsPerMessage {
+		return nil, ErrTooManyMentions
+	}
+
+	// spans are the @names found in content; name is empty for @all.
+	type span struct {
+		entity models.MessageEntity
+		name   string
+	}
+	var spans []span
+	names := make(map[string]bool)
+	isAdmin, adminChecked := false, false
+	for _, m := range mentionRe.FindAllStringSubmatchIndex(content, -1) {
+		offset := models.UTF16Len(content[:m[2]])
+		length := models.UTF16Len(content[m[2]:m[3]])
+		if !mentionFits(entities, offset, length) {
+			continue
+		}
+		name := strings.ToLower(content[m[4]:m[5]])
+		if name == mentionAllName {
+			if !adminChecked {
+				var err error
+				if isAdmin, err = s.IsAdmin(groupID, senderID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, err
+				}
+				adminChecked = true
+			}
+			if isAdmin {
+				spans = append(spans, span{entity: models.MessageEntity{Type: models.EntityMentionAll, Offset: offset, Length: length}})
+			}
+			continue
+		}
+		if s.userRepo == nil {
+			continue
+		}
+		names[name] = true
+		spans = append(spans, span{entity: models.MessageEntity{Type: models.EntityMention, Offset: offset, Length: length}, name: name})
+	}
+
+	userIDs := make(map[string]uint, len(names))
+	if len(names) > 0 {
+		users, err := s.userRepo.FindByUsernames(slices.Collect(maps.Keys(names)))
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			userIDs[strings.ToLower(u.Username)] = u.ID
+		}
+	}
+	candidates := slices.Clone(explicit)
+	for _, id := range userIDs {
+		candidates = append(candidates, id)
+	}
+	members := make(map[uint]bool, len(candidates))
+	if len(candidates) > 0 {
+		ids, err := s.groupRepo.FilterMembers(groupID, candidates)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			members[id] = true
+		}
+	}
+
+	resolved := make([]models.MessageEntity, 0, len(entities)+len(spans))
+	mentions := 0
+	add := func(e models.MessageEntity) error {
+		if mentions++; mentions > maxMentionsPerMessage {
+			return ErrTooManyMentions
+		}
+		resolved = append(resolved, e)
+		return nil
+	}
+	for _, e := range entities {
+		if e.Type != models.EntityMention {
+			resolved = append(resolved, e)
+		} else if members[e.UserID] {
+			if err := add(e); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, sp := range spans {
+		e := sp.entity
+		if sp.name != "" {
+			id, ok := userIDs[sp.name]
+			if !ok || !members[id] {
+				continue
+			}
+			e.UserID = id
+		}
+		if err := add(e); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(resolved) == 0 {
+		return nil, nil
+	}
+	richtext.Sort(resolved)
+	return resolved, nil
+}
+
+// mentionFits reports whether a mention may cover the span: entities around
+// it are fine, unless they show their text verbatim or are links, but it
+// can't cut through or contain one.
+func mentionFits(entities []models.MessageEntity, offset, length int) bool {
+	end := offset + length
+	for _, e := range entities {
+		if e.End() <= offset || end <= e.Offset {
+			continue
+		}
+		if e.Type.Verbatim() || e.Type == models.EntityLink || e.Offset > offset || e.End() < end {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutMentions drops mention entities, which only mean something in groups.
+func withoutMentions(entities []models.MessageEntity) []models.MessageEntity {
+	kept := entities[:0]
+	for _, e := range entities {
+		if e.Type != models.EntityMention {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// MentionedUserIDs returns the users the message mentions by name, without
+// the sender. all reports an @all.
+func MentionedUserIDs(message *models.Message) (ids []uint, all bool) {
+	seen := make(map[uint]bool)
+	for _, e := range message.Entities {
+		switch e.Type {
+		case models.EntityMentionAll:
+			all = true
+		case models.EntityMention:
+			if e.UserID != message.SenderID && !seen[e.UserID] {
+				seen[e.UserID] = true
+				ids = append(ids, e.UserID)
+			}
+		}
+	}
+	return ids, all
+}
+
+// RecordMentions stores an unread mention for every user the group message
+// mentions. Failures are logged; the message itself is already sent.
+func (s *GroupService) RecordMentions(message *models.Message) {
+	if s.groupReadStateRepo == nil || message.GroupID == nil {
+		return
+	}
+	var topicID uint
+	if message.TopicID != nil {
+		topicID = *message.TopicID
+	}
+	ids, all := MentionedUserIDs(message)
+	var err error
+	if all {
+		err = s.groupReadStateRepo.AddMentionAll(*message.GroupID, topicID, message.ID, message.SenderID)
+	} else {
+		err = s.groupReadStateRepo.AddMentions(*message.GroupID, topicID, message.ID, ids)
+	}
+	if err != nil {
+		log.Printf("group %d: failed to record mentions of message %d: %v", *message.GroupID, message.ID, err)
+	}
+}
+
+// UnreadMentions returns how many unread mentions the user has in a topic of
+// the group and the oldest of them after afterID, 0 when there is none.
+func (s *GroupService) UnreadMentions(groupID, topicID, userID, afterID uint) (count int64, next uint, err error) {
+	if s.groupReadStateRepo == nil {
+		return 0, 0, nil
+	}
+	if count, err = s.groupReadStateRepo.CountMentions(groupID, topicID, userID); err != nil || count == 0 {
+		return count, 0, err
+	}
+	next, err = s.groupReadStateRepo.NextMention(groupID, topicID, userID, afterID)
+	return count, next, err
+}
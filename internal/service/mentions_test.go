@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/richtext"
+)
+
+// mentionReadStateRepository keeps unread mentions in memory.
+type mentionReadStateRepository struct {
+	nopReadStateRepository
+	mentions map[uint][]uint // user ID -> message IDs
+	all      []uint          // message IDs mentioning everyone
+}
+
+func (r *mentionReadStateRepository) AddMentions(groupID, topicID, messageID uint, userIDs []uint) error {
+	if r.mentions == nil {
+		r.mentions = make(map[uint][]uint)
+	}
+	for _, id := range userIDs {
+		r.mentions[id] = append(r.mentions[id], messageID)
+	}
+	return nil
+}
+
+func (r *mentionReadStateRepository) AddMentionAll(groupID, topicID, messageID, senderID uint) error {
+	r.all = append(r.all, messageID)
+	return nil
+}
+
+func TestResolveMentions(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		_ = userRepo.Create(&models.User{Username: name})
+	}
+	groupRepo := NewMockGroupRepository()
+	readStates := &mentionReadStateRepository{}
+	groups := NewGroupService(groupRepo, readStates, userRepo, nil)
+	group, err := groups.CreateGroup("team", "", 1)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	_ = groupRepo.AddMember(group.ID, 2, models.RoleMember, 0)
+	_ = groupRepo.AddMember(group.ID, 3, models.RoleMember, 0)
+
+	// dave (4) isn't a member; the e-mail address and unknown name stay text.
+	content := "👋 @bob and @dave, mail bob@example.com or @nobody"
+	entities, err := groups.ResolveMentions(group.ID, 1, content, nil)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	want := models.MessageEntity{Type: models.EntityMention, Offset: 3, Length: 4, UserID: 2}
+	if len(entities) != 1 || entities[0] != want {
+		t.Fatalf("entities = %+v", entities)
+	}
+
+	// A mention marked by user ID takes precedence over the name it covers.
+	explicit := []models.MessageEntity{{Type: models.EntityMention, Offset: 0, Length: 5, UserID: 3}}
+	entities, err = groups.ResolveMentions(group.ID, 1, "Carol @bob", explicit)
+	if err != nil || len(entities) != 2 || entities[0].UserID != 3 || entities[1].UserID != 2 {
+		t.Fatalf("explicit entities = %+v, %v", entities, err)
+	}
+
+	// Names in code aren't mentions, formatting around one is kept, and
+	// dave marked by ID is still not a member.
+	formatted := []models.MessageEntity{
+		{Type: models.EntityCode, Offset: 0, Length: 4},
+		{Type: models.EntityBold, Offset: 5, Length: 10},
+		{Type: models.EntityMention, Offset: 16, Length: 4, UserID: 4},
+	}
+	entities, err = groups.ResolveMentions(group.ID, 1, "@bob **@carol** dave", formatted)
+	if err != nil || len(entities) != 3 || entities[0].Type != models.EntityCode ||
+		entities[1].Type != models.EntityBold || entities[2].Type != models.EntityMention || entities[2].UserID != 3 {
+		t.Fatalf("formatted entities = %+v, %v", entities, err)
+	}
+
+	// @all is only a mention when an admin sends it.
+	if entities, err := groups.ResolveMentions(group.ID, 2, "hey @all", nil); err != nil || len(entities) != 0 {
+		t.Fatalf("member @all = %+v, %v", entities, err)
+	}
+	entities, err = groups.ResolveMentions(group.ID, 1, "hey @all", nil)
+	if err != nil || len(entities) != 1 || entities[0].Type != models.EntityMentionAll {
+		t.Fatalf("admin @all = %+v, %v", entities, err)
+	}
+
+	// Names are matched regardless of case, and each mention counts towards
+	// the limit even when it repeats a name.
+	entities, err = groups.ResolveMentions(group.ID, 1, "@Bob @bob", nil)
+	if err != nil || len(entities) != 2 || entities[0].UserID != 2 || entities[1].UserID != 2 {
+		t.Fatalf("repeated entities = %+v, %v", entities, err)
+	}
+	many := strings.Repeat("@bob ", maxMentionsPerMessage) + "@carol"
+	if _, err := groups.ResolveMentions(group.ID, 1, many, nil); !errors.Is(err, ErrTooManyMentions) {
+		t.Fatalf("too many mentions err = %v", err)
+	}
+}
+
+func TestMessageMentionsRecorded(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	for _, name := range []string{"alice", "bob", "carol"} {
+		_ = userRepo.Create(&models.User{Username: name})
+	}
+	groupRepo := NewMockGroupRepository()
+	readStates := &mentionReadStateRepository{}
+	groups := NewGroupService(groupRepo, readStates, userRepo, nil)
+	messages := NewMessageService(NewMockMessageRepository())
+	messages.EnableMentions(groups)
+
+	group, err := groups.CreateGroup("team", "", 1)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	_ = groupRepo.AddMember(group.ID, 2, models.RoleMember, 0)
+
+	msg, err := messages.CreateWithAttachment(1, "c-1", nil, &group.ID, nil, "@alice @bob ping", nil, models.TextMessage, nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if len(msg.Entities) != 2 {
+		t.Fatalf("entities = %+v", msg.Entities)
+	}
+	// The sender mentioning themselves gets no unread mention.
+	if len(readStates.mentions) != 1 || len(readStates.mentions[2]) != 1 || readStates.mentions[2][0] != msg.ID {
+		t.Fatalf("mentions = %+v", readStates.mentions)
+	}
+
+	if _, err := messages.CreateWithAttachment(1, "c-2", nil, &group.ID, nil, "@all standup", nil, models.TextMessage, nil); err != nil || len(readStates.all) != 1 {
+		t.Fatalf("@all = %v, %v", readStates.all, err)
+	}
+
+	if _, err := messages.CreateWithAttachment(1, "c-4", nil, &group.ID, nil, "hi", []models.MessageEntity{{Type: models.EntityBold, Offset: 1, Length: 5}}, models.TextMessage, nil); !errors.Is(err, richtext.ErrInvalidEntities) {
+		t.Fatalf("out of range entity err = %v", err)
+	}
+
+	// Direct messages keep formatting but not mentions.
+	bob := uint(2)
+	dm, err := messages.CreateWithAttachment(1, "c-3", &bob, nil, nil, "@bob hi", []models.MessageEntity{
+		{Type: models.EntityMention, Offset: 0, Length: 4, UserID: 2},
+		{Type: models.EntityItalic, Offset: 5, Length: 2},
+	}, models.TextMessage, nil)
+	if err != nil || len(dm.Entities) != 1 || dm.Entities[0].Type != models.EntityItalic {
+		t.Fatalf("dm entities = %+v, %v", dm.Entities, err)
+	}
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+const (
+	minMessageTTL = 5 * time.Second
+	maxMessageTTL = 365 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidMessageTTL = errors.New("invalid message ttl")
+	ErrSelfConversation  = errors.New("cannot change settings of a conversation with yourself")
+)
+
+// ExpiryDelivery tells clients about messages the reaper deleted. The
+// websocket layer implements it and invalidates the cached conversations.
+type ExpiryDelivery interface {
+	DeliverMessagesDeleted(messages []models.Message)
+}
+
+// MessageExpiryConfig controls the disappearing message reaper.
+type MessageExpiryConfig struct {
+	// Interval between reaper runs; 0 disables the reaper.
+	Interval time.Duration
+	// BatchSize is the number of messages deleted per query.
+	BatchSize int
+}
+
+func DefaultMessageExpiryConfig() MessageExpiryConfig {
+	return MessageExpiryConfig{Interval: 5 * time.Second, BatchSize: 500}
+}
+
+// LoadMessageExpiryConfigFromEnv reads MESSAGE_EXPIRY_INTERVAL on top of the defaults.
+func LoadMessageExpiryConfigFromEnv() MessageExpiryConfig {
+	cfg := DefaultMessageExpiryConfig()
+	if v := os.Getenv("MESSAGE_EXPIRY_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			cfg.Interval = d
+		}
+	}
+	return cfg
+}
+
+// normalizeMessageTTL validates a conversation timer; 0 seconds turns it
+// off. An empty mode means the timer starts at send.
+func normalizeMessageTTL(seconds int, mode models.MessageTTLMode) (models.MessageTTLMode, error) {
+	if mode == "" {
+		mode = models.TTLAfterSend
+	}
+	if !mode.Valid() {
+		return "", ErrInvalidMessageTTL
+	}
+	ttl := time.Duration(seconds) * time.Second
+	if seconds != 0 && (ttl < minMessageTTL || ttl > maxMessageTTL) {
+		return "", ErrInvalidMessageTTL
+	}
+	return mode, nil
+}
+
+// MessageExpiryService implements disappearing messages: it stamps new
+// messages with their conversation's timer and deletes them, with their
+// attachments, once they expire.
+type MessageExpiryService struct {
+	messageRepo  repository.MessageRepositoryInterface
+	groupRepo    repository.GroupRepositoryInterface
+	chatSettings repository.DirectChatSettingsRepositoryInterface
+	userRepo     repository.UserRepositoryInterface
+	attachments  *AttachmentService
+	delivery     ExpiryDelivery
+	cfg          MessageExpiryConfig
+	now          func() time.Time
+}
+
+// NewMessageExpiryService wires disappearing messages. attachments may be nil
+// when storage isn't configured.
+func NewMessageExpiryService(
+	messageRepo repository.MessageRepositoryInterface,
+	groupRepo repository.GroupRepositoryInterface,
+	chatSettings repository.DirectChatSettingsRepositoryInterface,
+	userRepo repository.UserRepositoryInterface,
+	attachments *AttachmentService,
+	cfg MessageExpiryConfig,
+) *MessageExpiryService {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	return &MessageExpiryService{
+		messageRepo:  messageRepo,
+		groupRepo:    groupRepo,
+		chatSettings: chatSettings,
+		userRepo:     userRepo,
+		attachments:  attachments,
+		cfg:          cfg,
+		now:          time.Now,
+	}
+}
+
+// EnableDelivery sends message_deleted events for expired messages.
+func (s *MessageExpiryService) EnableDelivery(delivery ExpiryDelivery) {
+	s.delivery = delivery
+}
+
+// GetDirectSettings returns the settings of the user's conversation with peerID.
+func (s *MessageExpiryService) GetDirectSettings(userID, peerID uint) (*models.DirectChatSettings, error) {
+	return s.chatSettings.Get(userID, peerID)
+}
+
+// SetDirectTTL changes the disappearing message timer of a direct
+// conversation. Either participant may change it; it applies to messages
+// sent afterwards. changed is false when the timer was already set so.
+func (s *MessageExpiryService) SetDirectTTL(userID, peerID uint, seconds int, mode models.MessageTTLMode) (settings *models.DirectChatSettings, changed bool, err error) {
+	if userID == peerID {
+		return nil, false, ErrSelfConversation
+	}
+	mode, err = normalizeMessageTTL(seconds, mode)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := s.userRepo.FindByID(peerID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, ErrUserNotFound
+		}
+		return nil, false, err
+	}
+
+	settings, err = s.chatSettings.Get(userID, peerID)
+	if err != nil {
+		return nil, false, err
+	}
+	if settings.MessageTTLSeconds == seconds && settings.MessageTTLMode == mode {
+		return settings, false, nil
+	}
+	settings.MessageTTLSeconds = seconds
+	settings.MessageTTLMode = mode
+	settings.UpdatedBy = userID
+	if err := s.chatSettings.Save(settings); err != nil {
+		return nil, false, err
+	}
+	return settings, true, nil
+}
+
+// applyTTL stamps a new message with its conversation's timer, starting it
+// now when the timer runs from send time.
+func (s *MessageExpiryService) applyTTL(message *models.Message) error {
+	var seconds int
+	var mode models.MessageTTLMode
+	switch {
+	case message.GroupID != nil:
+		group, err := s.groupRepo.FindInfo(*message.GroupID)
+		if err != nil {
+			return err
+		}
+		seconds, mode = group.MessageTTLSeconds, group.MessageTTLMode
+	case message.RecipientID != nil:
+		settings, err := s.chatSettings.Get(message.SenderID, *message.RecipientID)
+		if err != nil {
+			return err
+		}
+		seconds, mode = settings.MessageTTLSeconds, settings.MessageTTLMode
+	}
+	if seconds <= 0 {
+		return nil
+	}
+
+	message.TTLSeconds = seconds
+	if mode != models.TTLAfterRead {
+		expiresAt := s.now().Add(time.Duration(seconds) * time.Second)
+		message.ExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+// Start deletes expired messages every cfg.Interval until ctx is cancelled.
+func (s *MessageExpiryService) Start(ctx context.Context) {
+	if s.cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ReapExpired(ctx); err != nil {
+				log.Printf("[expiry] reap failed: %v", err)
+			}
+		}
+	}
+}
+
+// ReapExpired deletes every message whose expiry has passed, along with
+// attachments no other message carries, and tells clients. It returns the
+// number of messages deleted.
+func (s *MessageExpiryService) ReapExpired(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		expired, err := s.messageRepo.FindExpired(s.now(), s.cfg.BatchSize)
+		if err != nil || len(expired) == 0 {
+			return total, err
+		}
+		ids := make([]uint, len(expired))
+		for i, m := range expired {
+			ids[i] = m.ID
+		}
+		if err := s.messageRepo.DeleteMessages(ids); err != nil {
+			return total, err
+		}
+		total += len(expired)
+
+		s.deleteAttachments(ctx, expired)
+		if s.delivery != nil {
+			s.delivery.DeliverMessagesDeleted(expired)
+		}
+		if len(expired) < s.cfg.BatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (s *MessageExpiryService) deleteAttachments(ctx context.Context, messages []models.Message) {
+	if s.attachments == nil {
+		return
+	}
+	seen := make(map[uint]bool)
+	for _, m := range messages {
+		if m.AttachmentID == nil || seen[*m.AttachmentID] {
+			continue
+		}
+		seen[*m.AttachmentID] = true
+		if err := s.attachments.DeleteIfUnreferenced(ctx, *m.AttachmentID); err != nil && !errors.Is(err, ErrStorageNotConfigured) {
+			log.Printf("[expiry] delete attachment %d failed: %v", *m.AttachmentID, err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"github.com/noteduco342/OMMessenger-backend/internal/storage"
+)
+
+// MockDirectChatSettingsRepository keeps direct conversation settings in memory.
+type MockDirectChatSettingsRepository struct {
+	settings map[[2]uint]models.DirectChatSettings
+}
+
+func chatKey(a, b uint) [2]uint {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]uint{a, b}
+}
+
+func (m *MockDirectChatSettingsRepository) Get(userID1, userID2 uint) (*models.DirectChatSettings, error) {
+	key := chatKey(userID1, userID2)
+	if s, ok := m.settings[key]; ok {
+		return &s, nil
+	}
+	return &models.DirectChatSettings{UserLowID: key[0], UserHighID: key[1], MessageTTLMode: models.TTLAfterSend}, nil
+}
+
+func (m *MockDirectChatSettingsRepository) Save(settings *models.DirectChatSettings) error {
+	if m.settings == nil {
+		m.settings = make(map[[2]uint]models.DirectChatSettings)
+	}
+	m.settings[chatKey(settings.UserLowID, settings.UserHighID)] = *settings
+	return nil
+}
+
+// nopReadStateRepository accepts read marks without storing them.
+type nopReadStateRepository struct{}
+
+func (nopReadStateRepository) EnsureForMember(groupID, userID uint) error { return nil }
+func (nopReadStateRepository) DeleteForMember(groupID, userID uint) error { return nil }
+func (nopReadStateRepository) UpsertMonotonic(groupID, topicID, userID uint, lastReadMessageID uint) error {
+	return nil
+}
+func (nopReadStateRepository) Get(groupID, topicID, userID uint) (*models.GroupReadState, error) {
+	return &models.GroupReadState{GroupID: groupID, TopicID: topicID, UserID: userID}, nil
+}
+func (nopReadStateRepository) ListByGroup(groupID, topicID uint) ([]models.GroupReadState, error) {
+	return nil, nil
+}
+func (nopReadStateRepository) ListBehind(userID uint) ([]repository.GroupCatchUpRow, error) {
+	return nil, nil
+}
+func (nopReadStateRepository) AddMentions(groupID, topicID, messageID uint, userIDs []uint) error {
+	return nil
+}
+func (nopReadStateRepository) AddMentionAll(groupID, topicID, messageID, senderID uint) error {
+	return nil
+}
+func (nopReadStateRepository) CountMentions(groupID, topicID, userID uint) (int64, error) {
+	return 0, nil
+}
+func (nopReadStateRepository) NextMention(groupID, topicID, userID, afterID uint) (uint, error) {
+	return 0, nil
+}
+
+type recordingExpiryDelivery struct {
+	deleted []models.Message
+}
+
+func (d *recordingExpiryDelivery) DeliverMessagesDeleted(messages []models.Message) {
+	d.deleted = append(d.deleted, messages...)
+}
+
+func TestMessageExpiry_DirectAfterSend(t *testing.T) {
+	ctx := context.Background()
+	userRepo := NewMockUserRepository()
+	_ = userRepo.Create(&models.User{Username: "alice"})
+	_ = userRepo.Create(&models.User{Username: "bob"})
+	messageRepo := NewMockMessageRepository()
+	attachmentRepo := newFakeAttachmentRepo()
+	attachments := NewAttachmentService(attachmentRepo, storage.NewMemoryStorage(), nil, nil)
+	expiry := NewMessageExpiryService(messageRepo, NewMockGroupRepository(), &MockDirectChatSettingsRepository{}, userRepo, attachments, DefaultMessageExpiryConfig())
+	delivery := &recordingExpiryDelivery{}
+	expiry.EnableDelivery(delivery)
+	messages := NewMessageService(messageRepo)
+	messages.EnableExpiry(expiry)
+
+	now := time.Now()
+	expiry.now = func() time.Time { return now }
+
+	for _, tc := range []struct {
+		seconds int
+		mode    models.MessageTTLMode
+	}{{-1, ""}, {1, ""}, {400 * 24 * 3600, ""}, {60, "later"}} {
+		if _, _, err := expiry.SetDirectTTL(1, 2, tc.seconds, tc.mode); !errors.Is(err, ErrInvalidMessageTTL) {
+			t.Errorf("ttl %d %q: err = %v", tc.seconds, tc.mode, err)
+		}
+	}
+	if _, _, err := expiry.SetDirectTTL(1, 99, 60, ""); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("unknown peer err = %v", err)
+	}
+
+	bob := uint(2)
+	before, err := messages.CreateWithAttachment(1, "c-0", &bob, nil, nil, "kept", nil, models.TextMessage, nil)
+	if err != nil || before.ExpiresAt != nil {
+		t.Fatalf("message before timer = %+v, %v", before, err)
+	}
+
+	settings, changed, err := expiry.SetDirectTTL(2, 1, 60, "")
+	if err != nil || !changed || settings.MessageTTLMode != models.TTLAfterSend || settings.UpdatedBy != 2 {
+		t.Fatalf("set ttl = %+v, %v, %v", settings, changed, err)
+	}
+	if _, changed, _ := expiry.SetDirectTTL(1, 2, 60, models.TTLAfterSend); changed {
+		t.Fatalf("same ttl reported as changed")
+	}
+
+	att, err := attachments.Upload(ctx, 1, "secret.pdf", bytes.NewReader([]byte("%PDF-1.4 secret")))
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	msg, err := messages.CreateWithAttachment(1, "c-1", &bob, nil, nil, "gone soon", nil, models.FileMessage, &att.ID)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if msg.TTLSeconds != 60 || msg.ExpiresAt == nil || !msg.ExpiresAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("ttl = %d, expires_at = %v", msg.TTLSeconds, msg.ExpiresAt)
+	}
+
+	if n, err := expiry.ReapExpired(ctx); err != nil || n != 0 {
+		t.Fatalf("early reap = %d, %v", n, err)
+	}
+	now = now.Add(2 * time.Minute)
+	if n, err := expiry.ReapExpired(ctx); err != nil || n != 1 {
+		t.Fatalf("reap = %d, %v", n, err)
+	}
+	if _, err := messageRepo.FindByID(msg.ID); err == nil {
+		t.Fatalf("expired message still stored")
+	}
+	if _, err := messageRepo.FindByID(before.ID); err != nil {
+		t.Fatalf("message without timer deleted: %v", err)
+	}
+	if _, ok := attachmentRepo.attachments[att.ID]; ok {
+		t.Fatalf("attachment of expired message kept")
+	}
+	if len(delivery.deleted) != 1 || delivery.deleted[0].ID != msg.ID {
+		t.Fatalf("deleted events = %+v", delivery.deleted)
+	}
+}
+
+func TestMessageExpiry_GroupAfterRead(t *testing.T) {
+	groupRepo := NewMockGroupRepository()
+	messageRepo := NewMockMessageRepository()
+	groups := NewGroupService(groupRepo, nopReadStateRepository{}, nil, nil)
+	groups.EnableSystemMessages(messageRepo, &recordingDelivery{})
+	expiry := NewMessageExpiryService(messageRepo, groupRepo, &MockDirectChatSettingsRepository{}, nil, nil, DefaultMessageExpiryConfig())
+	messages := NewMessageService(messageRepo)
+	messages.EnableExpiry(expiry)
+
+	group, err := groups.CreateGroup("secret", "", 1)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	_ = groupRepo.AddMember(group.ID, 2, models.RoleMember, 0)
+
+	ttl, mode := 30, models.TTLAfterRead
+	if _, _, err := groups.UpdateGroup(group.ID, 2, UpdateGroupInput{MessageTTLSeconds: &ttl}); !errors.Is(err, ErrGroupPermissionDenied) {
+		t.Fatalf("member sets ttl err = %v", err)
+	}
+	bad := models.MessageTTLMode("never")
+	if _, _, err := groups.UpdateGroup(group.ID, 1, UpdateGroupInput{MessageTTLSeconds: &ttl, MessageTTLMode: &bad}); !errors.Is(err, ErrInvalidMessageTTL) {
+		t.Fatalf("bad mode err = %v", err)
+	}
+	if _, changed, err := groups.UpdateGroup(group.ID, 1, UpdateGroupInput{MessageTTLSeconds: &ttl, MessageTTLMode: &mode}); err != nil || len(changed) != 2 {
+		t.Fatalf("set ttl = %v, %v", changed, err)
+	}
+
+	msg, err := messages.CreateWithAttachment(1, "c-1", nil, &group.ID, nil, "read me", nil, models.TextMessage, nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if msg.TTLSeconds != ttl || msg.ExpiresAt != nil {
+		t.Fatalf("read-mode message ttl = %d, expires_at = %v", msg.TTLSeconds, msg.ExpiresAt)
+	}
+
+	// The sender reading their own message doesn't start the timer.
+	_ = groups.UpsertReadStateMonotonic(group.ID, 0, 1, msg.ID)
+	if got, _ := messageRepo.FindByID(msg.ID); got.ExpiresAt != nil {
+		t.Fatalf("timer started by sender")
+	}
+	_ = groups.UpsertReadStateMonotonic(group.ID, 0, 2, msg.ID)
+	if got, _ := messageRepo.FindByID(msg.ID); got.ExpiresAt == nil {
+		t.Fatalf("timer not started by reader")
+	}
+}
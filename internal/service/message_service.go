@@ -5,42 +5,97 @@ import (
 
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
 	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"github.com/noteduco342/OMMessenger-backend/internal/richtext"
 )
 
 type MessageService struct {
 	messageRepo repository.MessageRepositoryInterface
+	expiry      *MessageExpiryService
+	groups      *GroupService
+	previews    *LinkPreviewService
 }
 
 func NewMessageService(messageRepo repository.MessageRepositoryInterface) *MessageService {
 	return &MessageService{messageRepo: messageRepo}
 }
 
+// EnableExpiry applies conversations' disappearing message timers to new messages.
+func (s *MessageService) EnableExpiry(expiry *MessageExpiryService) {
+	s.expiry = expiry
+}
+
+// EnableMentions resolves the mentions of new group messages and records
+// them as unread mentions of the users named.
+func (s *MessageService) EnableMentions(groups *GroupService) {
+	s.groups = groups
+}
+
+// EnableLinkPreviews unfurls the first link of new messages.
+func (s *MessageService) EnableLinkPreviews(previews *LinkPreviewService) {
+	s.previews = previews
+}
+
+// create stores a new message, with its entities checked and mentions
+// resolved, stamped with its conversation's timer, and reloads it with sender
+// and attachment. Its link preview follows later unless it is cached.
+func (s *MessageService) create(message *models.Message) (*models.Message, error) {
+	entities, err := richtext.Validate(message.Content, message.Entities)
+	if err != nil {
+		return nil, err
+	}
+	if message.GroupID == nil || s.groups == nil {
+		entities = withoutMentions(entities)
+	} else if entities, err = s.groups.ResolveMentions(*message.GroupID, message.SenderID, message.Content, entities); err != nil {
+		return nil, err
+	}
+	message.Entities = entities
+	if s.expiry != nil {
+		if err := s.expiry.applyTTL(message); err != nil {
+			return nil, err
+		}
+	}
+	var previewURL string
+	if s.previews != nil {
+		previewURL = s.previews.prepare(message)
+	}
+	if err := s.messageRepo.Create(message); err != nil {
+		return nil, err
+	}
+	if s.groups != nil && len(message.Entities) > 0 {
+		s.groups.RecordMentions(message)
+	}
+	if previewURL != "" {
+		s.previews.enqueue(message.ID, previewURL)
+	}
+	return s.messageRepo.FindByID(message.ID)
+}
+
 type SendMessageInput struct {
-	RecipientID *uint              `json:"recipient_id"`
-	GroupID     *uint              `json:"group_id"`
-	Content     string             `json:"content"`
-	MessageType models.MessageType `json:"message_type"`
+	RecipientID *uint                  `json:"recipient_id"`
+	GroupID     *uint                  `json:"group_id"`
+	Content     string                 `json:"content"`
+	Entities    []models.MessageEntity `json:"entities"`
+	MessageType models.MessageType     `json:"message_type"`
+	// AttachmentID must reference one of the sender's uploads.
+	AttachmentID *uint `json:"attachment_id"`
 }
 
 func (s *MessageService) SendMessage(senderID uint, input SendMessageInput) (*models.Message, error) {
 	message := &models.Message{
-		SenderID:    senderID,
-		RecipientID: input.RecipientID,
-		GroupID:     input.GroupID,
-		Content:     input.Content,
-		MessageType: input.MessageType,
+		SenderID:     senderID,
+		RecipientID:  input.RecipientID,
+		GroupID:      input.GroupID,
+		Content:      input.Content,
+		Entities:     input.Entities,
+		MessageType:  input.MessageType,
+		AttachmentID: input.AttachmentID,
 	}
 
 	if message.MessageType == "" {
 		message.MessageType = models.TextMessage
 	}
 
-	if err := s.messageRepo.Create(message); err != nil {
-		return nil, err
-	}
-
-	// Load sender info
-	return s.messageRepo.FindByID(message.ID)
+	return s.create(message)
 }
 
 func (s *MessageService) GetConversation(userID1, userID2 uint, limit int) ([]models.Message, error) {
@@ -86,34 +141,36 @@ func (s *MessageService) CreateWithClientID(senderID uint, clientID string, reci
 		Status:      models.StatusSent,
 	}
 
-	if err := s.messageRepo.Create(message); err != nil {
-		return nil, err
-	}
-
-	return s.messageRepo.FindByID(message.ID)
+	return s.create(message)
 }
 
 // CreateWithClientIDAndType creates a message with client ID and message type for deduplication
 func (s *MessageService) CreateWithClientIDAndType(senderID uint, clientID string, recipientID *uint, groupID *uint, content string, messageType models.MessageType) (*models.Message, error) {
+	return s.CreateWithAttachment(senderID, clientID, recipientID, groupID, nil, content, nil, messageType, nil)
+}
+
+// CreateWithAttachment is CreateWithClientIDAndType for messages that carry an
+// uploaded attachment, formatting entities or go to a forum topic. Callers verify the
+// sender owns the attachment and may post in the topic.
+func (s *MessageService) CreateWithAttachment(senderID uint, clientID string, recipientID *uint, groupID *uint, topicID *uint, content string, entities []models.MessageEntity, messageType models.MessageType, attachmentID *uint) (*models.Message, error) {
 	if messageType == "" {
 		messageType = models.TextMessage
 	}
 
 	message := &models.Message{
-		ClientID:    clientID,
-		SenderID:    senderID,
-		RecipientID: recipientID,
-		GroupID:     groupID,
-		Content:     content,
-		MessageType: messageType,
-		Status:      models.StatusSent,
+		ClientID:     clientID,
+		SenderID:     senderID,
+		RecipientID:  recipientID,
+		GroupID:      groupID,
+		TopicID:      topicID,
+		Content:      content,
+		Entities:     entities,
+		MessageType:  messageType,
+		AttachmentID: attachmentID,
+		Status:       models.StatusSent,
 	}
 
-	if err := s.messageRepo.Create(message); err != nil {
-		return nil, err
-	}
-
-	return s.messageRepo.FindByID(message.ID)
+	return s.create(message)
 }
 
 // GetByClientID finds a message by client ID and sender
@@ -129,11 +186,12 @@ func (s *MessageService) GetMessagesSince(requestingUserID uint, conversationID
 	return s.messageRepo.FindMessagesSince(requestingUserID, conversationID, lastMessageID, limit)
 }
 
-func (s *MessageService) GetGroupMessages(groupID uint, cursor uint, limit int) ([]models.Message, error) {
+// GetGroupMessages pages through a group topic; topicID 0 is the General stream.
+func (s *MessageService) GetGroupMessages(groupID, topicID uint, cursor uint, limit int) ([]models.Message, error) {
 	if limit == 0 || limit > 100 {
 		limit = 50
 	}
-	return s.messageRepo.FindGroupMessages(groupID, cursor, limit)
+	return s.messageRepo.FindGroupMessages(groupID, topicID, cursor, limit)
 }
 
 func (s *MessageService) ListGroupConversations(userID uint, cursorCreatedAt *time.Time, cursorMessageID uint, limit int) ([]repository.GroupConversationRow, error) {
@@ -156,16 +214,16 @@ func (s *MessageService) ListConversationsUnified(userID uint, cursorCreatedAt *
 	return s.messageRepo.ListConversationsUnified(userID, cursorCreatedAt, cursorMessageID, limit)
 }
 
-func (s *MessageService) GetLatestGroupMessageID(groupID uint) (uint, error) {
-	return s.messageRepo.GetLatestGroupMessageID(groupID)
+func (s *MessageService) GetLatestGroupMessageID(groupID, topicID uint) (uint, error) {
+	return s.messageRepo.GetLatestGroupMessageID(groupID, topicID)
 }
 
 func (s *MessageService) GetLatestDirectMessageID(userID1, userID2 uint) (uint, error) {
 	return s.messageRepo.GetLatestDirectMessageID(userID1, userID2)
 }
 
-func (s *MessageService) IsMessageInGroup(messageID uint, groupID uint) (bool, error) {
-	return s.messageRepo.IsMessageInGroup(messageID, groupID)
+func (s *MessageService) IsMessageInGroup(messageID uint, groupID, topicID uint) (bool, error) {
+	return s.messageRepo.IsMessageInGroup(messageID, groupID, topicID)
 }
 
 func (s *MessageService) ListDirectConversations(userID uint, cursorCreatedAt *time.Time, cursorMessageID uint, limit int) ([]repository.ConversationRow, error) {
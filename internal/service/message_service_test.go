@@ -9,6 +9,7 @@ import (
 
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
 	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"gorm.io/gorm"
 )
 
 // MockMessageRepository is a mock implementation of MessageRepository for testing
@@ -46,7 +47,7 @@ func (m *MockMessageRepository) FindByClientID(clientID string, senderID uint) (
 			return msg, nil
 		}
 	}
-	return nil, errors.New("record not found")
+	return nil, gorm.ErrRecordNotFound
 }
 
 func (m *MockMessageRepository) FindConversation(userID1, userID2 uint, limit int) ([]models.Message, error) {
@@ -81,14 +82,22 @@ func (m *MockMessageRepository) FindConversationCursor(userID1, userID2 uint, cu
 	return result, nil
 }
 
-func (m *MockMessageRepository) FindGroupMessages(groupID uint, cursor uint, limit int) ([]models.Message, error) {
+// inTopic mirrors the repository's topic filter: topicID 0 is the General stream.
+func inTopic(msg *models.Message, topicID uint) bool {
+	if topicID == 0 {
+		return msg.TopicID == nil
+	}
+	return msg.TopicID != nil && *msg.TopicID == topicID
+}
+
+func (m *MockMessageRepository) FindGroupMessages(groupID, topicID uint, cursor uint, limit int) ([]models.Message, error) {
 	var result []models.Message
 	count := 0
 	for _, msg := range m.messages {
 		if count >= limit {
 			break
 		}
-		if msg.GroupID == nil || *msg.GroupID != groupID {
+		if msg.GroupID == nil || *msg.GroupID != groupID || !inTopic(msg, topicID) {
 			continue
 		}
 		if cursor > 0 && msg.ID >= cursor {
@@ -160,10 +169,10 @@ func (m *MockMessageRepository) ListConversationsUnified(userID uint, cursorCrea
 	return []repository.ConversationUnifiedRow{}, nil
 }
 
-func (m *MockMessageRepository) GetLatestGroupMessageID(groupID uint) (uint, error) {
+func (m *MockMessageRepository) GetLatestGroupMessageID(groupID, topicID uint) (uint, error) {
 	var maxID uint
 	for _, msg := range m.messages {
-		if msg.GroupID != nil && *msg.GroupID == groupID {
+		if msg.GroupID != nil && *msg.GroupID == groupID && inTopic(msg, topicID) {
 			if msg.ID > maxID {
 				maxID = msg.ID
 			}
@@ -172,9 +181,9 @@ func (m *MockMessageRepository) GetLatestGroupMessageID(groupID uint) (uint, err
 	return maxID, nil
 }
 
-func (m *MockMessageRepository) IsMessageInGroup(messageID uint, groupID uint) (bool, error) {
+func (m *MockMessageRepository) IsMessageInGroup(messageID uint, groupID, topicID uint) (bool, error) {
 	if msg, ok := m.messages[messageID]; ok {
-		return msg.GroupID != nil && *msg.GroupID == groupID, nil
+		return msg.GroupID != nil && *msg.GroupID == groupID && inTopic(msg, topicID), nil
 	}
 	return false, nil
 }
@@ -192,6 +201,7 @@ func (m *MockMessageRepository) MarkAsRead(messageID uint) error {
 	if msg, ok := m.messages[messageID]; ok {
 		msg.IsRead = true
 		msg.Status = models.StatusRead
+		startReadTimer(msg)
 		return nil
 	}
 	return errors.New("record not found")
@@ -204,12 +214,56 @@ func (m *MockMessageRepository) MarkConversationAsRead(userID uint, peerID uint)
 		if msg.RecipientID != nil && *msg.RecipientID == userID && msg.SenderID == peerID && !msg.IsRead {
 			msg.IsRead = true
 			msg.Status = models.StatusRead
+			startReadTimer(msg)
 			cleared++
 		}
 	}
 	return cleared, nil
 }
 
+// startReadTimer mirrors the repository: read-mode timers start at first read.
+func startReadTimer(msg *models.Message) {
+	if msg.TTLSeconds > 0 && msg.ExpiresAt == nil {
+		expiresAt := time.Now().Add(time.Duration(msg.TTLSeconds) * time.Second)
+		msg.ExpiresAt = &expiresAt
+	}
+}
+
+func (m *MockMessageRepository) StartGroupReadTimers(groupID, topicID, readerID, upToID uint) error {
+	for _, msg := range m.messages {
+		if msg.GroupID != nil && *msg.GroupID == groupID && inTopic(msg, topicID) && msg.ID <= upToID && msg.SenderID != readerID {
+			startReadTimer(msg)
+		}
+	}
+	return nil
+}
+
+func (m *MockMessageRepository) FindExpired(now time.Time, limit int) ([]models.Message, error) {
+	var result []models.Message
+	for _, msg := range m.messages {
+		if len(result) < limit && msg.ExpiresAt != nil && !msg.ExpiresAt.After(now) {
+			result = append(result, *msg)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockMessageRepository) DeleteMessages(ids []uint) error {
+	for _, id := range ids {
+		delete(m.messages, id)
+	}
+	return nil
+}
+
+func (m *MockMessageRepository) SetLinkPreview(messageID uint, preview *models.LinkPreview) (bool, error) {
+	msg, ok := m.messages[messageID]
+	if !ok {
+		return false, nil
+	}
+	msg.LinkPreview = preview
+	return true, nil
+}
+
 // Tests for MessageService
 
 func TestSendMessage(t *testing.T) {
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"slices"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+)
+
+// MockGroupAuditRepository keeps audit entries in memory for tests.
+type MockGroupAuditRepository struct {
+	entries []models.GroupAuditEntry
+}
+
+func (m *MockGroupAuditRepository) Create(entry *models.GroupAuditEntry) error {
+	entry.ID = uint(len(m.entries) + 1)
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+func (m *MockGroupAuditRepository) List(groupID uint, q repository.AuditQuery) ([]models.GroupAuditEntry, error) {
+	var out []models.GroupAuditEntry
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		e := m.entries[i]
+		if e.GroupID != groupID || (q.ActorID != 0 && e.ActorID != q.ActorID) ||
+			(len(q.Actions) > 0 && !slices.Contains(q.Actions, e.Action)) ||
+			(q.BeforeID != 0 && e.ID >= q.BeforeID) {
+			continue
+		}
+		out = append(out, e)
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+	return out, nil
+}
@@ -2,8 +2,12 @@ package service
 
 import (
 	"errors"
+	"slices"
+	"time"
 
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"gorm.io/gorm"
 )
 
 // MockGroupRepository is a mock implementation for tests
@@ -12,7 +16,15 @@ type MockGroupRepository struct {
 	groups      map[uint]*models.Group
 	handles     map[string]*models.Group
 	memberships map[uint]map[uint]models.GroupRole
+	bans        map[[2]uint]models.GroupBan
+	joinOrder   map[[2]uint]int
+	requests    map[uint]*models.GroupJoinRequest
+	topics      map[uint]*models.GroupTopic
 	nextID      uint
+
+	// groupAttachments are the attachments of each group's messages, which
+	// Delete reports.
+	groupAttachments map[uint][]uint
 }
 
 func NewMockGroupRepository() *MockGroupRepository {
@@ -20,10 +32,17 @@ func NewMockGroupRepository() *MockGroupRepository {
 		groups:      make(map[uint]*models.Group),
 		handles:     make(map[string]*models.Group),
 		memberships: make(map[uint]map[uint]models.GroupRole),
+		joinOrder:   make(map[[2]uint]int),
+		requests:    make(map[uint]*models.GroupJoinRequest),
+		topics:      make(map[uint]*models.GroupTopic),
 		nextID:      1,
 	}
 }
 
+func (m *MockGroupRepository) WithTx(tx *gorm.DB) repository.GroupRepositoryInterface {
+	return m
+}
+
 func (m *MockGroupRepository) Create(group *models.Group) error {
 	if group.ID == 0 {
 		group.ID = m.nextID
@@ -36,6 +55,22 @@ func (m *MockGroupRepository) Create(group *models.Group) error {
 	return nil
 }
 
+func (m *MockGroupRepository) Update(group *models.Group) error {
+	if _, ok := m.groups[group.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	for h, g := range m.handles {
+		if g.ID == group.ID {
+			delete(m.handles, h)
+		}
+	}
+	m.groups[group.ID] = group
+	if group.Handle != nil {
+		m.handles[*group.Handle] = group
+	}
+	return nil
+}
+
 func (m *MockGroupRepository) FindByID(id uint) (*models.Group, error) {
 	if g, ok := m.groups[id]; ok {
 		return g, nil
@@ -63,11 +98,15 @@ func (m *MockGroupRepository) SearchPublicGroups(query string, limit int) ([]mod
 	return out, nil
 }
 
-func (m *MockGroupRepository) AddMember(groupID, userID uint, role models.GroupRole) error {
+func (m *MockGroupRepository) AddMember(groupID, userID uint, role models.GroupRole, maxMembers int64) error {
 	if _, ok := m.memberships[groupID]; !ok {
 		m.memberships[groupID] = make(map[uint]models.GroupRole)
 	}
+	if maxMembers > 0 && int64(len(m.memberships[groupID])) >= maxMembers {
+		return repository.ErrGroupFull
+	}
 	m.memberships[groupID][userID] = role
+	m.joinOrder[[2]uint{groupID, userID}] = len(m.joinOrder) + 1
 	return nil
 }
 
@@ -78,14 +117,26 @@ func (m *MockGroupRepository) RemoveMember(groupID, userID uint) error {
 	return nil
 }
 
-func (m *MockGroupRepository) GetMembers(groupID uint) ([]models.User, error) {
-	var users []models.User
-	if gm, ok := m.memberships[groupID]; ok {
-		for uid := range gm {
-			users = append(users, models.User{ID: uid})
+func (m *MockGroupRepository) ListMembers(groupID uint, q repository.MemberQuery) ([]models.GroupMember, error) {
+	var out []models.GroupMember
+	for uid, role := range m.memberships[groupID] {
+		if len(q.Roles) > 0 && !slices.Contains(q.Roles, role) {
+			continue
 		}
+		member := models.GroupMember{GroupID: groupID, UserID: uid, Role: role, User: models.User{ID: uid}}
+		member.JoinedAt = time.Unix(int64(m.joinOrder[[2]uint{groupID, uid}]), 0)
+		out = append(out, member)
 	}
-	return users, nil
+	slices.SortFunc(out, func(a, b models.GroupMember) int { return a.JoinedAt.Compare(b.JoinedAt) })
+	if q.After != nil {
+		for len(out) > 0 && !out[0].JoinedAt.After(q.After.JoinedAt) {
+			out = out[1:]
+		}
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
 }
 
 func (m *MockGroupRepository) IsMember(groupID, userID uint) (bool, error) {
@@ -102,7 +153,72 @@ func (m *MockGroupRepository) GetMemberRole(groupID, userID uint) (models.GroupR
 			return role, nil
 		}
 	}
-	return "", errors.New("record not found")
+	return "", gorm.ErrRecordNotFound
+}
+
+func (m *MockGroupRepository) FindMember(groupID, userID uint) (*models.GroupMember, error) {
+	role, err := m.GetMemberRole(groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	g, ok := m.groups[groupID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &models.GroupMember{GroupID: groupID, UserID: userID, Role: role, Group: *g}, nil
+}
+
+func (m *MockGroupRepository) UpdatePermissions(groupID uint, member, moderator models.GroupPermission) error {
+	g, ok := m.groups[groupID]
+	if !ok {
+		return errors.New("record not found")
+	}
+	g.MemberPermissions = member
+	g.ModeratorPermissions = moderator
+	return nil
+}
+
+func (m *MockGroupRepository) UpdateMemberRole(groupID, userID uint, role models.GroupRole) error {
+	gm, ok := m.memberships[groupID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if _, ok := gm[userID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	gm[userID] = role
+	return nil
+}
+
+func (m *MockGroupRepository) SaveBan(ban *models.GroupBan) error {
+	if m.bans == nil {
+		m.bans = make(map[[2]uint]models.GroupBan)
+	}
+	m.bans[[2]uint{ban.GroupID, ban.UserID}] = *ban
+	return nil
+}
+
+func (m *MockGroupRepository) DeleteBan(groupID, userID uint) error {
+	delete(m.bans, [2]uint{groupID, userID})
+	return nil
+}
+
+func (m *MockGroupRepository) FindActiveBan(groupID, userID uint, now time.Time) (*models.GroupBan, error) {
+	ban, ok := m.bans[[2]uint{groupID, userID}]
+	if !ok || !ban.ActiveAt(now) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &ban, nil
+}
+
+func (m *MockGroupRepository) ListActiveBans(groupID uint, now time.Time) ([]models.GroupBan, error) {
+	var out []models.GroupBan
+	for key, ban := range m.bans {
+		if key[0] == groupID && ban.ActiveAt(now) {
+			out = append(out, ban)
+		}
+	}
+	return out, nil
 }
 
 func (m *MockGroupRepository) GetUserGroups(userID uint) ([]models.Group, error) {
@@ -116,3 +232,191 @@ func (m *MockGroupRepository) GetUserGroups(userID uint) ([]models.Group, error)
 	}
 	return out, nil
 }
+
+func (m *MockGroupRepository) TransferOwnership(groupID, fromUserID, toUserID uint) error {
+	if _, err := m.GetMemberRole(groupID, toUserID); err != nil {
+		return err
+	}
+	m.memberships[groupID][toUserID] = models.RoleOwner
+	if _, ok := m.memberships[groupID][fromUserID]; ok {
+		m.memberships[groupID][fromUserID] = models.RoleAdmin
+	}
+	if g, ok := m.groups[groupID]; ok {
+		g.OwnerID = toUserID
+	}
+	return nil
+}
+
+func (m *MockGroupRepository) FindOldestMember(groupID, excludeUserID uint) (*models.GroupMember, error) {
+	var oldest *models.GroupMember
+	oldestSeq := 0
+	for uid, role := range m.memberships[groupID] {
+		seq := m.joinOrder[[2]uint{groupID, uid}]
+		if uid == excludeUserID || (oldest != nil && seq > oldestSeq) {
+			continue
+		}
+		oldest = &models.GroupMember{GroupID: groupID, UserID: uid, Role: role}
+		oldestSeq = seq
+	}
+	if oldest == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return oldest, nil
+}
+
+func (m *MockGroupRepository) Delete(groupID uint) ([]uint, error) {
+	g, ok := m.groups[groupID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if g.Handle != nil {
+		delete(m.handles, *g.Handle)
+	}
+	delete(m.groups, groupID)
+	delete(m.memberships, groupID)
+	for key := range m.bans {
+		if key[0] == groupID {
+			delete(m.bans, key)
+		}
+	}
+	return m.groupAttachments[groupID], nil
+}
+
+func (m *MockGroupRepository) GetMemberIDsByRoles(groupID uint, roles []models.GroupRole) ([]uint, error) {
+	var ids []uint
+	for uid, role := range m.memberships[groupID] {
+		for _, r := range roles {
+			if role == r {
+				ids = append(ids, uid)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (m *MockGroupRepository) CreateJoinRequest(req *models.GroupJoinRequest) error {
+	req.ID = uint(len(m.requests) + 1)
+	if req.Status == "" {
+		req.Status = models.JoinRequestPending
+	}
+	stored := *req
+	m.requests[req.ID] = &stored
+	return nil
+}
+
+func (m *MockGroupRepository) FindJoinRequest(id uint) (*models.GroupJoinRequest, error) {
+	if req, ok := m.requests[id]; ok {
+		found := *req
+		return &found, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *MockGroupRepository) FindPendingJoinRequest(groupID, userID uint) (*models.GroupJoinRequest, error) {
+	for _, req := range m.requests {
+		if req.GroupID == groupID && req.UserID == userID && req.Status == models.JoinRequestPending {
+			found := *req
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *MockGroupRepository) ListPendingJoinRequests(groupID uint) ([]models.GroupJoinRequest, error) {
+	var out []models.GroupJoinRequest
+	for id := uint(1); id <= uint(len(m.requests)); id++ {
+		if req := m.requests[id]; req.GroupID == groupID && req.Status == models.JoinRequestPending {
+			out = append(out, *req)
+		}
+	}
+	return out, nil
+}
+
+func (m *MockGroupRepository) DecideJoinRequest(id uint, status models.JoinRequestStatus, deciderID uint, reason string, at time.Time) error {
+	req, ok := m.requests[id]
+	if !ok || req.Status != models.JoinRequestPending {
+		return gorm.ErrRecordNotFound
+	}
+	req.Status = status
+	req.DecidedBy = &deciderID
+	req.Reason = reason
+	req.DecidedAt = &at
+	return nil
+}
+
+func (m *MockGroupRepository) ReopenJoinRequest(id uint) error {
+	req, ok := m.requests[id]
+	if !ok || req.Status != models.JoinRequestApproved {
+		return gorm.ErrRecordNotFound
+	}
+	req.Status = models.JoinRequestPending
+	req.DecidedBy = nil
+	req.Reason = ""
+	req.DecidedAt = nil
+	return nil
+}
+
+func (m *MockGroupRepository) CreateTopic(topic *models.GroupTopic) error {
+	topic.ID = uint(len(m.topics) + 1)
+	stored := *topic
+	m.topics[topic.ID] = &stored
+	return nil
+}
+
+func (m *MockGroupRepository) FindTopic(id uint) (*models.GroupTopic, error) {
+	topic, ok := m.topics[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	out := *topic
+	return &out, nil
+}
+
+func (m *MockGroupRepository) ListTopics(groupID uint) ([]models.GroupTopic, error) {
+	var out []models.GroupTopic
+	for id := uint(len(m.topics)); id > 0; id-- {
+		if t := m.topics[id]; t.GroupID == groupID {
+			out = append(out, *t)
+		}
+	}
+	return out, nil
+}
+
+func (m *MockGroupRepository) UpdateTopic(topic *models.GroupTopic) error {
+	if _, ok := m.topics[topic.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	stored := *topic
+	m.topics[topic.ID] = &stored
+	return nil
+}
+
+func (m *MockGroupRepository) FindInfo(id uint) (*models.Group, error) {
+	return m.FindByID(id)
+}
+
+func (m *MockGroupRepository) GetMemberIDs(groupID uint) ([]uint, error) {
+	var ids []uint
+	for uid := range m.memberships[groupID] {
+		ids = append(ids, uid)
+	}
+	return ids, nil
+}
+
+func (m *MockGroupRepository) FilterMembers(groupID uint, userIDs []uint) ([]uint, error) {
+	var ids []uint
+	for _, uid := range userIDs {
+		if _, ok := m.memberships[groupID][uid]; ok {
+			ids = append(ids, uid)
+		}
+	}
+	return ids, nil
+}
+
+func (m *MockGroupRepository) CountMembers(groupIDs []uint) (map[uint]int64, error) {
+	out := make(map[uint]int64, len(groupIDs))
+	for _, id := range groupIDs {
+		out[id] = int64(len(m.memberships[id]))
+	}
+	return out, nil
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"github.com/noteduco342/OMMessenger-backend/internal/scanner"
+	"github.com/noteduco342/OMMessenger-backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+const (
+	scanQueueSize = 256
+	scanWorkers   = 2
+	// scanSweepInterval is how often quarantined blobs are retried, covering
+	// a full queue, scanner outages and restarts.
+	scanSweepInterval = time.Minute
+	scanSweepBatch    = 100
+)
+
+// ScanService moves uploaded content from quarantined to clean or infected.
+// A nil *ScanService or one without a scanner leaves new uploads clean.
+type ScanService struct {
+	repo    repository.AttachmentRepositoryInterface
+	store   storage.BlobStore
+	scanner scanner.Scanner
+	queue   chan string
+}
+
+func NewScanService(repo repository.AttachmentRepositoryInterface, store storage.BlobStore, sc scanner.Scanner) *ScanService {
+	return &ScanService{repo: repo, store: store, scanner: sc, queue: make(chan string, scanQueueSize)}
+}
+
+func (s *ScanService) Enabled() bool {
+	return s != nil && s.scanner != nil
+}
+
+// InitialStatus is the state recorded for content the first time it's uploaded.
+func (s *ScanService) InitialStatus() models.ScanStatus {
+	if s.Enabled() {
+		return models.ScanQuarantined
+	}
+	return models.ScanClean
+}
+
+// Enqueue schedules a background scan. It never blocks; if the queue is full
+// the periodic sweep picks the blob up.
+func (s *ScanService) Enqueue(hash string) {
+	if !s.Enabled() {
+		return
+	}
+	select {
+	case s.queue <- hash:
+	default:
+		log.Printf("[scan] queue full, deferring %s to sweep", hash)
+	}
+}
+
+// Start runs the scan workers and the quarantine sweep until ctx is cancelled.
+func (s *ScanService) Start(ctx context.Context) {
+	if !s.Enabled() {
+		return
+	}
+	for i := 0; i < scanWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case hash := <-s.queue:
+					if err := s.ScanBlob(ctx, hash); err != nil {
+						log.Printf("[scan] scan %s failed: %v", hash, err)
+					}
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(scanSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *ScanService) sweep(ctx context.Context) {
+	// Skip blobs touched recently; they're most likely still in the queue.
+	blobs, err := s.repo.ListQuarantinedBlobs(time.Now().Add(-scanSweepInterval), scanSweepBatch)
+	if err != nil {
+		log.Printf("[scan] sweep failed: %v", err)
+		return
+	}
+	for _, blob := range blobs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.ScanBlob(ctx, blob.Hash); err != nil {
+			log.Printf("[scan] scan %s failed: %v", blob.Hash, err)
+			if errors.Is(err, scanner.ErrScannerUnavailable) {
+				// Don't hammer a daemon that's down; retry next sweep.
+				return
+			}
+		}
+	}
+}
+
+// ScanBlob scans one stored blob and records the verdict. On error the blob
+// stays quarantined.
+func (s *ScanService) ScanBlob(ctx context.Context, hash string) error {
+	if !s.Enabled() {
+		return nil
+	}
+	if s.store == nil {
+		return ErrStorageNotConfigured
+	}
+	blob, err := s.repo.FindBlob(hash)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Deleted before we got to it.
+			return nil
+		}
+		return err
+	}
+	if blob.ScanStatus != models.ScanQuarantined {
+		return nil
+	}
+
+	obj, _, err := s.store.Get(ctx, blob.Key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	result, err := s.scanner.Scan(ctx, obj)
+	if err != nil {
+		return err
+	}
+	status := models.ScanClean
+	if result.Infected {
+		status = models.ScanInfected
+		log.Printf("[scan] blob %s infected: %s", hash, result.Signature)
+	}
+	return s.repo.SetBlobScanResult(hash, status, result.Signature)
+}
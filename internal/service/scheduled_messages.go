@@ -0,0 +1,470 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"github.com/noteduco342/OMMessenger-backend/internal/richtext"
+	"gorm.io/gorm"
+)
+
+const (
+	// scheduledClaimTimeout is how long a claimed message may stay claimed
+	// before another run assumes the claiming process died.
+	scheduledClaimTimeout = 5 * time.Minute
+	maxScheduledAttempts  = 5
+	scheduledRetryBackoff = 30 * time.Second
+)
+
+var (
+	ErrScheduledNotFound     = errors.New("scheduled message not found")
+	ErrScheduledNotEditable  = errors.New("scheduled message is no longer pending")
+	ErrInvalidSendAt         = errors.New("send_at must be in the future")
+	ErrInvalidScheduleTarget = errors.New("exactly one of recipient_id or group_id is required")
+	ErrEmptyScheduledMessage = errors.New("content or attachment is required")
+	ErrTooManyScheduled      = errors.New("too many scheduled messages")
+	ErrClientIDTaken         = errors.New("client_id already used")
+)
+
+// ScheduledDelivery hands sent scheduled messages to the websocket layer,
+// which the service can't import.
+type ScheduledDelivery interface {
+	MessageDelivery
+	DeliverDirectMessage(message *models.Message)
+	NotifyUser(userID uint, event map[string]interface{})
+}
+
+// SchedulerConfig controls scheduled message limits and the send loop.
+type SchedulerConfig struct {
+	// Interval between checks for due messages.
+	Interval time.Duration
+	// BatchSize is the number of due messages claimed per check.
+	BatchSize int
+	// MaxPerUser caps each user's unsent scheduled messages.
+	MaxPerUser int64
+	// MaxAhead is how far in the future a message may be scheduled.
+	MaxAhead time.Duration
+}
+
+func DefaultSchedulerConfig() SchedulerConfig {
+	return SchedulerConfig{
+		Interval:   2 * time.Second,
+		BatchSize:  100,
+		MaxPerUser: 100,
+		MaxAhead:   366 * 24 * time.Hour,
+	}
+}
+
+// LoadSchedulerConfigFromEnv reads SCHEDULED_* overrides on top of the defaults.
+func LoadSchedulerConfigFromEnv() SchedulerConfig {
+	cfg := DefaultSchedulerConfig()
+	if d, err := time.ParseDuration(os.Getenv("SCHEDULED_POLL_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if n, err := strconv.ParseInt(os.Getenv("SCHEDULED_MAX_PER_USER"), 10, 64); err == nil && n > 0 {
+		cfg.MaxPerUser = n
+	}
+	return cfg
+}
+
+type ScheduleMessageInput struct {
+	ClientID     string                 `json:"client_id"`
+	RecipientID  *uint                  `json:"recipient_id"`
+	GroupID      *uint                  `json:"group_id"`
+	TopicID      *uint                  `json:"topic_id"`
+	Content      string                 `json:"content"`
+	Entities     []models.MessageEntity `json:"entities"`
+	MessageType  models.MessageType     `json:"message_type"`
+	AttachmentID *uint                  `json:"attachment_id"`
+	SendAt       time.Time              `json:"send_at"`
+}
+
+// UpdateScheduledInput holds the fields to change; nil fields are left alone.
+// New content replaces the entities with Entities.
+type UpdateScheduledInput struct {
+	Content  *string                `json:"content"`
+	Entities []models.MessageEntity `json:"entities"`
+	SendAt   *time.Time             `json:"send_at"`
+}
+
+// ScheduledMessageService stores messages to be sent later and sends them
+// when they come due, through MessageService and the same delivery path as
+// live messages.
+type ScheduledMessageService struct {
+	repo        repository.ScheduledMessageRepositoryInterface
+	messages    *MessageService
+	groups      *GroupService
+	attachments *AttachmentService
+	userRepo    repository.UserRepositoryInterface
+	delivery    ScheduledDelivery
+	cfg         SchedulerConfig
+	now         func() time.Time
+}
+
+func NewScheduledMessageService(
+	repo repository.ScheduledMessageRepositoryInterface,
+	messages *MessageService,
+	groups *GroupService,
+	attachments *AttachmentService,
+	userRepo repository.UserRepositoryInterface,
+	cfg SchedulerConfig,
+) *ScheduledMessageService {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	return &ScheduledMessageService{
+		repo:        repo,
+		messages:    messages,
+		groups:      groups,
+		attachments: attachments,
+		userRepo:    userRepo,
+		cfg:         cfg,
+		now:         time.Now,
+	}
+}
+
+// EnableDelivery pushes sent messages to online users. Without it they are
+// only stored and reach clients through history and sync.
+func (s *ScheduledMessageService) EnableDelivery(delivery ScheduledDelivery) {
+	s.delivery = delivery
+}
+
+// Schedule stores a message to be sent at input.SendAt. The sender must be
+// allowed to send it now; the check is repeated when it comes due. Scheduling
+// the same client_id twice returns the first message.
+func (s *ScheduledMessageService) Schedule(senderID uint, input ScheduleMessageInput) (*models.ScheduledMessage, error) {
+	clientID := strings.TrimSpace(input.ClientID)
+	if clientID == "" {
+		clientID = uuid.NewString()
+	} else {
+		if existing, err := s.repo.FindByClientID(clientID, senderID); err == nil {
+			return existing, nil
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if _, err := s.messages.GetByClientID(clientID, senderID); err == nil {
+			return nil, ErrClientIDTaken
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	if (input.RecipientID == nil) == (input.GroupID == nil) {
+		return nil, ErrInvalidScheduleTarget
+	}
+	if input.TopicID != nil && (input.GroupID == nil || *input.TopicID == 0) {
+		input.TopicID = nil
+	}
+	if input.Content == "" && input.AttachmentID == nil {
+		return nil, ErrEmptyScheduledMessage
+	}
+	if err := s.checkSendAt(input.SendAt); err != nil {
+		return nil, err
+	}
+	entities, err := richtext.Validate(input.Content, input.Entities)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := s.repo.CountPending(senderID)
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.MaxPerUser > 0 && pending >= s.cfg.MaxPerUser {
+		return nil, ErrTooManyScheduled
+	}
+
+	msg := &models.ScheduledMessage{
+		ClientID:     clientID,
+		SenderID:     senderID,
+		RecipientID:  input.RecipientID,
+		GroupID:      input.GroupID,
+		TopicID:      input.TopicID,
+		Content:      input.Content,
+		Entities:     entities,
+		MessageType:  input.MessageType,
+		AttachmentID: input.AttachmentID,
+		SendAt:       input.SendAt.UTC(),
+		Status:       models.ScheduledPending,
+	}
+	if msg.MessageType == "" {
+		msg.MessageType = models.TextMessage
+	}
+	if err := s.checkAccess(msg); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// List returns the user's scheduled messages that haven't been sent,
+// including failed ones, soonest first.
+func (s *ScheduledMessageService) List(senderID uint) ([]models.ScheduledMessage, error) {
+	return s.repo.ListBySender(senderID)
+}
+
+// Update edits a pending message's content or send time.
+func (s *ScheduledMessageService) Update(senderID, id uint, input UpdateScheduledInput) (*models.ScheduledMessage, error) {
+	msg, err := s.find(senderID, id)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Status != models.ScheduledPending {
+		return nil, ErrScheduledNotEditable
+	}
+	if input.Content != nil {
+		msg.Content = *input.Content
+		if msg.Entities, err = richtext.Validate(msg.Content, input.Entities); err != nil {
+			return nil, err
+		}
+	}
+	if msg.Content == "" && msg.AttachmentID == nil {
+		return nil, ErrEmptyScheduledMessage
+	}
+	if input.SendAt != nil {
+		if err := s.checkSendAt(*input.SendAt); err != nil {
+			return nil, err
+		}
+		msg.SendAt = input.SendAt.UTC()
+	}
+	if err := s.repo.UpdatePending(msg); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrScheduledNotEditable
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Cancel deletes a pending or failed scheduled message.
+func (s *ScheduledMessageService) Cancel(senderID, id uint) error {
+	if _, err := s.find(senderID, id); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrScheduledNotEditable
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *ScheduledMessageService) find(senderID, id uint) (*models.ScheduledMessage, error) {
+	msg, err := s.repo.FindByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrScheduledNotFound
+		}
+		return nil, err
+	}
+	if msg.SenderID != senderID {
+		return nil, ErrScheduledNotFound
+	}
+	return msg, nil
+}
+
+func (s *ScheduledMessageService) checkSendAt(sendAt time.Time) error {
+	now := s.now()
+	if !sendAt.After(now) || (s.cfg.MaxAhead > 0 && sendAt.After(now.Add(s.cfg.MaxAhead))) {
+		return ErrInvalidSendAt
+	}
+	return nil
+}
+
+// checkAccess applies the checks a live send of msg would: group membership
+// and permissions, the topic, the recipient and the attachment. Slow mode and
+// flood limits don't apply to scheduled sends.
+func (s *ScheduledMessageService) checkAccess(msg *models.ScheduledMessage) error {
+	if msg.GroupID != nil {
+		perm := models.PermSendMessages
+		if msg.AttachmentID != nil {
+			perm |= models.PermSendMedia
+		}
+		if err := s.groups.Authorize(*msg.GroupID, msg.SenderID, perm); err != nil {
+			return err
+		}
+		if msg.TopicID != nil {
+			if err := s.groups.CheckTopicPost(*msg.GroupID, *msg.TopicID, msg.SenderID); err != nil {
+				return err
+			}
+		}
+	} else if msg.RecipientID != nil {
+		if _, err := s.userRepo.FindByID(*msg.RecipientID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+	}
+	if msg.AttachmentID != nil {
+		if s.attachments == nil {
+			return ErrStorageNotConfigured
+		}
+		if _, err := s.attachments.CheckAttachable(msg.SenderID, *msg.AttachmentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScheduledFailureCode names the API error code for errors that make a
+// scheduled message impossible to send. It reports false for transient
+// errors, which are retried.
+func ScheduledFailureCode(err error) (string, bool) {
+	switch {
+	case errors.Is(err, ErrNotGroupMember):
+		return "not_group_member", true
+	case errors.Is(err, ErrChannelAdminOnly):
+		return "channel_admin_only", true
+	case errors.Is(err, ErrGroupPermissionDenied):
+		return "missing_permission", true
+	case errors.Is(err, ErrTopicNotFound):
+		return "topic_not_found", true
+	case errors.Is(err, ErrTopicClosed):
+		return "topic_closed", true
+	case errors.Is(err, ErrNotForum):
+		return "not_forum", true
+	case errors.Is(err, ErrUserNotFound):
+		return "recipient_not_found", true
+	case errors.Is(err, ErrAttachmentNotFound), errors.Is(err, ErrAttachmentForbidden):
+		return "invalid_attachment", true
+	case errors.Is(err, ErrAttachmentInfected):
+		return "attachment_infected", true
+	case errors.Is(err, ErrStorageNotConfigured):
+		return "storage_not_configured", true
+	}
+	return EntityErrorCode(err)
+}
+
+// Start sends due messages every cfg.Interval until ctx is cancelled. Claims
+// left behind by a process that died mid-send are released on each pass.
+func (s *ScheduledMessageService) Start(ctx context.Context) {
+	if s.cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := s.repo.ReleaseStale(s.now().Add(-scheduledClaimTimeout)); err != nil {
+				log.Printf("[scheduler] release stale claims failed: %v", err)
+			} else if n > 0 {
+				log.Printf("[scheduler] released %d stale claims", n)
+			}
+			if err := s.SendDue(); err != nil {
+				log.Printf("[scheduler] run failed: %v", err)
+			}
+		}
+	}
+}
+
+// SendDue claims the messages that are due and sends them.
+func (s *ScheduledMessageService) SendDue() error {
+	for {
+		due, err := s.repo.ClaimDue(s.now(), s.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+		for i := range due {
+			s.send(&due[i])
+		}
+		if len(due) < s.cfg.BatchSize {
+			return nil
+		}
+	}
+}
+
+// send turns a claimed scheduled message into a real one.
+func (s *ScheduledMessageService) send(sm *models.ScheduledMessage) {
+	// A run that died after creating the message leaves the claim behind;
+	// the client_id shows it already went out.
+	if existing, err := s.messages.GetByClientID(sm.ClientID, sm.SenderID); err == nil && existing != nil {
+		if err := s.repo.Complete(sm.ID); err != nil {
+			log.Printf("[scheduler] complete %d failed: %v", sm.ID, err)
+		}
+		return
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.retry(sm, err)
+		return
+	}
+
+	if err := s.checkAccess(sm); err != nil {
+		if code, permanent := ScheduledFailureCode(err); permanent {
+			s.fail(sm, code)
+			return
+		}
+		s.retry(sm, err)
+		return
+	}
+
+	message, err := s.messages.CreateWithAttachment(sm.SenderID, sm.ClientID, sm.RecipientID, sm.GroupID, sm.TopicID, sm.Content, sm.Entities, sm.MessageType, sm.AttachmentID)
+	if err != nil {
+		if code, permanent := ScheduledFailureCode(err); permanent {
+			s.fail(sm, code)
+			return
+		}
+		s.retry(sm, err)
+		return
+	}
+	if err := s.repo.Complete(sm.ID); err != nil {
+		log.Printf("[scheduler] complete %d failed: %v", sm.ID, err)
+	}
+
+	if s.delivery == nil {
+		return
+	}
+	// The sender gets the message too: unlike a live send there was no ack.
+	if message.GroupID != nil {
+		s.delivery.DeliverGroupMessage(message, 0)
+	} else {
+		s.delivery.DeliverDirectMessage(message)
+	}
+	s.delivery.NotifyUser(sm.SenderID, map[string]interface{}{
+		"type":         "scheduled_message_sent",
+		"scheduled_id": sm.ID,
+		"message_id":   message.ID,
+		"client_id":    sm.ClientID,
+	})
+}
+
+func (s *ScheduledMessageService) retry(sm *models.ScheduledMessage, cause error) {
+	attempts := sm.Attempts + 1
+	if attempts >= maxScheduledAttempts {
+		log.Printf("[scheduler] giving up on %d after %d attempts: %v", sm.ID, attempts, cause)
+		s.fail(sm, "send_failed")
+		return
+	}
+	log.Printf("[scheduler] send %d failed (attempt %d): %v", sm.ID, attempts, cause)
+	next := s.now().Add(time.Duration(attempts) * scheduledRetryBackoff)
+	if err := s.repo.Retry(sm.ID, attempts, next); err != nil {
+		log.Printf("[scheduler] requeue %d failed: %v", sm.ID, err)
+	}
+}
+
+func (s *ScheduledMessageService) fail(sm *models.ScheduledMessage, code string) {
+	if err := s.repo.MarkFailed(sm.ID, code); err != nil {
+		log.Printf("[scheduler] mark %d failed: %v", sm.ID, err)
+		return
+	}
+	if s.delivery != nil {
+		s.delivery.NotifyUser(sm.SenderID, map[string]interface{}{
+			"type":         "scheduled_message_failed",
+			"scheduled_id": sm.ID,
+			"client_id":    sm.ClientID,
+			"error":        code,
+		})
+	}
+}
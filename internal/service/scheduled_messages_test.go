@@ -0,0 +1,278 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// MockScheduledMessageRepository keeps scheduled messages in memory.
+type MockScheduledMessageRepository struct {
+	rows   map[uint]*models.ScheduledMessage
+	nextID uint
+}
+
+func NewMockScheduledMessageRepository() *MockScheduledMessageRepository {
+	return &MockScheduledMessageRepository{rows: make(map[uint]*models.ScheduledMessage), nextID: 1}
+}
+
+func (m *MockScheduledMessageRepository) Create(msg *models.ScheduledMessage) error {
+	msg.ID = m.nextID
+	m.nextID++
+	row := *msg
+	m.rows[msg.ID] = &row
+	return nil
+}
+
+func (m *MockScheduledMessageRepository) FindByID(id uint) (*models.ScheduledMessage, error) {
+	if row, ok := m.rows[id]; ok {
+		cp := *row
+		return &cp, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *MockScheduledMessageRepository) FindByClientID(clientID string, senderID uint) (*models.ScheduledMessage, error) {
+	for _, row := range m.rows {
+		if row.ClientID == clientID && row.SenderID == senderID {
+			cp := *row
+			return &cp, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *MockScheduledMessageRepository) ListBySender(senderID uint) ([]models.ScheduledMessage, error) {
+	var out []models.ScheduledMessage
+	for _, row := range m.rows {
+		if row.SenderID == senderID {
+			out = append(out, *row)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SendAt.Before(out[j].SendAt) })
+	return out, nil
+}
+
+func (m *MockScheduledMessageRepository) CountPending(senderID uint) (int64, error) {
+	var n int64
+	for _, row := range m.rows {
+		if row.SenderID == senderID && row.Status != models.ScheduledFailed {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MockScheduledMessageRepository) UpdatePending(msg *models.ScheduledMessage) error {
+	row, ok := m.rows[msg.ID]
+	if !ok || row.Status != models.ScheduledPending {
+		return gorm.ErrRecordNotFound
+	}
+	row.Content, row.SendAt = msg.Content, msg.SendAt
+	return nil
+}
+
+func (m *MockScheduledMessageRepository) Delete(id uint) error {
+	row, ok := m.rows[id]
+	if !ok || row.Status == models.ScheduledSending {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.rows, id)
+	return nil
+}
+
+func (m *MockScheduledMessageRepository) ClaimDue(now time.Time, limit int) ([]models.ScheduledMessage, error) {
+	var out []models.ScheduledMessage
+	for _, row := range m.rows {
+		if len(out) < limit && row.Status == models.ScheduledPending && !row.SendAt.After(now) {
+			row.Status = models.ScheduledSending
+			out = append(out, *row)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SendAt.Before(out[j].SendAt) })
+	return out, nil
+}
+
+func (m *MockScheduledMessageRepository) ReleaseStale(claimedBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockScheduledMessageRepository) Retry(id uint, attempts int, sendAt time.Time) error {
+	if row, ok := m.rows[id]; ok {
+		row.Status, row.Attempts, row.SendAt = models.ScheduledPending, attempts, sendAt
+	}
+	return nil
+}
+
+func (m *MockScheduledMessageRepository) Complete(id uint) error {
+	delete(m.rows, id)
+	return nil
+}
+
+func (m *MockScheduledMessageRepository) MarkFailed(id uint, reason string) error {
+	if row, ok := m.rows[id]; ok {
+		row.Status, row.Error = models.ScheduledFailed, reason
+	}
+	return nil
+}
+
+type recordingScheduledDelivery struct {
+	recordingDelivery
+	direct []*models.Message
+	events []map[string]interface{}
+}
+
+func (d *recordingScheduledDelivery) DeliverDirectMessage(message *models.Message) {
+	d.direct = append(d.direct, message)
+}
+
+func (d *recordingScheduledDelivery) NotifyUser(userID uint, event map[string]interface{}) {
+	d.events = append(d.events, event)
+}
+
+func TestScheduledMessageService(t *testing.T) {
+	groupRepo := NewMockGroupRepository()
+	groups := NewGroupService(groupRepo, nil, nil, nil)
+	userRepo := NewMockUserRepository()
+	_ = userRepo.Create(&models.User{Username: "alice"})
+	_ = userRepo.Create(&models.User{Username: "bob"})
+	messageRepo := NewMockMessageRepository()
+	repo := NewMockScheduledMessageRepository()
+	cfg := DefaultSchedulerConfig()
+	cfg.MaxPerUser = 3
+	svc := NewScheduledMessageService(repo, NewMessageService(messageRepo), groups, nil, userRepo, cfg)
+	delivery := &recordingScheduledDelivery{}
+	svc.EnableDelivery(delivery)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	group, err := groups.CreateGroup("team", "", 1)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	_ = groupRepo.AddMember(group.ID, 2, models.RoleMember, 0)
+	bob := uint(2)
+	missing := uint(99)
+
+	cases := []struct {
+		name  string
+		input ScheduleMessageInput
+		want  error
+	}{
+		{"no target", ScheduleMessageInput{Content: "hi", SendAt: now.Add(time.Hour)}, ErrInvalidScheduleTarget},
+		{"both targets", ScheduleMessageInput{RecipientID: &bob, GroupID: &group.ID, Content: "hi", SendAt: now.Add(time.Hour)}, ErrInvalidScheduleTarget},
+		{"past", ScheduleMessageInput{RecipientID: &bob, Content: "hi", SendAt: now.Add(-time.Minute)}, ErrInvalidSendAt},
+		{"too far", ScheduleMessageInput{RecipientID: &bob, Content: "hi", SendAt: now.AddDate(2, 0, 0)}, ErrInvalidSendAt},
+		{"empty", ScheduleMessageInput{RecipientID: &bob, SendAt: now.Add(time.Hour)}, ErrEmptyScheduledMessage},
+		{"unknown recipient", ScheduleMessageInput{RecipientID: &missing, Content: "hi", SendAt: now.Add(time.Hour)}, ErrUserNotFound},
+		{"attachment without storage", ScheduleMessageInput{RecipientID: &bob, AttachmentID: &missing, SendAt: now.Add(time.Hour)}, ErrStorageNotConfigured},
+	}
+	for _, tc := range cases {
+		if _, err := svc.Schedule(1, tc.input); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if _, err := svc.Schedule(3, ScheduleMessageInput{GroupID: &group.ID, Content: "hi", SendAt: now.Add(time.Hour)}); !errors.Is(err, ErrNotGroupMember) {
+		t.Fatalf("non-member err = %v", err)
+	}
+
+	direct, err := svc.Schedule(1, ScheduleMessageInput{ClientID: "c-dm", RecipientID: &bob, Content: "later", SendAt: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("schedule dm: %v", err)
+	}
+	again, err := svc.Schedule(1, ScheduleMessageInput{ClientID: "c-dm", RecipientID: &bob, Content: "retry", SendAt: now.Add(time.Minute)})
+	if err != nil || again.ID != direct.ID {
+		t.Fatalf("duplicate client_id = %+v, %v", again, err)
+	}
+	inGroup, err := svc.Schedule(2, ScheduleMessageInput{GroupID: &group.ID, Content: "standup", SendAt: now.Add(2 * time.Minute)})
+	if err != nil {
+		t.Fatalf("schedule group: %v", err)
+	}
+
+	edited := "later, edited"
+	if _, err := svc.Update(2, direct.ID, UpdateScheduledInput{Content: &edited}); !errors.Is(err, ErrScheduledNotFound) {
+		t.Fatalf("update by other user err = %v", err)
+	}
+	if _, err := svc.Update(1, direct.ID, UpdateScheduledInput{Content: &edited}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	// Bob loses access before the group message is due.
+	_ = groupRepo.RemoveMember(group.ID, 2)
+	now = now.Add(5 * time.Minute)
+	if err := svc.SendDue(); err != nil {
+		t.Fatalf("send due: %v", err)
+	}
+
+	sent, err := messageRepo.FindByClientID("c-dm", 1)
+	if err != nil {
+		t.Fatalf("direct message not created: %v", err)
+	}
+	if sent.Content != edited || sent.RecipientID == nil || *sent.RecipientID != bob {
+		t.Fatalf("sent message = %+v", sent)
+	}
+	if len(delivery.direct) != 1 || delivery.direct[0].ID != sent.ID {
+		t.Fatalf("direct deliveries = %v", delivery.direct)
+	}
+	if _, err := repo.FindByID(direct.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("sent row kept: %v", err)
+	}
+
+	if _, err := messageRepo.FindByClientID(inGroup.ClientID, 2); err == nil {
+		t.Fatalf("group message sent after sender left")
+	}
+	failed, err := repo.FindByID(inGroup.ID)
+	if err != nil || failed.Status != models.ScheduledFailed || failed.Error != "not_group_member" {
+		t.Fatalf("failed row = %+v, %v", failed, err)
+	}
+	if len(delivery.messages) != 0 {
+		t.Fatalf("group deliveries = %d", len(delivery.messages))
+	}
+
+	types := map[string]uint{}
+	for _, ev := range delivery.events {
+		types[ev["type"].(string)] = ev["scheduled_id"].(uint)
+	}
+	if types["scheduled_message_sent"] != direct.ID || types["scheduled_message_failed"] != inGroup.ID {
+		t.Fatalf("events = %v", delivery.events)
+	}
+
+	if err := svc.Cancel(2, inGroup.ID); err != nil {
+		t.Fatalf("cancel failed row: %v", err)
+	}
+}
+
+func TestScheduledMessageService_SkipsAlreadySent(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	_ = userRepo.Create(&models.User{Username: "alice"})
+	_ = userRepo.Create(&models.User{Username: "bob"})
+	messageRepo := NewMockMessageRepository()
+	repo := NewMockScheduledMessageRepository()
+	svc := NewScheduledMessageService(repo, NewMessageService(messageRepo), nil, nil, userRepo, DefaultSchedulerConfig())
+
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+	bob := uint(2)
+	row, err := svc.Schedule(1, ScheduleMessageInput{ClientID: "c-1", RecipientID: &bob, Content: "hi", SendAt: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+
+	// A previous run created the message but died before completing the row.
+	_ = messageRepo.Create(&models.Message{ClientID: "c-1", SenderID: 1, RecipientID: &bob, Content: "hi"})
+	now = now.Add(2 * time.Minute)
+	if err := svc.SendDue(); err != nil {
+		t.Fatalf("send due: %v", err)
+	}
+	if len(messageRepo.messages) != 1 {
+		t.Fatalf("messages = %d, want 1", len(messageRepo.messages))
+	}
+	if _, err := repo.FindByID(row.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("row kept: %v", err)
+	}
+}
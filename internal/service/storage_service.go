@@ -0,0 +1,205 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"github.com/noteduco342/OMMessenger-backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrStorageQuotaExceeded = repository.ErrStorageQuotaExceeded
+	ErrStoragePlanNotFound  = errors.New("storage plan not found")
+	ErrStoragePlanNameTaken = errors.New("storage plan name already taken")
+	ErrInvalidStoragePlan   = errors.New("invalid storage plan")
+	ErrUserNotFound         = errors.New("user not found")
+)
+
+const defaultStorageQuotaBytes = 1024 * 1024 * 1024
+
+// DefaultStorageQuotaBytes is the quota for users when no plan applies
+// (STORAGE_DEFAULT_QUOTA_BYTES, 0 = unlimited).
+func DefaultStorageQuotaBytes() int64 {
+	v := strings.TrimSpace(os.Getenv("STORAGE_DEFAULT_QUOTA_BYTES"))
+	if v == "" {
+		return defaultStorageQuotaBytes
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return defaultStorageQuotaBytes
+	}
+	return n
+}
+
+// StorageLimits are the effective limits for one user.
+type StorageLimits struct {
+	Plan         *models.StoragePlan
+	QuotaBytes   int64 // <= 0 means unlimited
+	MaxFileBytes int64
+}
+
+type StoragePlanInput struct {
+	Name         string `json:"name"`
+	QuotaBytes   int64  `json:"quota_bytes"`
+	MaxFileBytes int64  `json:"max_file_bytes"`
+	IsDefault    bool   `json:"is_default"`
+}
+
+type StorageService struct {
+	repo repository.StorageRepositoryInterface
+}
+
+func NewStorageService(repo repository.StorageRepositoryInterface) *StorageService {
+	return &StorageService{repo: repo}
+}
+
+func (s *StorageService) LimitsFor(userID uint) (StorageLimits, error) {
+	limits := StorageLimits{QuotaBytes: DefaultStorageQuotaBytes(), MaxFileBytes: MaxAttachmentBytes()}
+	plan, err := s.repo.PlanForUser(userID)
+	if err != nil {
+		return StorageLimits{}, err
+	}
+	if plan != nil {
+		limits.Plan = plan
+		limits.QuotaBytes = plan.QuotaBytes
+		if plan.MaxFileBytes > 0 {
+			limits.MaxFileBytes = min(plan.MaxFileBytes, limits.MaxFileBytes)
+		}
+	}
+	return limits, nil
+}
+
+// Usage reports the user's storage consumption against their plan.
+func (s *StorageService) Usage(userID uint) (*models.StorageUsageResponse, error) {
+	limits, err := s.LimitsFor(userID)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.repo.GetUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.StorageUsageResponse{
+		Plan:         limits.Plan,
+		QuotaBytes:   limits.QuotaBytes,
+		MaxFileBytes: limits.MaxFileBytes,
+		UsedBytes:    usage.TotalBytes(),
+		Breakdown:    usage,
+	}
+	if limits.QuotaBytes > 0 {
+		resp.RemainingBytes = max(limits.QuotaBytes-resp.UsedBytes, 0)
+	} else {
+		resp.RemainingBytes = -1
+	}
+	return resp, nil
+}
+
+// CheckUpload is a cheap pre-check before accepting an upload of size bytes.
+// The authoritative check runs again in the transaction that records it.
+func (s *StorageService) CheckUpload(userID uint, size int64) (StorageLimits, error) {
+	limits, err := s.LimitsFor(userID)
+	if err != nil {
+		return StorageLimits{}, err
+	}
+	if size > limits.MaxFileBytes {
+		return limits, ErrAttachmentTooLarge
+	}
+	if limits.QuotaBytes > 0 {
+		usage, err := s.repo.GetUsage(userID)
+		if err != nil {
+			return limits, err
+		}
+		if usage.TotalBytes()+size > limits.QuotaBytes {
+			return limits, ErrStorageQuotaExceeded
+		}
+	}
+	return limits, nil
+}
+
+// SaveAvatar persists the user's new avatar fields, enforcing the quota.
+func (s *StorageService) SaveAvatar(user *models.User) error {
+	limits, err := s.LimitsFor(user.ID)
+	if err != nil {
+		return err
+	}
+	return s.repo.SaveAvatarWithinQuota(user, limits.QuotaBytes)
+}
+
+func (s *StorageService) ListPlans() ([]models.StoragePlan, error) {
+	return s.repo.ListPlans()
+}
+
+func (s *StorageService) CreatePlan(input StoragePlanInput) (*models.StoragePlan, error) {
+	plan := &models.StoragePlan{}
+	if err := s.applyPlanInput(plan, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SavePlan(plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (s *StorageService) UpdatePlan(id uint, input StoragePlanInput) (*models.StoragePlan, error) {
+	plan, err := s.repo.FindPlan(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrStoragePlanNotFound
+		}
+		return nil, err
+	}
+	if err := s.applyPlanInput(plan, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SavePlan(plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// AssignPlan sets the user's plan; nil reverts to the default plan.
+func (s *StorageService) AssignPlan(userID uint, planID *uint) error {
+	if planID != nil {
+		if _, err := s.repo.FindPlan(*planID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrStoragePlanNotFound
+			}
+			return err
+		}
+	}
+	if err := s.repo.AssignPlan(userID, planID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *StorageService) applyPlanInput(plan *models.StoragePlan, input StoragePlanInput) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || len(name) > 64 || input.QuotaBytes <= 0 || input.MaxFileBytes < 0 {
+		return ErrInvalidStoragePlan
+	}
+
+	plans, err := s.repo.ListPlans()
+	if err != nil {
+		return err
+	}
+	for _, p := range plans {
+		if p.ID != plan.ID && strings.EqualFold(p.Name, name) {
+			return ErrStoragePlanNameTaken
+		}
+	}
+
+	plan.Name = name
+	plan.QuotaBytes = input.QuotaBytes
+	plan.MaxFileBytes = input.MaxFileBytes
+	plan.IsDefault = input.IsDefault
+	return nil
+}
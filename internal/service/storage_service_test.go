@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type fakeStorageRepo struct {
+	plans     map[uint]*models.StoragePlan
+	userPlans map[uint]uint
+	usage     map[uint]models.StorageUsage
+}
+
+func newFakeStorageRepo() *fakeStorageRepo {
+	return &fakeStorageRepo{plans: map[uint]*models.StoragePlan{}, userPlans: map[uint]uint{}, usage: map[uint]models.StorageUsage{}}
+}
+
+func (f *fakeStorageRepo) ListPlans() ([]models.StoragePlan, error) {
+	var out []models.StoragePlan
+	for _, p := range f.plans {
+		out = append(out, *p)
+	}
+	return out, nil
+}
+
+func (f *fakeStorageRepo) FindPlan(id uint) (*models.StoragePlan, error) {
+	p, ok := f.plans[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return p, nil
+}
+
+func (f *fakeStorageRepo) SavePlan(plan *models.StoragePlan) error {
+	if plan.ID == 0 {
+		plan.ID = uint(len(f.plans) + 1)
+	}
+	if plan.IsDefault {
+		for _, p := range f.plans {
+			p.IsDefault = false
+		}
+	}
+	f.plans[plan.ID] = plan
+	return nil
+}
+
+func (f *fakeStorageRepo) AssignPlan(userID uint, planID *uint) error {
+	if planID == nil {
+		delete(f.userPlans, userID)
+	} else {
+		f.userPlans[userID] = *planID
+	}
+	return nil
+}
+
+func (f *fakeStorageRepo) PlanForUser(userID uint) (*models.StoragePlan, error) {
+	if id, ok := f.userPlans[userID]; ok {
+		return f.plans[id], nil
+	}
+	for _, p := range f.plans {
+		if p.IsDefault {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeStorageRepo) GetUsage(userID uint) (models.StorageUsage, error) {
+	return f.usage[userID], nil
+}
+
+func (f *fakeStorageRepo) SaveAvatarWithinQuota(user *models.User, quotaBytes int64) error {
+	if quotaBytes > 0 && f.usage[user.ID].AttachmentBytes+user.AvatarSizeBytes > quotaBytes {
+		return ErrStorageQuotaExceeded
+	}
+	u := f.usage[user.ID]
+	u.AvatarBytes = user.AvatarSizeBytes
+	f.usage[user.ID] = u
+	return nil
+}
+
+func TestStorageService_Limits(t *testing.T) {
+	t.Setenv("STORAGE_DEFAULT_QUOTA_BYTES", "1000")
+	t.Setenv("ATTACHMENT_MAX_BYTES", "500")
+	repo := newFakeStorageRepo()
+	svc := NewStorageService(repo)
+
+	repo.usage[1] = models.StorageUsage{AvatarBytes: 100, AttachmentBytes: 800, AttachmentCount: 3}
+	if _, err := svc.CheckUpload(1, 100); err != nil {
+		t.Fatalf("upload within default quota: %v", err)
+	}
+	if _, err := svc.CheckUpload(1, 101); !errors.Is(err, ErrStorageQuotaExceeded) {
+		t.Fatalf("err = %v, want ErrStorageQuotaExceeded", err)
+	}
+	if _, err := svc.CheckUpload(2, 501); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("err = %v, want ErrAttachmentTooLarge", err)
+	}
+
+	pro, err := svc.CreatePlan(StoragePlanInput{Name: "pro", QuotaBytes: 5000, MaxFileBytes: 200})
+	if err != nil {
+		t.Fatalf("CreatePlan: %v", err)
+	}
+	if _, err := svc.CreatePlan(StoragePlanInput{Name: "PRO", QuotaBytes: 1}); !errors.Is(err, ErrStoragePlanNameTaken) {
+		t.Fatalf("duplicate plan err = %v", err)
+	}
+	if err := svc.AssignPlan(1, &pro.ID); err != nil {
+		t.Fatalf("AssignPlan: %v", err)
+	}
+
+	usage, err := svc.Usage(1)
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.Plan == nil || usage.Plan.Name != "pro" || usage.QuotaBytes != 5000 || usage.MaxFileBytes != 200 {
+		t.Fatalf("usage limits = %+v", usage)
+	}
+	if usage.UsedBytes != 900 || usage.RemainingBytes != 4100 {
+		t.Fatalf("usage = %+v", usage)
+	}
+	if _, err := svc.CheckUpload(1, 300); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("plan max file err = %v", err)
+	}
+
+	if err := svc.SaveAvatar(&models.User{ID: 2, AvatarSizeBytes: 2000}); !errors.Is(err, ErrStorageQuotaExceeded) {
+		t.Fatalf("avatar over default quota err = %v", err)
+	}
+}
@@ -2,9 +2,12 @@ package service
 
 import (
 	"errors"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/noteduco342/OMMessenger-backend/internal/models"
+	"gorm.io/gorm"
 )
 
 // MockUserRepository is a mock implementation of UserRepository for testing
@@ -44,14 +47,24 @@ func (m *MockUserRepository) FindByUsername(username string) (*models.User, erro
 			return user, nil
 		}
 	}
-	return nil, errors.New("record not found")
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *MockUserRepository) FindByUsernames(usernames []string) ([]models.User, error) {
+	var result []models.User
+	for _, user := range m.users {
+		if slices.Contains(usernames, strings.ToLower(user.Username)) {
+			result = append(result, *user)
+		}
+	}
+	return result, nil
 }
 
 func (m *MockUserRepository) FindByID(id uint) (*models.User, error) {
 	if user, ok := m.users[id]; ok {
 		return user, nil
 	}
-	return nil, errors.New("record not found")
+	return nil, gorm.ErrRecordNotFound
 }
 
 func (m *MockUserRepository) Update(user *models.User) error {
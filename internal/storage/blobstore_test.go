@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestBlobStores(t *testing.T) {
+	fsStore, err := NewFSStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSStorage: %v", err)
+	}
+
+	stores := []struct {
+		name  string
+		store BlobStore
+	}{
+		{"memory", NewMemoryStorage()},
+		{"fs", fsStore},
+	}
+
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := tt.store
+			payload := []byte("hello blob")
+
+			st, err := s.Put(ctx, "avatars/1/a.jpg", bytes.NewReader(payload), int64(len(payload)), "image/jpeg")
+			if err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if st.Size != int64(len(payload)) || st.ETag == "" {
+				t.Fatalf("Put stat = %+v", st)
+			}
+			if _, err := s.Put(ctx, "media/x.bin", bytes.NewReader(payload), int64(len(payload)), ""); err != nil {
+				t.Fatalf("Put second: %v", err)
+			}
+
+			rc, got, err := s.Get(ctx, "avatars/1/a.jpg")
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			body, _ := io.ReadAll(rc)
+			rc.Close()
+			if !bytes.Equal(body, payload) {
+				t.Fatalf("Get body = %q", body)
+			}
+			if got.ContentType != "image/jpeg" {
+				t.Fatalf("content type = %q", got.ContentType)
+			}
+
+			rc, _, err = s.GetRange(ctx, "avatars/1/a.jpg", 6, 100)
+			if err != nil {
+				t.Fatalf("GetRange: %v", err)
+			}
+			body, _ = io.ReadAll(rc)
+			rc.Close()
+			if string(body) != "blob" {
+				t.Fatalf("GetRange body = %q", body)
+			}
+
+			var keys []string
+			if err := s.List(ctx, "avatars/", func(o ObjectStat) error {
+				keys = append(keys, o.Key)
+				return nil
+			}); err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(keys) != 1 || keys[0] != "avatars/1/a.jpg" {
+				t.Fatalf("List keys = %v", keys)
+			}
+
+			if err := s.Delete(ctx, "avatars/1/a.jpg"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := s.Stat(ctx, "avatars/1/a.jpg"); !errors.Is(err, ErrObjectNotFound) {
+				t.Fatalf("Stat after delete err = %v, want ErrObjectNotFound", err)
+			}
+			if _, err := s.Put(ctx, "../escape", bytes.NewReader(payload), 1, ""); err == nil {
+				t.Fatalf("expected traversal key to be rejected")
+			}
+			if _, err := s.Presign(ctx, "media/x.bin", 0); !errors.Is(err, ErrPresignUnsupported) {
+				t.Fatalf("Presign err = %v", err)
+			}
+		})
+	}
+}
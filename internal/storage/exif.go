@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// EXIF orientation values (TIFF tag 0x0112). 1 means "already upright".
+const (
+	OrientationNormal      = 1
+	OrientationFlipH       = 2
+	OrientationRotate180   = 3
+	OrientationFlipV       = 4
+	OrientationTranspose   = 5
+	OrientationRotate90CW  = 6
+	OrientationTransverse  = 7
+	OrientationRotate90CCW = 8
+)
+
+const exifHeaderPrefix = "Exif\x00\x00"
+
+// ReadOrientation extracts the EXIF orientation from a JPEG, PNG (eXIf chunk)
+// or WebP (EXIF chunk) file. It returns OrientationNormal when the file has no
+// EXIF data or the tag is missing/invalid.
+func ReadOrientation(data []byte) int {
+	tiff := findExifTIFF(data)
+	if tiff == nil {
+		return OrientationNormal
+	}
+	o := parseTIFFOrientation(tiff)
+	if o < OrientationNormal || o > OrientationRotate90CCW {
+		return OrientationNormal
+	}
+	return o
+}
+
+// findExifTIFF returns the raw TIFF structure embedded in the container, or nil.
+func findExifTIFF(data []byte) []byte {
+	ct, err := detectMagic(data)
+	if err != nil {
+		return nil
+	}
+	switch ct {
+	case "image/jpeg":
+		return findJPEGExif(data)
+	case "image/png":
+		return findPNGExif(data)
+	case "image/webp":
+		return findWebPExif(data)
+	}
+	return nil
+}
+
+func findJPEGExif(data []byte) []byte {
+	var found []byte
+	walkJPEGSegments(data, func(marker byte, payload []byte) bool {
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte(exifHeaderPrefix)) {
+			found = payload[len(exifHeaderPrefix):]
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// walkJPEGSegments calls fn for every marker segment before the image data
+// (SOS). fn returns false to stop early. Malformed input simply ends the walk.
+func walkJPEGSegments(data []byte, fn func(marker byte, payload []byte) bool) {
+	i := 2 // skip SOI
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // fill byte
+			i++
+			continue
+		}
+		// SOS / EOI: no more metadata segments.
+		if marker == 0xDA || marker == 0xD9 {
+			return
+		}
+		// RSTn markers carry no length.
+		if marker >= 0xD0 && marker <= 0xD7 {
+			i += 2
+			continue
+		}
+		segLen := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if segLen < 2 || i+2+segLen > len(data) {
+			return
+		}
+		if !fn(marker, data[i+4:i+2+segLen]) {
+			return
+		}
+		i += 2 + segLen
+	}
+}
+
+func findPNGExif(data []byte) []byte {
+	var found []byte
+	walkPNGChunks(data, func(typ string, payload []byte) bool {
+		if typ == "eXIf" {
+			found = payload
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// walkPNGChunks calls fn for every chunk after the PNG signature.
+func walkPNGChunks(data []byte, fn func(typ string, payload []byte) bool) {
+	i := 8 // PNG signature
+	for i+8 <= len(data) {
+		n := int(binary.BigEndian.Uint32(data[i : i+4]))
+		if n < 0 || i+12+n > len(data) {
+			return
+		}
+		typ := string(data[i+4 : i+8])
+		if !fn(typ, data[i+8:i+8+n]) {
+			return
+		}
+		if typ == "IEND" {
+			return
+		}
+		i += 12 + n
+	}
+}
+
+func findWebPExif(data []byte) []byte {
+	var found []byte
+	walkWebPChunks(data, func(fourCC string, payload []byte) bool {
+		if fourCC == "EXIF" {
+			found = bytes.TrimPrefix(payload, []byte(exifHeaderPrefix))
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// walkWebPChunks calls fn for every top-level RIFF chunk in a WebP file.
+func walkWebPChunks(data []byte, fn func(fourCC string, payload []byte) bool) {
+	i := 12 // RIFF....WEBP
+	for i+8 <= len(data) {
+		fourCC := string(data[i : i+4])
+		n := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		if n < 0 || i+8+n > len(data) {
+			return
+		}
+		if !fn(fourCC, data[i+8:i+8+n]) {
+			return
+		}
+		i += 8 + n + n&1
+	}
+}
+
+// parseTIFFOrientation reads tag 0x0112 from IFD0 of a TIFF structure.
+func parseTIFFOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	if order.Uint16(tiff[2:4]) != 42 {
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	if count > 512 {
+		count = 512
+	}
+	for n := 0; n < count; n++ {
+		off := ifd + 2 + n*12
+		if off+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[off:off+2]) != 0x0112 {
+			continue
+		}
+		// Orientation must be a SHORT (type 3).
+		if order.Uint16(tiff[off+2:off+4]) != 3 {
+			return 0
+		}
+		return int(order.Uint16(tiff[off+8 : off+10]))
+	}
+	return 0
+}
+
+// ApplyOrientation returns img transformed so that it displays upright given
+// the EXIF orientation value. Orientation 1 (or unknown) returns img unchanged.
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= OrientationNormal || orientation > OrientationRotate90CCW {
+		return img
+	}
+
+	b := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	w, h := b.Dx(), b.Dy()
+
+	swap := orientation >= OrientationTranspose
+	dw, dh := w, h
+	if swap {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case OrientationFlipH:
+				dx, dy = w-1-x, y
+			case OrientationRotate180:
+				dx, dy = w-1-x, h-1-y
+			case OrientationFlipV:
+				dx, dy = x, h-1-y
+			case OrientationTranspose:
+				dx, dy = y, x
+			case OrientationRotate90CW:
+				dx, dy = h-1-y, x
+			case OrientationTransverse:
+				dx, dy = h-1-y, w-1-x
+			case OrientationRotate90CCW:
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
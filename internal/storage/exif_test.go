@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// tiffWithOrientation builds a minimal little-endian TIFF with IFD0 holding only
+// the orientation tag.
+func tiffWithOrientation(o uint16) []byte {
+	b := make([]byte, 8+2+12+4)
+	copy(b, "II")
+	binary.LittleEndian.PutUint16(b[2:], 42)
+	binary.LittleEndian.PutUint32(b[4:], 8)
+	binary.LittleEndian.PutUint16(b[8:], 1)
+	binary.LittleEndian.PutUint16(b[10:], 0x0112)
+	binary.LittleEndian.PutUint16(b[12:], 3)
+	binary.LittleEndian.PutUint32(b[14:], 1)
+	binary.LittleEndian.PutUint16(b[18:], o)
+	return b
+}
+
+func jpegWithOrientation(t *testing.T, w, h int, o uint16) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("jpeg encode: %v", err)
+	}
+	raw := buf.Bytes()
+
+	payload := append([]byte(exifHeaderPrefix), tiffWithOrientation(o)...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	seg = append(seg, payload...)
+
+	out := append([]byte{}, raw[:2]...)
+	out = append(out, seg...)
+	return append(out, raw[2:]...)
+}
+
+func pngWithChunk(t *testing.T, img image.Image, typ string, payload []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png encode: %v", err)
+	}
+	raw := buf.Bytes()
+
+	chunk := make([]byte, 8, 12+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, payload...)
+	crc := crc32.ChecksumIEEE(chunk[4:])
+	chunk = binary.BigEndian.AppendUint32(chunk, crc)
+
+	// Insert right after IHDR (8 signature + 25 IHDR).
+	out := append([]byte{}, raw[:33]...)
+	out = append(out, chunk...)
+	return append(out, raw[33:]...)
+}
+
+func TestReadOrientation(t *testing.T) {
+	data := jpegWithOrientation(t, 4, 2, OrientationRotate90CW)
+	if got := ReadOrientation(data); got != OrientationRotate90CW {
+		t.Fatalf("orientation = %d, want %d", got, OrientationRotate90CW)
+	}
+	if !HasMetadata(data) {
+		t.Fatalf("expected EXIF segment to be detected")
+	}
+
+	pngData := pngWithChunk(t, image.NewRGBA(image.Rect(0, 0, 2, 2)), "eXIf", tiffWithOrientation(OrientationRotate180))
+	if got := ReadOrientation(pngData); got != OrientationRotate180 {
+		t.Fatalf("png orientation = %d, want %d", got, OrientationRotate180)
+	}
+
+	if got := ReadOrientation([]byte("not an image at all")); got != OrientationNormal {
+		t.Fatalf("orientation for garbage = %d, want 1", got)
+	}
+}
+
+func TestApplyOrientation_Rotate90CW(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	red := color.NRGBA{R: 255, A: 255}
+	src.Set(0, 0, red) // top-left
+
+	out := ApplyOrientation(src, OrientationRotate90CW)
+	if out.Bounds().Dx() != 2 || out.Bounds().Dy() != 3 {
+		t.Fatalf("dims = %dx%d, want 2x3", out.Bounds().Dx(), out.Bounds().Dy())
+	}
+	// Top-left rotates to top-right.
+	if got := color.NRGBAModel.Convert(out.At(1, 0)).(color.NRGBA); got != red {
+		t.Fatalf("pixel (1,0) = %v, want red", got)
+	}
+}
+
+func TestProcessAvatarImage_AppliesOrientationAndStripsExif(t *testing.T) {
+	data := jpegWithOrientation(t, 40, 20, OrientationRotate90CW)
+
+	out, ct, _, err := ProcessAvatarImage(bytes.NewReader(data), DefaultAvatarOptions())
+	if err != nil {
+		t.Fatalf("ProcessAvatarImage: %v", err)
+	}
+	if ct != "image/jpeg" {
+		t.Fatalf("content type = %q, want image/jpeg", ct)
+	}
+	if HasMetadata(out) {
+		t.Fatalf("output still carries metadata")
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("jpeg decode: %v", err)
+	}
+	if decoded.Bounds().Dx() != 20 || decoded.Bounds().Dy() != 40 {
+		t.Fatalf("dims = %dx%d, want 20x40", decoded.Bounds().Dx(), decoded.Bounds().Dy())
+	}
+}
+
+func TestProcessAvatarImage_PNGOptIn(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	img.Set(1, 1, color.NRGBA{G: 255, A: 128})
+	data := pngWithChunk(t, img, "tEXt", []byte("Comment\x00secret"))
+
+	opts := DefaultAvatarOptions()
+	opts.AllowPNG = true
+	out, ct, _, err := ProcessAvatarImage(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatalf("ProcessAvatarImage: %v", err)
+	}
+	if ct != "image/png" {
+		t.Fatalf("content type = %q, want image/png", ct)
+	}
+	if HasMetadata(out) {
+		t.Fatalf("output still carries metadata")
+	}
+	decoded, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("png decode: %v", err)
+	}
+	if _, _, _, a := decoded.At(0, 0).RGBA(); a != 0 {
+		t.Fatalf("transparency lost: alpha = %d", a)
+	}
+}
+
+func TestStripWebPMetadata(t *testing.T) {
+	chunk := func(fourCC string, payload []byte) []byte {
+		b := make([]byte, 8, 8+len(payload)+1)
+		copy(b, fourCC)
+		binary.LittleEndian.PutUint32(b[4:], uint32(len(payload)))
+		b = append(b, payload...)
+		if len(payload)&1 == 1 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	vp8x := make([]byte, 10)
+	vp8x[0] = vp8xFlagEXIF | vp8xFlagICC | 0x10 // alpha flag must survive
+	body := []byte("WEBP")
+	body = append(body, chunk("VP8X", vp8x)...)
+	body = append(body, chunk("ICCP", []byte("icc"))...)
+	body = append(body, chunk("VP8L", []byte{0x2f, 0, 0, 0, 0})...)
+	body = append(body, chunk("EXIF", tiffWithOrientation(1))...)
+	data := append([]byte("RIFF\x00\x00\x00\x00"), body...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(body)))
+
+	if !HasMetadata(data) {
+		t.Fatalf("expected metadata in source")
+	}
+	out, err := StripWebPMetadata(data)
+	if err != nil {
+		t.Fatalf("StripWebPMetadata: %v", err)
+	}
+	if HasMetadata(out) {
+		t.Fatalf("metadata survived stripping")
+	}
+	if got := binary.LittleEndian.Uint32(out[4:]); int(got) != len(out)-8 {
+		t.Fatalf("RIFF size = %d, want %d", got, len(out)-8)
+	}
+	if out[20] != 0x10 {
+		t.Fatalf("VP8X flags = %#x, want 0x10", out[20])
+	}
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FSStorage stores objects as plain files under a root directory. It is meant
+// for local development and single-node deployments without MinIO.
+type FSStorage struct {
+	root string
+}
+
+func NewFSStorage(root string) (*FSStorage, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0o750); err != nil {
+		return nil, err
+	}
+	return &FSStorage{root: abs}, nil
+}
+
+func (s *FSStorage) pathFor(key string) (string, string, error) {
+	key, err := validateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	p := filepath.Join(s.root, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, s.root+string(os.PathSeparator)) {
+		return "", "", errors.New("invalid key")
+	}
+	return key, p, nil
+}
+
+// statFor derives object metadata from the file. Content type comes from the
+// key's extension; the ETag is size+mtime, which is what static servers use.
+func (s *FSStorage) statFor(key string, info fs.FileInfo) ObjectStat {
+	ct := mime.TypeByExtension(path.Ext(key))
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	return ObjectStat{
+		Key:          key,
+		ETag:         strconv.FormatInt(info.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(info.Size(), 16),
+		Size:         info.Size(),
+		ContentType:  ct,
+		LastModified: info.ModTime().UTC(),
+	}
+}
+
+func (s *FSStorage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (ObjectStat, error) {
+	key, p, err := s.pathFor(key)
+	if err != nil {
+		return ObjectStat{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return ObjectStat{}, err
+	}
+
+	// Write to a temp file and rename so readers never see partial objects.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return ObjectStat{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return ObjectStat{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return ObjectStat{}, err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return ObjectStat{}, err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return ObjectStat{}, err
+	}
+	st := s.statFor(key, info)
+	if contentType != "" {
+		st.ContentType = contentType
+	}
+	return st, nil
+}
+
+func (s *FSStorage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectStat, error) {
+	key, p, err := s.pathFor(key)
+	if err != nil {
+		return nil, ObjectStat{}, ErrObjectNotFound
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ObjectStat{}, ErrObjectNotFound
+		}
+		return nil, ObjectStat{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, ObjectStat{}, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, ObjectStat{}, ErrObjectNotFound
+	}
+	return f, s.statFor(key, info), nil
+}
+
+func (s *FSStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, ObjectStat, error) {
+	if offset < 0 || length <= 0 {
+		return nil, ObjectStat{}, fmt.Errorf("invalid range offset=%d length=%d", offset, length)
+	}
+	f, st, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, ObjectStat{}, err
+	}
+	if offset >= st.Size {
+		f.Close()
+		return nil, ObjectStat{}, fmt.Errorf("invalid range offset=%d size=%d", offset, st.Size)
+	}
+	file := f.(*os.File)
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(file, offset, length), file}, st, nil
+}
+
+func (s *FSStorage) Stat(ctx context.Context, key string) (ObjectStat, error) {
+	key, p, err := s.pathFor(key)
+	if err != nil {
+		return ObjectStat{}, ErrObjectNotFound
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ObjectStat{}, ErrObjectNotFound
+		}
+		return ObjectStat{}, err
+	}
+	if info.IsDir() {
+		return ObjectStat{}, ErrObjectNotFound
+	}
+	return s.statFor(key, info), nil
+}
+
+func (s *FSStorage) Delete(ctx context.Context, key string) error {
+	_, p, err := s.pathFor(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FSStorage) List(ctx context.Context, prefix string, fn func(ObjectStat) error) error {
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(s.statFor(key, info))
+	})
+	if err != nil {
+		return fmt.Errorf("list %q: %w", prefix, err)
+	}
+	return nil
+}
+
+func (s *FSStorage) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
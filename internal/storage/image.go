@@ -26,6 +26,13 @@ type ImageProcessOptions struct {
 	JPEGQuality int
 	// If source has alpha (e.g. PNG), flatten onto this background.
 	FlattenBackground colorRGB
+	// AllowPNG keeps transparent sources transparent by encoding them as PNG
+	// instead of flattening to JPEG. Opaque images are always stored as JPEG.
+	AllowPNG bool
+	// AllowWebP stores transparent WebP sources as WebP when no orientation
+	// or scaling is needed; the original bitstream is kept and only metadata
+	// chunks are dropped.
+	AllowWebP bool
 }
 
 type colorRGB struct{ R, G, B uint8 }
@@ -61,8 +68,10 @@ func detectMagic(header []byte) (string, error) {
 	return "", ErrUnsupported
 }
 
-// ProcessAvatarImage reads an uploaded image, validates, decodes, downscales to fit within MaxDim,
-// and encodes as JPEG. It never upscales.
+// ProcessAvatarImage reads an uploaded image, validates, decodes, applies the EXIF
+// orientation, downscales to fit within MaxDim and re-encodes it. It never upscales.
+// Output is JPEG unless the source is transparent and AllowPNG/AllowWebP opt in.
+// Metadata (EXIF, XMP, ICC, text chunks) never survives into the returned bytes.
 func ProcessAvatarImage(r io.Reader, opts ImageProcessOptions) ([]byte, string, int64, error) {
 	if opts.MaxBytes <= 0 {
 		opts.MaxBytes = 5 * 1024 * 1024
@@ -107,6 +116,10 @@ func ProcessAvatarImage(r io.Reader, opts ImageProcessOptions) ([]byte, string,
 		return nil, "", 0, fmt.Errorf("decode: %w", err)
 	}
 
+	// Rotate/flip before computing the target size so portrait photos stay portrait.
+	orientation := ReadOrientation(data)
+	img = ApplyOrientation(img, orientation)
+
 	bounds := img.Bounds()
 	w := bounds.Dx()
 	h := bounds.Dy()
@@ -133,19 +146,69 @@ func ProcessAvatarImage(r io.Reader, opts ImageProcessOptions) ([]byte, string,
 		}
 	}
 
-	dstRect := image.Rect(0, 0, tw, th)
-	// Flatten onto opaque RGBA.
-	dst := image.NewRGBA(dstRect)
-	bg := image.NewUniform(color.RGBA{R: opts.FlattenBackground.R, G: opts.FlattenBackground.G, B: opts.FlattenBackground.B, A: 255})
-	draw.Draw(dst, dst.Bounds(), bg, image.Point{}, draw.Src)
+	transparent := !isOpaque(img)
+
+	var (
+		out         []byte
+		contentType string
+	)
+	switch {
+	case transparent && opts.AllowWebP && srcType == "image/webp" && orientation == OrientationNormal && tw == w && th == h:
+		out, err = StripWebPMetadata(data)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		contentType = "image/webp"
+	case transparent && opts.AllowPNG:
+		dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, dst); err != nil {
+			return nil, "", 0, fmt.Errorf("encode: %w", err)
+		}
+		out, contentType = buf.Bytes(), "image/png"
+	default:
+		dstRect := image.Rect(0, 0, tw, th)
+		// Flatten onto opaque RGBA.
+		dst := image.NewRGBA(dstRect)
+		bg := image.NewUniform(color.RGBA{R: opts.FlattenBackground.R, G: opts.FlattenBackground.G, B: opts.FlattenBackground.B, A: 255})
+		draw.Draw(dst, dst.Bounds(), bg, image.Point{}, draw.Src)
+
+		// Scale/draw.
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+		// Encode JPEG.
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: opts.JPEGQuality}); err != nil {
+			return nil, "", 0, fmt.Errorf("encode: %w", err)
+		}
+		out, contentType = buf.Bytes(), "image/jpeg"
+	}
 
-	// Scale/draw.
-	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	// Final guard: nothing identifying may reach storage.
+	if HasMetadata(out) {
+		return nil, "", 0, ErrMetadataPresent
+	}
+	return out, contentType, int64(len(out)), nil
+}
+
+// ExtensionForContentType returns the file extension used for stored images.
+func ExtensionForContentType(contentType string) string {
+	switch contentType {
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".jpg"
+	}
+}
 
-	// Encode JPEG.
-	var out bytes.Buffer
-	if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: opts.JPEGQuality}); err != nil {
-		return nil, "", 0, fmt.Errorf("encode: %w", err)
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
 	}
-	return out.Bytes(), "image/jpeg", int64(out.Len()), nil
+	// Unknown image type: assume alpha may be present.
+	return false
 }
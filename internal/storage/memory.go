@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryObject struct {
+	data []byte
+	stat ObjectStat
+}
+
+// MemoryStorage keeps objects in process memory. Contents are lost on restart.
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{objects: make(map[string]memoryObject)}
+}
+
+func (s *MemoryStorage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (ObjectStat, error) {
+	key, err := validateKey(key)
+	if err != nil {
+		return ObjectStat{}, err
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return ObjectStat{}, err
+	}
+	sum := md5.Sum(data)
+	st := ObjectStat{
+		Key:          key,
+		ETag:         hex.EncodeToString(sum[:]),
+		Size:         int64(len(data)),
+		ContentType:  contentType,
+		LastModified: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	s.objects[key] = memoryObject{data: data, stat: st}
+	s.mu.Unlock()
+	return st, nil
+}
+
+func (s *MemoryStorage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectStat, error) {
+	s.mu.RLock()
+	obj, ok := s.objects[strings.TrimLeft(key, "/")]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ObjectStat{}, ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), obj.stat, nil
+}
+
+func (s *MemoryStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, ObjectStat, error) {
+	s.mu.RLock()
+	obj, ok := s.objects[strings.TrimLeft(key, "/")]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ObjectStat{}, ErrObjectNotFound
+	}
+	size := int64(len(obj.data))
+	if offset < 0 || length <= 0 || offset >= size {
+		return nil, ObjectStat{}, fmt.Errorf("invalid range offset=%d length=%d size=%d", offset, length, size)
+	}
+	end := min(offset+length, size)
+	return io.NopCloser(bytes.NewReader(obj.data[offset:end])), obj.stat, nil
+}
+
+func (s *MemoryStorage) Stat(ctx context.Context, key string) (ObjectStat, error) {
+	s.mu.RLock()
+	obj, ok := s.objects[strings.TrimLeft(key, "/")]
+	s.mu.RUnlock()
+	if !ok {
+		return ObjectStat{}, ErrObjectNotFound
+	}
+	return obj.stat, nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	delete(s.objects, strings.TrimLeft(key, "/"))
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStorage) List(ctx context.Context, prefix string, fn func(ObjectStat) error) error {
+	s.mu.RLock()
+	stats := make([]ObjectStat, 0, len(s.objects))
+	for k, obj := range s.objects {
+		if strings.HasPrefix(k, prefix) {
+			stats = append(stats, obj.stat)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Key < stats[j].Key })
+	for _, st := range stats {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMetadataPresent is returned when an encoded image still carries metadata
+// that must never be stored (EXIF, XMP, ICC, text chunks...).
+var ErrMetadataPresent = errors.New("image metadata present after processing")
+
+// WebP VP8X feature flags for metadata-bearing chunks.
+const (
+	vp8xFlagICC  = 0x20
+	vp8xFlagEXIF = 0x08
+	vp8xFlagXMP  = 0x04
+)
+
+// HasMetadata reports whether an encoded image contains metadata segments or
+// chunks. It is used as a final guard before anything is written to storage.
+func HasMetadata(data []byte) bool {
+	ct, err := detectMagic(data)
+	if err != nil {
+		return false
+	}
+	found := false
+	switch ct {
+	case "image/jpeg":
+		walkJPEGSegments(data, func(marker byte, payload []byte) bool {
+			// APP1..APP15 (EXIF, XMP, ICC, IPTC, ...) and COM.
+			if (marker >= 0xE1 && marker <= 0xEF) || marker == 0xFE {
+				found = true
+				return false
+			}
+			return true
+		})
+	case "image/png":
+		walkPNGChunks(data, func(typ string, payload []byte) bool {
+			switch typ {
+			case "eXIf", "iCCP", "tEXt", "zTXt", "iTXt", "tIME":
+				found = true
+				return false
+			}
+			return true
+		})
+	case "image/webp":
+		walkWebPChunks(data, func(fourCC string, payload []byte) bool {
+			switch fourCC {
+			case "EXIF", "XMP ", "ICCP":
+				found = true
+				return false
+			}
+			return true
+		})
+	}
+	return found
+}
+
+// StripWebPMetadata rewrites a WebP container without its EXIF, XMP and ICC
+// chunks, leaving the image bitstream untouched. The VP8X feature flags are
+// cleared accordingly so decoders don't look for the removed chunks.
+func StripWebPMetadata(data []byte) ([]byte, error) {
+	if ct, err := detectMagic(data); err != nil || ct != "image/webp" {
+		return nil, ErrInvalidImage
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	walkWebPChunks(data, func(fourCC string, payload []byte) bool {
+		switch fourCC {
+		case "EXIF", "XMP ", "ICCP":
+			return true
+		}
+		chunk := payload
+		if fourCC == "VP8X" && len(payload) > 0 {
+			chunk = append([]byte(nil), payload...)
+			chunk[0] &^= vp8xFlagICC | vp8xFlagEXIF | vp8xFlagXMP
+		}
+		var hdr [8]byte
+		copy(hdr[:4], fourCC)
+		binary.LittleEndian.PutUint32(hdr[4:], uint32(len(chunk)))
+		body.Write(hdr[:])
+		body.Write(chunk)
+		if len(chunk)&1 == 1 {
+			body.WriteByte(0)
+		}
+		return true
+	})
+
+	out := make([]byte, 8, 8+body.Len())
+	copy(out, "RIFF")
+	binary.LittleEndian.PutUint32(out[4:], uint32(body.Len()))
+	out = append(out, body.Bytes()...)
+	return out, nil
+}
@@ -68,14 +68,9 @@ func NewS3Storage(cfg S3Config) (*S3Storage, error) {
 	return &S3Storage{client: cl, bucket: cfg.Bucket}, nil
 }
 
-type ObjectStat struct {
-	ETag         string
-	Size         int64
-	ContentType  string
-	LastModified time.Time
-}
+var _ BlobStore = (*S3Storage)(nil)
 
-func (s *S3Storage) PutObject(ctx context.Context, key string, body io.Reader, size int64, contentType string) (ObjectStat, error) {
+func (s *S3Storage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (ObjectStat, error) {
 	info, err := s.client.PutObject(ctx, s.bucket, key, body, size, minio.PutObjectOptions{
 		ContentType: contentType,
 	})
@@ -83,34 +78,93 @@ func (s *S3Storage) PutObject(ctx context.Context, key string, body io.Reader, s
 		return ObjectStat{}, err
 	}
 	// minio-go returns ETag without quotes typically.
-	return ObjectStat{ETag: info.ETag, Size: info.Size, ContentType: contentType, LastModified: time.Now().UTC()}, nil
+	return ObjectStat{Key: key, ETag: info.ETag, Size: info.Size, ContentType: contentType, LastModified: time.Now().UTC()}, nil
 }
 
-func (s *S3Storage) GetObject(ctx context.Context, key string) (*minio.Object, ObjectStat, error) {
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectStat, error) {
 	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
 	if err != nil {
-		return nil, ObjectStat{}, err
+		return nil, ObjectStat{}, mapS3Error(err)
 	}
 	st, err := obj.Stat()
 	if err != nil {
 		_ = obj.Close()
+		return nil, ObjectStat{}, mapS3Error(err)
+	}
+	return obj, objectStatFromInfo(st), nil
+}
+
+func (s *S3Storage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, ObjectStat, error) {
+	if offset < 0 || length <= 0 {
+		return nil, ObjectStat{}, fmt.Errorf("invalid range offset=%d length=%d", offset, length)
+	}
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
 		return nil, ObjectStat{}, err
 	}
-	return obj, ObjectStat{ETag: st.ETag, Size: st.Size, ContentType: st.ContentType, LastModified: st.LastModified}, nil
+	obj, err := s.client.GetObject(ctx, s.bucket, key, opts)
+	if err != nil {
+		return nil, ObjectStat{}, mapS3Error(err)
+	}
+	st, err := obj.Stat()
+	if err != nil {
+		_ = obj.Close()
+		return nil, ObjectStat{}, mapS3Error(err)
+	}
+	return obj, objectStatFromInfo(st), nil
 }
 
-func (s *S3Storage) StatObject(ctx context.Context, key string) (ObjectStat, error) {
+func (s *S3Storage) Stat(ctx context.Context, key string) (ObjectStat, error) {
 	st, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
 	if err != nil {
-		return ObjectStat{}, err
+		return ObjectStat{}, mapS3Error(err)
 	}
-	return ObjectStat{ETag: st.ETag, Size: st.Size, ContentType: st.ContentType, LastModified: st.LastModified}, nil
+	return objectStatFromInfo(st), nil
 }
 
-func (s *S3Storage) DeleteObject(ctx context.Context, key string) error {
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
 	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
 }
 
+func (s *S3Storage) List(ctx context.Context, prefix string, fn func(ObjectStat) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the listing goroutine if fn bails out early
+
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return info.Err
+		}
+		if err := fn(objectStatFromInfo(info)); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *S3Storage) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, url.Values{})
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func objectStatFromInfo(info minio.ObjectInfo) ObjectStat {
+	return ObjectStat{Key: info.Key, ETag: info.ETag, Size: info.Size, ContentType: info.ContentType, LastModified: info.LastModified}
+}
+
+// mapS3Error converts "no such key" responses to ErrObjectNotFound so callers
+// don't need to know about minio error types.
+func mapS3Error(err error) error {
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) {
+		if resp.StatusCode == 404 || resp.Code == "NoSuchKey" || resp.Code == "NoSuchObject" {
+			return ErrObjectNotFound
+		}
+	}
+	return err
+}
+
 // SafeJoinAvatarPath ensures we don't allow path traversal.
 func SafeJoinAvatarPath(prefix string, key string) (string, error) {
 	key = strings.TrimSpace(key)
@@ -0,0 +1,144 @@
+package unfurl
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/noteduco342/OMMessenger-backend/internal/validation"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	maxTitleLength       = 256
+	maxDescriptionLength = 512
+	maxSiteNameLength    = 128
+	maxImageURLLength    = 2048
+)
+
+// Page is how a web page describes itself.
+type Page struct {
+	Title       string
+	Description string
+	SiteName    string
+	// ImageURL is the absolute URL of the page's preview image, if any.
+	ImageURL string
+}
+
+// Empty reports whether the page says nothing worth previewing.
+func (p Page) Empty() bool {
+	return p.Title == "" && p.Description == ""
+}
+
+// The tags each field is read from, in order of preference.
+var (
+	titleKeys       = []string{"og:title", "twitter:title"}
+	descriptionKeys = []string{"og:description", "twitter:description", "description"}
+	siteNameKeys    = []string{"og:site_name", "application-name"}
+	imageKeys       = []string{"og:image:secure_url", "og:image", "og:image:url", "twitter:image", "twitter:image:src"}
+)
+
+// ParsePage reads the OpenGraph and Twitter card tags, the description and
+// the title from the head of an HTML page fetched from pageURL. charsetLabel
+// is the charset the server declared, if any; otherwise it is sniffed from
+// the document.
+func ParsePage(body []byte, charsetLabel string, pageURL *url.URL) Page {
+	contentType := "text/html"
+	if charsetLabel != "" {
+		contentType += "; charset=" + charsetLabel
+	}
+	r, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		r = bytes.NewReader(body)
+	}
+	meta, title := readHead(r)
+
+	page := Page{
+		Title:       clean(first(meta, titleKeys, title), maxTitleLength),
+		Description: clean(first(meta, descriptionKeys, ""), maxDescriptionLength),
+		SiteName:    clean(first(meta, siteNameKeys, ""), maxSiteNameLength),
+	}
+	if image := first(meta, imageKeys, ""); image != "" {
+		if u, err := pageURL.Parse(strings.TrimSpace(image)); err == nil && allowedURL(u) && len(u.String()) <= maxImageURLLength {
+			page.ImageURL = u.String()
+		}
+	}
+	return page
+}
+
+// readHead collects the meta tags, keyed by their lower-cased property or
+// name, and the title of a document. It stops at the end of the head.
+func readHead(r io.Reader) (map[string]string, string) {
+	meta := make(map[string]string)
+	var title strings.Builder
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return meta, title.String()
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				return meta, title.String()
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Body:
+				return meta, title.String()
+			case atom.Title:
+				inTitle = tt == html.StartTagToken && title.Len() == 0
+			case atom.Meta:
+				var key, content string
+				for hasAttr {
+					var k, v []byte
+					k, v, hasAttr = z.TagAttr()
+					switch string(k) {
+					case "property", "name":
+						if key == "" {
+							key = strings.ToLower(strings.TrimSpace(string(v)))
+						}
+					case "content":
+						content = string(v)
+					}
+				}
+				if _, seen := meta[key]; key != "" && !seen && strings.TrimSpace(content) != "" {
+					meta[key] = content
+				}
+			}
+		}
+	}
+}
+
+func first(meta map[string]string, keys []string, fallback string) string {
+	for _, k := range keys {
+		if v, ok := meta[k]; ok {
+			return v
+		}
+	}
+	return fallback
+}
+
+// clean collapses whitespace, which also drops line breaks and other control
+// characters, and cuts s to limit characters.
+func clean(s string, limit int) string {
+	s = strings.Join(strings.FieldsFunc(s, isSpaceOrControl), " ")
+	return validation.TrimAndLimit(s, limit)
+}
+
+func isSpaceOrControl(r rune) bool {
+	return r <= ' ' || r == 0x7f || (r >= 0x80 && r <= 0x9f) || r == 0x2028 || r == 0x2029 || r == 0xa0
+}
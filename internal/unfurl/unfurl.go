@@ -0,0 +1,187 @@
+// Package unfurl fetches the web pages messages link to and reads the
+// OpenGraph and Twitter card tags that describe them, for link previews.
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const (
+	maxRedirects = 5
+	userAgent    = "OMMessenger-LinkPreview/1.0 (+https://github.com/noteduco342/OMMessenger-backend)"
+)
+
+var (
+	ErrBlockedAddress = errors.New("address not allowed")
+	ErrInvalidURL     = errors.New("invalid url")
+	ErrTooLarge       = errors.New("response too large")
+)
+
+// Resource is a fetched page or image.
+type Resource struct {
+	// URL is where the body came from, after redirects.
+	URL         *url.URL
+	ContentType string // media type without parameters, e.g. "text/html"
+	// Charset is the charset parameter of the Content-Type header, if any.
+	Charset string
+	Body    []byte
+	// Truncated is set when the body was cut at the size limit.
+	Truncated bool
+}
+
+// Fetcher fetches http and https URLs for the unfurler. At most maxBytes of
+// the body are read; a longer body is truncated when truncate is set and an
+// ErrTooLarge otherwise.
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string, maxBytes int64, truncate bool) (*Resource, error)
+}
+
+// HTTPFetcher fetches from the public internet. Every connection, including
+// those made for redirects, is checked after DNS resolution so that a link
+// can't reach loopback, private or link-local addresses.
+type HTTPFetcher struct {
+	client *http.Client
+}
+
+// NewHTTPFetcher returns a fetcher whose requests, redirects included, time
+// out after timeout.
+func NewHTTPFetcher(timeout time.Duration) *HTTPFetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return checkAddress(address)
+		},
+	}
+	transport := &http.Transport{
+		// A proxy would make the connection on our behalf, past the check.
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          16,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	return &HTTPFetcher{client: &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if !allowedURL(req.URL) {
+				return ErrInvalidURL
+			}
+			return nil
+		},
+	}}
+}
+
+// NewClientFetcher fetches through client as is, without the address check.
+// It is meant for tests against a local server.
+func NewClientFetcher(client *http.Client) *HTTPFetcher {
+	return &HTTPFetcher{client: client}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string, maxBytes int64, truncate bool) (*Resource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !allowedURL(u) {
+		return nil, ErrInvalidURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,image/*;q=0.8")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxBytes && !truncate {
+		return nil, ErrTooLarge
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	res := &Resource{URL: resp.Request.URL, Body: body}
+	if int64(len(body)) > maxBytes {
+		if !truncate {
+			return nil, ErrTooLarge
+		}
+		res.Body, res.Truncated = body[:maxBytes], true
+	}
+	if mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		res.ContentType, res.Charset = mediaType, params["charset"]
+	}
+	return res, nil
+}
+
+func allowedURL(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Hostname() != "" && u.User == nil
+}
+
+// blockedPrefixes are the special-purpose ranges netip's predicates don't
+// cover.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay anycast
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, embeds IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001::/32"),       // Teredo, embeds IPv4
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4, embeds IPv4
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+}
+
+// checkAddress rejects a dial to an address that isn't on the public
+// internet.
+func checkAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ErrBlockedAddress
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !PublicAddr(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// PublicAddr reports whether ip is a globally routable unicast address.
+func PublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.Zone() != "" || !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
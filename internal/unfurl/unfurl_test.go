@@ -0,0 +1,134 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePage(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/posts/1")
+	tests := []struct {
+		name string
+		html string
+		want Page
+	}{
+		{"OpenGraph", `<html><head>
+			<meta property="og:title" content="Hello &amp; welcome">
+			<meta property="og:description" content="A  post
+				about things">
+			<meta property="og:site_name" content="Example">
+			<meta property="og:image" content="/img/cover.png">
+			<title>Ignored</title>
+			</head><body><meta property="og:title" content="Body"></body></html>`,
+			Page{Title: "Hello & welcome", Description: "A post about things", SiteName: "Example", ImageURL: "https://example.com/img/cover.png"}},
+		{"Twitter card", `<meta name="twitter:title" content="Card"><meta name="twitter:image" content="https://cdn.example.com/a.jpg">`,
+			Page{Title: "Card", ImageURL: "https://cdn.example.com/a.jpg"}},
+		{"Title and description", `<title> Plain
+			page </title><meta name="Description" content="About">`,
+			Page{Title: "Plain page", Description: "About"}},
+		{"First tag wins", `<meta property="og:title" content="One"><meta property="og:title" content="Two">`,
+			Page{Title: "One"}},
+		{"Unsafe image", `<meta property="og:title" content="T"><meta property="og:image" content="javascript:alert(1)">`,
+			Page{Title: "T"}},
+		{"Nothing", `<p>hi</p>`, Page{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParsePage([]byte(tt.html), "", pageURL); got != tt.want {
+				t.Errorf("ParsePage = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePageCharset(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/")
+	// "Café" in ISO-8859-1.
+	body := []byte("<title>Caf\xe9</title>")
+	if got := ParsePage(body, "iso-8859-1", pageURL); got.Title != "Café" {
+		t.Fatalf("title = %q", got.Title)
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"64:ff9b::7f00:1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := PublicAddr(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("PublicAddr(%s) = %v, want %v", tt.addr, got, tt.public)
+		}
+	}
+}
+
+func TestHTTPFetcherBlocksLocalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request reached the server: %s", r.URL)
+	}))
+	defer srv.Close()
+
+	f := NewHTTPFetcher(2 * time.Second)
+	if _, err := f.Fetch(context.Background(), srv.URL, 1024, true); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("loopback err = %v", err)
+	}
+	if _, err := f.Fetch(context.Background(), "file:///etc/passwd", 1024, true); !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("file url err = %v", err)
+	}
+}
+
+func TestFetchLimits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(strings.Repeat("a", 100)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	f := NewClientFetcher(srv.Client())
+	ctx := context.Background()
+
+	res, err := f.Fetch(ctx, srv.URL+"/redirect", 10, true)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(res.Body) != 10 || !res.Truncated || res.ContentType != "text/html" || res.Charset != "utf-8" || res.URL.Path != "/page" {
+		t.Fatalf("resource = %+v", res)
+	}
+	if _, err := f.Fetch(ctx, srv.URL+"/page", 10, false); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("too large err = %v", err)
+	}
+	if _, err := f.Fetch(ctx, srv.URL+"/missing", 10, true); err == nil {
+		t.Fatalf("expected error for 404")
+	}
+}
@@ -57,6 +57,8 @@ func ValidatePassword(password string) bool {
 	return len(password) >= PasswordMinLength()
 }
 
+// MaxMessageLength is the longest message content allowed, in characters
+// (runes), read from MAX_MESSAGE_LENGTH.
 func MaxMessageLength() int {
 	maxStr := os.Getenv("MAX_MESSAGE_LENGTH")
 	if maxStr == "" {
@@ -69,10 +71,19 @@ func MaxMessageLength() int {
 	return max
 }
 
+// TrimAndLimit trims surrounding whitespace and cuts s to at most max
+// characters, never splitting a UTF-8 sequence. A max of 0 means no limit.
 func TrimAndLimit(s string, max int) string {
 	s = strings.TrimSpace(s)
-	if max > 0 && len(s) > max {
-		return s[:max]
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	n := 0
+	for i := range s {
+		if n == max {
+			return s[:i]
+		}
+		n++
 	}
 	return s
 }
@@ -173,6 +173,10 @@ func TestTrimAndLimit(t *testing.T) {
 		{"String exceeding limit", "hello world this is too long", 10, "hello worl"},
 		{"Empty string", "", 20, ""},
 		{"String at limit", "hello", 5, "hello"},
+		{"Limit counts runes", "héllo wörld", 7, "héllo w"},
+		{"Multibyte at limit", "日本語", 3, "日本語"},
+		{"Emoji not split", "👋👋👋", 2, "👋👋"},
+		{"No limit", "  hello  ", 0, "hello"},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,30 @@
+-- Content-addressed blobs shared by identical uploads
+CREATE TABLE IF NOT EXISTS media_blobs (
+    hash VARCHAR(64) PRIMARY KEY,
+    key VARCHAR(255) NOT NULL UNIQUE,
+    size_bytes BIGINT NOT NULL,
+    content_type VARCHAR(127) NOT NULL,
+    ref_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Per-upload metadata; several attachments may point at one blob
+CREATE TABLE IF NOT EXISTS attachments (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMPTZ,
+    uploader_id BIGINT NOT NULL REFERENCES users(id),
+    blob_hash VARCHAR(64) NOT NULL,
+    file_name VARCHAR(255),
+    content_type VARCHAR(127) NOT NULL,
+    size_bytes BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_uploader_id ON attachments (uploader_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_blob_hash ON attachments (blob_hash);
+CREATE INDEX IF NOT EXISTS idx_attachments_deleted_at ON attachments (deleted_at);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS attachment_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_messages_attachment_id ON messages (attachment_id);
@@ -0,0 +1,13 @@
+-- Admin-managed storage plans; users without a plan use the default one
+CREATE TABLE IF NOT EXISTS storage_plans (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(64) NOT NULL UNIQUE,
+    quota_bytes BIGINT NOT NULL,
+    max_file_bytes BIGINT NOT NULL DEFAULT 0,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS storage_plan_id BIGINT REFERENCES storage_plans(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_users_storage_plan_id ON users (storage_plan_id);
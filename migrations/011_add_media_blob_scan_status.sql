@@ -0,0 +1,5 @@
+-- Malware scan state per stored blob; existing content predates scanning
+ALTER TABLE media_blobs ADD COLUMN IF NOT EXISTS scan_status VARCHAR(16) NOT NULL DEFAULT 'clean';
+ALTER TABLE media_blobs ADD COLUMN IF NOT EXISTS scan_signature VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE media_blobs ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_media_blobs_scan_status ON media_blobs (scan_status);
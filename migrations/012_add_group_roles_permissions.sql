@@ -0,0 +1,9 @@
+-- Per-group permission bitmaps (see models.GroupPermission) and the owner role
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS member_permissions INTEGER NOT NULL DEFAULT 3;
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS moderator_permissions INTEGER NOT NULL DEFAULT 47;
+
+-- Creators were stored as admins before the owner role existed
+UPDATE group_members gm
+SET role = 'owner'
+FROM groups g
+WHERE gm.group_id = g.id AND gm.user_id = g.creator_id AND gm.role = 'admin';
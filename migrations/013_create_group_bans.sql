@@ -0,0 +1,12 @@
+-- Users banned from a group; expires_at NULL means permanent
+CREATE TABLE IF NOT EXISTS group_bans (
+    group_id BIGINT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    banned_by BIGINT NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_bans_expires_at ON group_bans (expires_at);
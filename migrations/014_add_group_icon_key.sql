@@ -0,0 +1,2 @@
+-- Storage key of the group's icon, used to replace/delete it and by the media GC
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS icon_key VARCHAR(255) NOT NULL DEFAULT '';
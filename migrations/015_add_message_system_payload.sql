@@ -0,0 +1,2 @@
+-- Structured payload of system messages (group events); NULL for user messages
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS system JSONB;
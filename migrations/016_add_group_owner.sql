@@ -0,0 +1,9 @@
+-- Current owner of the group; creator_id keeps recording who created it
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS owner_id BIGINT;
+
+UPDATE groups g SET owner_id = COALESCE(
+    (SELECT gm.user_id FROM group_members gm WHERE gm.group_id = g.id AND gm.role = 'owner' LIMIT 1),
+    g.creator_id
+) WHERE owner_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_groups_owner_id ON groups(owner_id);
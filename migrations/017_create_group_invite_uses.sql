@@ -0,0 +1,11 @@
+-- Who joined through which invite link
+CREATE TABLE IF NOT EXISTS group_invite_uses (
+    id BIGSERIAL PRIMARY KEY,
+    link_id BIGINT NOT NULL REFERENCES group_invite_links(id) ON DELETE CASCADE,
+    group_id BIGINT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_invite_uses_link_id ON group_invite_uses (link_id);
+CREATE INDEX IF NOT EXISTS idx_group_invite_uses_group_id ON group_invite_uses (group_id);
@@ -0,0 +1,21 @@
+-- Optional approval step for public joins and invite links
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS join_requires_approval BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE group_invite_links ADD COLUMN IF NOT EXISTS requires_approval BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS group_join_requests (
+    id BIGSERIAL PRIMARY KEY,
+    group_id BIGINT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    invite_link_id BIGINT REFERENCES group_invite_links(id) ON DELETE SET NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    decided_by BIGINT,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    decided_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_join_requests_group_status ON group_join_requests (group_id, status);
+CREATE INDEX IF NOT EXISTS idx_group_join_requests_user_id ON group_join_requests (user_id);
+-- At most one open request per user and group
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_join_requests_pending
+    ON group_join_requests (group_id, user_id) WHERE status = 'pending';
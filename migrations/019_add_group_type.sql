@@ -0,0 +1,2 @@
+-- Broadcast channels are groups of type 'channel'
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS type VARCHAR(16) NOT NULL DEFAULT 'group';
@@ -0,0 +1,2 @@
+-- Minimum seconds between a non-admin member's messages; 0 disables slow mode
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS slow_mode_seconds INTEGER NOT NULL DEFAULT 0;
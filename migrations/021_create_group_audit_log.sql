@@ -0,0 +1,15 @@
+-- Append-only record of administrative actions in a group
+CREATE TABLE IF NOT EXISTS group_audit_entries (
+    id BIGSERIAL PRIMARY KEY,
+    group_id BIGINT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    actor_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    action VARCHAR(32) NOT NULL,
+    target_user_id BIGINT,
+    invite_link_id BIGINT,
+    message_id BIGINT,
+    details JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_audit_group_id ON group_audit_entries (group_id, id);
+CREATE INDEX IF NOT EXISTS idx_group_audit_actor ON group_audit_entries (group_id, actor_id);
@@ -0,0 +1,25 @@
+-- Forum topics: separate message streams inside a group
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS is_forum BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS group_topics (
+    id BIGSERIAL PRIMARY KEY,
+    group_id BIGINT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    title VARCHAR(128) NOT NULL,
+    creator_id BIGINT NOT NULL,
+    is_closed BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_topics_group_id ON group_topics (group_id);
+
+-- NULL topic_id is the group's General stream
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS topic_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_messages_topic_id ON messages (topic_id);
+
+ALTER TABLE group_audit_entries ADD COLUMN IF NOT EXISTS topic_id BIGINT;
+
+-- Read state per topic; topic_id 0 is the General stream
+ALTER TABLE group_read_states ADD COLUMN IF NOT EXISTS topic_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE group_read_states DROP CONSTRAINT IF EXISTS group_read_states_pkey;
+ALTER TABLE group_read_states ADD PRIMARY KEY (group_id, user_id, topic_id);
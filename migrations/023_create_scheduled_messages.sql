@@ -0,0 +1,22 @@
+-- Messages written now and sent later by the scheduler
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+    id BIGSERIAL PRIMARY KEY,
+    client_id VARCHAR(36) NOT NULL,
+    sender_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_id BIGINT,
+    group_id BIGINT,
+    topic_id BIGINT,
+    content TEXT NOT NULL,
+    message_type VARCHAR(20) DEFAULT 'text',
+    attachment_id BIGINT,
+    send_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error VARCHAR(64),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scheduled_client_sender ON scheduled_messages (client_id, sender_id);
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_sender_id ON scheduled_messages (sender_id);
+CREATE INDEX IF NOT EXISTS idx_scheduled_status_send_at ON scheduled_messages (status, send_at);
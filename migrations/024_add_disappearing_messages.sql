@@ -0,0 +1,21 @@
+-- Disappearing messages: per-conversation timers and per-message expiry
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS message_ttl_seconds INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS message_ttl_mode VARCHAR(8) NOT NULL DEFAULT 'send';
+
+CREATE TABLE IF NOT EXISTS direct_chat_settings (
+    user_low_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_high_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_ttl_seconds INTEGER NOT NULL DEFAULT 0,
+    message_ttl_mode VARCHAR(8) NOT NULL DEFAULT 'send',
+    updated_by BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_low_id, user_high_id)
+);
+
+-- ttl_seconds is kept so read-mode timers can start when the message is read
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS ttl_seconds INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages (expires_at) WHERE expires_at IS NOT NULL;
+-- Read-mode messages whose timer hasn't started, looked up on every group read
+CREATE INDEX IF NOT EXISTS idx_messages_ttl_unstarted ON messages (group_id, id) WHERE ttl_seconds > 0 AND expires_at IS NULL;
@@ -0,0 +1,16 @@
+-- Mentions: structured message entities and per-user unread mentions
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS entities JSONB;
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS entities JSONB;
+
+-- One row per unread mention; deleted as the user's read mark passes it
+CREATE TABLE IF NOT EXISTS group_mentions (
+    user_id BIGINT NOT NULL,
+    message_id BIGINT NOT NULL,
+    group_id BIGINT NOT NULL,
+    topic_id BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_mentions_user_topic ON group_mentions (user_id, group_id, topic_id);
+CREATE INDEX IF NOT EXISTS idx_group_mentions_message_id ON group_mentions (message_id);
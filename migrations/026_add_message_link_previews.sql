@@ -0,0 +1,6 @@
+-- Link previews: the unfurled first link of a message; NULL until fetched
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS link_preview JSONB;
+
+-- Lets media GC find the preview images messages still reference
+CREATE INDEX IF NOT EXISTS idx_messages_link_preview_image_key ON messages ((link_preview->>'image_key'))
+    WHERE link_preview IS NOT NULL;